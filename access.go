@@ -0,0 +1,65 @@
+// access.go
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// AccessMode is whether a use reads or writes the resource, see UseRead
+type AccessMode int
+
+const (
+	// AccessWrite uses are limited by the resource's limiter. It is the
+	// mode of every use but UseRead's.
+	AccessWrite AccessMode = iota
+	// AccessRead uses are limited by the WithReadLimiter limiter
+	AccessRead
+)
+
+func (m AccessMode) String() string {
+	switch m {
+	case AccessWrite:
+		return "write"
+	case AccessRead:
+		return "read"
+	}
+	return fmt.Sprintf("AccessMode(%d)", int(m))
+}
+
+// WithReadLimiter makes UseRead take its tokens from l instead of the
+// resource's limiter, e.g. to allow far more reads than writes. Reads and
+// writes share the initialization, lifecycle and any concurrency cap.
+// Close leaves l open, so it can be shared with other resources.
+func WithReadLimiter(l Limiter) Option {
+	return func(r *Resource) {
+		r.readLimiter = l
+	}
+}
+
+// UseRead is like UseFunc for a use that only reads the resource, limited
+// by the WithReadLimiter limiter if there is one
+func (r *Resource) UseRead(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.useWaiting(ctx, AccessRead, 1, fn)
+}
+
+// UseWrite is like UseFunc, which also counts as a write, for a use that
+// changes the resource
+func (r *Resource) UseWrite(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.useWaiting(ctx, AccessWrite, 1, fn)
+}
+
+// limiterFor returns the limiter uses in mode take their tokens from
+func (r *Resource) limiterFor(mode AccessMode) Limiter {
+	r.cfgMu.RLock()
+	defer r.cfgMu.RUnlock()
+
+	return r.limiterForLocked(mode)
+}
+
+func (r *Resource) limiterForLocked(mode AccessMode) Limiter {
+	if mode == AccessRead && r.readLimiter != nil {
+		return r.readLimiter
+	}
+	return r.limiter
+}
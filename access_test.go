@@ -0,0 +1,121 @@
+// access_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// holdUses starts n uses through use, each holding its token until the
+// returned func is called
+func holdUses(n int, use func(ctx context.Context, fn func(ctx context.Context) error) error) func() {
+	release := make(chan struct{})
+	started := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			use(context.Background(), func(context.Context) error {
+				started <- struct{}{}
+				<-release
+				return nil
+			})
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-started
+	}
+	return func() {
+		close(release)
+		wg.Wait()
+	}
+}
+
+func TestUseReadWriteLimits(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	lc := &lifecycle{}
+	resource := NewResource("db", 1, 60, WithClock(clock), WithInit(lc.init), WithRateLimitMode(RateLimitFailFast),
+		WithReadLimiter(newRateLimiter(3, time.Minute, 3, WithLimiterClock(clock))))
+
+	doneReads := holdUses(3, resource.UseRead)
+	defer doneReads()
+	if err := resource.UseRead(context.Background(), noWork); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected a fourth read to be refused, got %v", err)
+	}
+
+	// The reads leave the write limit alone
+	doneWrite := holdUses(1, resource.UseWrite)
+	defer doneWrite()
+	if err := resource.Use(1); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected Use to count as a write and be refused, got %v", err)
+	}
+	if err := resource.UseFunc(context.Background(), noWork); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected UseFunc to count as a write and be refused, got %v", err)
+	}
+
+	if inits, _ := lc.counts(); inits != 1 {
+		t.Errorf("Expected reads and writes to share one initialization, got %d", inits)
+	}
+	snap := resource.Inspect()
+	if snap.Limiter == nil || snap.Limiter.Current != 1 || snap.ReadLimiter == nil || snap.ReadLimiter.Current != 3 {
+		t.Errorf("Expected 1 write and 3 read tokens held, got %+v", snap)
+	}
+}
+
+func TestUseReadWithoutReadLimiter(t *testing.T) {
+	resource := NewResource("db", 1, 60, WithRateLimitMode(RateLimitFailFast))
+	done := holdUses(1, resource.UseWrite)
+	defer done()
+
+	if err := resource.UseRead(context.Background(), noWork); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected reads to share the limiter without WithReadLimiter, got %v", err)
+	}
+}
+
+func TestUseReadMetricsAndEvents(t *testing.T) {
+	resource := NewResource("db", 10, 60, WithReadLimiter(NewRateLimiter(10, 60)))
+	events, unsubscribe := resource.Subscribe(16)
+	defer unsubscribe()
+
+	resource.UseRead(context.Background(), noWork)
+	resource.UseRead(context.Background(), noWork)
+	resource.Use(1)
+	if m := resource.Metrics(); m.Uses != 3 || m.Reads != 2 {
+		t.Errorf("Expected 3 uses of which 2 reads, got %+v", m)
+	}
+
+	var modes []AccessMode
+	for _, e := range drain(events) {
+		if e.Kind == EventAcquire {
+			modes = append(modes, e.Mode)
+		}
+	}
+	if len(modes) != 3 || modes[0] != AccessRead || modes[1] != AccessRead || modes[2] != AccessWrite {
+		t.Errorf("Expected acquire events for read, read and write, got %v", modes)
+	}
+}
+
+func TestAccessModeString(t *testing.T) {
+	for mode, want := range map[AccessMode]string{AccessWrite: "write", AccessRead: "read", AccessMode(7): "AccessMode(7)"} {
+		if mode.String() != want {
+			t.Errorf("Expected %q, got %q", want, mode.String())
+		}
+	}
+}
+
+func TestCloseLeavesSharedReadLimiter(t *testing.T) {
+	reads := NewRateLimiterDuration(10, time.Hour)
+	r := NewResource("a", 10, 3600, WithReadLimiter(reads))
+	r2 := NewResource("b", 10, 3600, WithReadLimiter(reads))
+
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := r2.UseRead(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Errorf("Expected b to keep reading through the shared read limiter, got %v", err)
+	}
+}
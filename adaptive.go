@@ -0,0 +1,104 @@
+// adaptive.go
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// AdaptiveLimiter is a RateLimiter whose limit follows an AIMD loop: it
+// grows by one after a limit's worth of successes and halves when callers
+// report a failure, staying within [min, max]
+type AdaptiveLimiter struct {
+	*RateLimiter
+
+	mu           sync.Mutex
+	min, max     int
+	limit        int
+	successes    int
+	lastDecrease time.Time
+}
+
+// NewAdaptiveLimiter creates an adaptive limiter starting at initial
+// requests per window
+func NewAdaptiveLimiter(initial, min, max int, window time.Duration, opts ...LimiterOption) *AdaptiveLimiter {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	if initial < min {
+		initial = min
+	}
+	if initial > max {
+		initial = max
+	}
+	return &AdaptiveLimiter{
+		RateLimiter: newRateLimiter(initial, window, initial, opts...),
+		min:         min,
+		max:         max,
+		limit:       initial,
+	}
+}
+
+// Limit returns the current adaptive limit
+func (al *AdaptiveLimiter) Limit() int {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	return al.limit
+}
+
+// ReportSuccess records a successful downstream call. A full limit's worth
+// of successes raises the limit by one.
+func (al *AdaptiveLimiter) ReportSuccess() {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	al.successes++
+	if al.successes < al.limit || al.limit >= al.max {
+		return
+	}
+	al.successes = 0
+	al.limit++
+	al.RateLimiter.SetLimit(al.limit)
+}
+
+// ReportFailure records a failed downstream call and halves the limit. A
+// burst of failures within one window counts as a single decrease.
+func (al *AdaptiveLimiter) ReportFailure() {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	now := al.RateLimiter.clock.Now()
+	if !al.lastDecrease.IsZero() && now.Sub(al.lastDecrease) < al.RateLimiter.window {
+		return
+	}
+	al.lastDecrease = now
+	al.successes = 0
+	al.limit /= 2
+	if al.limit < al.min {
+		al.limit = al.min
+	}
+	al.RateLimiter.SetLimit(al.limit)
+}
+
+// feedbackLimiter is implemented by limiters that adapt to call outcomes
+type feedbackLimiter interface {
+	ReportSuccess()
+	ReportFailure()
+}
+
+// reportOutcome feeds the result of the resource's work back to l, the
+// limiter the use took its token from, if it is adaptive
+func (r *Resource) reportOutcome(l Limiter, err error) {
+	f, ok := l.(feedbackLimiter)
+	if !ok {
+		return
+	}
+	if err != nil {
+		f.ReportFailure()
+	} else {
+		f.ReportSuccess()
+	}
+}
@@ -0,0 +1,74 @@
+// adaptive_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiterAIMD(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewAdaptiveLimiter(4, 2, 10, time.Second, WithLimiterClock(clock))
+
+	// A full limit's worth of successes raises the limit by one
+	for i := 0; i < 4; i++ {
+		limiter.ReportSuccess()
+	}
+	if n := limiter.Limit(); n != 5 {
+		t.Fatalf("Expected the limit to grow to 5, got %d", n)
+	}
+	if n := limiter.Remaining(); n != 5 {
+		t.Errorf("Expected the underlying limiter to allow 5, got %d", n)
+	}
+
+	// Failures halve it, but only once per window
+	limiter.ReportFailure()
+	limiter.ReportFailure()
+	if n := limiter.Limit(); n != 2 {
+		t.Errorf("Expected one halving to 2, got %d", n)
+	}
+	clock.Advance(time.Second)
+	limiter.ReportFailure()
+	if n := limiter.Limit(); n != 2 {
+		t.Errorf("Expected the limit to stop at the minimum of 2, got %d", n)
+	}
+}
+
+func TestAdaptiveLimiterConverges(t *testing.T) {
+	const capacity = 20 // what the simulated downstream can take per window
+	clock := NewFakeClock(time.Now())
+	limiter := NewAdaptiveLimiter(1, 1, 100, time.Second, WithLimiterClock(clock))
+
+	for window := 0; window < 200; window++ {
+		served := 0
+		for limiter.TryAcquire() {
+			served++
+			if served > capacity {
+				limiter.ReportFailure()
+			} else {
+				limiter.ReportSuccess()
+			}
+		}
+		clock.Advance(time.Second)
+
+		// Once warmed up the limit should hover around the capacity
+		if window >= 100 {
+			if n := limiter.Limit(); n < capacity/2 || n > capacity+1 {
+				t.Fatalf("Window %d: limit %d strayed from capacity %d", window, n, capacity)
+			}
+		}
+	}
+}
+
+func TestResourceReportsToAdaptiveLimiter(t *testing.T) {
+	limiter := NewAdaptiveLimiter(1, 1, 5, time.Hour)
+	resource := NewResource("Downstream", 1, 1, WithLimiter(limiter))
+	resource.initDone = true
+
+	if err := resource.Use(1); err != nil {
+		t.Fatal(err)
+	}
+	if n := limiter.Limit(); n != 2 {
+		t.Errorf("Expected a successful use to raise the limit to 2, got %d", n)
+	}
+}
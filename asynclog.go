@@ -0,0 +1,157 @@
+// asynclog.go
+package main
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy is what an async Logger does with a message when its queue
+// is full
+type OverflowPolicy int
+
+const (
+	OverflowBlock OverflowPolicy = iota // wait for room in the queue
+	OverflowDrop                        // drop the message and count it
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDrop:
+		return "drop"
+	}
+	return "unknown"
+}
+
+// asyncWriter is the queue and writer goroutine behind an async Logger
+type asyncWriter struct {
+	mu      sync.RWMutex // held for reading to queue, for writing by Close
+	queue   chan asyncEntry
+	policy  OverflowPolicy
+	closed  bool
+	dropped atomic.Uint64
+	done    chan struct{}
+}
+
+// asyncEntry is a rendered line, or a Flush waiting for the lines ahead of
+// it
+type asyncEntry struct {
+	line    string
+	flushed chan struct{}
+}
+
+// NewAsyncLogger creates a logger like NewLogger whose messages are queued,
+// up to buffer of them, for a single goroutine to write to w, so logging
+// goroutines render their lines in parallel and never wait on w. Lines are
+// written in the order they were queued. A message arriving with the queue
+// full waits for room or is dropped, as policy says. Call Flush to wait for
+// the queue to be written, and Close once the logger is done with.
+func NewAsyncLogger(w io.Writer, buffer int, policy OverflowPolicy) *Logger {
+	a := &asyncWriter{
+		queue:  make(chan asyncEntry, max(buffer, 1)),
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+	l := &Logger{out: w, async: a}
+	go a.run(l)
+	return l
+}
+
+// Dropped returns how many messages an async logger dropped because its
+// queue was full or it was closed
+func (l *Logger) Dropped() uint64 {
+	if a := l.root().async; a != nil {
+		return a.dropped.Load()
+	}
+	return 0
+}
+
+// Flush waits until every message an async logger queued before the call
+// has been written. It returns straight away for a logger that isn't async
+// or has been closed.
+func (l *Logger) Flush() {
+	a := l.root().async
+	if a == nil {
+		return
+	}
+	flushed := make(chan struct{})
+	a.mu.RLock()
+	if a.closed {
+		a.mu.RUnlock()
+		return
+	}
+	// Even under OverflowDrop a flush waits for room rather than be lost
+	a.queue <- asyncEntry{flushed: flushed}
+	a.mu.RUnlock()
+	<-flushed
+}
+
+// Close writes out an async logger's queue and stops its goroutine. Later
+// messages are dropped. It doesn't close the writer, does nothing for a
+// logger that isn't async, and is safe to call more than once.
+func (l *Logger) Close() error {
+	a := l.root().async
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	<-a.done
+	return nil
+}
+
+// enqueue queues line as the policy says
+func (a *asyncWriter) enqueue(line string) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		a.dropped.Add(1)
+		return
+	}
+	if a.policy == OverflowBlock {
+		a.queue <- asyncEntry{line: line}
+		return
+	}
+	select {
+	case a.queue <- asyncEntry{line: line}:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// run writes queued lines to l's output, batching whatever has queued up
+// into one write
+func (a *asyncWriter) run(l *Logger) {
+	defer close(a.done)
+	var batch []byte
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		l.mu.Lock()
+		l.output().Write(batch)
+		l.mu.Unlock()
+		batch = batch[:0]
+	}
+	for e := range a.queue {
+		if e.flushed != nil {
+			write()
+			close(e.flushed)
+			continue
+		}
+		batch = append(batch, e.line...)
+		if len(a.queue) == 0 {
+			write()
+		}
+	}
+	write()
+}
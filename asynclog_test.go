@@ -0,0 +1,180 @@
+// asynclog_test.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedCapture is a CaptureWriter holding up every write until open is
+// closed
+type gatedCapture struct {
+	CaptureWriter
+	open chan struct{}
+}
+
+func (w *gatedCapture) Write(p []byte) (int, error) {
+	<-w.open
+	return w.CaptureWriter.Write(p)
+}
+
+// lineN returns the n field of a line
+func lineN(line string) int {
+	i := strings.Index(line, " n=")
+	n, _ := strconv.Atoi(line[i+len(" n="):])
+	return n
+}
+
+func TestAsyncLoggerKeepsOrder(t *testing.T) {
+	logs := &CaptureWriter{}
+	logger := NewAsyncLogger(logs, 16, OverflowBlock)
+	defer logger.Close()
+
+	for i := 0; i < 1000; i++ {
+		logger.Info("tick", NewField("n", i))
+	}
+	logger.Flush()
+
+	lines := logs.Lines()
+	if len(lines) != 1000 {
+		t.Fatalf("Expected all 1000 lines once flushed, got %d", len(lines))
+	}
+	for i, line := range lines {
+		if lineN(line) != i {
+			t.Fatalf("Expected line %d to be message %d, got %q", i, i, line)
+		}
+	}
+}
+
+func TestAsyncLoggerFlushWaits(t *testing.T) {
+	w := &gatedCapture{open: make(chan struct{})}
+	logger := NewAsyncLogger(w, 16, OverflowBlock)
+	defer logger.Close()
+
+	logger.Info("queued")
+	flushed := make(chan struct{})
+	go func() {
+		logger.Flush()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		t.Fatal("Expected Flush to wait for the writer")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(w.open)
+	<-flushed
+	if !w.Contains("msg=queued") {
+		t.Errorf("Expected the line written by the time Flush returned, got %q", w.String())
+	}
+}
+
+func TestAsyncLoggerOverflow(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowDrop, OverflowBlock} {
+		w := &gatedCapture{open: make(chan struct{})}
+		logger := NewAsyncLogger(w, 4, policy).With(ResourceField("db"))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				logger.Warn("denied", NewField("n", i))
+			}
+		}()
+		if policy == OverflowDrop {
+			<-done
+			if d := logger.Dropped(); d == 0 || d > 100-4 {
+				t.Errorf("Expected the overflow past the queue to be dropped, got %d", d)
+			}
+		} else {
+			select {
+			case <-done:
+				t.Fatal("Expected OverflowBlock to wait for room in the queue")
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+
+		close(w.open)
+		<-done
+		logger.Close()
+		lines := w.Lines()
+		if uint64(len(lines))+logger.Dropped() != 100 {
+			t.Errorf("Expected every %v message written or dropped, %d written and %d dropped", policy, len(lines), logger.Dropped())
+		}
+		if policy == OverflowBlock && len(lines) != 100 {
+			t.Errorf("Expected OverflowBlock to write all 100, got %d", len(lines))
+		}
+		for i := 1; i < len(lines); i++ {
+			if lineN(lines[i]) <= lineN(lines[i-1]) {
+				t.Fatalf("Expected the %v lines in order, got %q after %q", policy, lines[i], lines[i-1])
+			}
+		}
+	}
+}
+
+func TestAsyncLoggerClose(t *testing.T) {
+	logs := &CaptureWriter{}
+	logger := NewAsyncLogger(logs, 16, OverflowBlock)
+	logger.Info("before")
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := logger.Close(); err != nil {
+		t.Errorf("Expected a second Close to succeed, got %v", err)
+	}
+	logger.Info("after")
+	logger.Flush()
+
+	if !logs.Contains("msg=before") || logs.Contains("msg=after") {
+		t.Errorf("Expected only the message before Close written, got %q", logs.String())
+	}
+	if logger.Dropped() != 1 {
+		t.Errorf("Expected the message after Close dropped, got %d", logger.Dropped())
+	}
+	// A logger that isn't async has nothing to flush or close
+	sync := NewLogger(logs)
+	sync.Flush()
+	if sync.Close() != nil || sync.Dropped() != 0 {
+		t.Error("Expected Flush and Close to do nothing without async")
+	}
+}
+
+// benchmarkLogger logs b.N messages from 64 goroutines to the null device
+func benchmarkLogger(b *testing.B, newLogger func(w *os.File) *Logger) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+	logger := newLogger(devNull)
+	defer logger.Close()
+
+	const goroutines = 64
+	b.ReportAllocs()
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < b.N; i += goroutines {
+				logger.Info("use acquired", ResourceField("db"), CallerField(Caller{Name: fmt.Sprint("caller ", g)}))
+			}
+		}(g)
+	}
+	wg.Wait()
+	logger.Flush()
+}
+
+func BenchmarkLoggerSync(b *testing.B) {
+	benchmarkLogger(b, func(w *os.File) *Logger { return NewLogger(w) })
+}
+
+func BenchmarkLoggerAsync(b *testing.B) {
+	benchmarkLogger(b, func(w *os.File) *Logger { return NewAsyncLogger(w, 4096, OverflowBlock) })
+}
@@ -0,0 +1,188 @@
+// audit.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AuditDecision is one allow or deny decision on a use of a resource, as
+// sent to an AuditSink. It marshals to JSON with the outcome by name and
+// the retry-after in nanoseconds.
+type AuditDecision struct {
+	Time       time.Time     `json:"time"`
+	Resource   string        `json:"resource"`
+	Caller     string        `json:"caller"`
+	Outcome    Decision      `json:"outcome"` // DecisionAllowed or DecisionDenied
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
+	Reason     string        `json:"reason,omitempty"` // why a use was denied
+}
+
+// AuditSink receives a resource's decisions, see WithAudit. Record is
+// called on the using goroutine, so it must return quickly, dropping the
+// decision rather than waiting if it can't keep up.
+type AuditSink interface {
+	Record(d AuditDecision)
+}
+
+// WithAudit sends every decision the resource's limiter and concurrency
+// cap make to sink: one allow for each use that gets its slot and token,
+// and one deny for each use turned away, with the RateLimitError's
+// RetryAfter. Uses that give up waiting aren't decisions.
+func WithAudit(sink AuditSink) Option {
+	return func(r *Resource) {
+		r.audit = sink
+	}
+}
+
+// recordDecision sends a use's decision to the WithAudit sink, if any. A
+// nil denial is an allow.
+func (r *Resource) recordDecision(caller Caller, denial error) {
+	if r.audit == nil {
+		return
+	}
+	d := AuditDecision{Time: r.clock.Now(), Resource: r.name, Caller: caller.String(), Outcome: DecisionAllowed}
+	if denial != nil {
+		d.Outcome = DecisionDenied
+		d.Reason = denial.Error()
+		var rle *RateLimitError
+		if errors.As(denial, &rle) {
+			d.RetryAfter = rle.RetryAfter
+		}
+	}
+	r.audit.Record(d)
+}
+
+// RingAuditSink keeps the latest decisions in memory, overwriting the
+// oldest once full
+type RingAuditSink struct {
+	mu          sync.Mutex
+	decisions   []AuditDecision
+	next        int // where the next decision goes
+	full        bool
+	overwritten uint64
+}
+
+// NewRingAuditSink creates a sink keeping the latest size decisions, at
+// least one
+func NewRingAuditSink(size int) *RingAuditSink {
+	return &RingAuditSink{decisions: make([]AuditDecision, max(size, 1))}
+}
+
+// Record keeps d, overwriting the oldest decision if the ring is full
+func (s *RingAuditSink) Record(d AuditDecision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.full {
+		s.overwritten++
+	}
+	s.decisions[s.next] = d
+	s.next = (s.next + 1) % len(s.decisions)
+	if s.next == 0 {
+		s.full = true
+	}
+}
+
+// Decisions returns the decisions kept, oldest first
+func (s *RingAuditSink) Decisions() []AuditDecision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.full {
+		return append([]AuditDecision(nil), s.decisions[:s.next]...)
+	}
+	return append(append([]AuditDecision(nil), s.decisions[s.next:]...), s.decisions[:s.next]...)
+}
+
+// Dropped returns how many decisions have been overwritten
+func (s *RingAuditSink) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.overwritten
+}
+
+// JSONLinesAuditSink writes decisions to an io.Writer, such as a file, one
+// JSON object per line. Record only queues the decision; a goroutine of
+// the sink's own writes the queue out in batches, so a slow writer never
+// holds up uses. Decisions arriving with the queue full are dropped and
+// counted.
+type JSONLinesAuditSink struct {
+	mu      sync.RWMutex // held for reading to queue, for writing by Close
+	queue   chan AuditDecision
+	closed  bool
+	dropped atomic.Uint64
+	done    chan struct{}
+	err     error // the first write error, read once done is closed
+}
+
+// NewJSONLinesAuditSink creates a sink writing to w, queueing up to buffer
+// decisions for it. Call Close to write out what is queued.
+func NewJSONLinesAuditSink(w io.Writer, buffer int) *JSONLinesAuditSink {
+	s := &JSONLinesAuditSink{queue: make(chan AuditDecision, max(buffer, 1)), done: make(chan struct{})}
+	go s.write(w)
+	return s
+}
+
+// Record queues d, or drops it if the queue is full or the sink closed
+func (s *JSONLinesAuditSink) Record(d AuditDecision) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		s.dropped.Add(1)
+		return
+	}
+	select {
+	case s.queue <- d:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many decisions weren't written because the queue was
+// full or the sink closed
+func (s *JSONLinesAuditSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close writes out the queued decisions and stops the sink, returning the
+// first error writing them, if any. It doesn't close the writer. Later
+// decisions are dropped.
+func (s *JSONLinesAuditSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	return s.err
+}
+
+// write encodes queued decisions to w, flushing whenever the queue runs
+// dry so each batch goes out in as few writes as it can. After a write
+// error it keeps draining the queue but writes nothing more.
+func (s *JSONLinesAuditSink) write(w io.Writer) {
+	defer close(s.done)
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for d := range s.queue {
+		if s.err == nil {
+			s.err = enc.Encode(d)
+		}
+		if len(s.queue) == 0 && s.err == nil {
+			s.err = bw.Flush()
+		}
+	}
+	if s.err == nil {
+		s.err = bw.Flush()
+	}
+}
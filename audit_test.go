@@ -0,0 +1,121 @@
+// audit_test.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAuditRecordsDecisions(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	sink := NewRingAuditSink(10)
+	resource, _ := NewResourceFromConfig("db", Config{MaxRequests: 1, Window: time.Minute}, WithClock(clock),
+		WithMaxConcurrent(1), WithAudit(sink))
+
+	resource.UseFunc(WithCaller(context.Background(), Caller{ID: "req-1"}), noWork)
+	resource.Use(2)
+
+	got := sink.Decisions()
+	if len(got) != 2 {
+		t.Fatalf("Expected an allow and a deny, got %+v", got)
+	}
+	if d := got[0]; d.Outcome != DecisionAllowed || d.Caller != "req-1" || d.Resource != "db" || !d.Time.Equal(clock.Now()) {
+		t.Errorf("Expected req-1 allowed on db now, got %+v", d)
+	}
+	if d := got[1]; d.Outcome != DecisionDenied || d.Caller != "Goroutine 2" || d.RetryAfter != time.Minute || !strings.Contains(d.Reason, "rate limit exceeded") {
+		t.Errorf("Expected Goroutine 2 denied for a minute, got %+v", d)
+	}
+}
+
+func TestRingAuditSinkOverwrites(t *testing.T) {
+	sink := NewRingAuditSink(2)
+	for _, caller := range []string{"a", "b", "c"} {
+		sink.Record(AuditDecision{Caller: caller})
+	}
+	got := sink.Decisions()
+	if len(got) != 2 || got[0].Caller != "b" || got[1].Caller != "c" {
+		t.Errorf("Expected the latest two decisions oldest first, got %+v", got)
+	}
+	if n := sink.Dropped(); n != 1 {
+		t.Errorf("Expected one decision overwritten, got %d", n)
+	}
+}
+
+// gatedWriter holds up every write until open is closed
+type gatedWriter struct {
+	open chan struct{}
+	mu   sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	<-w.open
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func TestJSONLinesAuditSink(t *testing.T) {
+	w := &gatedWriter{open: make(chan struct{})}
+	sink := NewJSONLinesAuditSink(w, 4)
+
+	// The writer is stuck, yet Record never waits; what doesn't fit is
+	// dropped
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		sink.Record(AuditDecision{Resource: "db", Outcome: DecisionDenied, RetryAfter: time.Second})
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected Record not to wait for the writer, took %v", d)
+	}
+	dropped := sink.Dropped()
+	if dropped == 0 || dropped > 100-4 {
+		t.Errorf("Expected the overflow past the queue to be dropped, got %d", dropped)
+	}
+
+	close(w.open)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sink.Record(AuditDecision{})
+	if sink.Dropped() != dropped+1 {
+		t.Error("Expected a decision after Close to be dropped")
+	}
+
+	lines := 0
+	sc := bufio.NewScanner(&w.buf)
+	for sc.Scan() {
+		lines++
+		var d map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &d); err != nil {
+			t.Fatalf("Expected a JSON object per line, got %q: %v", sc.Text(), err)
+		}
+		if d["outcome"] != "denied" || d["resource"] != "db" || d["retry_after"] != float64(time.Second) {
+			t.Errorf("Expected the decision's fields, got %v", d)
+		}
+	}
+	if uint64(lines)+dropped != 100 {
+		t.Errorf("Expected every decision written or dropped, %d written and %d dropped", lines, dropped)
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, io.ErrShortWrite }
+
+func TestJSONLinesAuditSinkWriteError(t *testing.T) {
+	sink := NewJSONLinesAuditSink(failingWriter{}, 4)
+	sink.Record(AuditDecision{})
+	if err := sink.Close(); !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("Expected Close to report the write error, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+// backoff.go
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// BackoffPolicy configures RetryWithBackoff. The zero value retries forever
+// with delays starting at 100ms, doubling up to 10s, without jitter.
+type BackoffPolicy struct {
+	// MaxAttempts caps how many times fn is called. Zero means no cap.
+	MaxAttempts int
+	// MaxElapsed gives up once waiting again would take the total time
+	// past it. Zero means no limit.
+	MaxElapsed time.Duration
+	// Initial is the first delay, Max the largest one and Multiplier how
+	// much each delay grows over the last
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction either way,
+	// e.g. 0.2 for ±20%
+	Jitter float64
+	// Clock is used for waiting. Nil means the real clock.
+	Clock Clock
+}
+
+// RetryWithBackoff calls fn until it succeeds, the policy gives up or ctx is
+// done, and returns fn's last error or ctx's. Between attempts it waits on
+// an exponential schedule, except after a RateLimitError with a RetryAfter
+// hint, when it waits exactly that long.
+func RetryWithBackoff(ctx context.Context, policy BackoffPolicy, fn func() error) error {
+	clock := policy.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	delay := policy.Initial
+	if delay <= 0 {
+		delay = 100 * time.Millisecond
+	}
+	maxDelay := policy.Max
+	if maxDelay <= 0 {
+		maxDelay = 10 * time.Second
+	}
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	start := clock.Now()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		wait := jitter(delay, policy.Jitter)
+		var rle *RateLimitError
+		if errors.As(err, &rle) && rle.RetryAfter > 0 {
+			wait = rle.RetryAfter
+		} else {
+			delay = min(time.Duration(float64(delay)*multiplier), maxDelay)
+		}
+		if policy.MaxElapsed > 0 && clock.Now().Add(wait).Sub(start) > policy.MaxElapsed {
+			return err
+		}
+
+		select {
+		case <-clock.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// jitter moves d by a random amount of up to fraction of it either way
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + fraction*(2*rand.Float64()-1)))
+}
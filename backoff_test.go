@@ -0,0 +1,148 @@
+// backoff_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// retryInBackground runs RetryWithBackoff and reports each call to fn on
+// calls and the final result on done
+func retryInBackground(policy BackoffPolicy, fn func(attempt int) error) (calls chan int, done chan error) {
+	calls = make(chan int, 100)
+	done = make(chan error, 1)
+	attempt := 0
+	go func() {
+		done <- RetryWithBackoff(context.Background(), policy, func() error {
+			attempt++
+			calls <- attempt
+			return fn(attempt)
+		})
+	}()
+	return calls, done
+}
+
+func TestRetryWithBackoffHonoursRetryAfter(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	calls, done := retryInBackground(BackoffPolicy{Initial: time.Second, Clock: clock}, func(attempt int) error {
+		if attempt == 1 {
+			return &RateLimitError{Resource: "test", RetryAfter: 3 * time.Second}
+		}
+		return nil
+	})
+
+	<-calls
+	clock.BlockUntil(1)
+	clock.Advance(2999 * time.Millisecond)
+	select {
+	case <-calls:
+		t.Fatal("Expected the retry to wait the full retry-after of 3s")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(time.Millisecond)
+	<-calls
+	if err := <-done; err != nil {
+		t.Errorf("Expected the retry to succeed, got %v", err)
+	}
+}
+
+func TestRetryWithBackoffExponential(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	failure := errors.New("busy")
+	calls, done := retryInBackground(BackoffPolicy{MaxAttempts: 3, Initial: time.Second, Clock: clock}, func(int) error {
+		return failure
+	})
+
+	<-calls
+	for _, wait := range []time.Duration{time.Second, 2 * time.Second} {
+		clock.BlockUntil(1)
+		clock.Advance(wait - time.Millisecond)
+		select {
+		case <-calls:
+			t.Fatalf("Expected a delay of %v", wait)
+		case <-time.After(10 * time.Millisecond):
+		}
+		clock.Advance(time.Millisecond)
+		<-calls
+	}
+
+	if err := <-done; err != failure {
+		t.Errorf("Expected the last error after 3 attempts, got %v", err)
+	}
+}
+
+func TestRetryWithBackoffMaxElapsed(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	calls, done := retryInBackground(BackoffPolicy{MaxElapsed: 5 * time.Second, Clock: clock}, func(int) error {
+		return &RateLimitError{Resource: "test", RetryAfter: 10 * time.Second}
+	})
+
+	<-calls
+	if err := <-done; !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected to give up rather than wait past MaxElapsed, got %v", err)
+	}
+}
+
+func TestRetryWithBackoffContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := RetryWithBackoff(ctx, BackoffPolicy{Clock: NewFakeClock(time.Now())}, func() error {
+		return errors.New("busy")
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestJitterStaysInRange(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := jitter(time.Second, 0.2); d < 800*time.Millisecond || d > 1200*time.Millisecond {
+			t.Fatalf("Expected a jittered delay within 20%%, got %v", d)
+		}
+	}
+}
+
+func TestUseReturnsRetryAfter(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	resource, _ := NewResourceFromConfig("test", Config{MaxRequests: 1, Window: time.Minute}, WithClock(clock), WithMaxConcurrent(1))
+	if err := resource.Use(1); err != nil {
+		t.Fatal(err)
+	}
+
+	var rle *RateLimitError
+	if err := resource.Use(2); !errors.As(err, &rle) || rle.RetryAfter != time.Minute {
+		t.Fatalf("Expected a RateLimitError retrying after 1m, got %v", err)
+	}
+	if rle.Resource != "test" || rle.Limit != 1 {
+		t.Errorf("Expected the error to name resource test and its limit of 1, got %+v", rle)
+	}
+}
+
+func TestUseReturnsRetryAfterFromTiersAndCalendars(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tiered, _ := newTieredLimiter(clock,
+		Tier{Max: 1, Window: time.Second},
+		Tier{Max: 1, Window: time.Minute},
+	)
+	daily, _ := newTestCalendarLimiter(t, 1, PeriodDay, time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC))
+
+	for _, tc := range []struct {
+		name    string
+		limiter Limiter
+		want    time.Duration
+	}{
+		// Both tiers are full, so the longer wait counts
+		{"tiered", tiered, time.Minute},
+		{"calendar", daily, 6 * time.Hour},
+	} {
+		resource := NewResource(tc.name, 0, 0, WithLimiter(tc.limiter))
+		done := fillBulkhead(resource, 1)
+		var rle *RateLimitError
+		if err := resource.Use(2); !errors.As(err, &rle) || rle.RetryAfter != tc.want {
+			t.Errorf("Expected the %s resource to retry after %v, got %v", tc.name, tc.want, err)
+		}
+		done()
+	}
+}
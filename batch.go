@@ -0,0 +1,108 @@
+// batch.go
+package main
+
+import "sync/atomic"
+
+// Batch is a run of tokens taken in one go by Prefetch, handed out one at a
+// time by Take without touching the limiter. Tokens taken from a batch
+// count like tokens from TryAcquire and are released the same way.
+type Batch struct {
+	limiter   *RateLimiter
+	epoch     uint64 // window the tokens were charged to
+	remaining atomic.Int64
+}
+
+// Prefetch takes up to n tokens from the current window at once, as many as
+// fit, so a worker handling many small items pays for the lock once per
+// batch instead of once per item. It fails with ErrRateLimited, counted as
+// one denial, if not even one token is available.
+func (rl *RateLimiter) Prefetch(n int) (*Batch, error) {
+	if n <= 0 {
+		return nil, ErrInvalidCost
+	}
+
+	defer rl.fireEvents()
+	b, err := rl.prefetchLocal(n)
+	if err != nil {
+		return nil, err
+	}
+	// Batch tokens count as acquisitions only as Take hands them out
+	if ok, _ := rl.commitShared(int(b.remaining.Load()), b.epoch, false); !ok {
+		return nil, ErrRateLimited
+	}
+	return b, nil
+}
+
+// prefetchLocal is Prefetch against the local window alone
+func (rl *RateLimiter) prefetchLocal(n int) (*Batch, error) {
+	rl.lock()
+	defer rl.unlock()
+
+	if err := rl.unavailableLocked(); err != nil {
+		return nil, err
+	}
+	now := rl.clock.Now()
+	rl.resetIfExpiredLocked(now)
+
+	take := n
+	if rl.mode != ModeBypass {
+		left, _ := rl.sharedLeftLocked(now)
+		take = min(n, rl.allowance-rl.currRequests, left)
+		if rl.waiters.Len() > 0 {
+			// Queued callers get what is left first
+			take = 0
+		}
+	}
+	if take <= 0 {
+		rl.denied++
+		rl.queueEventLocked(limiterEvent{now: now, current: rl.currRequests, max: rl.allowance})
+		return nil, ErrRateLimited
+	}
+
+	rl.currRequests += take
+	rl.held += take
+	b := &Batch{limiter: rl, epoch: rl.epoch}
+	b.remaining.Store(int64(take))
+	return b, nil
+}
+
+// Take hands out one of the batch's tokens, reporting false once they are
+// used up. It is safe for concurrent use and never blocks.
+func (b *Batch) Take() bool {
+	for {
+		r := b.remaining.Load()
+		if r <= 0 {
+			return false
+		}
+		if b.remaining.CompareAndSwap(r, r-1) {
+			// Counted as an acquisition when the limiter next locks
+			b.limiter.fast.acquired.Add(1)
+			return true
+		}
+	}
+}
+
+// Remaining returns how many tokens the batch still has
+func (b *Batch) Remaining() int {
+	return int(max(b.remaining.Load(), 0))
+}
+
+// ReturnUnused gives the tokens not yet taken back to the limiter and empties
+// the batch. If their window has since reset they free nothing in the new
+// one.
+func (b *Batch) ReturnUnused() {
+	n := int(b.remaining.Swap(0))
+	if n <= 0 {
+		return
+	}
+
+	rl := b.limiter
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	now := rl.clock.Now()
+	rl.resetIfExpiredLocked(now)
+	rl.releaseEpochLocked(n, b.epoch)
+	rl.dispatchLocked(now)
+}
@@ -0,0 +1,121 @@
+// batch_test.go
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPrefetch(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(10, 60, WithLimiterClock(clock))
+	limiter.TryAcquireN(4)
+
+	// Only 6 of the 8 asked for fit
+	b, err := limiter.Prefetch(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := b.Remaining(); n != 6 {
+		t.Errorf("Expected a batch of 6, got %d", n)
+	}
+	if limiter.TryAcquire() {
+		t.Error("Expected the batch to hold the rest of the window")
+	}
+
+	for i := 0; i < 2; i++ {
+		if !b.Take() {
+			t.Fatalf("Expected Take %d to succeed", i+1)
+		}
+	}
+	b.ReturnUnused()
+	if b.Take() || b.Remaining() != 0 {
+		t.Error("Expected the batch to be empty after ReturnUnused")
+	}
+	if n := limiter.Remaining(); n != 4 {
+		t.Errorf("Expected the 4 unused tokens back in the window, got %d", n)
+	}
+	if stats := limiter.Stats(); stats.Acquired != 3 {
+		t.Errorf("Expected the TryAcquireN and 2 takes to count as acquisitions, got %d", stats.Acquired)
+	}
+
+	if _, err := limiter.Prefetch(0); !errors.Is(err, ErrInvalidCost) {
+		t.Errorf("Expected ErrInvalidCost for an empty prefetch, got %v", err)
+	}
+	limiter.TryAcquireN(4)
+	if _, err := limiter.Prefetch(1); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited from a full window, got %v", err)
+	}
+}
+
+func TestPrefetchReturnAfterReset(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(10, 60, WithLimiterClock(clock))
+
+	b, err := limiter.Prefetch(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Take()
+
+	// The unused tokens belong to a window that is over, so returning them
+	// must not push the new one past its limit
+	clock.Advance(time.Minute)
+	limiter.TryAcquireN(10)
+	b.ReturnUnused()
+	if limiter.TryAcquire() {
+		t.Error("Expected tokens returned after the reset to free nothing")
+	}
+}
+
+func TestBatchConcurrentTake(t *testing.T) {
+	limiter := NewRateLimiter(100, 60)
+	b, err := limiter.Prefetch(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	taken := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b.Take() {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != 100 {
+		t.Errorf("Expected exactly 100 takes, got %d", taken)
+	}
+}
+
+// The benchmarks take one token per item from a limiter that never runs
+// out, on every core at once: per item, or through batches of 64
+func BenchmarkTryAcquirePerItem(b *testing.B) {
+	limiter := NewRateLimiterDuration(1<<30, time.Hour)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			limiter.TryAcquire()
+		}
+	})
+}
+
+func BenchmarkPrefetch(b *testing.B) {
+	limiter := NewRateLimiterDuration(1<<30, time.Hour)
+	b.RunParallel(func(pb *testing.PB) {
+		var batch *Batch
+		for pb.Next() {
+			for batch == nil || !batch.Take() {
+				batch, _ = limiter.Prefetch(64)
+			}
+		}
+	})
+}
@@ -0,0 +1,281 @@
+// breaker.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by uses of a resource whose circuit breaker is
+// open, or half-open with its probe already in flight
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// BreakerState is where a CircuitBreaker is in its cycle
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through, counting consecutive failures
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails every call until the reset timeout has passed
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe through to decide whether to
+	// close again or go back to open
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// CircuitBreaker stops calls to a failing downstream. After threshold
+// consecutive failures it opens, failing calls straight away; once the reset
+// timeout has passed it lets one probe through, closing again if the probe
+// succeeds and reopening if it fails.
+type CircuitBreaker struct {
+	mu           sync.Mutex
+	clock        Clock
+	threshold    int
+	resetTimeout time.Duration
+	state        BreakerState
+	failures     int       // consecutive failures while closed
+	openedAt     time.Time // when the breaker last opened
+	probing      bool      // a half-open probe is in flight
+	generation   uint64    // incremented on every transition
+
+	// told about every transition, outside the lock
+	observers []func(from, to BreakerState)
+}
+
+// BreakerOption configures a CircuitBreaker
+type BreakerOption func(*CircuitBreaker)
+
+// WithBreakerClock makes the breaker read time from c instead of the real
+// clock
+func WithBreakerClock(c Clock) BreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.clock = c
+	}
+}
+
+// WithOnStateChange registers f to be called with every state transition.
+// It runs without the breaker's lock held, on the goroutine whose call
+// caused the transition.
+func WithOnStateChange(f func(from, to BreakerState)) BreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.observers = append(cb.observers, f)
+	}
+}
+
+// NewCircuitBreaker creates a closed breaker that opens after threshold
+// consecutive failures and probes again resetTimeout after opening. A
+// threshold below one is raised to one.
+func NewCircuitBreaker(threshold int, resetTimeout time.Duration, opts ...BreakerOption) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	cb := &CircuitBreaker{
+		clock:        realClock{},
+		threshold:    threshold,
+		resetTimeout: resetTimeout,
+	}
+	for _, opt := range opts {
+		opt(cb)
+	}
+	return cb
+}
+
+// WithCircuitBreaker puts cb in front of the resource's work: uses fail
+// straight away with ErrCircuitOpen while it is open, and the outcome of
+// the work, including panics, is fed back to it. Cancelled uses, and uses
+// that never got to run, don't count either way. Transitions are logged.
+func WithCircuitBreaker(cb *CircuitBreaker) Option {
+	return func(r *Resource) {
+		r.breaker = cb
+		cb.mu.Lock()
+		defer cb.mu.Unlock()
+		cb.observers = append(cb.observers, func(from, to BreakerState) {
+			r.log(LevelWarn, "circuit breaker changed", NewField("from", from), NewField("to", to))
+		})
+	}
+}
+
+// State returns the breaker's state, moving an open breaker whose reset
+// timeout has passed to half-open
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mu.Lock()
+	changed := cb.halfOpenIfDueLocked()
+	state := cb.state
+	cb.mu.Unlock()
+
+	if changed {
+		cb.notify(BreakerOpen, BreakerHalfOpen)
+	}
+	return state
+}
+
+// Do runs fn through the breaker, failing with ErrCircuitOpen instead if it
+// is open, and records fn's error as the outcome
+func (cb *CircuitBreaker) Do(fn func() error) error {
+	t, err := cb.allow()
+	if err != nil {
+		return err
+	}
+	defer cb.done(t)
+
+	defer func() {
+		if p := recover(); p != nil {
+			cb.record(t, fmt.Errorf("panic: %v", p))
+			panic(p)
+		}
+	}()
+	err = fn()
+	cb.record(t, err)
+	return err
+}
+
+// breakerTicket is a call let through by allow, to be settled by record or
+// given up by done
+type breakerTicket struct {
+	generation uint64
+	probe      bool
+	settled    bool
+}
+
+// allow lets a call through or fails with ErrCircuitOpen. In half-open only
+// the first caller gets through, as the probe.
+func (cb *CircuitBreaker) allow() (*breakerTicket, error) {
+	cb.mu.Lock()
+	changed := cb.halfOpenIfDueLocked()
+	t, err := cb.allowLocked()
+	cb.mu.Unlock()
+
+	if changed {
+		cb.notify(BreakerOpen, BreakerHalfOpen)
+	}
+	return t, err
+}
+
+func (cb *CircuitBreaker) allowLocked() (*breakerTicket, error) {
+	switch cb.state {
+	case BreakerOpen:
+		return nil, ErrCircuitOpen
+	case BreakerHalfOpen:
+		if cb.probing {
+			return nil, ErrCircuitOpen
+		}
+		cb.probing = true
+		return &breakerTicket{generation: cb.generation, probe: true}, nil
+	}
+	return &breakerTicket{generation: cb.generation}, nil
+}
+
+// record feeds a call's outcome back. Outcomes of calls let through before
+// the latest transition are stale and ignored.
+func (cb *CircuitBreaker) record(t *breakerTicket, err error) {
+	cb.mu.Lock()
+	t.settled = true
+	if t.generation != cb.generation {
+		cb.mu.Unlock()
+		return
+	}
+
+	from := cb.state
+	switch {
+	case cb.state == BreakerHalfOpen && err == nil:
+		cb.transitionLocked(BreakerClosed)
+	case cb.state == BreakerHalfOpen:
+		cb.transitionLocked(BreakerOpen)
+	case err == nil:
+		cb.failures = 0
+	default:
+		cb.failures++
+		if cb.failures >= cb.threshold {
+			cb.transitionLocked(BreakerOpen)
+		}
+	}
+	to := cb.state
+	cb.mu.Unlock()
+
+	if from != to {
+		cb.notify(from, to)
+	}
+}
+
+// done gives up a ticket that record never settled, so an abandoned probe
+// lets the next caller probe instead
+func (cb *CircuitBreaker) done(t *breakerTicket) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if !t.settled && t.probe && t.generation == cb.generation {
+		cb.probing = false
+	}
+}
+
+// halfOpenIfDueLocked moves an open breaker to half-open once the reset
+// timeout has passed, reporting whether it did
+func (cb *CircuitBreaker) halfOpenIfDueLocked() bool {
+	if cb.state != BreakerOpen || cb.clock.Now().Sub(cb.openedAt) < cb.resetTimeout {
+		return false
+	}
+	cb.transitionLocked(BreakerHalfOpen)
+	return true
+}
+
+func (cb *CircuitBreaker) transitionLocked(to BreakerState) {
+	cb.state = to
+	cb.failures = 0
+	cb.probing = false
+	cb.generation++
+	if to == BreakerOpen {
+		cb.openedAt = cb.clock.Now()
+	}
+}
+
+// notify tells the observers about a transition
+func (cb *CircuitBreaker) notify(from, to BreakerState) {
+	cb.mu.Lock()
+	observers := cb.observers
+	cb.mu.Unlock()
+
+	for _, f := range observers {
+		f(from, to)
+	}
+}
+
+// breakerAllow asks the resource's breaker, if it has one, to let a use
+// through
+func (r *Resource) breakerAllow() (*breakerTicket, error) {
+	if r.breaker == nil {
+		return nil, nil
+	}
+	t, err := r.breaker.allow()
+	if err != nil {
+		return nil, fmt.Errorf("resource %s: %w", r.name, err)
+	}
+	return t, nil
+}
+
+// breakerRecord feeds a use's outcome back to the resource's breaker
+func (r *Resource) breakerRecord(t *breakerTicket, err error) {
+	if t != nil {
+		r.breaker.record(t, err)
+	}
+}
+
+// breakerDone gives up a use's ticket if its outcome was never recorded
+func (r *Resource) breakerDone(t *breakerTicket) {
+	if t != nil {
+		r.breaker.done(t)
+	}
+}
@@ -0,0 +1,248 @@
+// breaker_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errDownstream = errors.New("downstream failed")
+
+func fail() error { return errDownstream }
+func pass() error { return nil }
+
+// transitions records a breaker's state changes
+type transitions struct {
+	mu  sync.Mutex
+	got []string
+}
+
+func (tr *transitions) record(from, to BreakerState) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.got = append(tr.got, from.String()+"->"+to.String())
+}
+
+func (tr *transitions) String() string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return strings.Join(tr.got, " ")
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tr := &transitions{}
+	cb := NewCircuitBreaker(3, time.Minute, WithBreakerClock(clock), WithOnStateChange(tr.record))
+
+	cb.Do(fail)
+	cb.Do(fail)
+	// A success in between starts the count again
+	cb.Do(pass)
+	cb.Do(fail)
+	cb.Do(fail)
+	if cb.State() != BreakerClosed {
+		t.Error("Expected the breaker to stay closed below the threshold")
+	}
+	cb.Do(fail)
+	if cb.State() != BreakerOpen {
+		t.Error("Expected consecutive failures to open the breaker")
+	}
+
+	called := false
+	if err := cb.Do(func() error { called = true; return nil }); !errors.Is(err, ErrCircuitOpen) || called {
+		t.Errorf("Expected an open breaker to fail without calling, got %v", err)
+	}
+	if tr.String() != "closed->open" {
+		t.Errorf("Unexpected transitions %q", tr)
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeSuccess(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tr := &transitions{}
+	cb := NewCircuitBreaker(1, time.Minute, WithBreakerClock(clock), WithOnStateChange(tr.record))
+	cb.Do(fail)
+
+	clock.Advance(59 * time.Second)
+	if err := cb.Do(pass); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the breaker to stay open until the reset timeout, got %v", err)
+	}
+	clock.Advance(time.Second)
+	if cb.State() != BreakerHalfOpen {
+		t.Errorf("Expected half-open after the reset timeout, got %v", cb.State())
+	}
+
+	if err := cb.Do(pass); err != nil {
+		t.Errorf("Expected the probe to go through, got %v", err)
+	}
+	if cb.State() != BreakerClosed {
+		t.Errorf("Expected a passing probe to close the breaker, got %v", cb.State())
+	}
+	if err := cb.Do(pass); err != nil {
+		t.Errorf("Expected calls to go through once closed, got %v", err)
+	}
+	if want := "closed->open open->half-open half-open->closed"; tr.String() != want {
+		t.Errorf("Expected transitions %q, got %q", want, tr)
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeFailure(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tr := &transitions{}
+	cb := NewCircuitBreaker(1, time.Minute, WithBreakerClock(clock), WithOnStateChange(tr.record))
+	cb.Do(fail)
+
+	clock.Advance(time.Minute)
+	if err := cb.Do(fail); !errors.Is(err, errDownstream) {
+		t.Errorf("Expected the probe to run, got %v", err)
+	}
+	if cb.State() != BreakerOpen {
+		t.Errorf("Expected a failing probe to reopen the breaker, got %v", cb.State())
+	}
+
+	// The reset timeout starts again from the failed probe
+	clock.Advance(30 * time.Second)
+	if err := cb.Do(pass); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the reopened breaker to wait a full timeout, got %v", err)
+	}
+	clock.Advance(30 * time.Second)
+	if err := cb.Do(pass); err != nil {
+		t.Errorf("Expected a second probe after another timeout, got %v", err)
+	}
+	if want := "closed->open open->half-open half-open->open open->half-open half-open->closed"; tr.String() != want {
+		t.Errorf("Expected transitions %q, got %q", want, tr)
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cb := NewCircuitBreaker(1, time.Minute, WithBreakerClock(clock))
+	cb.Do(fail)
+	clock.Advance(time.Minute)
+
+	probing := make(chan struct{})
+	finish := make(chan struct{})
+	go cb.Do(func() error {
+		close(probing)
+		<-finish
+		return nil
+	})
+	<-probing
+
+	for i := 0; i < 5; i++ {
+		if err := cb.Do(pass); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("Expected callers behind the probe to fail fast, got %v", err)
+		}
+	}
+	close(finish)
+}
+
+func TestCircuitBreakerAbandonedProbe(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cb := NewCircuitBreaker(1, time.Minute, WithBreakerClock(clock))
+	cb.Do(fail)
+	clock.Advance(time.Minute)
+
+	// A probe let through that never reports lets the next caller probe
+	tk, err := cb.allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb.done(tk)
+	if err := cb.Do(pass); err != nil {
+		t.Errorf("Expected a new probe after one was given up, got %v", err)
+	}
+}
+
+func TestResourceCircuitBreaker(t *testing.T) {
+	logs := &CaptureWriter{}
+
+	clock := NewFakeClock(time.Now())
+	tr := &transitions{}
+	cb := NewCircuitBreaker(2, time.Minute, WithBreakerClock(clock), WithOnStateChange(tr.record))
+	resource := NewResource("api", 100, 60, WithClock(clock), WithLogger(NewLogger(logs)), WithCircuitBreaker(cb),
+		WithInit(func(context.Context) error { return nil }))
+	limiter := resource.limiter.(*RateLimiter)
+	use := func(fn func() error) error {
+		return resource.UseFunc(context.Background(), func(context.Context) error { return fn() })
+	}
+
+	use(fail)
+	// A cancelled use doesn't count as a failure
+	ctx, cancel := context.WithCancel(context.Background())
+	resource.UseFunc(ctx, func(context.Context) error { cancel(); return context.Canceled })
+	if cb.State() != BreakerClosed {
+		t.Error("Expected a cancelled use not to count against the breaker")
+	}
+	use(fail)
+	if cb.State() != BreakerOpen {
+		t.Fatalf("Expected failing uses to open the breaker, got %v", cb.State())
+	}
+
+	before := limiter.Stats().Acquired
+	if err := use(pass); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen while open, got %v", err)
+	}
+	if limiter.Stats().Acquired != before {
+		t.Error("Expected an open breaker to fail before taking a token")
+	}
+
+	// A probe that panics reopens the breaker
+	clock.Advance(time.Minute)
+	func() {
+		defer func() { recover() }()
+		use(func() error { panic("boom") })
+	}()
+	if cb.State() != BreakerOpen {
+		t.Errorf("Expected a panicking probe to reopen the breaker, got %v", cb.State())
+	}
+
+	clock.Advance(time.Minute)
+	if err := use(pass); err != nil {
+		t.Errorf("Expected the probe to succeed, got %v", err)
+	}
+	if cb.State() != BreakerClosed {
+		t.Errorf("Expected a passing probe to close the breaker, got %v", cb.State())
+	}
+	if !logs.Contains(`msg="circuit breaker changed" resource=api from=half-open to=closed`) {
+		t.Errorf("Expected transitions to be logged, got %q", logs.String())
+	}
+	if want := "closed->open open->half-open half-open->open open->half-open half-open->closed"; tr.String() != want {
+		t.Errorf("Expected transitions %q, got %q", want, tr)
+	}
+}
+
+func TestResourceCircuitBreakerProbeRateLimited(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cb := NewCircuitBreaker(1, time.Minute, WithBreakerClock(clock))
+	resource := NewResource("api", 1, 3600, WithClock(clock), WithCircuitBreaker(cb),
+		WithInit(func(context.Context) error { return nil }))
+	resource.UseFunc(context.Background(), func(context.Context) error { return errDownstream })
+
+	// Hold the only token so the probe is denied before it runs
+	resource.limiter.TryAcquire()
+	clock.Advance(time.Minute)
+	if err := resource.Use(1); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected the probe to be rate limited, got %v", err)
+	}
+	resource.limiter.Release()
+
+	if err := resource.UseFunc(context.Background(), func(context.Context) error { return nil }); err != nil {
+		t.Errorf("Expected a denied probe to let the next use probe, got %v", err)
+	}
+	if cb.State() != BreakerClosed {
+		t.Errorf("Expected the second probe to close the breaker, got %v", cb.State())
+	}
+}
+
+func TestBreakerStateString(t *testing.T) {
+	for state, want := range map[BreakerState]string{BreakerClosed: "closed", BreakerOpen: "open", BreakerHalfOpen: "half-open"} {
+		if state.String() != want {
+			t.Errorf("Expected %q, got %q", want, state.String())
+		}
+	}
+}
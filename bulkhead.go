@@ -0,0 +1,73 @@
+// bulkhead.go
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// BulkheadMode is what a use does when a resource's WithMaxConcurrent cap
+// is full
+type BulkheadMode int
+
+const (
+	// BulkheadPerCall makes Use fail straight away and UseFunc and
+	// UseContext wait for a slot, as they do for the limiter
+	BulkheadPerCall BulkheadMode = iota
+	// BulkheadFailFast makes every use fail straight away with
+	// ErrTooManyConcurrent
+	BulkheadFailFast
+	// BulkheadWait makes every use wait for a slot, Use without a deadline
+	BulkheadWait
+)
+
+func (m BulkheadMode) String() string {
+	switch m {
+	case BulkheadPerCall:
+		return "per-call"
+	case BulkheadFailFast:
+		return "fail-fast"
+	case BulkheadWait:
+		return "wait"
+	}
+	return fmt.Sprintf("BulkheadMode(%d)", int(m))
+}
+
+// WithBulkheadMode sets what uses do when the WithMaxConcurrent cap is
+// full, whichever of Use and UseFunc they come through. The rate limit is
+// unaffected: Use still fails straight away when it is reached.
+func WithBulkheadMode(mode BulkheadMode) Option {
+	return func(r *Resource) {
+		r.bulkhead = mode
+	}
+}
+
+// bulkheadWaits reports whether a use waits for a concurrency slot, given
+// whether the call waits by default
+func (r *Resource) bulkheadWaits(wait bool) bool {
+	switch r.bulkhead {
+	case BulkheadFailFast:
+		return false
+	case BulkheadWait:
+		return true
+	}
+	return wait
+}
+
+// acquireSlot takes a concurrency slot if the resource has a cap, waiting
+// for one until ctx is done if wait is set
+func (r *Resource) acquireSlot(ctx context.Context, wait bool) error {
+	if r.sem == nil {
+		return nil
+	}
+	if !wait {
+		if !r.sem.TryAcquire() {
+			return fmt.Errorf("%w of resource %s (caller %v)", ErrTooManyConcurrent, r.name, callerOf(ctx))
+		}
+		return nil
+	}
+	if err := r.sem.Acquire(ctx); err != nil {
+		return fmt.Errorf("%w of resource %s (caller %v): %w", ErrTooManyConcurrent, r.name, callerOf(ctx), err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// bulkhead_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBulkheadCapsWork(t *testing.T) {
+	resource := NewResource("slow", 100, 1, WithMaxConcurrent(2),
+		WithInit(func(context.Context) error { return nil }))
+
+	var inside, most atomic.Int32
+	work := func(context.Context) error {
+		n := inside.Add(1)
+		defer inside.Add(-1)
+		for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+		}
+		if f := resource.Metrics().InFlight; f > 2 {
+			t.Errorf("Expected at most 2 uses in flight, Metrics reported %d", f)
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := resource.UseFunc(context.Background(), work); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if most.Load() != 2 {
+		t.Errorf("Expected exactly 2 goroutines in the work at once, at most %d were", most.Load())
+	}
+	if m := resource.Metrics(); m.InFlight != 0 || m.Uses != 10 {
+		t.Errorf("Expected 10 finished uses and none in flight, got %+v", m)
+	}
+}
+
+// fillBulkhead occupies every slot of resource until the returned func is
+// called
+func fillBulkhead(resource *Resource, n int) func() {
+	release := make(chan struct{})
+	started := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resource.UseFunc(context.Background(), func(context.Context) error {
+				started <- struct{}{}
+				<-release
+				return nil
+			})
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-started
+	}
+	return func() {
+		close(release)
+		wg.Wait()
+	}
+}
+
+func TestBulkheadFailFast(t *testing.T) {
+	resource := NewResource("slow", 100, 1, WithMaxConcurrent(2), WithBulkheadMode(BulkheadFailFast),
+		WithInit(func(context.Context) error { return nil }))
+	done := fillBulkhead(resource, 2)
+	defer done()
+
+	err := resource.UseFunc(context.Background(), func(context.Context) error { return nil })
+	if !errors.Is(err, ErrTooManyConcurrent) {
+		t.Errorf("Expected UseFunc to fail fast over the cap, got %v", err)
+	}
+	if m := resource.Metrics(); m.InFlight != 2 || m.RateLimited != 1 {
+		t.Errorf("Expected 2 in flight and 1 rejection, got %+v", m)
+	}
+}
+
+func TestBulkheadWait(t *testing.T) {
+	resource := NewResource("slow", 100, 1, WithMaxConcurrent(1), WithBulkheadMode(BulkheadWait),
+		WithInit(func(context.Context) error { return nil }))
+	done := fillBulkhead(resource, 1)
+
+	errs := make(chan error, 1)
+	go func() { errs <- resource.Use(1) }()
+	select {
+	case err := <-errs:
+		t.Fatalf("Expected Use to wait for a slot, returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	done()
+	if err := <-errs; err != nil {
+		t.Errorf("Expected Use to get the slot once freed, got %v", err)
+	}
+}
+
+func TestBulkheadPerCall(t *testing.T) {
+	resource := NewResource("slow", 100, 1, WithMaxConcurrent(1),
+		WithInit(func(context.Context) error { return nil }))
+	done := fillBulkhead(resource, 1)
+	defer done()
+
+	if err := resource.Use(1); !errors.Is(err, ErrTooManyConcurrent) {
+		t.Errorf("Expected Use to fail fast by default, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := resource.UseFunc(ctx, func(context.Context) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected UseFunc to wait by default, got %v", err)
+	}
+	// The cancelled wait isn't a rejection
+	if m := resource.Metrics(); m.RateLimited != 1 {
+		t.Errorf("Expected only the failed Use to count as rejected, got %+v", m)
+	}
+}
+
+func TestBulkheadModeString(t *testing.T) {
+	for mode, want := range map[BulkheadMode]string{BulkheadPerCall: "per-call", BulkheadFailFast: "fail-fast", BulkheadWait: "wait"} {
+		if mode.String() != want {
+			t.Errorf("Expected %q, got %q", want, mode.String())
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// bytes.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ByteRateLimiter limits a byte count per window, for bandwidth quotas such
+// as 5 MB/s. Counts are int64 so large transfers can't overflow, and bytes
+// are consumed rather than held: there is no Release.
+type ByteRateLimiter struct {
+	mu        sync.Mutex
+	perWindow int64
+	window    time.Duration
+	clock     Clock
+
+	used      int64 // bytes charged to the current window
+	lastReset time.Time
+}
+
+// NewByteRateLimiter creates a limiter allowing bytesPerWindow bytes in
+// every window
+func NewByteRateLimiter(bytesPerWindow int64, window time.Duration) (*ByteRateLimiter, error) {
+	if bytesPerWindow <= 0 {
+		return nil, fmt.Errorf("%w: bytes per window must be positive, got %d", ErrInvalidConfig, bytesPerWindow)
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("%w: Window must be positive, got %v", ErrInvalidConfig, window)
+	}
+	bl := &ByteRateLimiter{perWindow: bytesPerWindow, window: window, clock: realClock{}}
+	bl.lastReset = bl.clock.Now()
+	return bl, nil
+}
+
+// resetIfExpiredLocked starts a new window at now if the current one has
+// elapsed, or if the clock stepped back past its start
+func (bl *ByteRateLimiter) resetIfExpiredLocked(now time.Time) {
+	if elapsed := now.Sub(bl.lastReset); elapsed >= bl.window || elapsed < 0 {
+		bl.used = 0
+		bl.lastReset = now
+	}
+}
+
+// TryAcquireBytes charges n bytes to the current window if they all fit
+func (bl *ByteRateLimiter) TryAcquireBytes(n int64) bool {
+	if n <= 0 {
+		return n == 0
+	}
+
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	bl.resetIfExpiredLocked(bl.clock.Now())
+	if n > bl.perWindow-bl.used {
+		return false
+	}
+	bl.used += n
+	return true
+}
+
+// takeUpTo charges as much of n as the current window has room for and
+// returns how much that was, along with how long until the window resets
+func (bl *ByteRateLimiter) takeUpTo(n int64) (int64, time.Duration) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	now := bl.clock.Now()
+	bl.resetIfExpiredLocked(now)
+	taken := min(n, bl.perWindow-bl.used)
+	bl.used += taken
+	return taken, bl.lastReset.Add(bl.window).Sub(now)
+}
+
+// WaitBytes charges n bytes, waiting for later windows if the current one
+// doesn't have room. Requests bigger than a window are spread over as many
+// windows as they need instead of failing. If ctx ends first the bytes
+// charged so far stay spent.
+func (bl *ByteRateLimiter) WaitBytes(ctx context.Context, n int64) error {
+	for n > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		taken, untilReset := bl.takeUpTo(n)
+		if n -= taken; n == 0 {
+			return nil
+		}
+		select {
+		case <-bl.clock.After(untilReset):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Reader returns a reader that reads from r and charges every byte read to
+// the limiter, so io.Copy from it runs at the limited rate. Each Read is
+// capped at one window's worth so the transfer stays smooth.
+func (bl *ByteRateLimiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &limitedReader{ctx: ctx, r: r, bl: bl}
+}
+
+// Writer returns a writer that charges the limiter before passing bytes on
+// to w, one window's worth at a time
+func (bl *ByteRateLimiter) Writer(ctx context.Context, w io.Writer) io.Writer {
+	return &limitedWriter{ctx: ctx, w: w, bl: bl}
+}
+
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	bl  *ByteRateLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > lr.bl.perWindow {
+		p = p[:lr.bl.perWindow]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if werr := lr.bl.WaitBytes(lr.ctx, int64(n)); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+type limitedWriter struct {
+	ctx context.Context
+	w   io.Writer
+	bl  *ByteRateLimiter
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if int64(len(chunk)) > lw.bl.perWindow {
+			chunk = chunk[:lw.bl.perWindow]
+		}
+		if err := lw.bl.WaitBytes(lw.ctx, int64(len(chunk))); err != nil {
+			return written, err
+		}
+		n, err := lw.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,119 @@
+// bytes_test.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"testing"
+	"time"
+)
+
+func newTestByteRateLimiter(t *testing.T, perWindow int64, window time.Duration) (*ByteRateLimiter, *FakeClock) {
+	t.Helper()
+	bl, err := NewByteRateLimiter(perWindow, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := NewFakeClock(time.Now())
+	bl.clock = clock
+	bl.lastReset = clock.Now()
+	return bl, clock
+}
+
+func TestTryAcquireBytes(t *testing.T) {
+	bl, clock := newTestByteRateLimiter(t, 5<<20, time.Second)
+
+	if !bl.TryAcquireBytes(3<<20) || bl.TryAcquireBytes(3<<20) {
+		t.Error("Expected 3 MB to fit once in a 5 MB window")
+	}
+	if !bl.TryAcquireBytes(2 << 20) {
+		t.Error("Expected the last 2 MB to fit")
+	}
+	clock.Advance(time.Second)
+	if !bl.TryAcquireBytes(5 << 20) {
+		t.Error("Expected a full window after the reset")
+	}
+
+	// Counts beyond int32 don't overflow
+	big, _ := newTestByteRateLimiter(t, math.MaxInt64/2, time.Second)
+	if !big.TryAcquireBytes(math.MaxInt64/4) || !big.TryAcquireBytes(math.MaxInt64/4) || big.TryAcquireBytes(math.MaxInt64/4) {
+		t.Error("Expected huge counts to be charged exactly")
+	}
+}
+
+func TestWaitBytesSpansWindows(t *testing.T) {
+	bl, clock := newTestByteRateLimiter(t, 100, time.Second)
+
+	done := make(chan error, 1)
+	go func() { done <- bl.WaitBytes(context.Background(), 250) }()
+
+	// 100 now, 100 in the next window and the last 50 in the one after
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if bl.TryAcquireBytes(51) || !bl.TryAcquireBytes(50) {
+		t.Error("Expected the third window to have 50 bytes left")
+	}
+}
+
+func TestWaitBytesCancelled(t *testing.T) {
+	bl, _ := newTestByteRateLimiter(t, 100, time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() { done <- bl.WaitBytes(ctx, 250) }()
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestByteRateLimiterReaderWriter(t *testing.T) {
+	// 1000 bytes per 10ms, so 5000 bytes need at least 4 window resets
+	const size = 5000
+	data := bytes.Repeat([]byte("x"), size)
+
+	for _, tt := range []struct {
+		name string
+		copy func(bl *ByteRateLimiter, dst io.Writer) (int64, error)
+	}{
+		{"reader", func(bl *ByteRateLimiter, dst io.Writer) (int64, error) {
+			return io.Copy(dst, bl.Reader(context.Background(), bytes.NewReader(data)))
+		}},
+		{"writer", func(bl *ByteRateLimiter, dst io.Writer) (int64, error) {
+			return io.Copy(bl.Writer(context.Background(), dst), bytes.NewReader(data))
+		}},
+	} {
+		bl, err := NewByteRateLimiter(1000, 10*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dst bytes.Buffer
+		start := time.Now()
+		n, err := tt.copy(bl, &dst)
+		elapsed := time.Since(start)
+
+		if err != nil || n != size || !bytes.Equal(dst.Bytes(), data) {
+			t.Errorf("%s: expected all %d bytes copied, got %d, %v", tt.name, size, n, err)
+		}
+		if elapsed < 40*time.Millisecond {
+			t.Errorf("%s: expected the copy to be throttled to at least 40ms, took %v", tt.name, elapsed)
+		}
+	}
+}
+
+func TestNewByteRateLimiterValidation(t *testing.T) {
+	if _, err := NewByteRateLimiter(0, time.Second); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for a zero rate, got %v", err)
+	}
+	if _, err := NewByteRateLimiter(1, 0); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for a zero window, got %v", err)
+	}
+}
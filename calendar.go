@@ -0,0 +1,185 @@
+// calendar.go
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Period is the calendar unit a CalendarLimiter's quota resets on
+type Period int
+
+// Periods
+const (
+	PeriodHour Period = iota
+	PeriodDay
+	PeriodMonth
+)
+
+// String returns the period's name
+func (p Period) String() string {
+	switch p {
+	case PeriodHour:
+		return "hour"
+	case PeriodDay:
+		return "day"
+	case PeriodMonth:
+		return "month"
+	}
+	return "unknown"
+}
+
+// CalendarLimiter allows maxRequests per calendar period, e.g. per day
+// starting at local midnight, rather than per rolling window. Period
+// boundaries are worked out with the time package in the limiter's
+// location, so days on which daylight saving starts or ends last 23 or 25
+// hours as they should. Acquisitions are quota: Release gives nothing back.
+type CalendarLimiter struct {
+	mu          sync.Mutex
+	maxRequests int
+	period      Period
+	loc         *time.Location
+	clock       Clock
+
+	count int
+	start time.Time // current period, [start, end)
+	end   time.Time
+
+	acquired uint64
+	denied   uint64
+}
+
+// NewCalendarLimiter creates a limiter allowing maxRequests per period in
+// loc. A nil loc means UTC.
+func NewCalendarLimiter(maxRequests int, period Period, loc *time.Location) (*CalendarLimiter, error) {
+	if maxRequests <= 0 {
+		return nil, fmt.Errorf("%w: MaxRequests must be positive, got %d", ErrInvalidConfig, maxRequests)
+	}
+	if period < PeriodHour || period > PeriodMonth {
+		return nil, fmt.Errorf("%w: unknown period %d", ErrInvalidConfig, period)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &CalendarLimiter{
+		maxRequests: maxRequests,
+		period:      period,
+		loc:         loc,
+		clock:       realClock{},
+	}, nil
+}
+
+// bounds returns the period containing t
+func (cl *CalendarLimiter) bounds(t time.Time) (start, end time.Time) {
+	t = t.In(cl.loc)
+	y, m, d := t.Date()
+	switch cl.period {
+	case PeriodHour:
+		// Step back to the top of the local hour in elapsed time, since
+		// time.Date can't tell the two 1:00s of a fall-back night apart
+		start = t.Add(-time.Duration(t.Minute())*time.Minute -
+			time.Duration(t.Second())*time.Second -
+			time.Duration(t.Nanosecond()))
+		return start, start.Add(time.Hour)
+	case PeriodDay:
+		return time.Date(y, m, d, 0, 0, 0, 0, cl.loc), time.Date(y, m, d+1, 0, 0, 0, 0, cl.loc)
+	}
+	return time.Date(y, m, 1, 0, 0, 0, 0, cl.loc), time.Date(y, m+1, 1, 0, 0, 0, 0, cl.loc)
+}
+
+// advanceLocked moves to the period containing now. A later period starts
+// the quota afresh; if the clock stepped back into an earlier one the count
+// is kept rather than handing the quota out twice.
+func (cl *CalendarLimiter) advanceLocked(now time.Time) {
+	if !now.Before(cl.start) && now.Before(cl.end) {
+		return
+	}
+	if !now.Before(cl.end) {
+		cl.count = 0
+	}
+	cl.start, cl.end = cl.bounds(now)
+}
+
+// TryAcquire takes a request from the current period's quota
+func (cl *CalendarLimiter) TryAcquire() bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.advanceLocked(cl.clock.Now())
+	if cl.count >= cl.maxRequests {
+		cl.denied++
+		return false
+	}
+	cl.count++
+	cl.acquired++
+	return true
+}
+
+// Release is a no-op: a request counts against its period's quota until
+// the period ends
+func (cl *CalendarLimiter) Release() {}
+
+// Remaining returns how many requests are left in the current period
+func (cl *CalendarLimiter) Remaining() int {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.advanceLocked(cl.clock.Now())
+	return cl.maxRequests - cl.count
+}
+
+// NextReset returns when the current period ends and the quota resets
+func (cl *CalendarLimiter) NextReset() time.Time {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.advanceLocked(cl.clock.Now())
+	return cl.end
+}
+
+// RetryAfter returns zero if the quota has room, otherwise the time until
+// the period ends
+func (cl *CalendarLimiter) RetryAfter() time.Duration {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	now := cl.clock.Now()
+	cl.advanceLocked(now)
+	if cl.count < cl.maxRequests {
+		return 0
+	}
+	return cl.end.Sub(now)
+}
+
+// Limit returns the requests allowed per period
+func (cl *CalendarLimiter) Limit() int {
+	return cl.maxRequests
+}
+
+// Stats returns the limiter's counters and the current period's usage
+func (cl *CalendarLimiter) Stats() LimiterStats {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	now := cl.clock.Now()
+	cl.advanceLocked(now)
+	return LimiterStats{
+		Acquired:   cl.acquired,
+		Denied:     cl.denied,
+		Current:    cl.count,
+		UntilReset: cl.end.Sub(now),
+	}
+}
+
+// SetHeaders sets the X-RateLimit-* headers for the current period, with
+// the reset at the true period boundary
+func (cl *CalendarLimiter) SetHeaders(w http.ResponseWriter) {
+	cl.mu.Lock()
+	cl.advanceLocked(cl.clock.Now())
+	remaining, reset := cl.maxRequests-cl.count, cl.end
+	cl.mu.Unlock()
+
+	setRateLimitHeaders(w, cl.maxRequests, remaining, reset)
+}
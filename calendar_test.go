@@ -0,0 +1,143 @@
+// calendar_test.go
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	_ "time/tzdata" // so the DST tests don't depend on the host's zoneinfo
+)
+
+func newTestCalendarLimiter(t *testing.T, max int, period Period, now time.Time) (*CalendarLimiter, *FakeClock) {
+	t.Helper()
+	cl, err := NewCalendarLimiter(max, period, now.Location())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := NewFakeClock(now)
+	cl.clock = clock
+	return cl, clock
+}
+
+func eastern(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestCalendarLimiterDailyQuota(t *testing.T) {
+	loc := eastern(t)
+	cl, clock := newTestCalendarLimiter(t, 2, PeriodDay, time.Date(2024, 6, 1, 22, 0, 0, 0, loc))
+	midnight := time.Date(2024, 6, 2, 0, 0, 0, 0, loc)
+
+	if !cl.TryAcquire() || !cl.TryAcquire() || cl.TryAcquire() {
+		t.Fatal("Expected exactly 2 requests on the first day")
+	}
+	if got := cl.RetryAfter(); got != 2*time.Hour {
+		t.Errorf("Expected to retry at midnight in 2h, got %v", got)
+	}
+	if got := cl.NextReset(); !got.Equal(midnight) {
+		t.Errorf("Expected the reset at %v, got %v", midnight, got)
+	}
+
+	clock.Set(midnight.Add(-time.Nanosecond))
+	if cl.TryAcquire() {
+		t.Error("Expected the quota to hold until midnight")
+	}
+	clock.Set(midnight)
+	if !cl.TryAcquire() {
+		t.Error("Expected a fresh quota at midnight")
+	}
+	if stats := cl.Stats(); stats.Acquired != 3 || stats.Denied != 2 || stats.Current != 1 || stats.UntilReset != 24*time.Hour {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestCalendarLimiterDST(t *testing.T) {
+	loc := eastern(t)
+	tests := []struct {
+		name   string
+		period Period
+		now    time.Time
+		length time.Duration
+	}{
+		{"spring forward day", PeriodDay, time.Date(2024, 3, 10, 12, 0, 0, 0, loc), 23 * time.Hour},
+		{"fall back day", PeriodDay, time.Date(2024, 11, 3, 12, 0, 0, 0, loc), 25 * time.Hour},
+		{"ordinary day", PeriodDay, time.Date(2024, 11, 4, 12, 0, 0, 0, loc), 24 * time.Hour},
+		{"february", PeriodMonth, time.Date(2024, 2, 10, 0, 0, 0, 0, loc), 29 * 24 * time.Hour},
+		{"march", PeriodMonth, time.Date(2024, 3, 10, 0, 0, 0, 0, loc), 31*24*time.Hour - time.Hour},
+	}
+	for _, tt := range tests {
+		cl, _ := newTestCalendarLimiter(t, 1, tt.period, tt.now)
+		start, end := cl.bounds(tt.now)
+		if got := end.Sub(start); got != tt.length {
+			t.Errorf("%s: expected a %v period, got %v (%v to %v)", tt.name, tt.length, got, start, end)
+		}
+		if start.In(loc).Hour() != 0 || end.In(loc).Hour() != 0 {
+			t.Errorf("%s: expected the period to run midnight to midnight, got %v to %v", tt.name, start, end)
+		}
+	}
+}
+
+func TestCalendarLimiterHourlyFallBack(t *testing.T) {
+	loc := eastern(t)
+	// 1:30 happens twice on 2024-11-03, first in EDT and an hour later in EST
+	first := time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC).In(loc)
+	cl, clock := newTestCalendarLimiter(t, 1, PeriodHour, first)
+
+	if !cl.TryAcquire() || cl.TryAcquire() {
+		t.Fatal("Expected one request in the first 1:00 hour")
+	}
+	if got := cl.RetryAfter(); got != 30*time.Minute {
+		t.Errorf("Expected the hour to end in 30m, got %v", got)
+	}
+	clock.Advance(time.Hour)
+	if !cl.TryAcquire() {
+		t.Error("Expected the repeated 1:00 hour to have its own quota")
+	}
+}
+
+func TestCalendarLimiterClockStepBack(t *testing.T) {
+	cl, clock := newTestCalendarLimiter(t, 1, PeriodDay, time.Date(2024, 6, 2, 1, 0, 0, 0, time.UTC))
+	cl.TryAcquire()
+
+	// Stepping into yesterday and back must not grant today's quota again
+	clock.Set(time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC))
+	clock.Set(time.Date(2024, 6, 2, 2, 0, 0, 0, time.UTC))
+	if cl.TryAcquire() {
+		t.Error("Expected the used quota to survive a clock step back")
+	}
+}
+
+func TestCalendarLimiterHeaders(t *testing.T) {
+	loc := eastern(t)
+	cl, _ := newTestCalendarLimiter(t, 5, PeriodDay, time.Date(2024, 3, 10, 12, 0, 0, 0, loc))
+	cl.TryAcquire()
+
+	w := httptest.NewRecorder()
+	cl.SetHeaders(w)
+	midnight := time.Date(2024, 3, 11, 0, 0, 0, 0, loc)
+	if got := w.Header().Get("X-RateLimit-Reset"); got != strconv.FormatInt(midnight.Unix(), 10) {
+		t.Errorf("Expected the reset at local midnight %d, got %s", midnight.Unix(), got)
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "4" {
+		t.Errorf("Expected 4 remaining, got %s", got)
+	}
+}
+
+func TestNewCalendarLimiterValidation(t *testing.T) {
+	if _, err := NewCalendarLimiter(0, PeriodDay, nil); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for a zero quota, got %v", err)
+	}
+	if _, err := NewCalendarLimiter(1, Period(7), nil); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for an unknown period, got %v", err)
+	}
+	if cl, err := NewCalendarLimiter(1, PeriodDay, nil); err != nil || cl.loc != time.UTC {
+		t.Errorf("Expected a nil location to mean UTC, got %v, %v", cl, err)
+	}
+}
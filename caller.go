@@ -0,0 +1,54 @@
+// caller.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Caller identifies who is using a resource, e.g. by request ID or
+// principal. Attach one to a context with WithCaller and the resource
+// reports it in its logs, errors and UseEvents.
+type Caller struct {
+	ID   string
+	Name string
+}
+
+// String returns the caller's name, its ID if it has none, or "anonymous"
+// for the zero Caller
+func (c Caller) String() string {
+	switch {
+	case c.Name != "":
+		return c.Name
+	case c.ID != "":
+		return c.ID
+	}
+	return "anonymous"
+}
+
+// callerKey is the context key for WithCaller
+type callerKey struct{}
+
+// WithCaller returns a copy of ctx carrying c
+func WithCaller(ctx context.Context, c Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+// CallerFromContext returns the caller attached with WithCaller, and
+// whether there was one
+func CallerFromContext(ctx context.Context) (Caller, bool) {
+	c, ok := ctx.Value(callerKey{}).(Caller)
+	return c, ok
+}
+
+// callerOf is the caller attached to ctx, or the anonymous zero Caller
+func callerOf(ctx context.Context) Caller {
+	c, _ := CallerFromContext(ctx)
+	return c
+}
+
+// goroutineCaller is the caller behind Use's demo goroutine ids
+func goroutineCaller(id int) Caller {
+	return Caller{ID: strconv.Itoa(id), Name: fmt.Sprintf("Goroutine %d", id)}
+}
@@ -0,0 +1,70 @@
+// caller_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallerFromContext(t *testing.T) {
+	if _, ok := CallerFromContext(context.Background()); ok {
+		t.Error("Expected no caller on a bare context")
+	}
+	c := Caller{ID: "req-42", Name: "billing"}
+	got, ok := CallerFromContext(WithCaller(context.Background(), c))
+	if !ok || got != c {
+		t.Errorf("Expected %+v back, got %+v", c, got)
+	}
+
+	for c, want := range map[Caller]string{
+		{ID: "req-42", Name: "billing"}: "billing",
+		{ID: "req-42"}:                  "req-42",
+		{}:                              "anonymous",
+	} {
+		if c.String() != want {
+			t.Errorf("Expected %+v to print as %q, got %q", c, want, c.String())
+		}
+	}
+}
+
+func TestUseContextPassesCaller(t *testing.T) {
+	var got Caller
+	resource := NewResource("db", 10, 1, WithWork(func(ctx context.Context) error {
+		got = callerOf(ctx)
+		return nil
+	}))
+	billing := Caller{ID: "req-42", Name: "billing"}
+	if err := resource.UseContext(WithCaller(context.Background(), billing)); err != nil {
+		t.Fatal(err)
+	}
+	if got != billing {
+		t.Errorf("Expected the work to see billing, got %+v", got)
+	}
+	resource.Use(3)
+	if got.Name != "Goroutine 3" {
+		t.Errorf("Expected Use's work to see its goroutine, got %+v", got)
+	}
+}
+
+func TestRateLimitErrorNamesCaller(t *testing.T) {
+	resource := NewResource("db", 1, 60, WithMaxConcurrent(2), WithRateLimitMode(RateLimitFailFast),
+		WithClock(NewFakeClock(time.Now())), WithInit(noWork))
+	resource.UseFunc(context.Background(), noWork)
+
+	err := resource.UseFunc(WithCaller(context.Background(), Caller{ID: "req-42"}), noWork)
+	var rle *RateLimitError
+	if !errors.As(err, &rle) || rle.Caller != "req-42" || !strings.Contains(err.Error(), "(caller req-42)") {
+		t.Errorf("Expected the denial to name req-42, got %v", err)
+	}
+	if err := resource.Use(3); err == nil || !strings.Contains(err.Error(), "(caller Goroutine 3)") {
+		t.Errorf("Expected Use's denial to name its goroutine, got %v", err)
+	}
+	// A context without a caller is anonymous
+	err = resource.UseFunc(context.Background(), noWork)
+	if !errors.As(err, &rle) || rle.Caller != "anonymous" {
+		t.Errorf("Expected an anonymous denial, got %v", err)
+	}
+}
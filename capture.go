@@ -0,0 +1,63 @@
+// capture.go
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// CaptureWriter records the lines written to it, for tests that check what
+// a Logger logged. It is safe for concurrent use.
+type CaptureWriter struct {
+	mu      sync.Mutex
+	lines   []string
+	partial string // written since the last newline
+}
+
+// Write records every complete line in p, holding back any trailing
+// partial line until its newline arrives
+func (c *CaptureWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	text := c.partial + string(p)
+	for {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			break
+		}
+		c.lines = append(c.lines, text[:i])
+		text = text[i+1:]
+	}
+	c.partial = text
+	return len(p), nil
+}
+
+// Lines returns the complete lines written so far, without their newlines
+func (c *CaptureWriter) Lines() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.lines...)
+}
+
+// String returns the complete lines written so far, joined by newlines
+func (c *CaptureWriter) String() string {
+	return strings.Join(c.Lines(), "\n")
+}
+
+// Contains reports whether any line written so far contains substr
+func (c *CaptureWriter) Contains(substr string) bool {
+	for _, line := range c.Lines() {
+		if strings.Contains(line, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset forgets every line written so far
+func (c *CaptureWriter) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lines, c.partial = nil, ""
+}
@@ -0,0 +1,83 @@
+// capture_test.go
+package main
+
+import (
+	"os"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+// testLog collects what the tests' resources log through loggers without
+// an output of their own, so go test -v shows only the tests' own output
+var testLog = &CaptureWriter{}
+
+func TestMain(m *testing.M) {
+	defaultOutput = testLog
+	os.Exit(m.Run())
+}
+
+func TestCaptureWriterSplitsLines(t *testing.T) {
+	c := &CaptureWriter{}
+	c.Write([]byte("one\ntw"))
+	c.Write([]byte("o\n"))
+	c.Write([]byte("three"))
+	if got := c.Lines(); len(got) != 2 || got[0] != "one" || got[1] != "two" {
+		t.Errorf("Expected the two complete lines, got %q", got)
+	}
+	c.Write([]byte("\n"))
+	if !c.Contains("three") || c.String() != "one\ntwo\nthree" {
+		t.Errorf("Expected the partial line once finished, got %q", c.String())
+	}
+	c.Reset()
+	if len(c.Lines()) != 0 {
+		t.Errorf("Expected Reset to forget the lines, got %q", c.Lines())
+	}
+}
+
+// fieldsPattern matches one whole tick line
+var fieldsPattern = regexp.MustCompile(`^ts=\S+ level=INFO msg=tick goroutine=\d+ n=\d+$`)
+
+func TestLoggerWritesWholeLines(t *testing.T) {
+	logs := &CaptureWriter{}
+	logger := NewLogger(logs)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Info("tick", NewField("goroutine", i), NewField("n", j))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines := logs.Lines()
+	if len(lines) != 800 {
+		t.Fatalf("Expected 800 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if !fieldsPattern.MatchString(line) {
+			t.Fatalf("Expected a whole line, got %q", line)
+		}
+	}
+}
+
+func TestLoggerSetOutput(t *testing.T) {
+	first, second := &CaptureWriter{}, &CaptureWriter{}
+	logger := NewLogger(first)
+	child := logger.With(ResourceField("db"))
+
+	child.Info("before")
+	logger.SetOutput(second)
+	child.Info("after")
+
+	if !first.Contains("msg=before resource=db") || first.Contains("after") {
+		t.Errorf("Expected only the first line in the first writer, got %q", first.String())
+	}
+	if !second.Contains("msg=after resource=db") || second.Contains("before") {
+		t.Errorf("Expected only the second line in the second writer, got %q", second.String())
+	}
+}
@@ -0,0 +1,162 @@
+// clock.go
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock abstracts time so limiter behaviour can be tested without sleeping
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+	Sleep(d time.Duration)
+}
+
+// Timer is a pending AfterFunc call
+type Timer interface {
+	Stop() bool
+}
+
+// realClock is the Clock backed by the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// FakeClock is a Clock that only moves when Advance is called. Timers fire,
+// and sleepers wake, synchronously inside Advance.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	pending []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	at    time.Time
+	ch    chan time.Time // set for After and Sleep
+	f     func()         // set for AfterFunc
+}
+
+// NewFakeClock creates a fake clock reading now
+func NewFakeClock(now time.Time) *FakeClock {
+	fc := &FakeClock{now: now}
+	fc.cond = sync.NewCond(&fc.mu)
+	return fc
+}
+
+// Now returns the fake clock's current time
+func (fc *FakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+// After returns a channel that receives the time once the clock has been
+// advanced by d
+func (fc *FakeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	fc.add(&fakeTimer{clock: fc, ch: ch}, d)
+	return ch
+}
+
+// AfterFunc calls f once the clock has been advanced by d
+func (fc *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	t := &fakeTimer{clock: fc, f: f}
+	fc.add(t, d)
+	return t
+}
+
+// Sleep blocks until the clock has been advanced by d
+func (fc *FakeClock) Sleep(d time.Duration) {
+	<-fc.After(d)
+}
+
+func (fc *FakeClock) add(t *fakeTimer, d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	t.at = fc.now.Add(d)
+	fc.pending = append(fc.pending, t)
+	fc.cond.Broadcast()
+}
+
+// Advance moves the clock forward by d, firing every timer that comes due
+// in deadline order
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	fc.now = fc.now.Add(d)
+	now := fc.now
+
+	var due []*fakeTimer
+	kept := fc.pending[:0]
+	for _, t := range fc.pending {
+		if t.at.After(now) {
+			kept = append(kept, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	fc.pending = kept
+	fc.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+	for _, t := range due {
+		if t.f != nil {
+			t.f()
+		} else {
+			t.ch <- now
+		}
+	}
+}
+
+// Set moves the clock to t, which may be in the past to simulate a wall
+// clock step. Moving forward fires due timers like Advance; moving back
+// leaves pending timers at their deadlines.
+func (fc *FakeClock) Set(t time.Time) {
+	fc.mu.Lock()
+	d := t.Sub(fc.now)
+	if d < 0 {
+		fc.now = t
+	}
+	fc.mu.Unlock()
+
+	if d > 0 {
+		fc.Advance(d)
+	}
+}
+
+// BlockUntil waits until at least n timers or sleepers are pending, so a
+// test can be sure a goroutine is parked before advancing the clock
+func (fc *FakeClock) BlockUntil(n int) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	for len(fc.pending) < n {
+		fc.cond.Wait()
+	}
+}
+
+// Stop cancels the timer, reporting whether it was still pending
+func (t *fakeTimer) Stop() bool {
+	fc := t.clock
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	for i, p := range fc.pending {
+		if p == t {
+			fc.pending = append(fc.pending[:i], fc.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
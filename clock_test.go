@@ -0,0 +1,54 @@
+// clock_test.go
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFakeClockAdvance(t *testing.T) {
+	start := time.Now()
+	clock := NewFakeClock(start)
+
+	var fired []int
+	clock.AfterFunc(2*time.Second, func() { fired = append(fired, 2) })
+	clock.AfterFunc(time.Second, func() { fired = append(fired, 1) })
+	stopped := clock.AfterFunc(time.Second, func() { fired = append(fired, -1) })
+	after := clock.After(3 * time.Second)
+
+	if !stopped.Stop() {
+		t.Error("Stop on a pending timer should report true")
+	}
+	if stopped.Stop() {
+		t.Error("Second Stop should report false")
+	}
+
+	clock.Advance(2 * time.Second)
+	if !reflect.DeepEqual(fired, []int{1, 2}) {
+		t.Errorf("Expected timers to fire in deadline order, got %v", fired)
+	}
+	select {
+	case <-after:
+		t.Error("After(3s) fired after only 2s")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	if got := <-after; !got.Equal(start.Add(3 * time.Second)) {
+		t.Errorf("Expected After to deliver the fake time, got %v", got)
+	}
+}
+
+func TestFakeClockSleep(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	done := make(chan struct{})
+	go func() {
+		clock.Sleep(time.Minute)
+		close(done)
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-done
+}
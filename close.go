@@ -0,0 +1,151 @@
+// close.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrClosed is returned by blocking calls on a limiter that has been closed
+// and by uses of a closed Resource
+var ErrClosed = errors.New("rate limiter: closed")
+
+// Close shuts the limiter down. Goroutines blocked in Acquire return
+// ErrClosed, WaitChan channels are closed, later acquisitions and
+// reservations fail straight away and the pending window reset timer is
+// stopped, as is the timer reclaiming leases, which end with the limiter.
+// Tokens already held can still be released. It is safe to call more than
+// once.
+func (rl *RateLimiter) Close() error {
+	rl.lock()
+	defer rl.unlock()
+
+	if rl.closed {
+		return nil
+	}
+	rl.closed = true
+
+	if rl.resetTimer != nil {
+		rl.resetTimer.Stop()
+		rl.resetTimer = nil
+	}
+	// Outstanding leases end with the limiter, so nothing is left to reclaim
+	if rl.leaseTimer != nil {
+		rl.leaseTimer.Stop()
+		rl.leaseTimer = nil
+	}
+	for l := range rl.leases {
+		l.done = true
+	}
+	rl.leases = nil
+	rl.failWaitersLocked(ErrClosed)
+	rl.notifyLocked()
+	return nil
+}
+
+// failWaitersLocked wakes every goroutine blocked in Acquire with err
+func (rl *RateLimiter) failWaitersLocked(err error) {
+	for e := rl.waiters.Front(); e != nil; e = rl.waiters.Front() {
+		w := rl.waiters.Remove(e).(*waiter)
+		w.err = err
+		close(w.ready)
+	}
+}
+
+// WithTeardown sets a function Close runs once the resource has drained,
+// e.g. to close a database connection
+func WithTeardown(teardown func(ctx context.Context) error) Option {
+	return func(r *Resource) {
+		r.teardown = teardown
+	}
+}
+
+// Close shuts the resource down. Uses that start afterwards fail with
+// ErrClosed while those in flight are left to finish. Once they have, Close
+// stops the health checks and the idle timer, runs the WithTeardown
+// function unless the idle timer already has since the last use, and
+// closes the limiter if the resource built it itself. Limiters passed in
+// through WithLimiter or WithReadLimiter are left open, as other resources
+// may share them. If ctx ends first Close returns ctx.Err() without tearing
+// down; calling it again waits once more.
+// It is safe to call more than once and from several goroutines, and
+// teardown runs only once.
+func (r *Resource) Close(ctx context.Context) error {
+	select {
+	case <-r.stopUses():
+	case <-ctx.Done():
+		return fmt.Errorf("resource %s: %w", r.name, ctx.Err())
+	}
+
+	r.closeOnce.Do(func() {
+		r.stopHealthChecks()
+		var errs []error
+		if r.teardown != nil && !r.idledOut() {
+			if err := r.teardown(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("resource %s: teardown: %w", r.name, err))
+			}
+		}
+		r.cfgMu.RLock()
+		limiter, owned := r.limiter, r.ownsLimiter
+		r.cfgMu.RUnlock()
+		if c, ok := limiter.(io.Closer); ok && owned {
+			errs = append(errs, c.Close())
+		}
+		if r.callers != nil {
+			errs = append(errs, r.callers.Close())
+		}
+		r.closeErr = errors.Join(errs...)
+		r.setState(ResourceClosed)
+		r.closeEvents(r.closeErr)
+	})
+	return r.closeErr
+}
+
+// stopUses makes later uses fail with ErrClosed, and returns a channel
+// closed once those in flight have finished
+func (r *Resource) stopUses() <-chan struct{} {
+	r.closeMu.Lock()
+	defer r.closeMu.Unlock()
+
+	return r.stopUsesLocked()
+}
+
+func (r *Resource) stopUsesLocked() <-chan struct{} {
+	if !r.closed {
+		r.closed = true
+		r.setState(ResourceClosing)
+		r.stopIdleTimerLocked()
+		r.drained = make(chan struct{})
+		if r.inFlight == 0 {
+			close(r.drained)
+		}
+	}
+	return r.drained
+}
+
+// enter counts a use in flight, or fails with ErrClosed once Close has been
+// called
+func (r *Resource) enter() error {
+	r.closeMu.Lock()
+	defer r.closeMu.Unlock()
+
+	if r.closed {
+		return fmt.Errorf("resource %s: %w", r.name, ErrClosed)
+	}
+	r.inFlight++
+	return nil
+}
+
+// exit ends a use counted by enter, letting Close go ahead after the last
+func (r *Resource) exit() {
+	r.closeMu.Lock()
+	defer r.closeMu.Unlock()
+
+	r.inFlight--
+	r.lastUse = r.clock.Now()
+	if r.closed && r.inFlight == 0 {
+		close(r.drained)
+	}
+}
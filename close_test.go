@@ -0,0 +1,222 @@
+// close_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCloseDrainsWaiters(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 60, WithLimiterClock(clock))
+	limiter.TryAcquire()
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errs <- limiter.Acquire(context.Background()) }()
+	}
+	waitForWaiters(limiter, 2)
+
+	if err := limiter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; !errors.Is(err, ErrClosed) {
+			t.Errorf("Expected ErrClosed for a pending Acquire, got %v", err)
+		}
+	}
+	if limiter.resetTimer != nil {
+		t.Error("Expected the reset timer to be stopped")
+	}
+
+	// The window resetting must not revive the limiter
+	clock.Advance(time.Minute)
+	if limiter.TryAcquire() {
+		t.Error("Expected TryAcquire to fail once closed")
+	}
+	if err := limiter.Acquire(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from Acquire once closed, got %v", err)
+	}
+	if _, err := limiter.Reserve(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from Reserve once closed, got %v", err)
+	}
+	if n := limiter.Stats().Denied; n != 0 {
+		t.Errorf("Expected calls on a closed limiter not to count as denials, got %d", n)
+	}
+
+	if err := limiter.Close(); err != nil {
+		t.Errorf("Expected a second Close to succeed, got %v", err)
+	}
+}
+
+func TestResourceCloseCascades(t *testing.T) {
+	resource, _ := NewResourceFromConfig("test", Config{MaxRequests: 3, Window: time.Minute})
+	limiter := resource.limiter.(*RateLimiter)
+
+	if err := resource.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if limiter.TryAcquire() {
+		t.Error("Expected closing the resource to close its limiter")
+	}
+}
+
+func TestResourceCloseLeavesPassedLimiter(t *testing.T) {
+	limiter := NewRateLimiterDuration(10, time.Hour)
+	a := NewResource("a", 0, 0, WithLimiter(limiter))
+	b := NewResource("b", 0, 0, WithLimiter(limiter))
+
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UseFunc(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Errorf("Expected b to keep using the limiter a was closed with, got %v", err)
+	}
+}
+
+func TestCloseStopsLeaseTimer(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(3, 60, WithLimiterClock(clock))
+	lease, err := limiter.Lease(context.Background(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter.Close()
+
+	clock.mu.Lock()
+	pending := len(clock.pending)
+	clock.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("Expected Close to stop the lease timer, %d timers pending", pending)
+	}
+	clock.Advance(time.Hour)
+	if s := limiter.Stats(); s.ExpiredLeases != 0 {
+		t.Errorf("Expected no leases reclaimed after Close, got %d", s.ExpiredLeases)
+	}
+	if err := lease.Extend(time.Minute); !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("Expected a lease to end with its limiter, got %v", err)
+	}
+	lease.Release()
+	if limiter.leases != nil {
+		t.Errorf("Expected Close to forget the leases, %d left", len(limiter.leases))
+	}
+}
+
+func TestKeyedLimiterCloseClosesKeys(t *testing.T) {
+	kl := NewKeyedLimiter(3, 60)
+	kl.TryAcquire("a")
+	kl.Close()
+	kl.Close()
+
+	if kl.TryAcquire("a") || kl.TryAcquire("b") {
+		t.Error("Expected acquisitions to fail once the keyed limiter is closed")
+	}
+}
+
+func TestResourceCloseDrainsUses(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(e string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}
+	teardowns := 0
+	resource := NewResource("db", 10, 60, WithInit(func(context.Context) error { return nil }),
+		WithTeardown(func(context.Context) error {
+			teardowns++
+			record("teardown")
+			return nil
+		}))
+
+	const users = 3
+	release := make(chan struct{})
+	started := make(chan struct{}, users)
+	var uses sync.WaitGroup
+	for i := 0; i < users; i++ {
+		uses.Add(1)
+		go func() {
+			defer uses.Done()
+			err := resource.UseFunc(context.Background(), func(context.Context) error {
+				started <- struct{}{}
+				<-release
+				record("use")
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Expected an in-flight use to finish, got %v", err)
+			}
+		}()
+	}
+	for i := 0; i < users; i++ {
+		<-started
+	}
+
+	closed := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { closed <- resource.Close(context.Background()) }()
+	}
+	for {
+		resource.closeMu.Lock()
+		c := resource.closed
+		resource.closeMu.Unlock()
+		if c {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := resource.UseFunc(context.Background(), func(context.Context) error { return nil }); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed for a use after Close, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := resource.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Close to give up with its context while uses are in flight, got %v", err)
+	}
+	select {
+	case err := <-closed:
+		t.Errorf("Expected Close to wait for in-flight uses, returned %v", err)
+	default:
+	}
+
+	close(release)
+	uses.Wait()
+	for i := 0; i < 2; i++ {
+		if err := <-closed; err != nil {
+			t.Errorf("Expected Close to succeed once drained, got %v", err)
+		}
+	}
+	if err := resource.Close(context.Background()); err != nil {
+		t.Errorf("Expected closing again to succeed, got %v", err)
+	}
+
+	if teardowns != 1 {
+		t.Errorf("Expected teardown to run once, ran %d times", teardowns)
+	}
+	want := []string{"use", "use", "use", "teardown"}
+	if len(events) != len(want) {
+		t.Fatalf("Expected events %v, got %v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("Expected events %v, got %v", want, events)
+			break
+		}
+	}
+}
+
+func TestResourceCloseTeardownError(t *testing.T) {
+	errHangUp := errors.New("hang up failed")
+	resource := NewResource("db", 10, 60, WithTeardown(func(context.Context) error { return errHangUp }))
+
+	if err := resource.Close(context.Background()); !errors.Is(err, errHangUp) {
+		t.Errorf("Expected Close to return the teardown error, got %v", err)
+	}
+	if err := resource.Close(context.Background()); !errors.Is(err, errHangUp) {
+		t.Errorf("Expected a second Close to report the same error, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+// composite.go
+package main
+
+import "time"
+
+// CompositeLimiter grants a request only when every child limiter does, e.g.
+// a per-user limit combined with a global one
+type CompositeLimiter struct {
+	limiters []Limiter
+}
+
+// NewCompositeLimiter creates a limiter requiring a token from each of
+// limiters, taken in the given order
+func NewCompositeLimiter(limiters ...Limiter) *CompositeLimiter {
+	return &CompositeLimiter{limiters: limiters}
+}
+
+// Allow takes a token from every child. If one denies, the tokens already
+// taken from earlier children are released and the longest retry-after
+// hint among the denying child and the later ones is returned, since a
+// retry needs them all to have room. Children whose Release is a no-op,
+// like the token bucket, don't get their token back.
+func (c *CompositeLimiter) Allow() (bool, time.Duration) {
+	for i, l := range c.limiters {
+		if ok, wait := allow(l); !ok {
+			for _, acquired := range c.limiters[:i] {
+				acquired.Release()
+			}
+			for _, later := range c.limiters[i+1:] {
+				wait = max(wait, retryAfter(later))
+			}
+			return false, wait
+		}
+	}
+	return true, 0
+}
+
+// TryAcquire takes a token from every child or from none
+func (c *CompositeLimiter) TryAcquire() bool {
+	ok, _ := c.Allow()
+	return ok
+}
+
+// Release returns a token to every child
+func (c *CompositeLimiter) Release() {
+	for _, l := range c.limiters {
+		l.Release()
+	}
+}
@@ -0,0 +1,83 @@
+// composite_test.go
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCompositeLimiterAllOrNothing(t *testing.T) {
+	perUser := NewRateLimiter(2, 60)
+	global := NewRateLimiter(3, 60)
+	limiter := NewCompositeLimiter(perUser, global)
+
+	if !limiter.TryAcquire() || !limiter.TryAcquire() {
+		t.Fatal("The first two requests fit both limits")
+	}
+	if limiter.TryAcquire() {
+		t.Fatal("The per-user limit of 2 should deny the third request")
+	}
+	if n := global.Remaining(); n != 1 {
+		t.Errorf("The denied request must not hold a global token, %d remaining", n)
+	}
+
+	// Exhaust the global limit from elsewhere; the per-user token taken
+	// first must be rolled back
+	limiter.Release()
+	global.TryAcquireN(2)
+	if limiter.TryAcquire() {
+		t.Fatal("The exhausted global limit should deny")
+	}
+	if n := perUser.Remaining(); n != 1 {
+		t.Errorf("Expected the per-user token to be released on global denial, %d remaining", n)
+	}
+}
+
+func TestCompositeLimiterReleasePropagates(t *testing.T) {
+	a := NewRateLimiter(1, 60)
+	b := NewRateLimiter(1, 60)
+	limiter := NewCompositeLimiter(a, b)
+
+	limiter.TryAcquire()
+	limiter.Release()
+	if a.Remaining() != 1 || b.Remaining() != 1 {
+		t.Errorf("Release should reach every child, remaining %d and %d", a.Remaining(), b.Remaining())
+	}
+}
+
+func TestCompositeLimiterWithResourceAndMiddleware(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	global := NewRateLimiter(1, 30, WithLimiterClock(clock))
+	limiter := NewCompositeLimiter(NewRateLimiter(5, 60), global)
+
+	resource := NewResource("Shared", 1, 1, WithLimiter(limiter))
+	resource.initDone = true
+	global.TryAcquire()
+	if err := resource.Use(1); err == nil {
+		t.Error("Resource should be denied through the composite limiter")
+	}
+
+	rec := httptest.NewRecorder()
+	Middleware(limiter, okHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 through the composite limiter, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Expected the denying child's Retry-After of 30, got %q", got)
+	}
+}
+
+func TestCompositeLimiterLongestRetryAfter(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	perSecond := newRateLimiter(1, time.Second, 1, WithLimiterClock(clock))
+	perHour := newRateLimiter(1, time.Hour, 1, WithLimiterClock(clock))
+	limiter := NewCompositeLimiter(perSecond, perHour)
+
+	limiter.TryAcquire()
+	// The seconds limiter denies first, but the hour one is full too
+	if ok, retryAfter := limiter.Allow(); ok || retryAfter != time.Hour {
+		t.Errorf("Expected a denial for the hour, got %v and %v", ok, retryAfter)
+	}
+}
@@ -0,0 +1,80 @@
+// config.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidConfig is wrapped by every error Config.Validate returns
+var ErrInvalidConfig = errors.New("rate limiter: invalid config")
+
+// Config describes a RateLimiter with named fields, so limits can't be
+// confused with window lengths
+type Config struct {
+	// MaxRequests is the sustained number of requests allowed per window
+	MaxRequests int
+	// Window is how long each window lasts
+	Window time.Duration
+	// Burst is the most requests a single window can allow once quiet
+	// windows have let capacity accumulate. Zero means MaxRequests.
+	Burst int
+	// Clock is where the limiter reads time from. Nil means the real clock.
+	Clock Clock
+}
+
+// Validate reports the first problem with c, if any
+func (c Config) Validate() error {
+	switch {
+	case c.MaxRequests <= 0:
+		return fmt.Errorf("%w: MaxRequests must be positive, got %d", ErrInvalidConfig, c.MaxRequests)
+	case c.Window <= 0:
+		return fmt.Errorf("%w: Window must be positive, got %v", ErrInvalidConfig, c.Window)
+	case c.Burst < 0:
+		return fmt.Errorf("%w: Burst must not be negative, got %d", ErrInvalidConfig, c.Burst)
+	case c.Burst != 0 && c.Burst < c.MaxRequests:
+		return fmt.Errorf("%w: Burst %d is below MaxRequests %d", ErrInvalidConfig, c.Burst, c.MaxRequests)
+	}
+	return nil
+}
+
+// NewRateLimiterFromConfig creates a rate limiter described by cfg, or
+// returns an error wrapping ErrInvalidConfig if cfg doesn't validate. opts
+// are applied after the config, so they win over it.
+func NewRateLimiterFromConfig(cfg Config, opts ...LimiterOption) (*RateLimiter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Clock != nil {
+		opts = append([]LimiterOption{WithLimiterClock(cfg.Clock)}, opts...)
+	}
+	return newRateLimiter(cfg.MaxRequests, cfg.Window, cfg.Burst, opts...), nil
+}
+
+// NewResourceFromConfig creates a resource whose rate limiter is described
+// by cfg. A nil cfg.Clock falls back to the one set with WithClock. The
+// config is validated even if WithLimiter replaces the limiter. With
+// WithRegistry, a name that is already registered is an error.
+func NewResourceFromConfig(name string, cfg Config, opts ...Option) (*Resource, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("resource %s: %w", name, err)
+	}
+
+	r := newResource(name, opts)
+	if r.limiter == nil {
+		if cfg.Clock == nil {
+			cfg.Clock = r.clock
+		}
+		rl, err := NewRateLimiterFromConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		r.limiter = rl
+		r.ownsLimiter = true
+	}
+	if err := r.register(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
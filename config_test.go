@@ -0,0 +1,76 @@
+// config_test.go
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{"valid", Config{MaxRequests: 3, Window: time.Second}, true},
+		{"with burst", Config{MaxRequests: 3, Window: time.Second, Burst: 10}, true},
+		{"zero max", Config{Window: time.Second}, false},
+		{"negative max", Config{MaxRequests: -1, Window: time.Second}, false},
+		{"zero window", Config{MaxRequests: 3}, false},
+		{"negative window", Config{MaxRequests: 3, Window: -time.Second}, false},
+		{"negative burst", Config{MaxRequests: 3, Window: time.Second, Burst: -1}, false},
+		{"burst below max", Config{MaxRequests: 3, Window: time.Second, Burst: 2}, false},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.Validate()
+		if tt.ok && err != nil {
+			t.Errorf("%s: Expected no error, got %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: Expected ErrInvalidConfig, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestNewRateLimiterFromConfig(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter, err := NewRateLimiterFromConfig(Config{MaxRequests: 2, Window: time.Minute, Burst: 4, Clock: clock})
+	if err != nil {
+		t.Fatalf("Expected a valid config, got %v", err)
+	}
+
+	// The limiter starts with the full burst and then sustains 2 a window,
+	// read from the configured clock
+	if !limiter.TryAcquireN(4) || limiter.TryAcquire() {
+		t.Error("Expected the first window to allow exactly the burst of 4")
+	}
+	clock.Advance(time.Minute)
+	if n := limiter.Remaining(); n != 2 {
+		t.Errorf("Expected 2 remaining in the next window, got %d", n)
+	}
+
+	if _, err := NewRateLimiterFromConfig(Config{MaxRequests: 1}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for a missing window, got %v", err)
+	}
+}
+
+func TestNewResourceFromConfig(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	resource, err := NewResourceFromConfig("test", Config{MaxRequests: 1, Window: time.Second}, WithClock(clock))
+	if err != nil {
+		t.Fatalf("Expected a valid config, got %v", err)
+	}
+
+	limiter := resource.limiter.(*RateLimiter)
+	if limiter.clock != clock {
+		t.Error("Expected the limiter to use the resource's clock")
+	}
+	if !limiter.TryAcquire() || limiter.TryAcquire() {
+		t.Error("Expected the limiter to allow exactly 1")
+	}
+
+	if _, err := NewResourceFromConfig("test", Config{Window: time.Second}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for a missing limit, got %v", err)
+	}
+}
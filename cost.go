@@ -0,0 +1,116 @@
+// cost.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrInvalidCost is returned for costs that aren't positive
+	ErrInvalidCost = errors.New("rate limiter: cost must be positive")
+	// ErrCostExceedsLimit is returned for costs larger than any window
+	// can grant, which would otherwise wait forever
+	ErrCostExceedsLimit = errors.New("rate limiter: cost exceeds limit")
+)
+
+// TryAcquireCost attempts to take cost units from the current window.
+// Heavier operations can charge more than one unit of the limit.
+func (rl *RateLimiter) TryAcquireCost(cost int) bool {
+	return rl.TryAcquireN(cost)
+}
+
+// ReleaseCost returns cost units taken by TryAcquireCost or AcquireCost
+func (rl *RateLimiter) ReleaseCost(cost int) {
+	rl.ReleaseN(cost)
+}
+
+// checkCostLocked rejects costs that can never be granted
+func (rl *RateLimiter) checkCostLocked(cost int) error {
+	if cost <= 0 {
+		return ErrInvalidCost
+	}
+	if cost > rl.burst {
+		return fmt.Errorf("%w: cost %d, limit %d", ErrCostExceedsLimit, cost, rl.burst)
+	}
+	return nil
+}
+
+// costLimiter is implemented by limiters that can charge several units at
+// once
+type costLimiter interface {
+	TryAcquireCost(cost int) bool
+	ReleaseCost(cost int)
+	checkCost(cost int) error
+}
+
+func (rl *RateLimiter) checkCost(cost int) error {
+	rl.lock()
+	defer rl.unlock()
+
+	return rl.checkCostLocked(cost)
+}
+
+// UseCost is like Use but charges cost units of the resource's limit
+func (r *Resource) UseCost(id, cost int) error {
+	return r.use(WithCaller(context.Background(), goroutineCaller(id)), false, AccessWrite, cost, r.workFunc())
+}
+
+// UseWeighted is like UseFunc but charges cost units of the resource's
+// limit, for operations heavier than most. A cost the limiter could never
+// grant in one window fails straight away with ErrCostExceedsLimit instead
+// of waiting forever, as does a cost other than 1 on a limiter that can't
+// charge several units at once. Exactly cost units are given back when fn
+// returns or panics, unless WithMaxConcurrent keeps tokens for the window.
+func (r *Resource) UseWeighted(ctx context.Context, cost int, fn func(ctx context.Context) error) error {
+	return r.useWaiting(ctx, AccessWrite, cost, fn)
+}
+
+// checkCost rejects a cost the resource's limiter can never grant
+func (r *Resource) checkCost(l Limiter, cost int) error {
+	if cost == 1 {
+		return nil
+	}
+	cl, ok := l.(costLimiter)
+	if !ok {
+		return fmt.Errorf("limiter for resource %s does not support weighted use", r.name)
+	}
+	if err := cl.checkCost(cost); err != nil {
+		return fmt.Errorf("resource %s: %w", r.name, err)
+	}
+	return nil
+}
+
+// acquireCost takes cost units from a limiter checkCost has accepted,
+// waiting for them until ctx is done if wait is set and the limiter can
+func (r *Resource) acquireCost(ctx context.Context, l Limiter, wait bool, cost int) error {
+	if a, ok := l.(interface {
+		AcquireCost(ctx context.Context, cost int) error
+	}); ok && wait {
+		if err := a.AcquireCost(ctx, cost); err != nil {
+			return fmt.Errorf("resource %s: %w", r.name, err)
+		}
+		return nil
+	}
+	if !l.(costLimiter).TryAcquireCost(cost) {
+		var retryAfter time.Duration
+		if ra, ok := l.(interface{ RetryAfter() time.Duration }); ok {
+			retryAfter = ra.RetryAfter()
+		}
+		rle := newRateLimitError(r.name, l, retryAfter)
+		rle.Caller = callerOf(ctx).String()
+		return rle
+	}
+	return nil
+}
+
+// releaseCost gives back the cost units a use took
+func (r *Resource) releaseCost(l Limiter, cost int) {
+	if cost == 1 {
+		l.Release()
+		return
+	}
+	l.(costLimiter).ReleaseCost(cost)
+}
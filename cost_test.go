@@ -0,0 +1,152 @@
+// cost_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterCost(t *testing.T) {
+	limiter := NewRateLimiter(30, 60)
+
+	if !limiter.TryAcquireCost(25) {
+		t.Fatal("An export costing 25 of 30 units should succeed")
+	}
+	if limiter.TryAcquireCost(6) {
+		t.Error("6 more units with only 5 left should fail")
+	}
+	for i := 0; i < 5; i++ {
+		if !limiter.TryAcquireCost(1) {
+			t.Errorf("Status call %d costing 1 unit should succeed", i+1)
+		}
+	}
+
+	limiter.ReleaseCost(25)
+	if !limiter.TryAcquireCost(25) {
+		t.Error("Releasing 25 units should make room for another export")
+	}
+}
+
+func TestAcquireCostTooLarge(t *testing.T) {
+	limiter := NewRateLimiter(10, 60)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := limiter.AcquireCost(ctx, 11)
+	if !errors.Is(err, ErrCostExceedsLimit) {
+		t.Errorf("Expected ErrCostExceedsLimit, got %v", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("An impossible cost should fail immediately, not wait")
+	}
+	if err := limiter.AcquireCost(ctx, 0); !errors.Is(err, ErrInvalidCost) {
+		t.Errorf("Expected ErrInvalidCost, got %v", err)
+	}
+}
+
+func TestAcquireCostWaitsForRelease(t *testing.T) {
+	limiter := NewRateLimiter(10, 60)
+	limiter.TryAcquireCost(8)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- limiter.AcquireCost(context.Background(), 5)
+	}()
+	waitForWaiters(limiter, 1)
+
+	// Freeing 2 units leaves 4 available, still not enough
+	limiter.ReleaseCost(2)
+	select {
+	case err := <-done:
+		t.Fatalf("AcquireCost returned with too few units free: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	limiter.ReleaseCost(1)
+	if err := <-done; err != nil {
+		t.Errorf("AcquireCost should succeed once 5 units are free, got %v", err)
+	}
+}
+
+func TestResourceUseCost(t *testing.T) {
+	resource := NewResource("Reports", 30, 60)
+	resource.initDone = true
+
+	if err := resource.UseCost(1, 31); !errors.Is(err, ErrCostExceedsLimit) {
+		t.Errorf("Expected ErrCostExceedsLimit, got %v", err)
+	}
+	if err := resource.UseCost(1, 25); err != nil {
+		t.Errorf("Expected a cost of 25 to fit, got %v", err)
+	}
+
+	bucket := NewResource("Bucket", 1, 1, WithLimiter(NewTokenBucketLimiter(1, 5)))
+	bucket.initDone = true
+	if err := bucket.UseCost(1, 2); err == nil {
+		t.Error("Expected weighted use to fail on a limiter without cost support")
+	}
+}
+
+func TestResourceUseWeighted(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	resource := NewResource("Reports", 10, 60, WithClock(clock), WithInit(noWork))
+	limiter := resource.limiter.(*RateLimiter)
+
+	// A cost no window can grant fails at once rather than waiting
+	if err := resource.UseWeighted(context.Background(), 11, noWork); !errors.Is(err, ErrCostExceedsLimit) {
+		t.Errorf("Expected ErrCostExceedsLimit, got %v", err)
+	}
+
+	err := resource.UseWeighted(context.Background(), 4, func(context.Context) error {
+		if n := limiter.Remaining(); n != 6 {
+			t.Errorf("Expected the work to hold 4 units, %d remaining", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := limiter.Remaining(); n != 10 {
+		t.Errorf("Expected all 4 units back after the use, %d remaining", n)
+	}
+
+	// A panicking use still gives back exactly its cost
+	func() {
+		defer func() { recover() }()
+		resource.UseWeighted(context.Background(), 3, func(context.Context) error { panic("boom") })
+	}()
+	if n := limiter.Remaining(); n != 10 {
+		t.Errorf("Expected the panicking use's 3 units back, %d remaining", n)
+	}
+
+	if m := resource.Metrics(); m.Uses != 2 || m.Units != 7 {
+		t.Errorf("Expected 2 uses charged 7 units, got %+v", m)
+	}
+
+	bucket := NewResource("Bucket", 1, 1, WithLimiter(NewTokenBucketLimiter(1, 5)), WithInit(noWork))
+	if err := bucket.UseWeighted(context.Background(), 2, noWork); err == nil {
+		t.Error("Expected weighted use to fail on a limiter without cost support")
+	}
+}
+
+func TestResourceUseWeightedWaits(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	resource := NewResource("Reports", 10, 60, WithClock(clock), WithMaxConcurrent(5), WithInit(noWork))
+	limiter := resource.limiter.(*RateLimiter)
+	if err := resource.UseWeighted(context.Background(), 6, noWork); err != nil {
+		t.Fatal(err)
+	}
+
+	// With the cap the units stay charged for the window, so the next
+	// heavy use waits for the next one
+	errs := make(chan error, 1)
+	go func() { errs <- resource.UseWeighted(context.Background(), 6, noWork) }()
+	waitForWaiters(limiter, 1)
+	clock.Advance(time.Minute)
+	if err := <-errs; err != nil {
+		t.Errorf("Expected the heavy use to get the next window, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+// errors.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrRateLimited is matched by every RateLimitError
+	ErrRateLimited = errors.New("rate limit exceeded")
+	// ErrTooManyConcurrent is returned by Resource.Use when a resource
+	// with WithMaxConcurrent is already at capacity
+	ErrTooManyConcurrent = errors.New("too many concurrent users")
+	// ErrInitFailed wraps the error from a resource's initialization,
+	// returned by every use once it has failed
+	ErrInitFailed = errors.New("resource initialization failed")
+	// ErrUseTimeout is returned by a use whose work outlasted the
+	// resource's WithUseTimeout
+	ErrUseTimeout = errors.New("resource use timed out")
+	// ErrCallerLimited is matched by a RateLimitError from a caller's own
+	// WithPerCallerLimit quota, and wraps ErrRateLimited
+	ErrCallerLimited = fmt.Errorf("caller %w", ErrRateLimited)
+	// ErrPanic is matched by every PanicError
+	ErrPanic = errors.New("resource work panicked")
+)
+
+// PanicError is a panic in a use's work, returned by the use with
+// WithPanicRecovery and reported to the OnError hooks either way
+type PanicError struct {
+	Resource string
+	Value    any    // what the work panicked with
+	Stack    []byte // the panicking goroutine's stack
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("resource %s: panic: %v", e.Resource, e.Value)
+}
+
+// Unwrap lets errors.Is match ErrPanic
+func (e *PanicError) Unwrap() error {
+	return ErrPanic
+}
+
+// RateLimitError is returned when a limiter denies a request: by
+// Resource.Use, and by the HTTP and gRPC middlewares, which turn it into
+// their own responses
+type RateLimitError struct {
+	Resource   string        // resource name, or the HTTP path or gRPC method
+	Limit      int           // the limit in force, or zero if the limiter can't say
+	RetryAfter time.Duration // hint for when to try again, or zero if unknown
+	Caller     string        // who was denied, for uses of a Resource
+	PerCaller  bool          // the caller's own quota was the one spent, see WithPerCallerLimit
+}
+
+func (e *RateLimitError) Error() string {
+	var err error = ErrRateLimited
+	if e.PerCaller {
+		err = ErrCallerLimited
+	}
+	if e.Caller != "" {
+		return fmt.Sprintf("%v for resource %s (caller %s)", err, e.Resource, e.Caller)
+	}
+	return fmt.Sprintf("%v for resource %s", err, e.Resource)
+}
+
+// Unwrap lets errors.Is match ErrRateLimited, and ErrCallerLimited for a
+// per-caller denial
+func (e *RateLimitError) Unwrap() error {
+	if e.PerCaller {
+		return ErrCallerLimited
+	}
+	return ErrRateLimited
+}
+
+// newRateLimitError describes a denial by l, filling in its limit if it
+// reports one
+func newRateLimitError(resource string, l any, retryAfter time.Duration) *RateLimitError {
+	err := &RateLimitError{Resource: resource, RetryAfter: retryAfter}
+	if lim, ok := l.(interface{ Limit() int }); ok {
+		err.Limit = lim.Limit()
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+// events.go
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventKind is what happened in an Event
+type EventKind int
+
+const (
+	// EventInit follows each initialization attempt, with its duration and
+	// error
+	EventInit EventKind = iota
+	// EventAcquire follows a use taking its slot and token
+	EventAcquire
+	// EventDeny follows a use turned away by the limiter or the concurrency
+	// cap
+	EventDeny
+	// EventRelease follows a use's work and the return of its slot and
+	// token
+	EventRelease
+	// EventError follows every failed use, denied ones included
+	EventError
+	// EventClose follows Close tearing the resource down, with the
+	// teardown's error. It is the last event sent.
+	EventClose
+	// EventReconfigure follows Reconfigure applying a change, described
+	// by the event's Config
+	EventReconfigure
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventInit:
+		return "init"
+	case EventAcquire:
+		return "acquire"
+	case EventDeny:
+		return "deny"
+	case EventRelease:
+		return "release"
+	case EventError:
+		return "error"
+	case EventClose:
+		return "close"
+	case EventReconfigure:
+		return "reconfigure"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event is sent to the resource's subscribers, see Subscribe
+type Event struct {
+	Kind EventKind
+	Time time.Time
+	UseEvent
+	Config *ConfigChange // for EventReconfigure, nil otherwise
+
+	// Dropped counts the events this subscriber missed just before this
+	// one because its buffer was full
+	Dropped uint64
+}
+
+// eventSubs are a resource's subscribers
+type eventSubs struct {
+	mu     sync.Mutex
+	subs   map[*subscriber]struct{}
+	closed bool // by Close; no events follow
+}
+
+// subscriber is one Subscribe call's channel
+type subscriber struct {
+	ch      chan Event
+	dropped uint64 // since the last event delivered
+}
+
+// Subscribe returns a channel of the resource's events, buffering up to
+// buffer of them, and a func that unsubscribes and closes the channel.
+// Events are never waited on: when the buffer is full they are dropped and
+// counted in the next one delivered, so a slow subscriber only loses events
+// and never holds up uses. The channel is closed after EventClose, and
+// straight away when subscribing to a closed resource.
+func (r *Resource) Subscribe(buffer int) (<-chan Event, func()) {
+	s := &subscriber{ch: make(chan Event, max(buffer, 0))}
+
+	r.events.mu.Lock()
+	defer r.events.mu.Unlock()
+
+	if r.events.closed {
+		close(s.ch)
+		return s.ch, func() {}
+	}
+	if r.events.subs == nil {
+		r.events.subs = make(map[*subscriber]struct{})
+	}
+	r.events.subs[s] = struct{}{}
+	return s.ch, func() {
+		r.events.mu.Lock()
+		defer r.events.mu.Unlock()
+
+		if _, ok := r.events.subs[s]; ok {
+			delete(r.events.subs, s)
+			close(s.ch)
+		}
+	}
+}
+
+// publish sends an event to every subscriber that has room for it
+func (r *Resource) publish(kind EventKind, ev UseEvent) {
+	r.publishEvent(Event{Kind: kind, UseEvent: ev})
+}
+
+// publishEvent is publish for an event with more than a UseEvent, stamping
+// it with the time
+func (r *Resource) publishEvent(e Event) {
+	r.events.mu.Lock()
+	defer r.events.mu.Unlock()
+
+	if len(r.events.subs) == 0 {
+		return
+	}
+	e.Time = r.clock.Now()
+	for s := range r.events.subs {
+		e.Dropped = s.dropped
+		select {
+		case s.ch <- e:
+			s.dropped = 0
+		default:
+			s.dropped++
+		}
+	}
+}
+
+// closeEvents sends EventClose and closes every subscriber's channel
+func (r *Resource) closeEvents(err error) {
+	r.publish(EventClose, UseEvent{Resource: r.name, Err: err})
+
+	r.events.mu.Lock()
+	defer r.events.mu.Unlock()
+
+	r.events.closed = true
+	for s := range r.events.subs {
+		close(s.ch)
+	}
+	r.events.subs = nil
+}
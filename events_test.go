@@ -0,0 +1,133 @@
+// events_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// drain collects the events buffered on ch
+func drain(ch <-chan Event) []Event {
+	var events []Event
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func kinds(events []Event) []EventKind {
+	k := make([]EventKind, len(events))
+	for i, e := range events {
+		k[i] = e.Kind
+	}
+	return k
+}
+
+func expectKinds(t *testing.T, events []Event, want ...EventKind) {
+	t.Helper()
+	got := kinds(events)
+	if len(got) != len(want) {
+		t.Fatalf("Expected events %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected events %v, got %v", want, got)
+		}
+	}
+}
+
+func TestResourceSubscribe(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	resource := NewResource("db", 1, 60, WithClock(clock), WithMaxConcurrent(2), WithRateLimitMode(RateLimitFailFast))
+	events, unsubscribe := resource.Subscribe(16)
+	defer unsubscribe()
+
+	ctx := WithCaller(context.Background(), Caller{ID: "req-1"})
+	resource.UseFunc(ctx, noWork)
+	got := drain(events)
+	expectKinds(t, got, EventInit, EventAcquire, EventRelease)
+	for _, e := range got {
+		if e.Resource != "db" || e.Caller.ID != "req-1" || !e.Time.Equal(clock.Now()) {
+			t.Errorf("Expected a timestamped event for req-1 on db, got %+v", e)
+		}
+	}
+
+	// The window's only token is gone, so the next use is denied
+	err := resource.UseFunc(context.Background(), noWork)
+	got = drain(events)
+	expectKinds(t, got, EventDeny, EventError)
+	if !errors.Is(got[0].Err, ErrRateLimited) || got[1].Err != err {
+		t.Errorf("Expected the denial's error in both events, got %v and %v", got[0].Err, got[1].Err)
+	}
+
+	clock.Advance(time.Minute)
+	errQuery := errors.New("query failed")
+	resource.UseFunc(context.Background(), func(context.Context) error { return errQuery })
+	got = drain(events)
+	expectKinds(t, got, EventAcquire, EventRelease, EventError)
+	if !errors.Is(got[2].Err, errQuery) {
+		t.Errorf("Expected the work's error, got %v", got[2].Err)
+	}
+
+	resource.Close(context.Background())
+	expectKinds(t, drain(events), EventClose)
+	if _, ok := <-events; ok {
+		t.Error("Expected the channel to be closed after EventClose")
+	}
+	late, _ := resource.Subscribe(1)
+	if _, ok := <-late; ok {
+		t.Error("Expected subscribing to a closed resource to give a closed channel")
+	}
+}
+
+func TestResourceSubscribeSlowSubscriber(t *testing.T) {
+	resource := NewResource("db", 100, 60)
+	events, unsubscribe := resource.Subscribe(1)
+
+	// Nobody reads, and uses go ahead regardless
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			resource.UseFunc(context.Background(), noWork)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a full subscriber not to block uses")
+	}
+
+	// Only the first event fit; the next one delivered says how many were lost
+	if e := <-events; e.Kind != EventInit || e.Dropped != 0 {
+		t.Errorf("Expected the init event with nothing dropped, got %+v", e)
+	}
+	resource.UseFunc(context.Background(), noWork)
+	if e := <-events; e.Kind != EventAcquire || e.Dropped != 10 {
+		t.Errorf("Expected an acquire after 10 dropped events, got %+v", e)
+	}
+
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-events; ok {
+		t.Error("Expected unsubscribing to close the channel")
+	}
+	resource.UseFunc(context.Background(), noWork)
+}
+
+func TestEventKindString(t *testing.T) {
+	for kind, want := range map[EventKind]string{EventInit: "init", EventDeny: "deny", EventClose: "close", EventKind(9): "EventKind(9)"} {
+		if kind.String() != want {
+			t.Errorf("Expected %q, got %q", want, kind.String())
+		}
+	}
+}
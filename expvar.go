@@ -0,0 +1,58 @@
+// expvar.go
+package main
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+// ErrExpvarExists is returned when publishing under a name expvar already
+// has
+var ErrExpvarExists = errors.New("rate limiter: expvar name already published")
+
+// expvarMu serializes the check and publish, since expvar.Publish panics
+// on duplicates
+var expvarMu sync.Mutex
+
+// PublishExpvar publishes the limiter's Stats under name, so they show up
+// live in /debug/vars. Publishing a name that is already taken returns
+// ErrExpvarExists instead of panicking like expvar.Publish.
+func (rl *RateLimiter) PublishExpvar(name string) error {
+	return publishStats(name, rl)
+}
+
+// PublishExpvar publishes the Stats of the resource's limiter under name,
+// following it through Reconfigure. It fails if the limiter doesn't report
+// stats.
+func (r *Resource) PublishExpvar(name string) error {
+	if _, err := r.LimiterStats(); err != nil {
+		return err
+	}
+	return publishFunc(name, func() any {
+		stats, _ := r.LimiterStats()
+		return stats
+	})
+}
+
+// PublishMetricsExpvar publishes the resource's Inspect snapshot under
+// name. Its Metrics are at the top level, as they are in the snapshot.
+func (r *Resource) PublishMetricsExpvar(name string) error {
+	return publishFunc(name, func() any { return r.Inspect() })
+}
+
+func publishStats(name string, s statsSource) error {
+	return publishFunc(name, func() any { return s.Stats() })
+}
+
+func publishFunc(name string, f func() any) error {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("%w: %s", ErrExpvarExists, name)
+	}
+	expvar.Publish(name, expvar.Func(f))
+	return nil
+}
@@ -0,0 +1,74 @@
+// expvar_test.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func ExampleRateLimiter_PublishExpvar() {
+	limiter := NewRateLimiter(2, 60)
+	if err := limiter.PublishExpvar("example_limiter"); err != nil {
+		fmt.Println(err)
+		return
+	}
+	limiter.TryAcquire()
+	limiter.TryAcquire()
+	limiter.TryAcquire()
+
+	rec := httptest.NewRecorder()
+	expvar.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+
+	var vars struct {
+		Limiter LimiterStats `json:"example_limiter"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&vars); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(vars.Limiter.Acquired, vars.Limiter.Denied, vars.Limiter.Current)
+	// Output: 2 1 2
+}
+
+// expvarNames numbers the names expvarName hands out
+var expvarNames atomic.Int64
+
+// expvarName returns a name for t to publish that no earlier run has, as
+// expvar names are process-wide and can't be unpublished
+func expvarName(t *testing.T) string {
+	return fmt.Sprintf("%s_%d", t.Name(), expvarNames.Add(1))
+}
+
+func TestPublishExpvarTwice(t *testing.T) {
+	limiter := NewRateLimiter(2, 60)
+	name := expvarName(t)
+	if err := limiter.PublishExpvar(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.PublishExpvar(name); !errors.Is(err, ErrExpvarExists) {
+		t.Errorf("Expected ErrExpvarExists for a second publish, got %v", err)
+	}
+}
+
+func TestResourcePublishExpvar(t *testing.T) {
+	resource, _ := NewResourceFromConfig("test", Config{MaxRequests: 2, Window: time.Minute})
+	name := expvarName(t)
+	if err := resource.PublishExpvar(name); err != nil {
+		t.Fatal(err)
+	}
+	if expvar.Get(name) == nil {
+		t.Error("Expected the resource's stats to be published")
+	}
+
+	noStats, _ := NewResourceFromConfig("test", Config{MaxRequests: 1, Window: time.Second}, WithLimiter(NewTokenBucketLimiter(1, 1)))
+	if err := noStats.PublishExpvar("test_no_stats"); err == nil {
+		t.Error("Expected an error for a limiter without stats")
+	}
+}
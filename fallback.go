@@ -0,0 +1,146 @@
+// fallback.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// FallbackPolicy is when a FallbackResource passes a use on from its
+// primary to its secondary
+type FallbackPolicy struct {
+	// OnRateLimited falls back when the primary's limiter or concurrency
+	// cap turns the use away
+	OnRateLimited bool
+	// OnUnhealthy falls back when the primary is unhealthy or its circuit
+	// breaker is open
+	OnUnhealthy bool
+	// OnError reports whether any other error from the primary, such as
+	// one from the work itself, is worth trying on the secondary. Nil means
+	// none is.
+	OnError func(error) bool
+}
+
+// DefaultFallbackPolicy falls back when the primary is busy or unhealthy
+var DefaultFallbackPolicy = FallbackPolicy{OnRateLimited: true, OnUnhealthy: true}
+
+// shouldFallBack reports whether the policy passes err on to the secondary
+func (p FallbackPolicy) shouldFallBack(err error) bool {
+	switch {
+	case errors.Is(err, ErrRateLimited), errors.Is(err, ErrTooManyConcurrent), errors.Is(err, ErrQueueFull):
+		return p.OnRateLimited
+	case errors.Is(err, ErrUnhealthy), errors.Is(err, ErrCircuitOpen):
+		return p.OnUnhealthy
+	}
+	return p.OnError != nil && p.OnError(err)
+}
+
+// FallbackError is returned by a FallbackResource use that failed, saying
+// which backend had the last word
+type FallbackError struct {
+	Backend string // name of the resource whose error Err is
+	Primary error  // why the primary was passed over, nil if it failed itself
+	Err     error
+}
+
+func (e *FallbackError) Error() string {
+	if e.Primary != nil {
+		return fmt.Sprintf("fallback to %s: %v (primary: %v)", e.Backend, e.Err, e.Primary)
+	}
+	return fmt.Sprintf("served by %s: %v", e.Backend, e.Err)
+}
+
+// Unwrap lets errors.Is and errors.As see both backends' errors
+func (e *FallbackError) Unwrap() []error {
+	if e.Primary != nil {
+		return []error{e.Err, e.Primary}
+	}
+	return []error{e.Err}
+}
+
+// FallbackMetrics counts which backend served a FallbackResource's uses
+type FallbackMetrics struct {
+	Primary   uint64 // uses the primary handled, failed or not
+	Secondary uint64 // uses passed on to the secondary
+	Failed    uint64 // uses that failed on whichever backend handled them
+}
+
+// FallbackResource uses a primary resource and, when the primary turns a
+// use away, a secondary such as a read replica. Each backend's own limits
+// apply to the uses it handles.
+type FallbackResource struct {
+	primary, secondary *Resource
+	policy             FallbackPolicy
+
+	mu      sync.Mutex
+	metrics FallbackMetrics
+}
+
+// NewFallbackResource creates a resource that falls back from primary to
+// secondary as policy says
+func NewFallbackResource(primary, secondary *Resource, policy FallbackPolicy) *FallbackResource {
+	return &FallbackResource{primary: primary, secondary: secondary, policy: policy}
+}
+
+// Use runs the primary's WithWork function, or failing that the
+// secondary's, like Resource.Use does: neither waits when full
+func (f *FallbackResource) Use(id int) error {
+	ctx := WithCaller(context.Background(), goroutineCaller(id))
+	return f.run(ctx,
+		func(r *Resource) error { return r.use(ctx, false, AccessWrite, 1, r.workFunc()) },
+		func(r *Resource) error { return r.use(ctx, false, AccessWrite, 1, r.workFunc()) })
+}
+
+// UseFunc runs fn on the primary if it takes the use straight away, and
+// otherwise, as the policy says, on the secondary. The primary is never
+// waited for, since the point is not to; the secondary is used like
+// UseFunc, waiting until ctx is done if it is full.
+func (f *FallbackResource) UseFunc(ctx context.Context, fn func(ctx context.Context) error) error {
+	return f.run(ctx,
+		func(r *Resource) error { return r.use(ctx, false, AccessWrite, 1, fn) },
+		func(r *Resource) error { return r.UseFunc(ctx, fn) })
+}
+
+// run tries the primary, then the secondary if the policy allows
+func (f *FallbackResource) run(ctx context.Context, primary, secondary func(*Resource) error) error {
+	err := primary(f.primary)
+	if err == nil || ctx.Err() != nil || !f.policy.shouldFallBack(err) {
+		f.record(false, err)
+		if err != nil {
+			return &FallbackError{Backend: f.primary.name, Err: err}
+		}
+		return nil
+	}
+
+	serr := secondary(f.secondary)
+	f.record(true, serr)
+	if serr != nil {
+		return &FallbackError{Backend: f.secondary.name, Primary: err, Err: serr}
+	}
+	return nil
+}
+
+func (f *FallbackResource) record(secondary bool, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if secondary {
+		f.metrics.Secondary++
+	} else {
+		f.metrics.Primary++
+	}
+	if err != nil {
+		f.metrics.Failed++
+	}
+}
+
+// Metrics returns how the uses have been split between the backends. Each
+// backend's own Metrics cover the uses it handled.
+func (f *FallbackResource) Metrics() FallbackMetrics {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.metrics
+}
@@ -0,0 +1,97 @@
+// fallback_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// busyResource returns a resource whose single token is held until t ends
+func busyResource(t *testing.T, name string) *Resource {
+	r := NewResource(name, 1, 3600)
+	t.Cleanup(fillBulkhead(r, 1))
+	return r
+}
+
+func TestFallbackPrimaryDeniedSecondaryServes(t *testing.T) {
+	primary := busyResource(t, "primary")
+	secondary := NewResource("replica", 10, 3600)
+	fr := NewFallbackResource(primary, secondary, DefaultFallbackPolicy)
+
+	ran := 0
+	if err := fr.UseFunc(context.Background(), func(context.Context) error { ran++; return nil }); err != nil {
+		t.Fatalf("Expected the secondary to serve the use, got %v", err)
+	}
+	if ran != 1 {
+		t.Errorf("Expected the work to run once, ran %d times", ran)
+	}
+	if m := fr.Metrics(); m.Primary != 0 || m.Secondary != 1 || m.Failed != 0 {
+		t.Errorf("Expected one use served by the secondary, got %+v", m)
+	}
+	if m := primary.Metrics(); m.Uses != 0 || m.RateLimited != 1 {
+		t.Errorf("Expected the primary to record its rejection, got %+v", m)
+	}
+	if m := secondary.Metrics(); m.Uses != 1 {
+		t.Errorf("Expected the secondary to record the use, got %+v", m)
+	}
+}
+
+func TestFallbackBothDenied(t *testing.T) {
+	fr := NewFallbackResource(busyResource(t, "primary"), busyResource(t, "replica"), DefaultFallbackPolicy)
+
+	err := fr.Use(1)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected ErrRateLimited, got %v", err)
+	}
+	var fe *FallbackError
+	if !errors.As(err, &fe) || fe.Backend != "replica" || fe.Primary == nil {
+		t.Errorf("Expected a FallbackError from the replica carrying the primary's error, got %v", err)
+	}
+	if m := fr.Metrics(); m.Secondary != 1 || m.Failed != 1 {
+		t.Errorf("Expected one failed use on the secondary, got %+v", m)
+	}
+}
+
+func TestFallbackPrimaryErrorNotRetried(t *testing.T) {
+	primary := NewResource("primary", 10, 3600)
+	secondary := NewResource("replica", 10, 3600)
+	fr := NewFallbackResource(primary, secondary, DefaultFallbackPolicy)
+
+	errBadQuery := errors.New("bad query")
+	ran := 0
+	err := fr.UseFunc(context.Background(), func(context.Context) error { ran++; return errBadQuery })
+	if !errors.Is(err, errBadQuery) {
+		t.Fatalf("Expected the work's error, got %v", err)
+	}
+	var fe *FallbackError
+	if !errors.As(err, &fe) || fe.Backend != "primary" || fe.Primary != nil {
+		t.Errorf("Expected a FallbackError from the primary alone, got %v", err)
+	}
+	if ran != 1 {
+		t.Errorf("Expected the work to run only on the primary, ran %d times", ran)
+	}
+	if m := secondary.Metrics(); m.Uses != 0 {
+		t.Errorf("Expected the secondary to go unused, got %+v", m)
+	}
+
+	// A policy can opt in to retrying such errors
+	fr.policy.OnError = func(err error) bool { return errors.Is(err, errBadQuery) }
+	ran = 0
+	fr.UseFunc(context.Background(), func(context.Context) error { ran++; return errBadQuery })
+	if ran != 2 {
+		t.Errorf("Expected OnError to send the use on to the secondary, ran %d times", ran)
+	}
+}
+
+func TestFallbackPolicyOptOut(t *testing.T) {
+	fr := NewFallbackResource(busyResource(t, "primary"), NewResource("replica", 10, 3600), FallbackPolicy{OnUnhealthy: true})
+
+	err := fr.UseFunc(context.Background(), noWork)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected the primary's rejection without OnRateLimited, got %v", err)
+	}
+	if m := fr.Metrics(); m.Primary != 1 || m.Secondary != 0 {
+		t.Errorf("Expected the primary alone to handle the use, got %+v", m)
+	}
+}
@@ -0,0 +1,95 @@
+// fastpath.go
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// The fast path packs the current window's count into one word together
+// with a generation and a frozen bit. TryAcquire bumps the count with a
+// compare-and-swap and never takes the mutex while the window is open,
+// nobody is queued and the tokens fit. Everything else runs under the
+// mutex as before: lock freezes the word so no fast acquisition can slip
+// in while the locked code works on currRequests, and unlock publishes the
+// result under a new generation, so a fast path that read the old
+// allowance or window end can't complete against the new state.
+const (
+	stateFrozen   = 1 << 63
+	stateGenShift = 32
+	stateGenMask  = 1<<31 - 1
+	stateCount    = 1<<32 - 1
+)
+
+// fastState is what the fast path reads and writes without the mutex
+type fastState struct {
+	word      atomic.Uint64 // frozen bit | generation | tokens in the window
+	allowance atomic.Int64
+	enabled   atomic.Bool // false while anyone is queued, outside ModeNormal, once closed or with a shared window
+
+	// The window's bounds as offsets from base, which is read once at
+	// construction so that offsets use the monotonic clock when there is
+	// one and ignore wall clock steps
+	base        time.Time
+	windowStart atomic.Int64
+	windowEnd   atomic.Int64
+
+	// counts taken on the fast path, folded into the limiter by lock
+	acquired atomic.Uint64
+	held     atomic.Int64
+}
+
+// lock takes the mutex and freezes the fast path, bringing currRequests and
+// the counters up to date with what it acquired
+func (rl *RateLimiter) lock() {
+	rl.mu.Lock()
+	for {
+		w := rl.fast.word.Load()
+		if rl.fast.word.CompareAndSwap(w, w|stateFrozen) {
+			rl.currRequests = int(w & stateCount)
+			break
+		}
+	}
+	rl.acquired += rl.fast.acquired.Swap(0)
+	rl.held += int(rl.fast.held.Swap(0))
+}
+
+// unlock publishes the locked state to the fast path and releases the mutex
+func (rl *RateLimiter) unlock() {
+	rl.fast.allowance.Store(int64(rl.allowance))
+	rl.fast.windowStart.Store(int64(rl.lastReset.Sub(rl.fast.base)))
+	rl.fast.windowEnd.Store(int64(rl.lastReset.Add(rl.window).Sub(rl.fast.base)))
+	rl.fast.enabled.Store(!rl.closed && rl.mode == ModeNormal && rl.waiters.Len() == 0 && rl.shared == nil)
+
+	gen := (rl.fast.word.Load()>>stateGenShift + 1) & stateGenMask
+	rl.fast.word.Store(gen<<stateGenShift | uint64(max(rl.currRequests, 0)))
+	rl.mu.Unlock()
+}
+
+// tryAcquireFast takes n tokens without the mutex if that is safe. When it
+// returns false the caller must take the locked path, which also handles
+// denials and window resets.
+func (rl *RateLimiter) tryAcquireFast(n int) bool {
+	if n <= 0 || !rl.fast.enabled.Load() {
+		return false
+	}
+
+	// Count the tokens as held before taking them, so a reset that starts
+	// in between never sees fewer held tokens than are out there
+	rl.fast.held.Add(int64(n))
+	for {
+		w := rl.fast.word.Load()
+		offset := int64(rl.clock.Now().Sub(rl.fast.base))
+		if w&stateFrozen != 0 ||
+			offset < rl.fast.windowStart.Load() || offset >= rl.fast.windowEnd.Load() ||
+			int64(w&stateCount)+int64(n) > rl.fast.allowance.Load() {
+			break
+		}
+		if rl.fast.word.CompareAndSwap(w, w+uint64(n)) {
+			rl.fast.acquired.Add(1)
+			return true
+		}
+	}
+	rl.fast.held.Add(-int64(n))
+	return false
+}
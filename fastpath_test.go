@@ -0,0 +1,118 @@
+// fastpath_test.go
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFastPathAcrossResets(t *testing.T) {
+	const limit, windows = 50, 50
+	clock := NewFakeClock(time.Now())
+	var resets int64
+	limiter := NewRateLimiter(limit, 1,
+		WithLimiterClock(clock),
+		WithOnWindowReset(func() { atomic.AddInt64(&resets, 1) }),
+	)
+
+	var acquired int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if limiter.TryAcquire() {
+					atomic.AddInt64(&acquired, 1)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < windows; i++ {
+		time.Sleep(100 * time.Microsecond)
+		clock.Advance(time.Second)
+	}
+	close(stop)
+	wg.Wait()
+
+	// Nothing is ever released, so no window can hand out more than the
+	// limit
+	got := atomic.LoadInt64(&acquired)
+	if max := int64(limit) * (atomic.LoadInt64(&resets) + 1); got > max {
+		t.Errorf("Acquired %d tokens over %d windows, more than the %d allowed", got, resets+1, max)
+	}
+	if stats := limiter.Stats(); stats.Acquired != uint64(got) {
+		t.Errorf("Expected Stats to count all %d acquisitions, got %d", got, stats.Acquired)
+	}
+}
+
+func TestFastPathWithReleases(t *testing.T) {
+	limiter := NewRateLimiter(8, 3600)
+
+	var active, overLimit int64
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				if !limiter.TryAcquire() {
+					continue
+				}
+				if atomic.AddInt64(&active, 1) > 8 {
+					atomic.AddInt64(&overLimit, 1)
+				}
+				atomic.AddInt64(&active, -1)
+				limiter.Release()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if overLimit != 0 {
+		t.Errorf("Saw more than 8 tokens held at once %d times", overLimit)
+	}
+	if stats := limiter.Stats(); stats.Current != 0 {
+		t.Errorf("Expected every token to be returned, %d held", stats.Current)
+	}
+}
+
+func benchmarkTryAcquire(b *testing.B, acquire func(*RateLimiter) bool) {
+	for _, goroutines := range []int{1, 8, 64} {
+		b.Run(fmt.Sprintf("goroutines=%d", goroutines), func(b *testing.B) {
+			limiter := NewRateLimiter(1<<31, 3600)
+			per := b.N/goroutines + 1
+
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for i := 0; i < goroutines; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < per; j++ {
+						acquire(limiter)
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func BenchmarkTryAcquireFast(b *testing.B) {
+	benchmarkTryAcquire(b, func(rl *RateLimiter) bool { return rl.TryAcquire() })
+}
+
+func BenchmarkTryAcquireLocked(b *testing.B) {
+	benchmarkTryAcquire(b, func(rl *RateLimiter) bool { return rl.tryAcquireSlow(1) })
+}
@@ -0,0 +1,264 @@
+// fields.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Field is a key/value pair attached to a logged message, so log pipelines
+// can query it instead of parsing the message
+type Field struct {
+	Key   string
+	Value any
+}
+
+// NewField returns a field with any value. Errors, durations and
+// fmt.Stringers are rendered as their strings, anything else as itself.
+func NewField(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+// ResourceField names the resource a message is about
+func ResourceField(name string) Field {
+	return Field{Key: "resource", Value: name}
+}
+
+// CallerField names the caller a message is about
+func CallerField(c Caller) Field {
+	return Field{Key: "caller", Value: c.String()}
+}
+
+// DurationField records a duration, such as a wait
+func DurationField(key string, d time.Duration) Field {
+	return Field{Key: key, Value: d}
+}
+
+// ErrorField records an error
+func ErrorField(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// GroupField nests fields under key, as an object in JSON and as
+// key.field pairs in text
+func GroupField(key string, fields ...Field) Field {
+	return Field{Key: key, Value: fields}
+}
+
+// LogFormat is how a Logger renders its lines
+type LogFormat int32
+
+const (
+	TextFormat LogFormat = iota // logfmt key=value pairs, the default
+	JSONFormat                  // one JSON object per line
+)
+
+func (f LogFormat) String() string {
+	switch f {
+	case TextFormat:
+		return "text"
+	case JSONFormat:
+		return "json"
+	}
+	return fmt.Sprintf("LogFormat(%d)", int32(f))
+}
+
+// NewLogger creates a logger writing text lines to w, at LevelInfo unless
+// SetLevel changes it. The zero Logger writes to os.Stderr.
+func NewLogger(w io.Writer) *Logger {
+	return &Logger{out: w}
+}
+
+// SetOutput makes the logger, and every logger With made from it or it was
+// made from, write to w from now on. It is safe to call while the logger
+// is in use.
+func (l *Logger) SetOutput(w io.Writer) {
+	root := l.root()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	root.out = w
+}
+
+// SetFormat makes the logger, and every logger With made from it or it was
+// made from, render lines in format from now on. It is safe to call while
+// the logger is in use.
+func (l *Logger) SetFormat(format LogFormat) {
+	l.root().format.Store(int32(format))
+}
+
+// Format returns how the logger renders its lines
+func (l *Logger) Format() LogFormat {
+	return LogFormat(l.root().format.Load())
+}
+
+// With returns a child logger that adds fields to every message after l's
+// own. Children share everything else with the logger they were made from:
+// output, format, level, suppression and sampling are set for the whole
+// family, whichever member they are set on, so raising the level of a
+// program's logger quiets every resource's child too. A child costs a
+// couple of small allocations, cheap enough to make one per request.
+func (l *Logger) With(fields ...Field) *Logger {
+	return &Logger{
+		parent: l.root(),
+		name:   l.name,
+		// The full slice expression makes append copy, so siblings never
+		// share a backing array
+		fields: append(l.fields[:len(l.fields):len(l.fields)], fields...),
+	}
+}
+
+// Named returns a child logger like With whose messages carry a logger
+// field naming it, joined to l's own name with a dot, e.g. "orders.db"
+func (l *Logger) Named(name string) *Logger {
+	child := l.With()
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	child.name = name
+	return child
+}
+
+// root is the logger holding the output, format and level
+func (l *Logger) root() *Logger {
+	if l.parent != nil {
+		return l.parent
+	}
+	return l
+}
+
+// write renders and writes one line with a ts, level and msg ahead of the
+// fields, or hands them to the slog.Handler if there is one
+func (l *Logger) write(ctx context.Context, level Level, message string, fields []Field) {
+	root := l.root()
+	if root.handler != nil {
+		l.handle(ctx, level, message, fields)
+		return
+	}
+	all := make([]Field, 0, 4+len(l.fields)+len(fields))
+	all = append(all,
+		Field{Key: "ts", Value: time.Now()},
+		Field{Key: "level", Value: level},
+		Field{Key: "msg", Value: message})
+	if l.name != "" {
+		all = append(all, Field{Key: "logger", Value: l.name})
+	}
+	all = append(append(all, l.fields...), fields...)
+
+	var line string
+	if root.Format() == JSONFormat {
+		line = renderJSON(all)
+	} else {
+		line = renderText(all)
+	}
+
+	if root.async != nil {
+		root.async.enqueue(line + "\n")
+		return
+	}
+	// One Write per line, under the lock, so lines never interleave
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	io.WriteString(root.output(), line+"\n")
+}
+
+// defaultOutput is where loggers without an output of their own write.
+// The package's tests point it at a CaptureWriter.
+var defaultOutput io.Writer = os.Stderr
+
+// output is where the root logger writes, with its lock held
+func (l *Logger) output() io.Writer {
+	if l.out == nil {
+		return defaultOutput
+	}
+	return l.out
+}
+
+// fieldValue is what a field renders as
+func fieldValue(v any) any {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+// renderText renders fields as logfmt key=value pairs, quoting values that
+// need it, with a group's fields keyed by the group's key and theirs
+func renderText(fields []Field) string {
+	var b strings.Builder
+	appendText(&b, "", fields)
+	return b.String()
+}
+
+func appendText(b *strings.Builder, prefix string, fields []Field) {
+	for _, f := range fields {
+		if group, ok := f.Value.([]Field); ok {
+			appendText(b, prefix+f.Key+".", group)
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(prefix + f.Key)
+		b.WriteByte('=')
+		s := fmt.Sprint(fieldValue(f.Value))
+		if s == "" || strings.ContainsAny(s, " =\"\\") || strings.ContainsFunc(s, unicode.IsControl) {
+			s = strconv.Quote(s)
+		}
+		b.WriteString(s)
+	}
+}
+
+// renderJSON renders fields as a JSON object in their order, a group as a
+// nested object. A value JSON can't encode is rendered as its fmt string.
+func renderJSON(fields []Field) string {
+	var b bytes.Buffer
+	appendJSON(&b, fields)
+	return b.String()
+}
+
+func appendJSON(b *bytes.Buffer, fields []Field) {
+	b.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		appendJSONValue(b, f.Key)
+		b.WriteByte(':')
+		if group, ok := f.Value.([]Field); ok {
+			appendJSON(b, group)
+			continue
+		}
+		if !appendJSONValue(b, fieldValue(f.Value)) {
+			appendJSONValue(b, fmt.Sprint(f.Value))
+		}
+	}
+	b.WriteByte('}')
+}
+
+// appendJSONValue encodes v without escaping HTML, as the line is for a log
+// collector rather than a page, and reports whether v could be encoded
+func appendJSONValue(b *bytes.Buffer, v any) bool {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return false
+	}
+	b.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return true
+}
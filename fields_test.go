@@ -0,0 +1,223 @@
+// fields_test.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newFormatLogger returns a logger writing format to w
+func newFormatLogger(w io.Writer, format LogFormat) *Logger {
+	l := NewLogger(w)
+	l.SetFormat(format)
+	return l
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	at := time.Date(2026, 10, 14, 9, 30, 0, 123456789, time.UTC)
+	records := []struct {
+		message string
+		fields  []Field
+		want    map[string]any
+	}{
+		{`said "hello"`, nil, map[string]any{}},
+		{"line one\nline two\ttabbed", []Field{NewField("path", `C:\temp`)}, map[string]any{"path": `C:\temp`}},
+		{"<b>html</b> & more", []Field{ErrorField(fmt.Errorf("wrapped: %w", errors.New(`bad "input"`)))},
+			map[string]any{"error": `wrapped: bad "input"`}},
+		{"nested", []Field{GroupField("request", NewField("id", 7), GroupField("user", NewField("name", "ann\n")))},
+			map[string]any{"request": map[string]any{"id": 7.0, "user": map[string]any{"name": "ann\n"}}}},
+		{"values", []Field{NewField("at", at), DurationField("wait", 1500*time.Millisecond), NewField("ok", true), NewField("none", nil)},
+			map[string]any{"at": "2026-10-14T09:30:00.123456789Z", "wait": "1.5s", "ok": true, "none": nil}},
+	}
+
+	for _, r := range records {
+		var buf bytes.Buffer
+		newFormatLogger(&buf, JSONFormat).Warn(r.message, r.fields...)
+		if strings.Count(buf.String(), "\n") != 1 || strings.Contains(buf.String(), `\u003c`) {
+			t.Errorf("Expected one line without HTML escapes, got %q", buf.String())
+		}
+
+		var got map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("Expected %q to decode: %v", buf.String(), err)
+		}
+		if got["msg"] != r.message || got["level"] != "WARN" {
+			t.Errorf("Expected msg %q at WARN, got %v", r.message, got)
+		}
+		ts, err := time.Parse(time.RFC3339Nano, fmt.Sprint(got["ts"]))
+		if err != nil || time.Since(ts) > time.Minute {
+			t.Errorf("Expected an RFC3339Nano ts, got %v", got["ts"])
+		}
+		for key, value := range r.want {
+			if fmt.Sprint(got[key]) != fmt.Sprint(value) {
+				t.Errorf("Expected %s to be %v, got %v", key, value, got[key])
+			}
+		}
+	}
+}
+
+func TestJSONUnencodableValue(t *testing.T) {
+	var buf bytes.Buffer
+	newFormatLogger(&buf, JSONFormat).Info("odd", NewField("ch", make(chan int)))
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Expected %q to decode: %v", buf.String(), err)
+	}
+	if s, ok := got["ch"].(string); !ok || !strings.HasPrefix(s, "0x") {
+		t.Errorf("Expected the channel as its fmt string, got %v", got["ch"])
+	}
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	message := "said \"hi\"\nthen left"
+	newFormatLogger(&buf, TextFormat).Info(message, GroupField("user", NewField("name", "ann")), ErrorField(errors.New("a=b")))
+
+	line := strings.TrimSuffix(buf.String(), "\n")
+	if strings.Contains(line, "\n") {
+		t.Fatalf("Expected the newline to be escaped, got %q", line)
+	}
+	i := strings.Index(line, "msg=")
+	rest := line[i+len("msg="):]
+	quoted, err := strconv.QuotedPrefix(rest)
+	if err != nil {
+		t.Fatalf("Expected a quoted msg in %q: %v", line, err)
+	}
+	if got, _ := strconv.Unquote(quoted); got != message {
+		t.Errorf("Expected the msg to unquote to %q, got %q", message, got)
+	}
+	if want := ` user.name=ann error="a=b"`; rest[len(quoted):] != want {
+		t.Errorf("Expected the fields %q, got %q", want, rest[len(quoted):])
+	}
+}
+
+func TestLoggerSetFormatWhileLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newFormatLogger(&buf, TextFormat)
+	child := logger.With(ResourceField("db"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				child.Info("tick")
+			}
+		}()
+	}
+	for _, f := range []LogFormat{JSONFormat, TextFormat, JSONFormat} {
+		logger.SetFormat(f)
+	}
+	wg.Wait()
+
+	if child.Format() != JSONFormat {
+		t.Errorf("Expected the child to share its parent's format, got %v", child.Format())
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var v map[string]any
+		if json.Unmarshal([]byte(line), &v) != nil && !strings.HasPrefix(line, "ts=") {
+			t.Fatalf("Expected every line whole in one format, got %q", line)
+		}
+	}
+}
+
+func TestLoggerNamed(t *testing.T) {
+	logs := &CaptureWriter{}
+	orders := NewLogger(logs).Named("orders")
+	orders.Named("db").With(NewField("shard", 2)).Info("tick")
+	orders.Info("tock")
+
+	lines := logs.Lines()
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "msg=tick logger=orders.db shard=2") || !strings.HasSuffix(lines[1], "msg=tock logger=orders") {
+		t.Errorf("Expected the dotted names after the message, got %q", lines)
+	}
+
+	h := &recordHandler{}
+	NewSlogLogger(h).Named("orders").Info("tick")
+	if a := attrs(h.records[0]); a["logger"].String() != "orders" {
+		t.Errorf("Expected the name as a slog attribute, got %v", a)
+	}
+}
+
+func TestChildLoggersShareLevel(t *testing.T) {
+	logs := &CaptureWriter{}
+	parent := NewLogger(logs)
+	child := parent.Named("db")
+	grandchild := child.With(NewField("request", 1))
+
+	parent.SetLevel(LevelWarn)
+	grandchild.Info("dropped")
+	if child.Level() != LevelWarn || len(logs.Lines()) != 0 {
+		t.Errorf("Expected the parent's level to reach its children, got %v", child.Level())
+	}
+	// The family has one level, so setting it on a child sets the parent's
+	grandchild.SetLevel(LevelDebug)
+	parent.Debug("kept")
+	if parent.Level() != LevelDebug || len(logs.Lines()) != 1 {
+		t.Errorf("Expected a child's level to be the parent's too, got %v", parent.Level())
+	}
+}
+
+func TestSiblingLoggersKeepTheirFields(t *testing.T) {
+	logs := &CaptureWriter{}
+	base := NewLogger(logs).With(NewField("a", 1), NewField("b", 2))
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			base.With(NewField("request", i)).Info("tick")
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, line := range logs.Lines() {
+		i := strings.Index(line, "a=1 b=2 request=")
+		if i < 0 {
+			t.Fatalf("Expected the shared fields then the request, got %q", line)
+		}
+		seen[line[i:]] = true
+	}
+	if len(seen) != 50 {
+		t.Errorf("Expected each request's own field, got %d distinct", len(seen))
+	}
+}
+
+func TestResourceDerivesChildLogger(t *testing.T) {
+	logs := &CaptureWriter{}
+	parent := NewLogger(logs).Named("svc")
+	resource := NewResource("db", 1, 60, WithLogger(parent))
+	if child, ok := resource.logger.(*Logger); !ok || child == parent || child.root() != parent.root() {
+		t.Fatalf("Expected the resource to log through a child of the parent, got %v", resource.logger)
+	}
+
+	resource.Use(1)
+	if !strings.HasSuffix(logs.Lines()[0], `msg="state changed" logger=svc resource=db from=uninitialized to=initializing`) {
+		t.Errorf("Expected the resource's name from its child logger, once, got %q", logs.Lines()[0])
+	}
+	logs.Reset()
+	parent.SetLevel(LevelWarn)
+	resource.Close(context.Background())
+	if n := len(logs.Lines()); n != 0 {
+		t.Errorf("Expected the parent's level to quiet the resource, got %d lines", n)
+	}
+}
+
+func BenchmarkLoggerWith(b *testing.B) {
+	base := NewLogger(io.Discard).With(ResourceField("db"))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		base.With(NewField("request", "r-1"))
+	}
+}
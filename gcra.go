@@ -0,0 +1,60 @@
+// gcra.go
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// GCRALimiter implements the generic cell rate algorithm. It tracks a single
+// theoretical arrival time, so memory use is constant regardless of burst.
+type GCRALimiter struct {
+	mu       sync.Mutex
+	interval time.Duration // emission interval, 1/rate
+	burst    int
+	tat      time.Time // theoretical arrival time of the next request
+	clock    Clock
+}
+
+// NewGCRALimiter creates a limiter allowing rate requests per second with
+// bursts of up to burst requests
+func NewGCRALimiter(rate float64, burst int) *GCRALimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &GCRALimiter{
+		interval: time.Duration(float64(time.Second) / rate),
+		burst:    burst,
+		clock:    realClock{},
+	}
+}
+
+// Allow reports whether a request may proceed now. When it may not, the
+// returned duration is how long until the next request would be allowed,
+// suitable for a Retry-After header.
+func (g *GCRALimiter) Allow() (bool, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.clock.Now()
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(g.interval)
+	allowAt := newTat.Add(-time.Duration(g.burst) * g.interval)
+	if now.Before(allowAt) {
+		return false, allowAt.Sub(now)
+	}
+	g.tat = newTat
+	return true, 0
+}
+
+// TryAcquire reports whether a request may proceed now
+func (g *GCRALimiter) TryAcquire() bool {
+	ok, _ := g.Allow()
+	return ok
+}
+
+// Release is a no-op: GCRA accounts for requests when they arrive
+func (g *GCRALimiter) Release() {}
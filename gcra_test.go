@@ -0,0 +1,78 @@
+// gcra_test.go
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGCRABurstAndRetryAfter(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewGCRALimiter(10, 3) // 10/s with a burst of 3
+	limiter.clock = clock
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow(); !ok {
+			t.Fatalf("Burst acquisition %d should succeed", i+1)
+		}
+	}
+
+	ok, retryAfter := limiter.Allow()
+	if ok {
+		t.Fatal("Acquisition beyond the burst should fail")
+	}
+	if retryAfter != 100*time.Millisecond {
+		t.Errorf("Expected retry after 100ms, got %v", retryAfter)
+	}
+
+	clock.Advance(retryAfter)
+	if ok, _ := limiter.Allow(); !ok {
+		t.Error("Acquisition after the retry-after delay should succeed")
+	}
+	if ok, _ := limiter.Allow(); ok {
+		t.Error("Only one token should have been earned")
+	}
+}
+
+func TestGCRASustainedRate(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewGCRALimiter(10, 1)
+	limiter.clock = clock
+
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		if limiter.TryAcquire() {
+			allowed++
+		}
+		clock.Advance(10 * time.Millisecond)
+	}
+	// One second of traffic at 100 attempts/s against a 10/s limit
+	if allowed != 10 {
+		t.Errorf("Expected 10 allowed requests in one second, got %d", allowed)
+	}
+}
+
+func TestGCRAConcurrent(t *testing.T) {
+	limiter := NewGCRALimiter(1, 5)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if limiter.TryAcquire() {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 5 {
+		t.Errorf("Expected the burst of 5 to be allowed, got %d", allowed)
+	}
+}
@@ -0,0 +1,161 @@
+// group.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrMemberExists is returned when adding a member under a name that is
+// already taken
+var ErrMemberExists = errors.New("rate limiter: group member already exists")
+
+// LimiterGroup splits a shared budget between named members, each of which
+// also has its own cap. A member's request must fit both its own limit and
+// the shared one.
+type LimiterGroup struct {
+	shared *RateLimiter
+
+	mu      sync.RWMutex
+	members map[string]*GroupMember
+}
+
+// GroupMember is one member of a LimiterGroup. It implements Limiter, so it
+// can be handed to a Resource or the HTTP middleware on its own.
+type GroupMember struct {
+	name    string
+	group   *LimiterGroup
+	limiter *RateLimiter
+	removed atomic.Bool
+}
+
+// GroupStats is a point-in-time view of a LimiterGroup
+type GroupStats struct {
+	Shared  LimiterStats            // the shared budget
+	Members map[string]LimiterStats // each member's own limit, by name
+}
+
+// NewLimiterGroup creates a group whose members all draw on shared
+func NewLimiterGroup(shared *RateLimiter) *LimiterGroup {
+	return &LimiterGroup{
+		shared:  shared,
+		members: make(map[string]*GroupMember),
+	}
+}
+
+// AddMember adds a member named name whose own limit is described by cfg.
+// It is safe to call while other members are acquiring.
+func (g *LimiterGroup) AddMember(name string, cfg Config, opts ...LimiterOption) (*GroupMember, error) {
+	limiter, err := NewRateLimiterFromConfig(cfg, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("group member %s: %w", name, err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.members[name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrMemberExists, name)
+	}
+	m := &GroupMember{name: name, group: g, limiter: limiter}
+	g.members[name] = m
+	return m, nil
+}
+
+// Member returns the member named name
+func (g *LimiterGroup) Member(name string) (*GroupMember, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	m, ok := g.members[name]
+	return m, ok
+}
+
+// RemoveMember removes the member named name. From then on its acquisitions
+// are denied, but tokens it already holds can still be released, so
+// requests in flight finish normally.
+func (g *LimiterGroup) RemoveMember(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if m, ok := g.members[name]; ok {
+		m.removed.Store(true)
+		delete(g.members, name)
+	}
+}
+
+// Names returns the members' names in sorted order
+func (g *LimiterGroup) Names() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	names := make([]string, 0, len(g.members))
+	for name := range g.members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stats returns the shared budget's stats alongside every member's
+func (g *LimiterGroup) Stats() GroupStats {
+	g.mu.RLock()
+	members := make([]*GroupMember, 0, len(g.members))
+	for _, m := range g.members {
+		members = append(members, m)
+	}
+	g.mu.RUnlock()
+
+	stats := GroupStats{
+		Shared:  g.shared.Stats(),
+		Members: make(map[string]LimiterStats, len(members)),
+	}
+	for _, m := range members {
+		stats.Members[m.name] = m.limiter.Stats()
+	}
+	return stats
+}
+
+// Name returns the member's name
+func (m *GroupMember) Name() string {
+	return m.name
+}
+
+// Allow takes a token from the member's own limit and then from the shared
+// budget. If the shared budget denies, the member's token is given back.
+// The retry-after hint comes from whichever limit denied.
+func (m *GroupMember) Allow() (bool, time.Duration) {
+	if m.removed.Load() {
+		return false, 0
+	}
+	if !m.limiter.TryAcquire() {
+		return false, m.limiter.RetryAfter()
+	}
+	if !m.group.shared.TryAcquire() {
+		m.limiter.Release()
+		return false, m.group.shared.RetryAfter()
+	}
+	return true, 0
+}
+
+// TryAcquire takes a token from both the member's limit and the shared
+// budget, or from neither
+func (m *GroupMember) TryAcquire() bool {
+	ok, _ := m.Allow()
+	return ok
+}
+
+// Release returns a token to the member's limit and the shared budget
+func (m *GroupMember) Release() {
+	m.limiter.Release()
+	m.group.shared.Release()
+}
+
+// Stats returns the stats of the member's own limit
+func (m *GroupMember) Stats() LimiterStats {
+	return m.limiter.Stats()
+}
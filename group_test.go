@@ -0,0 +1,107 @@
+// group_test.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiterGroupSharedBudget(t *testing.T) {
+	group := NewLimiterGroup(NewRateLimiter(3, 60))
+	a, err := group.AddMember("a", Config{MaxRequests: 2, Window: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := group.AddMember("b", Config{MaxRequests: 2, Window: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !a.TryAcquire() || !a.TryAcquire() {
+		t.Fatal("Expected a to get its own two tokens")
+	}
+	if a.TryAcquire() {
+		t.Error("Expected a to be capped by its own limit")
+	}
+	if !b.TryAcquire() {
+		t.Fatal("Expected b to get the last shared token")
+	}
+	if b.TryAcquire() {
+		t.Error("Expected b to be capped by the shared budget")
+	}
+	if n := b.Stats().Current; n != 1 {
+		t.Errorf("Expected b's token to be rolled back when the shared budget denied, holding %d", n)
+	}
+
+	a.Release()
+	if !b.TryAcquire() {
+		t.Error("Expected a release by a to free a shared token for b")
+	}
+
+	stats := group.Stats()
+	if stats.Shared.Current != 3 || stats.Members["a"].Current != 1 || stats.Members["b"].Current != 2 {
+		t.Errorf("Unexpected group stats %+v", stats)
+	}
+
+	if _, err := group.AddMember("a", Config{MaxRequests: 1, Window: time.Minute}); !errors.Is(err, ErrMemberExists) {
+		t.Errorf("Expected ErrMemberExists for a duplicate name, got %v", err)
+	}
+}
+
+func TestLimiterGroupRemoveMember(t *testing.T) {
+	shared := NewRateLimiter(2, 60)
+	group := NewLimiterGroup(shared)
+	a, _ := group.AddMember("a", Config{MaxRequests: 2, Window: time.Minute})
+
+	if !a.TryAcquire() {
+		t.Fatal("Expected a to acquire")
+	}
+	group.RemoveMember("a")
+	if _, ok := group.Member("a"); ok {
+		t.Error("Expected a to be gone from the group")
+	}
+	if a.TryAcquire() {
+		t.Error("Expected a removed member to be denied")
+	}
+
+	// The token held across the removal is still returned to the budget
+	a.Release()
+	if n := shared.Remaining(); n != 2 {
+		t.Errorf("Expected the shared budget to be whole again, %d remaining", n)
+	}
+}
+
+func TestLimiterGroupConcurrentMembership(t *testing.T) {
+	shared := NewRateLimiter(1000, 60)
+	group := NewLimiterGroup(shared)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				name := fmt.Sprintf("job-%d-%d", i, j%5)
+				m, ok := group.Member(name)
+				if !ok {
+					m, _ = group.AddMember(name, Config{MaxRequests: 100, Window: time.Minute})
+				}
+				if m != nil && m.TryAcquire() {
+					m.Release()
+				}
+				group.Stats()
+				if j%7 == 0 {
+					group.RemoveMember(name)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := shared.Stats().Current; n != 0 {
+		t.Errorf("Expected every shared token to be returned, %d held", n)
+	}
+}
@@ -0,0 +1,156 @@
+// grpc_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startHealthServer serves the standard health service over an in-memory
+// connection with the given interceptors installed
+func startHealthServer(t *testing.T, opts ...grpc.ServerOption) healthpb.HealthClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+// retryDelay extracts the RetryInfo detail from a status error
+func retryDelay(err error) time.Duration {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			return info.RetryDelay.AsDuration()
+		}
+	}
+	return -1
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 60, WithLimiterClock(clock))
+	client := startHealthServer(t, grpc.UnaryInterceptor(UnaryServerInterceptor(limiter)))
+	ctx := context.Background()
+
+	// The token is released after each call completes
+	for i := 0; i < 3; i++ {
+		if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("Call %d should succeed, got %v", i+1, err)
+		}
+	}
+
+	limiter.TryAcquire()
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	if code := status.Code(err); code != codes.ResourceExhausted {
+		t.Fatalf("Expected ResourceExhausted, got %v", err)
+	}
+	if d := retryDelay(err); d != time.Minute {
+		t.Errorf("Expected a retry delay of 1m, got %v", d)
+	}
+	if msg := status.Convert(err).Message(); msg != "rate limit exceeded for resource /grpc.health.v1.Health/Check" {
+		t.Errorf("Expected the denial to name the method, got %q", msg)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	limiter := NewRateLimiter(1, 60)
+	client := startHealthServer(t, grpc.StreamInterceptor(StreamServerInterceptor(limiter)))
+
+	// Watch holds its stream, and so its token, open until cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	first, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.Recv(); err != nil {
+		t.Fatalf("First stream should be served, got %v", err)
+	}
+
+	second, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Recv(); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted while the first stream is open, got %v", err)
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for !limiter.TryAcquire() {
+		if time.Now().After(deadline) {
+			t.Fatal("Token was not released after the stream ended")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestInterceptorMetadataKey(t *testing.T) {
+	keyed := NewKeyedLimiter(1, 60)
+	tenant := func(md metadata.MD) string {
+		if v := md.Get("x-tenant"); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	client := startHealthServer(t, grpc.UnaryInterceptor(
+		UnaryServerInterceptor(NewRateLimiter(100, 60), WithMetadataKey(keyed, tenant))))
+
+	keyed.TryAcquire("acme")
+	acme := metadata.AppendToOutgoingContext(context.Background(), "x-tenant", "acme")
+	if _, err := client.Check(acme, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected acme to be limited, got %v", err)
+	}
+
+	globex := metadata.AppendToOutgoingContext(context.Background(), "x-tenant", "globex")
+	if _, err := client.Check(globex, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("Expected globex to be served, got %v", err)
+	}
+}
+
+func TestInterceptorReportsKeyOverride(t *testing.T) {
+	keyed := NewKeyedLimiter(1, 60)
+	if err := keyed.SetOverride("acme", 1000, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	tenant := func(md metadata.MD) string { return md.Get("x-tenant")[0] }
+	g := newGRPCLimits(NewRateLimiter(10000, 60), []GRPCOption{WithMetadataKey(keyed, tenant)})
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant", "acme"))
+	for i := 0; i < 1000; i++ {
+		if _, err := g.acquire(ctx, "/test"); err != nil {
+			t.Fatalf("Expected acme's override to allow 1000, denied after %d: %v", i, err)
+		}
+	}
+	_, err := g.acquire(ctx, "/test")
+	var rle *RateLimitError
+	if !errors.As(err, &rle) || rle.Limit != 1000 {
+		t.Errorf("Expected a denial reporting acme's limit of 1000, got %v", err)
+	}
+}
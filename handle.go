@@ -0,0 +1,97 @@
+// handle.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrHandleReleased is returned by a Handle that has already been closed
+var ErrHandleReleased = errors.New("resource handle already released")
+
+// Handle is one owner's share of a resource used by several subsystems.
+// Closing a handle gives the share up, and the resource is closed only
+// when its last handle is.
+type Handle struct {
+	r        *Resource
+	released atomic.Bool
+}
+
+// Acquire returns a new handle on the resource, counting one more owner.
+// It fails with ErrClosed once the resource has been closed, including by
+// its last handle.
+func (r *Resource) Acquire() (*Handle, error) {
+	r.closeMu.Lock()
+	defer r.closeMu.Unlock()
+
+	if r.closed {
+		return nil, fmt.Errorf("resource %s: %w", r.name, ErrClosed)
+	}
+	r.refs++
+	return &Handle{r: r}, nil
+}
+
+// Acquire returns a handle on the resource called name, building it like
+// Get on the first call
+func (m *Manager) Acquire(name string) (*Handle, error) {
+	r, err := m.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.Acquire()
+}
+
+// Resource returns the resource the handle shares, or ErrHandleReleased
+// once it has been closed
+func (h *Handle) Resource() (*Resource, error) {
+	if h.released.Load() {
+		return nil, fmt.Errorf("resource %s: %w", h.r.name, ErrHandleReleased)
+	}
+	return h.r, nil
+}
+
+// Use is the resource's Use through the handle
+func (h *Handle) Use(id int) error {
+	r, err := h.Resource()
+	if err != nil {
+		return err
+	}
+	return r.Use(id)
+}
+
+// UseFunc is the resource's UseFunc through the handle
+func (h *Handle) UseFunc(ctx context.Context, fn func(ctx context.Context) error) error {
+	r, err := h.Resource()
+	if err != nil {
+		return err
+	}
+	return r.UseFunc(ctx, fn)
+}
+
+// Close releases the handle, after which its uses fail with
+// ErrHandleReleased, as does closing it again. Closing the last handle
+// closes the resource, as Close does, returning its error; the handle is
+// released whatever that is, and Resource.Close finishes a close interrupted
+// by ctx.
+func (h *Handle) Close(ctx context.Context) error {
+	if !h.released.CompareAndSwap(false, true) {
+		return fmt.Errorf("resource %s: %w", h.r.name, ErrHandleReleased)
+	}
+
+	r := h.r
+	r.closeMu.Lock()
+	r.refs--
+	last := r.refs == 0
+	if last {
+		// Stop uses before unlocking so no Acquire slips in between
+		r.stopUsesLocked()
+	}
+	r.closeMu.Unlock()
+
+	if !last {
+		return nil
+	}
+	return r.Close(ctx)
+}
@@ -0,0 +1,136 @@
+// handle_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestHandleLastOwnerCloses(t *testing.T) {
+	lc := &lifecycle{}
+	resource := NewResource("db", 100, 60, WithInit(lc.init), WithTeardown(lc.teardown))
+	orders, _ := resource.Acquire()
+	payments, err := resource.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := orders.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.UseFunc(context.Background(), noWork); !errors.Is(err, ErrHandleReleased) {
+		t.Errorf("Expected a closed handle to refuse uses, got %v", err)
+	}
+	if err := orders.Close(context.Background()); !errors.Is(err, ErrHandleReleased) {
+		t.Errorf("Expected closing a handle twice to be detected, got %v", err)
+	}
+	if err := payments.Use(1); err != nil {
+		t.Errorf("Expected the other owner's handle to keep working, got %v", err)
+	}
+	if _, teardowns := lc.counts(); teardowns != 0 {
+		t.Fatal("Expected the resource to stay up while a handle is open")
+	}
+
+	if err := payments.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, teardowns := lc.counts(); teardowns != 1 {
+		t.Errorf("Expected the last handle to tear the resource down, got %d teardowns", teardowns)
+	}
+	if _, err := resource.Acquire(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected no new handles once closed, got %v", err)
+	}
+}
+
+func TestHandleConcurrentOwners(t *testing.T) {
+	lc := &lifecycle{}
+	resource := NewResource("db", 1000, 60, WithInit(lc.init), WithTeardown(lc.teardown))
+	keep, _ := resource.Acquire()
+
+	// Owners come and go while keep holds the resource up, some closing
+	// their handle twice
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				h, err := resource.Acquire()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if err := h.UseFunc(context.Background(), noWork); err != nil {
+					t.Error(err)
+				}
+				if err := h.Close(context.Background()); err != nil {
+					t.Error(err)
+				}
+				if i%2 == 0 {
+					if err := h.Close(context.Background()); !errors.Is(err, ErrHandleReleased) {
+						t.Errorf("Expected a double close to be detected, got %v", err)
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if _, teardowns := lc.counts(); teardowns != 0 {
+		t.Fatalf("Expected no teardown while keep is open, got %d", teardowns)
+	}
+
+	// Now race the last close against new owners: either they get in
+	// first and keep it up, or they are refused
+	var handles []*Handle
+	var mu sync.Mutex
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h, err := resource.Acquire()
+			if err != nil {
+				if !errors.Is(err, ErrClosed) {
+					t.Error(err)
+				}
+				return
+			}
+			mu.Lock()
+			handles = append(handles, h)
+			mu.Unlock()
+		}()
+	}
+	keep.Close(context.Background())
+	wg.Wait()
+
+	_, teardowns := lc.counts()
+	if len(handles) == 0 && teardowns != 1 {
+		t.Errorf("Expected keep's close to tear down with no other owners, got %d teardowns", teardowns)
+	}
+	for _, h := range handles {
+		if err := h.Use(1); err != nil {
+			t.Errorf("Expected an acquired handle to work, got %v", err)
+		}
+		h.Close(context.Background())
+	}
+	if _, teardowns := lc.counts(); teardowns != 1 {
+		t.Errorf("Expected exactly one teardown, got %d", teardowns)
+	}
+}
+
+func TestManagerAcquire(t *testing.T) {
+	m := NewManager()
+	m.Register("db", func() *Resource { return NewResource("db", 10, 60) })
+	h, err := m.Acquire("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := m.Get("db")
+	if got, _ := h.Resource(); got != r {
+		t.Error("Expected the handle to share the managed resource")
+	}
+	if _, err := m.Acquire("nope"); !errors.Is(err, ErrUnknownResource) {
+		t.Errorf("Expected an unknown resource error, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+// headers.go
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SetHeaders sets the X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset headers on w. Limit is what the current window allows,
+// Remaining what is left of it and Reset the Unix time, rounded up to the
+// second, at which the window ends. A window that has expired but not yet
+// been lazily reset is reported as the fresh window the next call will
+// start.
+func (rl *RateLimiter) SetHeaders(w http.ResponseWriter) {
+	rl.lock()
+	now := rl.clock.Now()
+	limit := rl.allowance
+	remaining := rl.allowance - rl.currRequests
+	start := rl.windowStartLocked(now)
+	reset := start.Add(rl.window)
+	if elapsed := now.Sub(start); elapsed >= rl.window {
+		limit = rl.earnedAllowanceLocked(elapsed)
+		remaining = limit - rl.reservedNext
+		reset = now.Add(rl.window)
+	}
+	rl.unlock()
+
+	if remaining < 0 {
+		remaining = 0
+	}
+	setRateLimitHeaders(w, limit, remaining, reset)
+}
+
+// SetHeaders sets the X-RateLimit-* headers on w for key, as
+// RateLimiter.SetHeaders does. Unknown keys are left alone.
+func (kl *KeyedLimiter) SetHeaders(key string, w http.ResponseWriter) {
+	s := kl.shard(key)
+	s.mu.Lock()
+	e, ok := kl.entryLocked(s, key, false)
+	s.mu.Unlock()
+
+	if ok {
+		e.limiter.SetHeaders(w)
+	}
+}
+
+// headerSetter is implemented by limiters that can describe their window in
+// response headers
+type headerSetter interface {
+	SetHeaders(w http.ResponseWriter)
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, limit, remaining int, reset time.Time) {
+	secs := reset.Unix()
+	if reset.Nanosecond() > 0 {
+		secs++
+	}
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(secs, 10))
+}
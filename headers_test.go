@@ -0,0 +1,82 @@
+// headers_test.go
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func checkRateLimitHeaders(t *testing.T, rec *httptest.ResponseRecorder, limit, remaining int, reset int64) {
+	t.Helper()
+	h := rec.Header()
+	if got := h.Get("X-RateLimit-Limit"); got != strconv.Itoa(limit) {
+		t.Errorf("Expected X-RateLimit-Limit %d, got %q", limit, got)
+	}
+	if got := h.Get("X-RateLimit-Remaining"); got != strconv.Itoa(remaining) {
+		t.Errorf("Expected X-RateLimit-Remaining %d, got %q", remaining, got)
+	}
+	if got := h.Get("X-RateLimit-Reset"); got != strconv.FormatInt(reset, 10) {
+		t.Errorf("Expected X-RateLimit-Reset %d, got %q", reset, got)
+	}
+}
+
+func TestMiddlewareRateLimitHeaders(t *testing.T) {
+	// Start half way through a second so the reset has to be rounded up
+	clock := NewFakeClock(time.Unix(1000, int64(500*time.Millisecond)))
+	limiter := NewRateLimiter(2, 60, WithLimiterClock(clock))
+	handler := Middleware(limiter, okHandler())
+
+	allowed := httptest.NewRecorder()
+	handler.ServeHTTP(allowed, httptest.NewRequest(http.MethodGet, "/", nil))
+	if allowed.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", allowed.Code)
+	}
+	checkRateLimitHeaders(t, allowed, 2, 1, 1061)
+
+	// Hold both tokens so the next request is denied
+	limiter.TryAcquireN(2)
+	clock.Advance(10 * time.Second)
+	denied := httptest.NewRecorder()
+	handler.ServeHTTP(denied, httptest.NewRequest(http.MethodGet, "/", nil))
+	if denied.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", denied.Code)
+	}
+	checkRateLimitHeaders(t, denied, 2, 0, 1061)
+}
+
+func TestSetHeadersAcrossLazyReset(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	limiter := NewRateLimiter(2, 60, WithLimiterClock(clock))
+	limiter.TryAcquireN(2)
+
+	// The window has ended but nothing has reset it yet; the headers
+	// describe the window the next call will start
+	clock.Advance(65 * time.Second)
+	rec := httptest.NewRecorder()
+	limiter.SetHeaders(rec)
+	checkRateLimitHeaders(t, rec, 2, 2, 1125)
+
+	// Once a request does reset it the values agree
+	if !limiter.TryAcquire() {
+		t.Fatal("Expected an acquisition in the new window")
+	}
+	rec = httptest.NewRecorder()
+	limiter.SetHeaders(rec)
+	checkRateLimitHeaders(t, rec, 2, 1, 1125)
+}
+
+func TestKeyedMiddlewareRateLimitHeaders(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	kl := NewKeyedLimiter(1, 60)
+	kl.clock = clock
+	handler := KeyedMiddleware(kl, func(r *http.Request) string { return r.Header.Get("X-Client") }, okHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Client", "a")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	checkRateLimitHeaders(t, rec, 1, 0, 1060)
+}
@@ -0,0 +1,169 @@
+// health.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrUnhealthy is returned by uses of a resource whose health check has
+// failed too many times in a row
+var ErrUnhealthy = errors.New("resource unhealthy")
+
+// defaultUnhealthyAfter is how many consecutive failed checks quarantine a
+// resource unless WithUnhealthyAfter says otherwise
+const defaultUnhealthyAfter = 3
+
+// HealthStatus is whether a resource is serving, see Resource.Health
+type HealthStatus int
+
+const (
+	// Healthy resources serve uses. Resources without a health check, and
+	// those whose check hasn't failed enough yet, are healthy.
+	Healthy HealthStatus = iota
+	// Unhealthy resources fail every use with ErrUnhealthy until a check
+	// passes
+	Unhealthy
+)
+
+func (s HealthStatus) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Unhealthy:
+		return "unhealthy"
+	}
+	return fmt.Sprintf("HealthStatus(%d)", int(s))
+}
+
+// healthChecker runs a resource's health check in the background
+type healthChecker struct {
+	check    func(ctx context.Context) error
+	interval time.Duration
+
+	mu       sync.Mutex
+	started  bool
+	stopped  bool
+	status   HealthStatus
+	failures int   // consecutive failed checks
+	lastErr  error // from the latest failed check
+	cancel   context.CancelFunc
+	done     chan struct{} // closed when the goroutine exits
+}
+
+// WithHealthCheck makes the resource run check every interval, starting
+// from its first use. After WithUnhealthyAfter consecutive failures, three
+// by default, the resource turns Unhealthy and uses fail straight away with
+// ErrUnhealthy; the next passing check makes it Healthy again. Close stops
+// the checks, cancelling the context of one that is running.
+func WithHealthCheck(check func(ctx context.Context) error, interval time.Duration) Option {
+	return func(r *Resource) {
+		r.health = &healthChecker{check: check, interval: interval}
+	}
+}
+
+// WithUnhealthyAfter sets how many consecutive failed health checks make
+// the resource Unhealthy
+func WithUnhealthyAfter(k int) Option {
+	return func(r *Resource) {
+		r.unhealthyAfter = k
+	}
+}
+
+// Health reports whether the resource is serving
+func (r *Resource) Health() HealthStatus {
+	if r.health == nil {
+		return Healthy
+	}
+	r.health.mu.Lock()
+	defer r.health.mu.Unlock()
+
+	return r.health.status
+}
+
+// checkHealth starts the health checks on the first call and fails with
+// ErrUnhealthy, wrapping the latest check error, while the resource is
+// quarantined
+func (r *Resource) checkHealth() error {
+	h := r.health
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.started && !h.stopped {
+		h.started = true
+		var ctx context.Context
+		ctx, h.cancel = context.WithCancel(context.Background())
+		h.done = make(chan struct{})
+		go r.runHealthChecks(ctx, h)
+	}
+	if h.status == Unhealthy {
+		return fmt.Errorf("resource %s: %w: %w", r.name, ErrUnhealthy, h.lastErr)
+	}
+	return nil
+}
+
+func (r *Resource) runHealthChecks(ctx context.Context, h *healthChecker) {
+	defer close(h.done)
+	for {
+		select {
+		case <-r.clock.After(h.interval):
+		case <-ctx.Done():
+			return
+		}
+		err := h.check(ctx)
+		if ctx.Err() != nil {
+			// Stopped mid-check, so the result says nothing
+			return
+		}
+		r.recordHealth(h, err)
+	}
+}
+
+// recordHealth updates the health status with a check's result, logging
+// every transition
+func (r *Resource) recordHealth(h *healthChecker, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err == nil {
+		h.failures = 0
+		h.lastErr = nil
+		if h.status == Unhealthy {
+			h.status = Healthy
+			r.setStateHealth(true)
+			r.log(LevelInfo, "healthy again")
+		}
+		return
+	}
+	h.failures++
+	h.lastErr = err
+	if h.status == Healthy && h.failures >= r.unhealthyAfter {
+		h.status = Unhealthy
+		r.setStateHealth(false)
+		r.log(LevelWarn, "unhealthy", NewField("failures", h.failures), ErrorField(err))
+	}
+}
+
+// stopHealthChecks stops the health check goroutine, if it was started, and
+// waits for it to exit. Checks never start once it has been called.
+func (r *Resource) stopHealthChecks() {
+	h := r.health
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.stopped = true
+	cancel, done := h.cancel, h.done
+	h.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
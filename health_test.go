@@ -0,0 +1,146 @@
+// health_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyCheck is a health check whose result the test sets
+type flakyCheck struct {
+	mu     sync.Mutex
+	err    error
+	checks int
+}
+
+func (c *flakyCheck) check(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks++
+	return c.err
+}
+
+func (c *flakyCheck) set(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+// tick advances clock by one check interval and waits for the health check
+// goroutine to be waiting for the next one
+func tick(clock *FakeClock, interval time.Duration) {
+	clock.Advance(interval)
+	clock.BlockUntil(1)
+}
+
+func TestResourceHealthCheck(t *testing.T) {
+	logs := &CaptureWriter{}
+
+	clock := NewFakeClock(time.Now())
+	hc := &flakyCheck{}
+	resource := NewResource("db", 100, 60, WithClock(clock), WithLogger(NewLogger(logs)),
+		WithInit(func(context.Context) error { return nil }),
+		WithHealthCheck(hc.check, time.Second), WithUnhealthyAfter(2))
+	defer resource.Close(context.Background())
+	use := func() error {
+		return resource.UseFunc(context.Background(), func(context.Context) error { return nil })
+	}
+
+	if err := use(); err != nil {
+		t.Fatal(err)
+	}
+	clock.BlockUntil(1)
+
+	errDown := errors.New("ping timed out")
+	hc.set(errDown)
+	tick(clock, time.Second)
+	if resource.Health() != Healthy {
+		t.Error("Expected a single failure to leave the resource healthy")
+	}
+	if err := use(); err != nil {
+		t.Errorf("Expected uses to go ahead below the failure threshold, got %v", err)
+	}
+
+	tick(clock, time.Second)
+	if resource.Health() != Unhealthy {
+		t.Error("Expected consecutive failures to make the resource unhealthy")
+	}
+	if err := use(); !errors.Is(err, ErrUnhealthy) || !errors.Is(err, errDown) {
+		t.Errorf("Expected ErrUnhealthy wrapping the check error, got %v", err)
+	}
+	if !logs.Contains("msg=unhealthy resource=db failures=") {
+		t.Errorf("Expected the transition to be logged, got %q", logs.String())
+	}
+
+	hc.set(nil)
+	tick(clock, time.Second)
+	if resource.Health() != Healthy {
+		t.Error("Expected a passing check to make the resource healthy again")
+	}
+	if err := use(); err != nil {
+		t.Errorf("Expected uses to go ahead once healthy, got %v", err)
+	}
+	if !logs.Contains(`msg="healthy again" resource=db`) {
+		t.Errorf("Expected the recovery to be logged, got %q", logs.String())
+	}
+}
+
+func TestResourceHealthCheckStartsOnFirstUse(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	hc := &flakyCheck{}
+	resource := NewResource("db", 100, 60, WithClock(clock),
+		WithInit(func(context.Context) error { return nil }),
+		WithHealthCheck(hc.check, time.Second))
+	defer resource.Close(context.Background())
+
+	clock.Advance(5 * time.Second)
+	if hc.checks != 0 {
+		t.Errorf("Expected no checks before the first use, got %d", hc.checks)
+	}
+	resource.UseFunc(context.Background(), func(context.Context) error { return nil })
+	clock.BlockUntil(1)
+	tick(clock, time.Second)
+	tick(clock, time.Second)
+	if hc.checks != 2 {
+		t.Errorf("Expected a check per interval once used, got %d", hc.checks)
+	}
+}
+
+func TestResourceCloseStopsHealthCheck(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	running := make(chan struct{})
+	var cancelled bool
+	resource := NewResource("db", 100, 60, WithClock(clock),
+		WithInit(func(context.Context) error { return nil }),
+		WithHealthCheck(func(ctx context.Context) error {
+			close(running)
+			<-ctx.Done()
+			cancelled = true
+			return ctx.Err()
+		}, time.Second))
+
+	resource.UseFunc(context.Background(), func(context.Context) error { return nil })
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-running
+
+	// Close waits for the goroutine, so the check has seen its cancellation
+	if err := resource.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !cancelled {
+		t.Error("Expected Close to cancel a running health check")
+	}
+	if resource.Health() != Healthy {
+		t.Error("Expected a check cut short by Close not to count as a failure")
+	}
+}
+
+func TestHealthStatusString(t *testing.T) {
+	if Healthy.String() != "healthy" || Unhealthy.String() != "unhealthy" {
+		t.Errorf("Unexpected names %q, %q", Healthy, Unhealthy)
+	}
+}
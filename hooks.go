@@ -0,0 +1,88 @@
+// hooks.go
+package main
+
+import "time"
+
+// WithOnDenied registers f to be told about every denied acquisition, with
+// the time of the denial and the window's usage and allowance at that point.
+// See fireEvents for when and how callbacks run.
+func WithOnDenied(f func(now time.Time, current, max int)) LimiterOption {
+	return func(rl *RateLimiter) {
+		rl.deniedHook = f
+	}
+}
+
+// WithOnWindowReset registers f to be called every time a new window starts.
+// See fireEvents for when and how callbacks run.
+func WithOnWindowReset(f func()) LimiterOption {
+	return func(rl *RateLimiter) {
+		rl.resetHook = f
+	}
+}
+
+// limiterEvent is a callback invocation queued while the lock is held
+type limiterEvent struct {
+	reset   bool // a window reset rather than a denial
+	now     time.Time
+	current int
+	max     int
+}
+
+// queueEventLocked records e for delivery once the lock is released. Events
+// nobody listens for are dropped straight away.
+func (rl *RateLimiter) queueEventLocked(e limiterEvent) {
+	if e.reset && rl.resetHook == nil || !e.reset && rl.deniedHook == nil {
+		return
+	}
+	rl.events = append(rl.events, e)
+}
+
+// fireEvents delivers queued events to the callbacks. It must be called
+// without the lock held, and every method that can queue an event defers it
+// ahead of taking the lock.
+//
+// Callbacks run outside the mutex, so they may call back into the limiter.
+// They are never run concurrently: while one goroutine is delivering,
+// events queued by others are appended to its backlog and delivered by it in
+// order, so a callback may run on a goroutine other than the one whose call
+// caused the event.
+//
+// A panicking callback isn't recovered: the panic carries on out of the
+// call that was delivering, and the rest of the events it was delivering
+// are dropped. Events queued later are still delivered.
+func (rl *RateLimiter) fireEvents() {
+	rl.lock()
+	if rl.firing || len(rl.events) == 0 {
+		rl.unlock()
+		return
+	}
+	rl.firing = true
+	locked := true
+	defer func() {
+		// Also on a panic, so later events aren't left waiting on a
+		// delivery that will never come
+		if !locked {
+			rl.lock()
+		}
+		rl.firing = false
+		rl.unlock()
+	}()
+
+	for len(rl.events) > 0 {
+		events := rl.events
+		rl.events = nil
+		rl.unlock()
+		locked = false
+
+		for _, e := range events {
+			if e.reset {
+				rl.resetHook()
+			} else {
+				rl.deniedHook(e.now, e.current, e.max)
+			}
+		}
+
+		rl.lock()
+		locked = true
+	}
+}
@@ -0,0 +1,137 @@
+// hooks_test.go
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiterHooks(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	var denials []int
+	resets := 0
+	limiter := NewRateLimiter(2, 1,
+		WithLimiterClock(clock),
+		WithOnDenied(func(now time.Time, current, max int) {
+			if !now.Equal(clock.Now()) {
+				t.Errorf("Expected the denial time %v, got %v", clock.Now(), now)
+			}
+			denials = append(denials, current, max)
+		}),
+		WithOnWindowReset(func() { resets++ }),
+	)
+
+	limiter.TryAcquire()
+	limiter.TryAcquire()
+	if limiter.TryAcquire() {
+		t.Fatal("Expected the third acquisition to be denied")
+	}
+	if len(denials) != 2 || denials[0] != 2 || denials[1] != 2 {
+		t.Errorf("Expected one denial at 2 of 2, got %v", denials)
+	}
+	if resets != 0 {
+		t.Errorf("Expected no resets yet, got %d", resets)
+	}
+
+	clock.Advance(time.Second)
+	if !limiter.TryAcquire() {
+		t.Fatal("Expected an acquisition in the new window")
+	}
+	if resets != 1 {
+		t.Errorf("Expected one reset, got %d", resets)
+	}
+}
+
+func TestLimiterHooksReentrant(t *testing.T) {
+	var limiter *RateLimiter
+	calls := 0
+	limiter = NewRateLimiter(1, 60, WithOnDenied(func(time.Time, int, int) {
+		calls++
+		// Calling back in must not deadlock; the nested denial is delivered
+		// by the outer call once this callback returns
+		if calls == 1 {
+			limiter.TryAcquire()
+			limiter.Stats()
+		}
+	}))
+
+	limiter.TryAcquire()
+	done := make(chan struct{})
+	go func() {
+		limiter.TryAcquire()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Re-entering the limiter from a callback deadlocked")
+	}
+	if calls != 2 {
+		t.Errorf("Expected both denials to be reported, got %d", calls)
+	}
+}
+
+func TestLimiterHooksNeverConcurrent(t *testing.T) {
+	var active, overlaps, calls int32
+	limiter := NewRateLimiter(5, 60, WithOnDenied(func(time.Time, int, int) {
+		if atomic.AddInt32(&active, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Microsecond)
+		atomic.AddInt32(&active, -1)
+	}))
+
+	const goroutines, attempts = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < attempts; j++ {
+				limiter.TryAcquire()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&overlaps); n != 0 {
+		t.Errorf("Expected callbacks never to overlap, got %d overlaps", n)
+	}
+	if n := atomic.LoadInt32(&calls); n != goroutines*attempts-5 {
+		t.Errorf("Expected %d denials reported, got %d", goroutines*attempts-5, n)
+	}
+}
+
+func TestLimiterHooksPanic(t *testing.T) {
+	calls := 0
+	limiter := NewRateLimiter(1, 60, WithOnDenied(func(time.Time, int, int) {
+		calls++
+		if calls == 1 {
+			panic("hook failed")
+		}
+	}))
+	limiter.TryAcquire()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the callback's panic to carry on out of TryAcquire")
+			}
+		}()
+		limiter.TryAcquire()
+	}()
+
+	if limiter.TryAcquire() {
+		t.Fatal("Expected the limiter to keep denying")
+	}
+	if calls != 2 {
+		t.Errorf("Expected callbacks to run again after a panic, got %d calls", calls)
+	}
+	if n := len(limiter.events); n != 0 {
+		t.Errorf("Expected no events left queued, got %d", n)
+	}
+}
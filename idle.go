@@ -0,0 +1,89 @@
+// idle.go
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// WithIdleTimeout tears the resource down once d has passed without a use,
+// e.g. to give a rarely used connection back to the server: the
+// WithTeardown function runs and the resource goes back to uninitialized,
+// so the next use initializes it again. Uses don't touch the timer; when it
+// fires it checks when the last use ended and sleeps again if that was
+// less than d ago. Zero, the default, means never.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(r *Resource) {
+		r.idleAfter = d
+	}
+}
+
+// armIdleTimer starts the idle timer after a successful initialization
+func (r *Resource) armIdleTimer() {
+	if r.idleAfter <= 0 {
+		return
+	}
+	r.closeMu.Lock()
+	defer r.closeMu.Unlock()
+
+	if r.closed || r.idleTimer != nil {
+		return
+	}
+	r.lastUse = r.clock.Now()
+	r.idleTimer = r.clock.AfterFunc(r.idleAfter, r.onIdle)
+}
+
+// stopIdleTimerLocked cancels a pending idle timer
+func (r *Resource) stopIdleTimerLocked() {
+	if r.idleTimer != nil {
+		r.idleTimer.Stop()
+		r.idleTimer = nil
+	}
+}
+
+// onIdle tears the resource down if it really has been idle for the
+// timeout, or rearms the timer for when it will have been. It holds the
+// lock uses enter by for the whole teardown, so a use that arrives
+// meanwhile waits for it and then initializes afresh.
+func (r *Resource) onIdle() {
+	r.closeMu.Lock()
+	defer r.closeMu.Unlock()
+
+	r.idleTimer = nil
+	if r.closed {
+		return
+	}
+	if r.inFlight > 0 {
+		// The use in flight will end after now, so wait a full timeout
+		r.idleTimer = r.clock.AfterFunc(r.idleAfter, r.onIdle)
+		return
+	}
+	if idle := r.clock.Now().Sub(r.lastUse); idle < r.idleAfter {
+		r.idleTimer = r.clock.AfterFunc(r.idleAfter-idle, r.onIdle)
+		return
+	}
+
+	// Tear down while still initialized, so a teardown such as
+	// ValueResource's can tell there is something to close
+	r.log(LevelInfo, "idle, tearing down", DurationField("idle", r.idleAfter))
+	if r.teardown != nil {
+		if err := r.teardown(context.Background()); err != nil {
+			r.log(LevelError, "idle teardown failed", ErrorField(err))
+		}
+	}
+
+	r.initMu.Lock()
+	r.initDone = false
+	r.idled = true
+	r.setState(ResourceUninitialized)
+	r.initMu.Unlock()
+}
+
+// idledOut reports whether the idle timer has torn the resource down since
+// it was last initialized
+func (r *Resource) idledOut() bool {
+	r.initMu.Lock()
+	defer r.initMu.Unlock()
+
+	return r.idled
+}
@@ -0,0 +1,166 @@
+// idle_test.go
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lifecycle counts a resource's initializations and teardowns
+type lifecycle struct {
+	mu        sync.Mutex
+	inits     int
+	teardowns int
+	events    []string
+}
+
+func (lc *lifecycle) init(context.Context) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.inits++
+	lc.events = append(lc.events, "init")
+	return nil
+}
+
+func (lc *lifecycle) teardown(context.Context) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.teardowns++
+	lc.events = append(lc.events, "teardown")
+	return nil
+}
+
+func (lc *lifecycle) counts() (int, int) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return lc.inits, lc.teardowns
+}
+
+func noWork(context.Context) error { return nil }
+
+func TestResourceIdleTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	lc := &lifecycle{}
+	resource := NewResource("db", 100, 3600, WithClock(clock), WithIdleTimeout(time.Minute),
+		WithInit(lc.init), WithTeardown(lc.teardown))
+
+	resource.UseFunc(context.Background(), noWork)
+	clock.Advance(50 * time.Second)
+	// Every use pushes the teardown back
+	resource.UseFunc(context.Background(), noWork)
+	clock.Advance(50 * time.Second)
+	if _, teardowns := lc.counts(); teardowns != 0 {
+		t.Fatal("Expected a use within the timeout to keep the resource up")
+	}
+
+	clock.Advance(10 * time.Second)
+	if inits, teardowns := lc.counts(); inits != 1 || teardowns != 1 {
+		t.Fatalf("Expected a teardown a minute after the last use, got %d inits and %d teardowns", inits, teardowns)
+	}
+
+	// The next use initializes again, and starts a new idle cycle
+	resource.UseFunc(context.Background(), noWork)
+	if inits, _ := lc.counts(); inits != 2 {
+		t.Errorf("Expected a use after the teardown to initialize again, got %d inits", inits)
+	}
+	clock.Advance(time.Minute)
+	if _, teardowns := lc.counts(); teardowns != 2 {
+		t.Errorf("Expected the reinitialized resource to idle out too, got %d teardowns", teardowns)
+	}
+
+	// Nothing is initialized, so closing doesn't tear down a third time
+	resource.Close(context.Background())
+	if _, teardowns := lc.counts(); teardowns != 2 {
+		t.Errorf("Expected Close to skip teardown after an idle one, got %d teardowns", teardowns)
+	}
+}
+
+func TestResourceIdleTimeoutWaitsForInFlight(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	lc := &lifecycle{}
+	resource := NewResource("db", 100, 3600, WithClock(clock), WithIdleTimeout(time.Minute),
+		WithInit(lc.init), WithTeardown(lc.teardown))
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resource.UseFunc(context.Background(), func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	clock.Advance(2 * time.Minute)
+	if _, teardowns := lc.counts(); teardowns != 0 {
+		t.Error("Expected no teardown while a use is in flight")
+	}
+	close(release)
+	<-done
+	clock.Advance(time.Minute)
+	if _, teardowns := lc.counts(); teardowns != 1 {
+		t.Errorf("Expected a teardown once the use had been idle a minute, got %d", teardowns)
+	}
+}
+
+func TestResourceIdleTeardownBlocksUse(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	lc := &lifecycle{}
+	tearingDown := make(chan struct{})
+	finish := make(chan struct{})
+	resource := NewResource("db", 100, 3600, WithClock(clock), WithIdleTimeout(time.Minute),
+		WithInit(lc.init), WithTeardown(func(ctx context.Context) error {
+			close(tearingDown)
+			<-finish
+			return lc.teardown(ctx)
+		}))
+	resource.UseFunc(context.Background(), noWork)
+
+	go clock.Advance(time.Minute)
+	<-tearingDown
+
+	// A use arriving mid-teardown waits for it, then initializes afresh
+	used := make(chan error)
+	go func() { used <- resource.UseFunc(context.Background(), noWork) }()
+	select {
+	case err := <-used:
+		t.Fatalf("Expected the use to wait for the teardown, returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(finish)
+	if err := <-used; err != nil {
+		t.Fatal(err)
+	}
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	want := []string{"init", "teardown", "init"}
+	if len(lc.events) != len(want) || lc.events[1] != "teardown" || lc.events[2] != "init" {
+		t.Errorf("Expected events %v, got %v", want, lc.events)
+	}
+}
+
+func TestResourceCloseCancelsIdleTimer(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	lc := &lifecycle{}
+	resource := NewResource("db", 100, 3600, WithClock(clock), WithIdleTimeout(time.Minute),
+		WithInit(lc.init), WithTeardown(lc.teardown))
+	resource.UseFunc(context.Background(), noWork)
+
+	resource.Close(context.Background())
+	clock.Advance(time.Hour)
+	if _, teardowns := lc.counts(); teardowns != 1 {
+		t.Errorf("Expected only Close's teardown, got %d", teardowns)
+	}
+	clock.mu.Lock()
+	pending := len(clock.pending)
+	clock.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("Expected Close to stop the idle timer, %d timers pending", pending)
+	}
+}
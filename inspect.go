@@ -0,0 +1,69 @@
+// inspect.go
+package main
+
+import "time"
+
+// ResourceSnapshot is a point-in-time view of a resource for debugging,
+// made of plain values so it marshals to JSON as is
+type ResourceSnapshot struct {
+	Name    string
+	State   string // see ResourceState
+	Health  string // see HealthStatus
+	Breaker string // the circuit breaker's state, empty without one
+
+	ResourceMetrics // uses, errors and latencies, and the uses in flight
+
+	Limiter     *LimiterStats // nil if the limiter doesn't report stats
+	ReadLimiter *LimiterStats // the WithReadLimiter limiter's, nil likewise or without one
+	SlotsHeld   int           // of the WithMaxConcurrent cap, zero without one
+	QueueDepth  int           // uses waiting for a slot or a token
+
+	LastError   string    // from the latest failed use, empty if none has
+	LastErrorAt time.Time // zero if no use has failed
+	LastInit    time.Time // when the latest successful init finished, zero if none has
+}
+
+// Inspect gathers the resource's state, limiter usage, uses in flight and
+// waiting, and its latest error and initialization into one snapshot. Each
+// part is read under its own lock, one at a time and only for as long as
+// copying it takes, so Inspect never holds up uses for long; the parts can
+// be a moment apart from each other.
+func (r *Resource) Inspect() ResourceSnapshot {
+	s := ResourceSnapshot{
+		Name:            r.name,
+		State:           r.State().String(),
+		Health:          r.Health().String(),
+		ResourceMetrics: r.Metrics(),
+	}
+	if r.breaker != nil {
+		s.Breaker = r.breaker.State().String()
+	}
+	if stats, err := r.LimiterStats(); err == nil {
+		s.Limiter = &stats
+		s.QueueDepth = stats.Waiters
+	}
+	r.cfgMu.RLock()
+	readLimiter := r.readLimiter
+	r.cfgMu.RUnlock()
+	if src, ok := readLimiter.(statsSource); ok {
+		stats := src.Stats()
+		s.ReadLimiter = &stats
+		s.QueueDepth += stats.Waiters
+	}
+	if r.sem != nil {
+		s.SlotsHeld = r.sem.Held()
+		s.QueueDepth += r.sem.Waiting()
+	}
+
+	r.usage.mu.Lock()
+	if r.usage.lastErr != nil {
+		s.LastError = r.usage.lastErr.Error()
+		s.LastErrorAt = r.usage.lastErrAt
+	}
+	r.usage.mu.Unlock()
+
+	r.initMu.Lock()
+	s.LastInit = r.lastInit
+	r.initMu.Unlock()
+	return s
+}
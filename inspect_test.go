@@ -0,0 +1,88 @@
+// inspect_test.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"testing"
+	"time"
+)
+
+func TestResourceInspect(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	resource := NewResource("db", 10, 60, WithClock(clock), WithMaxConcurrent(1), WithInit(noWork))
+	if s := resource.Inspect(); s.State != "uninitialized" || !s.LastInit.IsZero() || s.LastError != "" {
+		t.Errorf("Expected a fresh resource to have nothing to report, got %+v", s)
+	}
+
+	errQuery := errors.New("query failed")
+	resource.UseFunc(context.Background(), func(context.Context) error { return errQuery })
+
+	// One use in flight, inspecting from inside its work, and one queued
+	var inside ResourceSnapshot
+	done := fillBulkhead(resource, 1)
+	queued := make(chan error, 1)
+	go func() {
+		queued <- resource.UseFunc(context.Background(), func(context.Context) error {
+			inside = resource.Inspect()
+			return nil
+		})
+	}()
+	for resource.Inspect().QueueDepth == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	s := resource.Inspect()
+	if s.Name != "db" || s.State != "ready" || s.Health != "healthy" || s.Breaker != "" {
+		t.Errorf("Expected a ready, healthy db, got %+v", s)
+	}
+	if s.InFlight != 1 || s.SlotsHeld != 1 || s.QueueDepth != 1 {
+		t.Errorf("Expected 1 use in flight and 1 queued, got %+v", s)
+	}
+	if s.Limiter == nil || s.Limiter.Current != 2 {
+		t.Errorf("Expected the limiter's usage, got %+v", s.Limiter)
+	}
+	if s.LastError != "resource db: query failed" || !s.LastErrorAt.Equal(clock.Now()) {
+		t.Errorf("Expected the failed use's error, got %q at %v", s.LastError, s.LastErrorAt)
+	}
+	if !s.LastInit.Equal(clock.Now()) {
+		t.Errorf("Expected the init time, got %v", s.LastInit)
+	}
+
+	done()
+	if err := <-queued; err != nil {
+		t.Fatal(err)
+	}
+	if inside.InFlight != 1 {
+		t.Errorf("Expected Inspect to work from inside a use, got %+v", inside)
+	}
+
+	// It marshals to JSON as is
+	var back ResourceSnapshot
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &back); err != nil || back.State != "ready" || back.Limiter.Current != 2 || back.InFlight != 1 {
+		t.Errorf("Expected the snapshot to survive JSON, got %+v and %v", back, err)
+	}
+}
+
+func TestResourceInspectExpvar(t *testing.T) {
+	resource := NewResource("db", 5, 60, WithInit(noWork))
+	name := expvarName(t)
+	if err := resource.PublishMetricsExpvar(name); err != nil {
+		t.Fatal(err)
+	}
+	resource.UseFunc(context.Background(), noWork)
+
+	var s ResourceSnapshot
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.State != "ready" || s.Uses != 1 {
+		t.Errorf("Expected the published snapshot to be live, got %+v", s)
+	}
+}
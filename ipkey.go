@@ -0,0 +1,139 @@
+// ipkey.go
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// IPKeyOption configures IPKeyFunc
+type IPKeyOption func(*ipKeyer)
+
+type ipKeyer struct {
+	trusted    []netip.Prefix
+	v4Bits     int
+	v6Bits     int
+	defaultKey string
+}
+
+// WithTrustedProxies makes IPKeyFunc believe X-Forwarded-For when the
+// request comes from one of prefixes. Headers from anyone else are ignored,
+// since clients can send whatever they like.
+func WithTrustedProxies(prefixes ...netip.Prefix) IPKeyOption {
+	return func(k *ipKeyer) {
+		k.trusted = append(k.trusted, prefixes...)
+	}
+}
+
+// WithIPv4Prefix groups IPv4 clients by their first bits bits, e.g. 24 to
+// limit per /24
+func WithIPv4Prefix(bits int) IPKeyOption {
+	return func(k *ipKeyer) {
+		k.v4Bits = bits
+	}
+}
+
+// WithIPv6Prefix groups IPv6 clients by their first bits bits, e.g. 64 so
+// that rotating addresses within one allocation doesn't dodge the limit
+func WithIPv6Prefix(bits int) IPKeyOption {
+	return func(k *ipKeyer) {
+		k.v6Bits = bits
+	}
+}
+
+// WithDefaultKey sets the key used when no client address can be parsed.
+// It defaults to "unknown", so such requests share one limit.
+func WithDefaultKey(key string) IPKeyOption {
+	return func(k *ipKeyer) {
+		k.defaultKey = key
+	}
+}
+
+// IPKeyFunc returns a key function for KeyedMiddleware that limits by
+// client IP. The client is the connection's remote address or, when that is
+// a trusted proxy, the right-most address in X-Forwarded-For that isn't a
+// trusted proxy itself. Addresses are reduced to the configured prefix
+// lengths, which default to the whole address.
+func IPKeyFunc(opts ...IPKeyOption) func(*http.Request) string {
+	k := &ipKeyer{v4Bits: 32, v6Bits: 128, defaultKey: "unknown"}
+	for _, opt := range opts {
+		opt(k)
+	}
+	return k.key
+}
+
+func (k *ipKeyer) key(r *http.Request) string {
+	addr, ok := parseRemoteAddr(r.RemoteAddr)
+	if ok && k.isTrusted(addr) {
+		addr, ok = k.forwardedClient(addr, r.Header.Values("X-Forwarded-For"))
+	}
+	if !ok {
+		return k.defaultKey
+	}
+	return k.normalize(addr)
+}
+
+// forwardedClient walks the X-Forwarded-For chain from the nearest hop
+// outwards and returns the first address not belonging to a trusted proxy.
+// A chain of nothing but trusted proxies yields the furthest one, and no
+// chain at all the proxy that connected. A malformed entry fails the walk.
+func (k *ipKeyer) forwardedClient(proxy netip.Addr, headers []string) (netip.Addr, bool) {
+	var hops []string
+	for _, h := range headers {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+
+	client := proxy
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		client = addr.WithZone("").Unmap()
+		if !k.isTrusted(client) {
+			break
+		}
+	}
+	return client, true
+}
+
+func (k *ipKeyer) isTrusted(addr netip.Addr) bool {
+	for _, p := range k.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize renders addr as the key for its prefix
+func (k *ipKeyer) normalize(addr netip.Addr) string {
+	bits := k.v6Bits
+	if addr.Is4() {
+		bits = k.v4Bits
+	}
+	if bits >= addr.BitLen() || bits < 0 {
+		return addr.String()
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return k.defaultKey
+	}
+	return prefix.String()
+}
+
+// parseRemoteAddr parses a host:port or bare address, dropping any zone and
+// unmapping IPv4-mapped IPv6 addresses
+func parseRemoteAddr(remote string) (netip.Addr, bool) {
+	host := remote
+	if h, _, err := net.SplitHostPort(remote); err == nil {
+		host = h
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone("").Unmap(), true
+}
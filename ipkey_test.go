@@ -0,0 +1,96 @@
+// ipkey_test.go
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func ipRequest(remote string, forwarded ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remote
+	for _, f := range forwarded {
+		r.Header.Add("X-Forwarded-For", f)
+	}
+	return r
+}
+
+func TestIPKeyFuncPrefixes(t *testing.T) {
+	keyFunc := IPKeyFunc(WithIPv4Prefix(24), WithIPv6Prefix(64))
+	tests := []struct {
+		remote, want string
+	}{
+		{"203.0.113.7:1234", "203.0.113.0/24"},
+		{"203.0.113.200:80", "203.0.113.0/24"},
+		{"[2001:db8:1:2:aaaa::1]:443", "2001:db8:1:2::/64"},
+		{"[2001:db8:1:2:bbbb::9]:443", "2001:db8:1:2::/64"},
+		{"[::ffff:198.51.100.4]:80", "198.51.100.0/24"},
+	}
+	for _, tt := range tests {
+		if got := keyFunc(ipRequest(tt.remote)); got != tt.want {
+			t.Errorf("%s: Expected key %q, got %q", tt.remote, tt.want, got)
+		}
+	}
+
+	if got := IPKeyFunc()(ipRequest("203.0.113.7:1234")); got != "203.0.113.7" {
+		t.Errorf("Expected the whole address by default, got %q", got)
+	}
+}
+
+func TestIPKeyFuncForwardedFor(t *testing.T) {
+	keyFunc := IPKeyFunc(WithTrustedProxies(netip.MustParsePrefix("10.0.0.0/8")))
+
+	// Through two trusted proxies the client is the first untrusted hop
+	if got := keyFunc(ipRequest("10.0.0.1:80", "198.51.100.4, 10.0.0.2")); got != "198.51.100.4" {
+		t.Errorf("Expected the forwarded client, got %q", got)
+	}
+	// Anything a client prepends itself is further out than the first
+	// untrusted hop and ignored
+	if got := keyFunc(ipRequest("10.0.0.1:80", "1.2.3.4", "198.51.100.4")); got != "198.51.100.4" {
+		t.Errorf("Expected the spoofed entry to be skipped, got %q", got)
+	}
+	// A trusted proxy without the header is itself the client
+	if got := keyFunc(ipRequest("10.0.0.1:80")); got != "10.0.0.1" {
+		t.Errorf("Expected the proxy address, got %q", got)
+	}
+}
+
+func TestIPKeyFuncIgnoresUntrustedForwardedFor(t *testing.T) {
+	keyFunc := IPKeyFunc(WithTrustedProxies(netip.MustParsePrefix("10.0.0.0/8")))
+	if got := keyFunc(ipRequest("198.51.100.4:80", "1.2.3.4")); got != "198.51.100.4" {
+		t.Errorf("Expected a header from an untrusted client to be ignored, got %q", got)
+	}
+
+	// Nor is a header believed when no proxies are trusted
+	if got := IPKeyFunc()(ipRequest("10.0.0.1:80", "1.2.3.4")); got != "10.0.0.1" {
+		t.Errorf("Expected the header to be ignored without trusted proxies, got %q", got)
+	}
+}
+
+func TestIPKeyFuncMalformed(t *testing.T) {
+	keyFunc := IPKeyFunc(WithTrustedProxies(netip.MustParsePrefix("10.0.0.0/8")), WithDefaultKey("anonymous"))
+	if got := keyFunc(ipRequest("not-an-ip")); got != "anonymous" {
+		t.Errorf("Expected the default key for a bad remote address, got %q", got)
+	}
+	if got := keyFunc(ipRequest("10.0.0.1:80", "garbage")); got != "anonymous" {
+		t.Errorf("Expected the default key for a bad forwarded address, got %q", got)
+	}
+	if got := IPKeyFunc()(ipRequest("")); got != "unknown" {
+		t.Errorf("Expected the default key to be unknown, got %q", got)
+	}
+}
+
+func TestKeyedMiddlewareByIP(t *testing.T) {
+	kl := NewKeyedLimiter(1, 60)
+	handler := KeyedMiddleware(kl, IPKeyFunc(WithIPv6Prefix(64)), okHandler())
+
+	// Hold the /64's only token, then rotate the address within it
+	kl.TryAcquire("2001:db8:1:2::/64")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, ipRequest("[2001:db8:1:2::ffff]:443"))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected addresses in the same /64 to share a limit, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,198 @@
+// keyed.go
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const keyedShards = 32
+
+// KeyedLimiter keeps an independent RateLimiter per key, e.g. per user or
+// per client IP, all sharing one configuration unless SetOverride gives a
+// key its own. Keys are spread over
+// several shards so traffic for different keys doesn't contend on one lock.
+type KeyedLimiter struct {
+	maxRequests int
+	window      time.Duration
+	shards      [keyedShards]keyedShard
+	clock       Clock
+
+	idleTTL   time.Duration
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type keyedShard struct {
+	mu        sync.Mutex
+	limiters  map[string]*keyedEntry
+	overrides map[string]keyQuota // set by SetOverride, allocated on first use
+	closed    bool
+}
+
+type keyedEntry struct {
+	limiter  *RateLimiter
+	lastUsed time.Time
+
+	// a quota change waiting for the window it was made in to end
+	pending  *keyQuota
+	switchAt time.Time
+}
+
+// KeyedOption configures a KeyedLimiter
+type KeyedOption func(*KeyedLimiter)
+
+// WithKeyTTL evicts keys that haven't been used for ttl. A background
+// sweeper checks every ttl/2 until Close is called.
+func WithKeyTTL(ttl time.Duration) KeyedOption {
+	return func(kl *KeyedLimiter) {
+		kl.idleTTL = ttl
+	}
+}
+
+// NewKeyedLimiter creates a keyed limiter allowing maxRequests per
+// windowSeconds for every key
+func NewKeyedLimiter(maxRequests, windowSeconds int, opts ...KeyedOption) *KeyedLimiter {
+	return newKeyedLimiter(maxRequests, time.Duration(windowSeconds)*time.Second, realClock{}, opts...)
+}
+
+func newKeyedLimiter(maxRequests int, window time.Duration, clock Clock, opts ...KeyedOption) *KeyedLimiter {
+	kl := &KeyedLimiter{
+		maxRequests: maxRequests,
+		window:      window,
+		clock:       clock,
+	}
+	for i := range kl.shards {
+		kl.shards[i].limiters = make(map[string]*keyedEntry)
+	}
+	for _, opt := range opts {
+		opt(kl)
+	}
+	if kl.idleTTL > 0 {
+		kl.stop = make(chan struct{})
+		kl.done = make(chan struct{})
+		go kl.sweep(kl.idleTTL / 2)
+	}
+	return kl
+}
+
+// shard picks the shard owning key using FNV-1a
+func (kl *KeyedLimiter) shard(key string) *keyedShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &kl.shards[h%keyedShards]
+}
+
+// TryAcquire attempts to acquire a token for key, creating its limiter on
+// first use
+func (kl *KeyedLimiter) TryAcquire(key string) bool {
+	s := kl.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	// The shard lock is held across the acquisition so the sweeper can't
+	// evict the entry between lookup and use
+	e, _ := kl.entryLocked(s, key, true)
+	e.lastUsed = kl.clock.Now()
+	return e.limiter.TryAcquire()
+}
+
+// Release releases a token for key. Unknown keys are ignored.
+func (kl *KeyedLimiter) Release(key string) {
+	s := kl.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := kl.entryLocked(s, key, false); ok {
+		e.lastUsed = kl.clock.Now()
+		e.limiter.Release()
+	}
+}
+
+// RetryAfter returns how long until key may next acquire a token
+func (kl *KeyedLimiter) RetryAfter(key string) time.Duration {
+	s := kl.shard(key)
+	s.mu.Lock()
+	e, ok := kl.entryLocked(s, key, false)
+	s.mu.Unlock()
+
+	if !ok {
+		return 0
+	}
+	return e.limiter.RetryAfter()
+}
+
+// Keys returns the currently tracked keys in sorted order
+func (kl *KeyedLimiter) Keys() []string {
+	var keys []string
+	for i := range kl.shards {
+		s := &kl.shards[i]
+		s.mu.Lock()
+		for key := range s.limiters {
+			keys = append(keys, key)
+		}
+		s.mu.Unlock()
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// evictIdle removes every key untouched for longer than the idle TTL
+func (kl *KeyedLimiter) evictIdle() {
+	now := kl.clock.Now()
+	for i := range kl.shards {
+		s := &kl.shards[i]
+		s.mu.Lock()
+		for key, e := range s.limiters {
+			if now.Sub(e.lastUsed) >= kl.idleTTL {
+				delete(s.limiters, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// sweep runs evictIdle every interval until Close is called
+func (kl *KeyedLimiter) sweep(interval time.Duration) {
+	defer close(kl.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			kl.evictIdle()
+		case <-kl.stop:
+			return
+		}
+	}
+}
+
+// Close stops the background sweeper and closes every key's limiter, so
+// later acquisitions fail. It is safe to call more than once.
+func (kl *KeyedLimiter) Close() error {
+	kl.closeOnce.Do(func() {
+		if kl.stop != nil {
+			close(kl.stop)
+			<-kl.done
+		}
+		for i := range kl.shards {
+			s := &kl.shards[i]
+			s.mu.Lock()
+			s.closed = true
+			for _, e := range s.limiters {
+				e.limiter.Close()
+			}
+			s.mu.Unlock()
+		}
+	})
+	return nil
+}
@@ -0,0 +1,115 @@
+// keyed_test.go
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedLimiterIndependentKeys(t *testing.T) {
+	limiter := NewKeyedLimiter(2, 60)
+
+	for i := 0; i < 2; i++ {
+		if !limiter.TryAcquire("alice") {
+			t.Fatalf("Acquisition %d for alice should succeed", i+1)
+		}
+	}
+	if limiter.TryAcquire("alice") {
+		t.Error("Third acquisition for alice should fail")
+	}
+	if !limiter.TryAcquire("bob") {
+		t.Error("Acquisition for bob uses a separate limit and should succeed")
+	}
+
+	limiter.Release("alice")
+	if !limiter.TryAcquire("alice") {
+		t.Error("Acquisition for alice after release should succeed")
+	}
+
+	// Releasing an unknown key must not create it
+	limiter.Release("carol")
+	if keys := limiter.Keys(); !reflect.DeepEqual(keys, []string{"alice", "bob"}) {
+		t.Errorf("Expected keys [alice bob], got %v", keys)
+	}
+}
+
+func TestKeyedLimiterConcurrent(t *testing.T) {
+	limiter := NewKeyedLimiter(5, 60)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := make(map[string]int)
+
+	for k := 0; k < 10; k++ {
+		key := fmt.Sprintf("user-%d", k)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if limiter.TryAcquire(key) {
+					mu.Lock()
+					granted[key]++
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for key, n := range granted {
+		if n != 5 {
+			t.Errorf("Expected 5 acquisitions for %s, got %d", key, n)
+		}
+	}
+	if n := len(limiter.Keys()); n != 10 {
+		t.Errorf("Expected 10 active keys, got %d", n)
+	}
+}
+
+func TestKeyedLimiterEvictionStartsFreshWindow(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewKeyedLimiter(1, 60, WithKeyTTL(time.Hour))
+	defer limiter.Close()
+	limiter.clock = clock
+
+	if !limiter.TryAcquire("alice") {
+		t.Fatal("First acquisition should succeed")
+	}
+	if limiter.TryAcquire("alice") {
+		t.Fatal("Second acquisition within the window should fail")
+	}
+
+	clock.Advance(30 * time.Minute)
+	limiter.TryAcquire("bob")
+	clock.Advance(40 * time.Minute)
+	limiter.evictIdle()
+
+	if keys := limiter.Keys(); !reflect.DeepEqual(keys, []string{"bob"}) {
+		t.Fatalf("Expected only bob to survive eviction, got %v", keys)
+	}
+	if !limiter.TryAcquire("alice") {
+		t.Error("A key re-created after eviction should start with a fresh window")
+	}
+}
+
+func TestKeyedLimiterSweeper(t *testing.T) {
+	limiter := NewKeyedLimiter(1, 60, WithKeyTTL(20*time.Millisecond))
+	limiter.TryAcquire("alice")
+
+	deadline := time.Now().Add(time.Second)
+	for len(limiter.Keys()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Sweeper did not evict the idle key")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := limiter.Close(); err != nil {
+		t.Errorf("Close returned %v", err)
+	}
+	if err := limiter.Close(); err != nil {
+		t.Errorf("Second Close returned %v", err)
+	}
+}
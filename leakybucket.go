@@ -0,0 +1,76 @@
+// leakybucket.go
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LeakyBucketLimiter lets requests through at a constant pace, one every
+// 1/rate seconds, instead of allowing bursts
+type LeakyBucketLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time // earliest time the next request may proceed
+	clock    Clock
+}
+
+// NewLeakyBucketLimiter creates a limiter draining rate requests per second
+func NewLeakyBucketLimiter(rate float64) *LeakyBucketLimiter {
+	return &LeakyBucketLimiter{
+		interval: time.Duration(float64(time.Second) / rate),
+		clock:    realClock{},
+	}
+}
+
+// TryAcquire succeeds only if the next slot has already been reached
+func (lb *LeakyBucketLimiter) TryAcquire() bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := lb.clock.Now()
+	if now.Before(lb.next) {
+		return false
+	}
+	lb.next = now.Add(lb.interval)
+	return true
+}
+
+// Acquire reserves the next free slot and sleeps until it arrives, or
+// returns ctx.Err() if ctx is done first
+func (lb *LeakyBucketLimiter) Acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	lb.mu.Lock()
+	now := lb.clock.Now()
+	slot := lb.next
+	if slot.Before(now) {
+		slot = now
+	}
+	lb.next = slot.Add(lb.interval)
+	lb.mu.Unlock()
+
+	wait := slot.Sub(now)
+	if wait <= 0 {
+		return nil
+	}
+
+	select {
+	case <-lb.clock.After(wait):
+		return nil
+	case <-ctx.Done():
+		lb.mu.Lock()
+		// Hand the slot back if nobody has queued behind us
+		if lb.next.Equal(slot.Add(lb.interval)) {
+			lb.next = slot
+		}
+		lb.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Release is a no-op: the bucket drains on its own schedule
+func (lb *LeakyBucketLimiter) Release() {}
@@ -0,0 +1,82 @@
+// leakybucket_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLeakyBucketTryAcquire(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	bucket := NewLeakyBucketLimiter(10) // one request every 100ms
+	bucket.clock = clock
+
+	if !bucket.TryAcquire() {
+		t.Fatal("First acquisition should succeed")
+	}
+	if bucket.TryAcquire() {
+		t.Error("Immediate second acquisition should fail")
+	}
+	clock.Advance(99 * time.Millisecond)
+	if bucket.TryAcquire() {
+		t.Error("Acquisition before the interval elapses should fail")
+	}
+	clock.Advance(time.Millisecond)
+	if !bucket.TryAcquire() {
+		t.Error("Acquisition after the interval should succeed")
+	}
+}
+
+func TestLeakyBucketAcquireSpacing(t *testing.T) {
+	const rate = 50 // one request every 20ms
+	interval := time.Second / rate
+	// Allow for timer and scheduler jitter on loaded machines
+	const slack = 5 * time.Millisecond
+
+	bucket := NewLeakyBucketLimiter(rate)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var times []time.Time
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := bucket.Acquire(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			times = append(times, time.Now())
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < interval-slack {
+			t.Errorf("Acquisitions %d and %d were only %v apart, expected at least %v", i-1, i, gap, interval)
+		}
+	}
+	if span := times[len(times)-1].Sub(times[0]); span < 9*interval-slack {
+		t.Errorf("10 acquisitions spanned %v, expected at least %v", span, 9*interval)
+	}
+}
+
+func TestLeakyBucketAcquireCancelled(t *testing.T) {
+	bucket := NewLeakyBucketLimiter(1)
+	if err := bucket.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := bucket.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
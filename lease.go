@@ -0,0 +1,157 @@
+// lease.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLeaseExpired is returned by Lease.Extend once the lease has expired or
+// been released
+var ErrLeaseExpired = errors.New("rate limiter: lease expired")
+
+// Lease is a token held for at most a TTL. If it isn't released in time the
+// limiter takes it back, so a caller that crashes or loses track of it
+// can't shrink the limiter's capacity for good.
+type Lease struct {
+	limiter *RateLimiter
+	epoch   uint64    // window the token was charged to
+	expires time.Time // guarded by the limiter's lock, like done
+	done    bool      // released or expired
+}
+
+// Lease blocks like Acquire until a token is available or ctx is done, and
+// returns it as a lease that the limiter reclaims ttl from now unless it is
+// released or extended first. Reclaimed leases are counted in
+// Stats().ExpiredLeases.
+func (rl *RateLimiter) Lease(ctx context.Context, ttl time.Duration) (*Lease, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("%w: lease TTL must be positive, got %v", ErrInvalidConfig, ttl)
+	}
+	epoch, err := rl.acquire(ctx, 1, PriorityNormal)
+	if err != nil {
+		return nil, err
+	}
+
+	rl.lock()
+	defer rl.unlock()
+
+	now := rl.clock.Now()
+	l := &Lease{limiter: rl, epoch: epoch, expires: now.Add(ttl)}
+	if rl.leases == nil {
+		rl.leases = make(map[*Lease]struct{})
+	}
+	rl.leases[l] = struct{}{}
+	rl.armLeaseTimerLocked(now)
+	return l, nil
+}
+
+// Release gives the token back. Releasing a lease that has already expired
+// or been released does nothing.
+func (l *Lease) Release() {
+	rl := l.limiter
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	if l.done {
+		return
+	}
+	now := rl.clock.Now()
+	rl.endLeaseLocked(l, now)
+	rl.dispatchLocked(now)
+}
+
+// Extend pushes the lease's expiry back by d. It fails with ErrLeaseExpired
+// if the lease has already expired or been released.
+func (l *Lease) Extend(d time.Duration) error {
+	rl := l.limiter
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	if l.done {
+		return ErrLeaseExpired
+	}
+	now := rl.clock.Now()
+	if !now.Before(l.expires) {
+		// Past its expiry with the timer yet to run
+		rl.endLeaseLocked(l, now)
+		rl.expiredLeases++
+		rl.dispatchLocked(now)
+		return ErrLeaseExpired
+	}
+	// A later expiry leaves the timer to fire early and rearm
+	l.expires = l.expires.Add(d)
+	rl.armLeaseTimerLocked(now)
+	return nil
+}
+
+// ExpiresAt returns when the limiter will reclaim the lease
+func (l *Lease) ExpiresAt() time.Time {
+	rl := l.limiter
+	rl.lock()
+	defer rl.unlock()
+
+	return l.expires
+}
+
+// endLeaseLocked gives a lease's token back to the window it came from
+func (rl *RateLimiter) endLeaseLocked(l *Lease, now time.Time) {
+	l.done = true
+	delete(rl.leases, l)
+	rl.resetIfExpiredLocked(now)
+	rl.releaseEpochLocked(1, l.epoch)
+}
+
+// armLeaseTimerLocked makes sure the lease timer fires by the earliest
+// expiry. One timer serves every lease, so the limiter keeps a single
+// pending callback however many leases are out.
+func (rl *RateLimiter) armLeaseTimerLocked(now time.Time) {
+	var next time.Time
+	for l := range rl.leases {
+		if next.IsZero() || l.expires.Before(next) {
+			next = l.expires
+		}
+	}
+	if next.IsZero() {
+		return
+	}
+	if rl.leaseTimer != nil {
+		if !next.Before(rl.leaseTimerAt) {
+			return
+		}
+		rl.leaseTimer.Stop()
+	}
+	rl.leaseTimer = rl.clock.AfterFunc(next.Sub(now), rl.reclaimLeases)
+	rl.leaseTimerAt = next
+}
+
+// reclaimLeases takes back every lease past its expiry and rearms the timer
+// for the rest
+func (rl *RateLimiter) reclaimLeases() {
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	if rl.closed {
+		// Close stopped the timer after it had already fired
+		return
+	}
+	rl.leaseTimer = nil
+	now := rl.clock.Now()
+	reclaimed := false
+	for l := range rl.leases {
+		if !now.Before(l.expires) {
+			rl.endLeaseLocked(l, now)
+			rl.expiredLeases++
+			reclaimed = true
+		}
+	}
+	if reclaimed {
+		rl.dispatchLocked(now)
+	}
+	rl.armLeaseTimerLocked(now)
+}
@@ -0,0 +1,141 @@
+// lease_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLeaseExpiryRecoversCapacity(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiterDuration(2, time.Hour, WithLimiterClock(clock))
+
+	// A caller leaks a lease and never releases it
+	if _, err := limiter.Lease(context.Background(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	held, _ := limiter.Lease(context.Background(), 10*time.Minute)
+	if limiter.TryAcquire() {
+		t.Fatal("Expected both tokens to be out on lease")
+	}
+
+	clock.Advance(time.Minute)
+	if !limiter.TryAcquire() {
+		t.Error("Expected the leaked lease's token back after its TTL")
+	}
+	if n := limiter.Stats().ExpiredLeases; n != 1 {
+		t.Errorf("Expected 1 expired lease, got %d", n)
+	}
+
+	// Releasing the lease still in force works as normal
+	held.Release()
+	if !limiter.TryAcquire() {
+		t.Error("Expected a released lease's token back")
+	}
+	clock.Advance(time.Hour - time.Minute - time.Second)
+	if n := limiter.Stats().ExpiredLeases; n != 1 {
+		t.Errorf("Expected a released lease never to expire, %d expired", n)
+	}
+}
+
+func TestLeaseReleaseAfterExpiry(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiterDuration(1, time.Hour, WithLimiterClock(clock))
+
+	lease, _ := limiter.Lease(context.Background(), time.Minute)
+	clock.Advance(time.Minute)
+	if !limiter.TryAcquire() {
+		t.Fatal("Expected the token back after the TTL")
+	}
+
+	// The token now belongs to someone else; the stale release mustn't free it
+	lease.Release()
+	lease.Release()
+	if limiter.TryAcquire() {
+		t.Error("Expected releasing an expired lease to do nothing")
+	}
+	if err := lease.Extend(time.Minute); !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("Expected ErrLeaseExpired extending an expired lease, got %v", err)
+	}
+}
+
+func TestLeaseExtend(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiterDuration(1, time.Hour, WithLimiterClock(clock))
+
+	lease, _ := limiter.Lease(context.Background(), time.Minute)
+	start := lease.ExpiresAt()
+	clock.Advance(30 * time.Second)
+	if err := lease.Extend(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got := lease.ExpiresAt(); !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected the expiry pushed back a minute, got %v", got.Sub(start))
+	}
+
+	// The timer armed for the original expiry fires and rearms
+	clock.Advance(30 * time.Second)
+	if limiter.TryAcquire() {
+		t.Error("Expected an extended lease to outlive its original TTL")
+	}
+	clock.Advance(time.Minute)
+	if !limiter.TryAcquire() {
+		t.Error("Expected the extended lease to expire in the end")
+	}
+	if err := lease.Extend(time.Minute); !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("Expected ErrLeaseExpired, got %v", err)
+	}
+}
+
+func TestLeaseWaitsForToken(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiterDuration(1, time.Hour, WithLimiterClock(clock))
+	limiter.Lease(context.Background(), time.Minute)
+
+	got := make(chan *Lease)
+	go func() {
+		lease, err := limiter.Lease(context.Background(), time.Minute)
+		if err != nil {
+			t.Error(err)
+		}
+		got <- lease
+	}()
+	waitForWaiters(limiter, 1)
+
+	// The first lease expiring hands its token to the queued one
+	clock.Advance(time.Minute)
+	lease := <-got
+	clock.Advance(30 * time.Second)
+	if limiter.TryAcquire() {
+		t.Error("Expected the second lease to hold the token")
+	}
+	lease.Release()
+}
+
+func TestLeaseSingleTimer(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiterDuration(100, time.Hour, WithLimiterClock(clock))
+	for i := 0; i < 50; i++ {
+		limiter.Lease(context.Background(), time.Duration(50-i)*time.Second)
+	}
+
+	clock.mu.Lock()
+	pending := len(clock.pending)
+	clock.mu.Unlock()
+	if pending != 1 {
+		t.Errorf("Expected one timer for every lease, got %d", pending)
+	}
+	clock.Advance(50 * time.Second)
+	if n := limiter.Stats().ExpiredLeases; n != 50 {
+		t.Errorf("Expected every lease to expire, got %d", n)
+	}
+}
+
+func TestLeaseInvalidTTL(t *testing.T) {
+	limiter := NewRateLimiter(1, 60)
+	if _, err := limiter.Lease(context.Background(), 0); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for a zero TTL, got %v", err)
+	}
+}
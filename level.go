@@ -0,0 +1,136 @@
+// level.go
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Level is how much a logged message matters. The zero Level is LevelInfo.
+type Level int32
+
+const (
+	LevelDebug Level = iota - 1 // per-use detail
+	LevelInfo                   // lifecycle changes
+	LevelWarn                   // denials and failing health checks
+	LevelError                  // failed teardowns, hooks and registrations
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int32(l))
+}
+
+// LeveledLogging is a Logging that filters messages by level and takes
+// fields. A resource asks Enabled before building a message and hands the
+// ones that pass to LogAt; a Logging without levels gets LevelInfo and
+// above through Log, with the fields rendered as logfmt after the message.
+type LeveledLogging interface {
+	Logging
+	Enabled(level Level) bool
+	LogAt(level Level, message string, fields ...Field)
+}
+
+// ContextLogging is a LeveledLogging that also takes the context of the
+// use a message is about
+type ContextLogging interface {
+	LeveledLogging
+	LogContext(ctx context.Context, level Level, message string, fields ...Field)
+}
+
+// SetLevel makes the logger, and every logger With made from it or it was
+// made from, drop messages below level from now on. It is safe to call
+// while the logger is in use.
+func (l *Logger) SetLevel(level Level) {
+	l.root().level.Store(int32(level))
+}
+
+// Level returns the level below which the logger drops messages
+func (l *Logger) Level() Level {
+	return Level(l.root().level.Load())
+}
+
+// Enabled reports whether the logger keeps messages at level, and so does
+// its slog.Handler if it has one
+func (l *Logger) Enabled(level Level) bool {
+	return l.enabled(context.Background(), level)
+}
+
+func (l *Logger) enabled(ctx context.Context, level Level) bool {
+	if level < l.Level() {
+		return false
+	}
+	if h := l.root().handler; h != nil {
+		return h.Enabled(ctx, level.slogLevel())
+	}
+	return true
+}
+
+// LogAt logs message with fields if the logger keeps messages at level.
+// Nothing is rendered for a message the logger drops.
+func (l *Logger) LogAt(level Level, message string, fields ...Field) {
+	l.LogContext(context.Background(), level, message, fields...)
+}
+
+// LogContext is LogAt with the context the message is about, which a
+// slog.Handler receives
+func (l *Logger) LogContext(ctx context.Context, level Level, message string, fields ...Field) {
+	if l.enabled(ctx, level) && l.admit(level, message, fields) {
+		l.write(ctx, level, message, fields)
+	}
+}
+
+// Debug logs message with fields at LevelDebug
+func (l *Logger) Debug(message string, fields ...Field) { l.LogAt(LevelDebug, message, fields...) }
+
+// Info logs message with fields at LevelInfo
+func (l *Logger) Info(message string, fields ...Field) { l.LogAt(LevelInfo, message, fields...) }
+
+// Warn logs message with fields at LevelWarn
+func (l *Logger) Warn(message string, fields ...Field) { l.LogAt(LevelWarn, message, fields...) }
+
+// Error logs message with fields at LevelError
+func (l *Logger) Error(message string, fields ...Field) { l.LogAt(LevelError, message, fields...) }
+
+// logEnabled reports whether the resource's logger keeps messages at level
+func (r *Resource) logEnabled(level Level) bool {
+	if l, ok := r.logger.(LeveledLogging); ok {
+		return l.Enabled(level)
+	}
+	return level >= LevelInfo
+}
+
+// log logs message at level with the resource's name and fields, unless
+// the resource's logger would drop it
+func (r *Resource) log(level Level, message string, fields ...Field) {
+	r.logContext(context.Background(), level, message, fields...)
+}
+
+// logContext is log for a message about a use, handing the use's ctx to a
+// ContextLogging so it can pick out what the ctx carries, such as a trace
+func (r *Resource) logContext(ctx context.Context, level Level, message string, fields ...Field) {
+	if !r.logEnabled(level) {
+		return
+	}
+	// A *Logger is a child carrying the name already, see newResource
+	if _, ok := r.logger.(*Logger); !ok {
+		fields = append([]Field{ResourceField(r.name)}, fields...)
+	}
+	switch l := r.logger.(type) {
+	case ContextLogging:
+		l.LogContext(ctx, level, message, fields...)
+	case LeveledLogging:
+		l.LogAt(level, message, fields...)
+	default:
+		r.logger.Log(message + " " + renderText(fields))
+	}
+}
@@ -0,0 +1,81 @@
+// lifecycle.go
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// UseEvent describes a point in the life of a resource use, passed to the
+// hooks registered with WithOnInit, WithOnAcquire, WithOnRelease and
+// WithOnError
+type UseEvent struct {
+	Resource string
+	Caller   Caller        // from WithCaller, or anonymous
+	Mode     AccessMode    // read for UseRead, otherwise write
+	Wait     time.Duration // spent acquiring the slot and token
+	Duration time.Duration // of the work, or of the init for OnInit
+	Err      error         // the failure, if any
+}
+
+// A Hook is called at one point of a resource use. Hooks run on the
+// caller's goroutine, holding none of the package's locks, so they may use
+// the resource themselves. A panicking hook is recovered and logged and
+// the use carries on.
+type Hook func(ctx context.Context, ev UseEvent)
+
+// resourceHooks are a resource's hooks, in registration order
+type resourceHooks struct {
+	onInit, onAcquire, onRelease, onError []Hook
+}
+
+// WithOnInit registers h to run after each initialization attempt, with the
+// attempt's duration and error. It runs on the goroutine that ran the
+// attempt, after uses waiting on it have been let go, and before that use
+// acquires anything.
+func WithOnInit(h Hook) Option {
+	return func(r *Resource) {
+		r.hooks.onInit = append(r.hooks.onInit, h)
+	}
+}
+
+// WithOnAcquire registers h to run once a use holds its concurrency slot and
+// token, with the time it waited for them. It always runs before the work
+// starts.
+func WithOnAcquire(h Hook) Option {
+	return func(r *Resource) {
+		r.hooks.onAcquire = append(r.hooks.onAcquire, h)
+	}
+}
+
+// WithOnRelease registers h to run after the work of a use has returned, or
+// panicked, and its slot and token have been given back, with the work's
+// duration and error
+func WithOnRelease(h Hook) Option {
+	return func(r *Resource) {
+		r.hooks.onRelease = append(r.hooks.onRelease, h)
+	}
+}
+
+// WithOnError registers h to run for every use that fails, whether it was
+// refused, failed to initialize, was cancelled or its work failed or
+// panicked. It runs last, after OnRelease if the work ran.
+func WithOnError(h Hook) Option {
+	return func(r *Resource) {
+		r.hooks.onError = append(r.hooks.onError, h)
+	}
+}
+
+// runHooks calls each hook in turn, recovering and logging their panics
+func (r *Resource) runHooks(ctx context.Context, name string, hooks []Hook, ev UseEvent) {
+	for _, h := range hooks {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					r.logContext(ctx, LevelError, "hook panicked", NewField("hook", name), NewField("panic", p))
+				}
+			}()
+			h(ctx, ev)
+		}()
+	}
+}
@@ -0,0 +1,164 @@
+// lifecycle_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// hookLog records the order hooks and work run in
+type hookLog struct {
+	mu     sync.Mutex
+	events []string
+	last   UseEvent
+}
+
+func (hl *hookLog) add(name string) {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+	hl.events = append(hl.events, name)
+}
+
+func (hl *hookLog) hook(name string) Hook {
+	return func(_ context.Context, ev UseEvent) {
+		hl.mu.Lock()
+		defer hl.mu.Unlock()
+		hl.events = append(hl.events, name)
+		hl.last = ev
+	}
+}
+
+func (hl *hookLog) String() string {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+	return strings.Join(hl.events, " ")
+}
+
+func hookedResource(hl *hookLog, opts ...Option) *Resource {
+	opts = append(opts,
+		WithInit(func(context.Context) error { hl.add("init"); return nil }),
+		WithOnInit(hl.hook("OnInit")),
+		WithOnAcquire(hl.hook("OnAcquire")),
+		WithOnRelease(hl.hook("OnRelease")),
+		WithOnError(hl.hook("OnError")))
+	return NewResource("db", 100, 1, opts...)
+}
+
+func TestHookOrder(t *testing.T) {
+	hl := &hookLog{}
+	resource := hookedResource(hl)
+
+	for i := 0; i < 2; i++ {
+		resource.UseFunc(context.Background(), func(context.Context) error {
+			hl.add("work")
+			return nil
+		})
+	}
+	want := "init OnInit OnAcquire work OnRelease OnAcquire work OnRelease"
+	if got := hl.String(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestHookOnAcquireHoldsSlotAndToken(t *testing.T) {
+	var resource *Resource
+	inFlight := -1
+	resource = NewResource("db", 100, 1, WithMaxConcurrent(1), WithOnAcquire(func(context.Context, UseEvent) {
+		inFlight = resource.Metrics().InFlight
+		// The slot is taken, so another use is refused
+		if err := resource.Use(2); !errors.Is(err, ErrTooManyConcurrent) {
+			t.Errorf("Expected the slot to be held during OnAcquire, got %v", err)
+		}
+	}))
+	resource.UseFunc(context.Background(), noWork)
+	if inFlight != 0 {
+		t.Errorf("Expected OnAcquire to run before the work started, %d in flight", inFlight)
+	}
+}
+
+func TestHookOnError(t *testing.T) {
+	hl := &hookLog{}
+	resource := hookedResource(hl, WithMaxConcurrent(1))
+	errWork := errors.New("query failed")
+
+	err := resource.UseFunc(context.Background(), func(context.Context) error { return errWork })
+	if want := "init OnInit OnAcquire OnRelease OnError"; hl.String() != want {
+		t.Errorf("Expected %q, got %q", want, hl.String())
+	}
+	if !errors.Is(hl.last.Err, errWork) || hl.last.Err != err {
+		t.Errorf("Expected OnError to get the use's error, got %v", hl.last.Err)
+	}
+
+	// A refused use never acquires, so only OnError runs
+	done := fillBulkhead(resource, 1)
+	hl.events = nil
+	err = resource.Use(1)
+	if got := hl.String(); !errors.Is(err, ErrTooManyConcurrent) || got != "OnError" || !errors.Is(hl.last.Err, ErrTooManyConcurrent) {
+		t.Errorf("Expected a lone OnError for a refused use, got %q and %v", got, err)
+	}
+	done()
+
+	hl.events = nil
+	func() {
+		defer func() { recover() }()
+		resource.UseFunc(context.Background(), func(context.Context) error { panic("boom") })
+	}()
+	if want := "OnAcquire OnRelease OnError"; hl.String() != want {
+		t.Errorf("Expected %q for a panicking use, got %q", want, hl.String())
+	}
+	if hl.last.Err == nil || !strings.Contains(hl.last.Err.Error(), "boom") {
+		t.Errorf("Expected OnError to report the panic, got %v", hl.last.Err)
+	}
+}
+
+func TestHookCaller(t *testing.T) {
+	hl := &hookLog{}
+	resource := hookedResource(hl)
+
+	alice := Caller{ID: "req-7", Name: "alice"}
+	resource.UseFunc(WithCaller(context.Background(), alice), noWork)
+	if hl.last.Caller != alice || hl.last.Resource != "db" {
+		t.Errorf("Expected alice on db, got %+v", hl.last)
+	}
+	resource.Use(3)
+	if hl.last.Caller.ID != "3" {
+		t.Errorf("Expected Use to report its id, got %+v", hl.last.Caller)
+	}
+}
+
+func TestHookPanicRecovered(t *testing.T) {
+	logs := &CaptureWriter{}
+
+	ran := false
+	resource := NewResource("db", 100, 1, WithLogger(NewLogger(logs)),
+		WithOnAcquire(func(context.Context, UseEvent) { panic("bad hook") }),
+		WithOnAcquire(func(context.Context, UseEvent) { ran = true }))
+	if err := resource.UseFunc(context.Background(), noWork); err != nil {
+		t.Errorf("Expected a panicking hook not to fail the use, got %v", err)
+	}
+	if !ran {
+		t.Error("Expected the hooks after a panicking one to run")
+	}
+	if !logs.Contains(`msg="hook panicked" resource=db hook=OnAcquire panic="bad hook"`) {
+		t.Errorf("Expected the panic to be logged, got %q", logs.String())
+	}
+}
+
+func TestHooksRunWithoutLocks(t *testing.T) {
+	var resource *Resource
+	reenter := func(context.Context, UseEvent) {
+		// Each of these takes a lock the use might otherwise be holding
+		resource.Metrics()
+		resource.limiter.(*RateLimiter).Stats()
+	}
+	resource = NewResource("db", 100, 1,
+		WithOnInit(reenter), WithOnAcquire(reenter), WithOnRelease(reenter), WithOnError(reenter))
+
+	if err := resource.UseFunc(context.Background(), noWork); err != nil {
+		t.Fatal(err)
+	}
+	resource.UseFunc(context.Background(), func(context.Context) error { return errors.New("fail") })
+}
@@ -0,0 +1,207 @@
+// logging_test.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// captureLog is a Logging that keeps every message
+type captureLog struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (c *captureLog) Log(message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, message)
+}
+
+// take returns the messages logged since the last call
+func (c *captureLog) take() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.messages
+	c.messages = nil
+	return m
+}
+
+func expectMessages(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Expected messages %q, got %q", want, got)
+	}
+	for i := range want {
+		if !strings.Contains(got[i], want[i]) {
+			t.Errorf("Expected message %d to contain %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	logs := &captureLog{}
+	resource := NewResource("db", 1, 60, WithLogger(logs), WithMaxConcurrent(1), WithBulkheadMode(BulkheadFailFast))
+
+	resource.Use(1)
+	expectMessages(t, logs.take(), `state changed resource=db from=uninitialized to=initializing`, `state changed resource=db from=initializing to=ready`)
+
+	if err := resource.Use(2); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected the window's only token to be spent, got %v", err)
+	}
+	expectMessages(t, logs.take(), `use denied resource=db caller="Goroutine 2" error="rate limit exceeded for resource db (caller Goroutine 2)"`)
+
+	resource.Close(context.Background())
+	expectMessages(t, logs.take(), `state changed resource=db from=ready to=closing`, `state changed resource=db from=closing to=closed`)
+}
+
+func TestLogFunc(t *testing.T) {
+	var got []string
+	resource := NewResource("db", 1, 60, WithLogger(LogFunc(func(m string) { got = append(got, m) })))
+	resource.Close(context.Background())
+	expectMessages(t, got, "state changed resource=db from=uninitialized to=closing", "state changed resource=db from=closing to=closed")
+}
+
+// levelLog is a LeveledLogging keeping the messages at or above min
+type levelLog struct {
+	captureLog
+	min Level
+}
+
+func (l *levelLog) Enabled(level Level) bool { return level >= l.min }
+
+func (l *levelLog) LogAt(level Level, message string, fields ...Field) {
+	l.Log(level.String() + " " + message + " " + renderText(fields))
+}
+
+func TestResourceLogLevels(t *testing.T) {
+	logs := &levelLog{min: LevelDebug}
+	resource := NewResource("db", 1, 60, WithLogger(logs), WithMaxConcurrent(1), WithBulkheadMode(BulkheadFailFast))
+
+	resource.UseFunc(WithCaller(context.Background(), Caller{Name: "alice"}), noWork)
+	expectMessages(t, logs.take(), "INFO state changed resource=db from=uninitialized to=initializing",
+		"INFO state changed resource=db from=initializing to=ready", "DEBUG use acquired resource=db caller=alice wait=")
+	resource.Use(2)
+	expectMessages(t, logs.take(), "WARN use denied resource=db")
+
+	// Only warnings and errors get through once the level is raised
+	logs.min = LevelWarn
+	resource.Use(3)
+	resource.Close(context.Background())
+	expectMessages(t, logs.take(), "WARN use denied resource=db")
+}
+
+func TestLoggerSetLevel(t *testing.T) {
+	logs := &CaptureWriter{}
+	logger := NewLogger(logs)
+	if logger.Level() != LevelInfo {
+		t.Errorf("Expected a new Logger to log at info, got %v", logger.Level())
+	}
+	logger.Debug("hidden", NewField("n", 1))
+	logger.Info("shown", NewField("n", 2))
+	logger.SetLevel(LevelError)
+	logger.Log("hidden")
+	logger.Warn("hidden", NewField("n", 4))
+	logger.Error("shown", NewField("n", 5))
+	logger.SetLevel(LevelDebug)
+	logger.Debug("shown", NewField("n", 6))
+
+	out := logs.String()
+	for _, want := range []string{"level=INFO msg=shown n=2", "level=ERROR msg=shown n=5", "level=DEBUG msg=shown n=6"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q to be logged, got %q", want, out)
+		}
+	}
+	if strings.Contains(out, "hidden") {
+		t.Errorf("Expected messages below the level to be dropped, got %q", out)
+	}
+}
+
+// formatCounter counts how often it is formatted
+type formatCounter struct{ n *int }
+
+func (f formatCounter) String() string {
+	*f.n++
+	return "counted"
+}
+
+func TestLoggerSkipsFormattingBelowLevel(t *testing.T) {
+	formatted := 0
+	logger := &Logger{}
+	logger.SetLevel(LevelWarn)
+	logger.Debug("counted", NewField("counter", formatCounter{&formatted}))
+	logger.Info("counted", NewField("counter", formatCounter{&formatted}))
+	if formatted != 0 {
+		t.Errorf("Expected filtered messages not to be formatted, formatted %d times", formatted)
+	}
+}
+
+func BenchmarkLoggerDisabledLevel(b *testing.B) {
+	logger := &Logger{}
+	logger.SetLevel(LevelWarn)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Debug("using resource", ResourceField("DatabaseConnection"), CallerField(Caller{Name: "bench"}))
+	}
+}
+
+func BenchmarkResourceUseDebugDisabled(b *testing.B) {
+	resource := NewResource("db", b.N+1, 60, WithLogger(&Logger{}))
+	ctx := WithCaller(context.Background(), Caller{Name: "bench"})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resource.UseFunc(ctx, noWork)
+	}
+}
+
+func TestLoggerJSONFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newFormatLogger(&buf, JSONFormat)
+	logger.SetLevel(LevelDebug)
+	resource := NewResource("db", 1, 60, WithLogger(logger.With(NewField("service", "orders"))), WithMaxConcurrent(1), WithBulkheadMode(BulkheadFailFast))
+	defer resource.Close(context.Background())
+
+	resource.UseFunc(WithCaller(context.Background(), Caller{Name: "alice"}), noWork)
+	buf.Reset()
+	resource.Use(2)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Expected one JSON object, got %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"level":    "WARN",
+		"msg":      "use denied",
+		"service":  "orders",
+		"resource": "db",
+		"caller":   "Goroutine 2",
+		"error":    "rate limit exceeded for resource db (caller Goroutine 2)",
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("Expected %s to be %q, got %v", key, value, line[key])
+		}
+	}
+	if _, err := time.Parse(time.RFC3339Nano, fmt.Sprint(line["ts"])); err != nil {
+		t.Errorf("Expected a timestamp, got %v", line["ts"])
+	}
+}
+
+func TestLoggerLogfmtQuoting(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newFormatLogger(&buf, TextFormat).With(ResourceField("db"))
+	logger.Info("use acquired", DurationField("wait", 1500*time.Millisecond), ErrorField(errors.New(`said "no"`)), NewField("empty", ""))
+
+	want := `level=INFO msg="use acquired" resource=db wait=1.5s error="said \"no\"" empty=""`
+	if got := strings.TrimSpace(buf.String()); !strings.HasSuffix(got, want) || !strings.HasPrefix(got, "ts=") {
+		t.Errorf("Expected a line ending %s, got %s", want, got)
+	}
+}
@@ -2,136 +2,952 @@
 package main
 
 import (
+	"container/list"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+// Limiter is the token surface shared by the limiter implementations
+type Limiter interface {
+	TryAcquire() bool
+	Release()
+}
+
 // RateLimiter manages resource access with configurable limits
 type RateLimiter struct {
-	mu            sync.Mutex
-	maxRequests   int
-	currRequests  int
-	windowSeconds int
-	lastReset     time.Time
+	mu           sync.Mutex // taken through lock and unlock, see fastpath.go
+	fast         fastState
+	clock        Clock
+	maxRequests  int // sustained requests per window
+	burst        int // most requests a single window can allow
+	allowance    int // requests the current window allows
+	currRequests int
+	window       time.Duration
+	lastReset    time.Time
+	epoch        uint64 // incremented on every window reset
+	reservedNext int    // tokens reserved ahead for the next window
+	held         int    // tokens handed out and not yet released, across windows
+	stale        int    // held tokens acquired in windows that have since reset
+
+	// cumulative counters reported by Stats
+	acquired   uint64
+	denied     uint64
+	unbalanced uint64
+
+	// waiters queues the goroutines blocked in Acquire, oldest first
+	waiters       list.List
+	notify        []chan struct{} // handed out by WaitChan, closed when there is room
+	resetTimer    Timer
+	priorityAging time.Duration
+	maxWaiters    int // zero for no cap, see WithMaxWaiters
+	releaseCheck  ReleaseCheck
+	closed        bool
+	mode          Mode
+	lastAt        time.Time // latest timestamp passed to AcquireNAt
+
+	// the window shared with other limiters, see WithCounterStore
+	shared      *StoreLimiter // nil unless WithCounterStore is used
+	sharedCount int64         // the store's count as of its last reply
+	sharedEnd   time.Time     // when the store's window ends, as of that reply
+
+	// outstanding leases and the timer reclaiming them, see lease.go
+	leases        map[*Lease]struct{}
+	leaseTimer    Timer
+	leaseTimerAt  time.Time
+	expiredLeases uint64
+
+	// callbacks and the events queued for them, see hooks.go
+	deniedHook func(now time.Time, current, max int)
+	resetHook  func()
+	events     []limiterEvent
+	firing     bool
 }
 
 // Resource represents a shared resource that needs rate limiting
 type Resource struct {
-	name     string
-	limiter  *RateLimiter
-	logger   *Logger
-	initOnce sync.Once
+	name        string
+	seq         uint64 // creation order, which orders UseAll within a name
+	limiter     Limiter
+	readLimiter Limiter    // nil unless WithReadLimiter is used
+	shared      bool       // the limiter belongs to a group, see NewResourceGroup
+	ownsLimiter bool       // the resource built its limiter, so Close closes it
+	sem         *Semaphore // nil unless WithMaxConcurrent is used
+	bulkhead    BulkheadMode
+	rateLimit   RateLimitMode
+	clock       Clock
+	metrics     MetricsSink
+	registry    *LimiterRegistry // nil unless WithRegistry is used
+	tracer      Tracer           // nil unless WithTracer is used
+	audit       AuditSink        // nil unless WithAudit is used
+	logger      Logging
+	init        func(ctx context.Context) error // see WithInit
+	work        func(ctx context.Context) error // see WithWork
+
+	useTimeout    time.Duration // zero for none, see WithUseTimeout
+	recoverPanics bool          // see WithPanicRecovery
+	callerQuota   *callerQuota  // nil unless WithPerCallerLimit is used
+	callers       *KeyedLimiter // built from callerQuota by newResource
+	retry         *retryPolicy  // nil unless WithRetry is used
+	hooks         resourceHooks
+	events        eventSubs
+
+	// cfgMu guards the limiters, work, useTimeout and retry, which
+	// Reconfigure can swap while uses run; reconfigMu serializes
+	// Reconfigure calls
+	cfgMu          sync.RWMutex
+	reconfigMu     sync.Mutex
+	preserveWindow bool // see WithPreservedWindow, read only by Reconfigure
+
+	// initialization state, see initialize
+	initMu      sync.Mutex
+	initDone    bool
+	initAttempt *initAttempt // the attempt in flight, if any
+	idled       bool         // torn down by the idle timer since the last init
+	lastInit    time.Time    // when the latest successful init finished
+
+	// lifecycle state, see State
+	stateMu        sync.Mutex
+	state          ResourceState
+	stateUnhealthy bool          // the health check's verdict, see setStateHealth
+	stateChanged   chan struct{} // closed on the next transition, if anyone waits
+
+	// background health checks, nil unless WithHealthCheck is used
+	health         *healthChecker
+	unhealthyAfter int
+
+	breaker *CircuitBreaker // nil unless WithCircuitBreaker is used
+	usage   usageStats      // reported by Metrics
+
+	// shutdown state, see Close
+	teardown  func(ctx context.Context) error // see WithTeardown
+	closeMu   sync.Mutex
+	closed    bool
+	inFlight  int           // uses between enter and exit
+	refs      int           // handles not yet closed, see Acquire
+	lastUse   time.Time     // when the latest use exited
+	idleAfter time.Duration // zero for never, see WithIdleTimeout
+	idleTimer Timer
+	drained   chan struct{} // closed once closed and inFlight is zero
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Logging is where a resource sends its messages, see WithLogger
+type Logging interface {
+	Log(message string)
 }
 
-// Logger provides thread-safe logging
+// LogFunc adapts a function to Logging, e.g. one passing messages to slog
+type LogFunc func(message string)
+
+func (f LogFunc) Log(message string) {
+	f(message)
+}
+
+// WithLogger sends the resource's messages to l instead of a Logger. A
+// *Logger is given a child with the resource's name as a field, so l's
+// level and output still apply.
+func WithLogger(l Logging) Option {
+	return func(r *Resource) {
+		r.logger = l
+	}
+}
+
+// Logger provides thread-safe structured logging, dropping messages below
+// its level, LevelInfo unless SetLevel changes it
 type Logger struct {
-	mu sync.Mutex
+	mu     sync.Mutex
+	level  atomic.Int32
+	out    io.Writer    // nil for os.Stderr, guarded by mu
+	format atomic.Int32 // a LogFormat
+	parent *Logger      // set by With, which holds the rest in its root
+	name   string       // set by Named
+	fields []Field      // added to every message by With
+
+	handler slog.Handler // set by NewSlogLogger, replacing out and format
+	async   *asyncWriter // set by NewAsyncLogger
+
+	suppress      atomic.Pointer[suppressor] // nil unless SetSuppression is used
+	suppressClock Clock                      // nil for the real clock
+	sampleEvery   atomic.Int64               // see SetSampling
+	sampled       atomic.Uint64
 }
 
+// Log logs message at LevelInfo
 func (l *Logger) Log(message string) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	log.Printf("%s: %s\n", time.Now().Format("15:04:05"), message)
+	l.LogAt(LevelInfo, message)
+}
+
+// LimiterOption configures a RateLimiter
+type LimiterOption func(*RateLimiter)
+
+// WithLimiterClock makes the limiter read time from c instead of the real
+// clock
+func WithLimiterClock(c Clock) LimiterOption {
+	return func(rl *RateLimiter) {
+		rl.clock = c
+	}
 }
 
 // NewRateLimiter creates a new rate limiter with specified limits
-func NewRateLimiter(maxRequests, windowSeconds int) *RateLimiter {
-	return &RateLimiter{
-		maxRequests:   maxRequests,
-		windowSeconds: windowSeconds,
-		lastReset:     time.Now(),
+//
+// Deprecated: the two bare ints are easy to swap; use
+// NewRateLimiterFromConfig instead.
+func NewRateLimiter(maxRequests, windowSeconds int, opts ...LimiterOption) *RateLimiter {
+	return NewRateLimiterDuration(maxRequests, time.Duration(windowSeconds)*time.Second, opts...)
+}
+
+// NewRateLimiterDuration creates a rate limiter allowing maxRequests per
+// window, which can be shorter than a second
+func NewRateLimiterDuration(maxRequests int, window time.Duration, opts ...LimiterOption) *RateLimiter {
+	return newRateLimiter(maxRequests, window, maxRequests, opts...)
+}
+
+// NewRateLimiterWithBurst creates a rate limiter that sustains rate requests
+// per window but lets capacity unused in quiet windows accumulate, so a
+// single window can allow up to burst requests. A burst below rate is
+// raised to rate.
+//
+// Deprecated: use NewRateLimiterFromConfig with Config.Burst instead.
+func NewRateLimiterWithBurst(rate int, window time.Duration, burst int, opts ...LimiterOption) *RateLimiter {
+	return newRateLimiter(rate, window, burst, opts...)
+}
+
+func newRateLimiter(rate int, window time.Duration, burst int, opts ...LimiterOption) *RateLimiter {
+	if burst < rate {
+		burst = rate
 	}
+	rl := &RateLimiter{
+		clock:         realClock{},
+		maxRequests:   rate,
+		burst:         burst,
+		allowance:     burst,
+		window:        window,
+		priorityAging: defaultPriorityAging,
+	}
+	for _, opt := range opts {
+		opt(rl)
+	}
+	rl.lastReset = rl.clock.Now()
+	rl.fast.base = rl.lastReset
+	return rl
 }
 
 // TryAcquire attempts to acquire a rate limit token
 func (rl *RateLimiter) TryAcquire() bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+	return rl.TryAcquireN(1)
+}
 
-	now := time.Now()
-	if now.Sub(rl.lastReset) >= time.Duration(rl.windowSeconds)*time.Second {
-		rl.currRequests = 0
-		rl.lastReset = now
+// TryAcquireN attempts to acquire n rate limit tokens at once. It fails
+// without acquiring anything if n is not positive, exceeds the burst or
+// doesn't fit in the current window.
+func (rl *RateLimiter) TryAcquireN(n int) bool {
+	if rl.tryAcquireFast(n) {
+		return true
 	}
+	return rl.tryAcquireSlow(n)
+}
+
+// tryAcquireSlow is TryAcquireN without the fast path
+func (rl *RateLimiter) tryAcquireSlow(n int) bool {
+	defer rl.fireEvents()
+	rl.lock()
+	ok := rl.tryAcquireOrDenyLocked(rl.clock.Now(), n)
+	epoch := rl.epoch
+	rl.unlock()
 
-	if rl.currRequests >= rl.maxRequests {
+	if !ok {
 		return false
 	}
+	ok, _ = rl.commitShared(n, epoch, true)
+	return ok
+}
 
-	rl.currRequests++
-	return true
+// Acquire blocks until a rate limit token is available or ctx is done.
+// Waiters are woken as soon as a token is released or the window resets.
+func (rl *RateLimiter) Acquire(ctx context.Context) error {
+	return rl.AcquireCost(ctx, 1)
+}
+
+// WaitTimeout blocks for up to d waiting for a token and reports whether it
+// got one. Like Acquire it sleeps until a release or window reset instead
+// of polling.
+func (rl *RateLimiter) WaitTimeout(d time.Duration) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The timeout is driven by the limiter's clock rather than a context
+	// deadline so it follows a fake clock in tests
+	go func() {
+		select {
+		case <-rl.clock.After(d):
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return rl.Acquire(ctx) == nil
 }
 
 // Release releases a rate limit token
 func (rl *RateLimiter) Release() {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+	rl.ReleaseN(1)
+}
+
+// ReleaseN releases n rate limit tokens. Non-positive n is ignored and the
+// count never drops below zero. See ReleaseChecked for how releasing more
+// than is held is reported.
+func (rl *RateLimiter) ReleaseN(n int) {
+	_ = rl.ReleaseChecked(n)
+}
+
+// SetLimit changes the sustained requests per window. The change applies to
+// the current window immediately: raising the limit frees capacity now,
+// while lowering it below the requests already made simply denies new
+// acquisitions until the window resets. A separately configured burst is
+// kept unless it falls below the new limit.
+func (rl *RateLimiter) SetLimit(max int) {
+	if max < 0 {
+		max = 0
+	}
+
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
 
-	if rl.currRequests > 0 {
-		rl.currRequests--
+	delta := max - rl.maxRequests
+	if rl.burst == rl.maxRequests || rl.burst < max {
+		rl.burst = max
+	}
+	rl.maxRequests = max
+
+	rl.allowance += delta
+	if rl.allowance > rl.burst {
+		rl.allowance = rl.burst
+	}
+	if rl.allowance < 0 {
+		rl.allowance = 0
+	}
+	rl.dispatchLocked(rl.clock.Now())
+}
+
+// SetWindow changes the window length. The current window keeps its start
+// time, so it ends at the old start plus d, or at the next call if that is
+// already in the past. Non-positive durations are ignored.
+func (rl *RateLimiter) SetWindow(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	rl.lock()
+	defer rl.unlock()
+
+	rl.window = d
+	if rl.resetTimer != nil {
+		rl.resetTimer.Stop()
+		rl.resetTimer = nil
+	}
+	rl.armResetTimerLocked(rl.clock.Now())
+}
+
+// resetIfExpiredLocked starts a new window if the current one has elapsed.
+// Each elapsed window earns maxRequests on top of whatever the last window
+// left unused, capped at the burst.
+func (rl *RateLimiter) resetIfExpiredLocked(now time.Time) {
+	elapsed := now.Sub(rl.lastReset)
+	if elapsed < 0 {
+		// The clock stepped back past the window start. Restart the window
+		// from now, keeping its count, so it neither stays open until the
+		// clock catches up nor hands out a fresh allowance.
+		rl.lastReset = now
+		return
+	}
+	if elapsed < rl.window {
+		return
+	}
+
+	rl.allowance = rl.earnedAllowanceLocked(elapsed)
+	// Everything still held except the reservations carried over belongs to
+	// windows that are now over, so releasing it mustn't free the new one
+	rl.stale = rl.held - rl.reservedNext
+	if rl.stale < 0 {
+		rl.stale = 0
+	}
+	rl.currRequests = rl.reservedNext
+	rl.reservedNext = 0
+	rl.lastReset = now
+	rl.epoch++
+	rl.queueEventLocked(limiterEvent{reset: true})
+}
+
+// windowStartLocked returns when the current window started, as seen from
+// now. A start in the future means the clock stepped back; the window
+// counts as starting now, as the next reset check will make it.
+func (rl *RateLimiter) windowStartLocked(now time.Time) time.Time {
+	if rl.lastReset.After(now) {
+		return now
+	}
+	return rl.lastReset
+}
+
+// earnedAllowanceLocked returns the allowance a window reset after elapsed
+// would grant
+func (rl *RateLimiter) earnedAllowanceLocked(elapsed time.Duration) int {
+	unused := rl.allowance - rl.currRequests
+	if unused < 0 {
+		unused = 0
+	}
+	if rl.window <= 0 {
+		// A zero window resets on every call, so every call earns the most
+		return rl.burst
+	}
+	windows := int64(elapsed / rl.window)
+	if earned := int64(unused) + windows*int64(rl.maxRequests); earned < int64(rl.burst) {
+		return int(earned)
+	}
+	return rl.burst
+}
+
+// tryAcquireOrDenyLocked is tryAcquireLocked that also records a failure as
+// a denial
+func (rl *RateLimiter) tryAcquireOrDenyLocked(now time.Time, n int) bool {
+	if rl.tryAcquireLocked(now, n) {
+		return true
+	}
+	if rl.unavailableLocked() != nil {
+		return false
+	}
+	rl.denied++
+	rl.queueEventLocked(limiterEvent{now: now, current: rl.currRequests, max: rl.allowance})
+	return false
+}
+
+// tryAcquireLocked takes n tokens if they fit in the window and nobody is
+// queued ahead of the caller. In bypass mode they are taken regardless.
+func (rl *RateLimiter) tryAcquireLocked(now time.Time, n int) bool {
+	if rl.unavailableLocked() != nil || n <= 0 {
+		return false
+	}
+	bypass := rl.mode == ModeBypass
+	if !bypass && (n > rl.burst || rl.waiters.Len() > 0) {
+		return false
+	}
+
+	rl.resetIfExpiredLocked(now)
+
+	if !bypass && rl.currRequests+n > rl.allowance {
+		return false
+	}
+	// The store would refuse tokens its window is known not to have
+	if left, _ := rl.sharedLeftLocked(now); !bypass && n > left {
+		return false
+	}
+
+	rl.currRequests += n
+	rl.held += n
+	rl.acquired++
+	return true
+}
+
+// Option configures a Resource
+type Option func(*Resource)
+
+// WithLimiter makes the resource use l instead of its own RateLimiter
+func WithLimiter(l Limiter) Option {
+	return func(r *Resource) {
+		r.limiter = l
+	}
+}
+
+// WithMaxConcurrent caps how many callers can use the resource at once,
+// separately from how many requests per window its limiter allows. With a
+// concurrency cap the limiter's tokens are no longer released after each
+// use, so the limiter counts requests per window and nothing else. See
+// WithBulkheadMode for whether callers over the cap wait or fail.
+func WithMaxConcurrent(n int) Option {
+	return func(r *Resource) {
+		r.sem = NewSemaphore(n)
+	}
+}
+
+// WithClock sets the clock used by the resource's own RateLimiter
+func WithClock(c Clock) Option {
+	return func(r *Resource) {
+		r.clock = c
 	}
 }
 
 // NewResource creates a new resource with rate limiting
-func NewResource(name string, maxRequests, windowSeconds int) *Resource {
-	return &Resource{
-		name:    name,
-		limiter: NewRateLimiter(maxRequests, windowSeconds),
-		logger:  &Logger{},
+//
+// Deprecated: the two bare ints are easy to swap; use NewResourceFromConfig
+// instead.
+func NewResource(name string, maxRequests, windowSeconds int, opts ...Option) *Resource {
+	r := newResource(name, opts)
+	if r.limiter == nil {
+		r.limiter = newRateLimiter(maxRequests, time.Duration(windowSeconds)*time.Second, maxRequests, WithLimiterClock(r.clock))
+		r.ownsLimiter = true
+	}
+	// There is no error to return, so a name clash is only logged
+	if err := r.register(); err != nil {
+		r.log(LevelError, "registration failed", ErrorField(err))
 	}
+	return r
 }
 
-// initialize performs one-time initialization of the resource
-func (r *Resource) initialize() {
-	r.logger.Log(fmt.Sprintf("Initializing resource: %s", r.name))
-	// Simulate some initialization work
-	time.Sleep(100 * time.Millisecond)
+// resourceSeq numbers resources as they are created
+var resourceSeq atomic.Uint64
+
+// newResource applies opts to a resource that has no limiter yet unless one
+// of them provides it
+func newResource(name string, opts []Option) *Resource {
+	r := &Resource{
+		name:   name,
+		seq:    resourceSeq.Add(1),
+		clock:  realClock{},
+		logger: &Logger{},
+	}
+	r.init = noop
+	r.work = noop
+	r.unhealthyAfter = defaultUnhealthyAfter
+	for _, opt := range opts {
+		opt(r)
+	}
+	if l, ok := r.logger.(*Logger); ok {
+		r.logger = l.With(ResourceField(name))
+	}
+	r.newCallerLimiter()
+	return r
+}
+
+// WithInit sets the resource's initialization, run by the first use, e.g.
+// to open a database connection. Once it succeeds it never runs again. If
+// it fails, that use and every use that was waiting on it return the error
+// wrapped in ErrInitFailed, and the next use tries again.
+func WithInit(init func(ctx context.Context) error) Option {
+	return func(r *Resource) {
+		r.init = init
+	}
+}
+
+// WithPanicRecovery sets whether a panic in a use's work is returned as a
+// *PanicError instead of carrying on out of the use. Either way the slot
+// and token are given back first and the panic is recorded as a failed
+// use and reported to the OnError hooks. By default panics carry on.
+func WithPanicRecovery(enabled bool) Option {
+	return func(r *Resource) {
+		r.recoverPanics = enabled
+	}
+}
+
+// WithUseTimeout caps how long the work of a single use may take,
+// whatever the caller's context allows: the work runs with a context that
+// expires after d, and if the work fails once that has happened returns an
+// error wrapping ErrUseTimeout. Whichever of the two deadlines comes first
+// wins; the caller's own returns its context error as usual. The token and
+// any concurrency slot are given back either way. Zero means no timeout.
+func WithUseTimeout(d time.Duration) Option {
+	return func(r *Resource) {
+		r.useTimeout = d
+	}
+}
+
+// initAttempt is one run of a resource's init, shared by every use that
+// arrives while it is in flight
+type initAttempt struct {
+	done chan struct{}
+	err  error
+}
+
+// initialize makes sure the resource has been initialized, running init if
+// no earlier attempt succeeded and none is in flight, or waiting for the one
+// that is
+func (r *Resource) initialize(ctx context.Context) error {
+	r.initMu.Lock()
+	if r.initDone {
+		r.initMu.Unlock()
+		return nil
+	}
+	if a := r.initAttempt; a != nil {
+		r.initMu.Unlock()
+		select {
+		case <-a.done:
+			return a.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	a := &initAttempt{done: make(chan struct{})}
+	r.initAttempt = a
+	// Transitions are rejected once the resource is closing, and it stays so
+	r.setState(ResourceInitializing)
+	r.initMu.Unlock()
+
+	// A panicking init counts as a failure, so waiters aren't stuck
+	a.err = fmt.Errorf("%w: resource %s: init panicked", ErrInitFailed, r.name)
+	start := r.clock.Now()
+	defer func() {
+		r.initMu.Lock()
+		r.initDone = a.err == nil
+		r.initAttempt = nil
+		if r.initDone {
+			r.idled = false
+			r.lastInit = r.clock.Now()
+			r.setState(ResourceReady)
+		} else {
+			r.setState(ResourceUninitialized)
+		}
+		r.initMu.Unlock()
+		close(a.done)
+		if a.err == nil {
+			r.armIdleTimer()
+		}
+		ev := UseEvent{
+			Resource: r.name,
+			Caller:   callerOf(ctx),
+			Duration: r.clock.Now().Sub(start),
+			Err:      a.err,
+		}
+		r.runHooks(ctx, "OnInit", r.hooks.onInit, ev)
+		r.publish(EventInit, ev)
+	}()
+
+	if err := r.init(ctx); err != nil {
+		a.err = fmt.Errorf("%w: resource %s: %w", ErrInitFailed, r.name, err)
+	} else {
+		a.err = nil
+	}
+	return a.err
+}
+
+// Init initializes the resource now rather than on its first use, so that
+// use doesn't pay for it. It shares an attempt already in flight, whether
+// started by a use or another Init, and returns the same error a use would;
+// once the resource is initialized it returns nil straight away. A failed
+// Init is retried by the next Init or use, and Init fails with ErrClosed
+// once Close has been called.
+func (r *Resource) Init(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := r.enter(); err != nil {
+		return err
+	}
+	defer r.exit()
+	return r.initialize(ctx)
+}
+
+// noop is the initialization and work of a resource without WithInit or
+// WithWork
+func noop(context.Context) error { return nil }
+
+// WithWork sets the work Use, UseContext and UseCost run, which does
+// nothing by default. UseFunc and its kin run the work they are given.
+func WithWork(work func(ctx context.Context) error) Option {
+	return func(r *Resource) {
+		r.work = work
+	}
 }
 
-// Use attempts to use the resource with rate limiting
+// Use runs the resource's WithWork function under its limits. It fails
+// straight away if the limiter or the concurrency cap is full. The caller
+// is reported as "Goroutine id"; UseContext and UseFunc take a Caller from
+// the context instead.
 func (r *Resource) Use(id int) error {
+	return r.use(WithCaller(context.Background(), goroutineCaller(id)), false, AccessWrite, 1, r.workFunc())
+}
+
+// UseContext is like Use but can be cancelled, and takes its caller from
+// ctx, see WithCaller. It waits like UseFunc, and the work is given ctx to
+// stop early by.
+func (r *Resource) UseContext(ctx context.Context) error {
+	return r.UseFunc(ctx, r.workFunc())
+}
+
+// UseFunc runs fn under the resource's limits: it initializes the resource
+// once, failing with ErrInitFailed if that did, takes a concurrency slot
+// and a token, runs fn and gives both back. It waits, until ctx is done,
+// for the concurrency cap and for limiters that can block, such as
+// RateLimiter, instead of failing straight away, and returns ctx.Err() if
+// ctx ends first. fn's error is returned wrapped with the resource name. If
+// fn panics the slot and token are still given back before the panic
+// carries on. With WithRetry, failed uses are tried again.
+func (r *Resource) UseFunc(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.useWaiting(ctx, AccessWrite, 1, fn)
+}
+
+// useWaiting is UseFunc charging cost units of the limiter for mode
+func (r *Resource) useWaiting(ctx context.Context, mode AccessMode, cost int, fn func(ctx context.Context) error) error {
+	if rp := r.currentRetry(); rp != nil {
+		return r.useWithRetry(ctx, rp, mode, cost, fn)
+	}
+	return r.use(ctx, true, mode, cost, fn)
+}
+
+// use runs fn under the resource's limits, charging cost units of the
+// limiter
+func (r *Resource) use(ctx context.Context, wait bool, mode AccessMode, cost int, fn func(ctx context.Context) error) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ev := UseEvent{Resource: r.name, Caller: callerOf(ctx), Mode: mode}
+	r.cfgMu.RLock()
+	l, useTimeout := r.limiterForLocked(mode), r.useTimeout
+	r.cfgMu.RUnlock()
+	defer func() {
+		var held *heldError
+		if err != nil && !errors.As(err, &held) {
+			r.usage.recordError(err, r.clock.Now())
+			ev.Err = err
+			r.runHooks(ctx, "OnError", r.hooks.onError, ev)
+			r.publish(EventError, ev)
+		}
+	}()
+	if err := r.checkCost(l, cost); err != nil {
+		return err
+	}
+	if err := r.enter(); err != nil {
+		return err
+	}
+	defer r.exit()
+	if err := r.checkHealth(); err != nil {
+		return err
+	}
+	ticket, err := r.breakerAllow()
+	if err != nil {
+		return err
+	}
+	defer r.breakerDone(ticket)
+
+	var span Span
+	if r.tracer != nil {
+		ctx, span = r.tracer.Start(ctx, r.name)
+		ctx = ContextWithSpan(ctx, span)
+		defer span.End()
+	}
+
 	// Ensure initialization happens exactly once
-	r.initOnce.Do(func() {
-		r.initialize()
-	})
+	if err := r.initialize(ctx); err != nil {
+		return err
+	}
 
-	if !r.limiter.TryAcquire() {
-		return fmt.Errorf("rate limit exceeded for resource %s", r.name)
+	start := r.clock.Now()
+	err = r.acquire(ctx, l, r.bulkheadWaits(wait), r.rateLimitWaits(wait), cost)
+	if span != nil {
+		span.SetAttributes(map[string]any{
+			attrAcquired:    err == nil,
+			attrWaitSeconds: r.clock.Now().Sub(start).Seconds(),
+		})
+	}
+	if err != nil {
+		if r.usage.recordRejection(err) {
+			r.recordDecision(ev.Caller, err)
+			r.logContext(ctx, LevelWarn, "use denied", CallerField(ev.Caller), ErrorField(err))
+			ev.Err = err
+			r.publish(EventDeny, ev)
+		}
+		return err
+	}
+	ev.Wait = r.clock.Now().Sub(start)
+	r.recordDecision(ev.Caller, nil)
+	// Deferred ahead of the releases so it runs after them
+	defer func() {
+		r.runHooks(ctx, "OnRelease", r.hooks.onRelease, ev)
+		r.publish(EventRelease, ev)
+	}()
+	if r.sem != nil {
+		defer r.sem.Release()
+	} else {
+		defer r.releaseCost(l, cost)
+		defer r.releaseCaller(ctx)
+	}
+	r.runHooks(ctx, "OnAcquire", r.hooks.onAcquire, ev)
+	r.publish(EventAcquire, ev)
+	if r.logEnabled(LevelDebug) {
+		r.logContext(ctx, LevelDebug, "use acquired", CallerField(ev.Caller), DurationField("wait", ev.Wait))
 	}
-	defer r.limiter.Release()
 
-	r.logger.Log(fmt.Sprintf("Goroutine %d using resource: %s", id, r.name))
-	// Simulate some work
-	time.Sleep(200 * time.Millisecond)
+	workStart := r.startWork(mode, cost)
+	defer r.observeUse(workStart)
+	defer func() {
+		// The deferred releases run as the panic unwinds, or before the
+		// use returns the panic as an error; either way it counts against
+		// an adaptive limiter
+		if p := recover(); p != nil {
+			err = &PanicError{Resource: r.name, Value: p, Stack: debug.Stack()}
+			ev.Duration = r.clock.Now().Sub(workStart)
+			ev.Err = err
+			r.recordUse(workStart, true)
+			r.reportOutcome(l, err)
+			r.breakerRecord(ticket, err)
+			if !r.recoverPanics {
+				panic(p)
+			}
+		}
+	}()
+
+	workCtx := ctx
+	if useTimeout > 0 {
+		var cancel context.CancelFunc
+		workCtx, cancel = context.WithTimeout(ctx, useTimeout)
+		defer cancel()
+	}
+	err = fn(workCtx)
+	var held *heldError
+	if errors.As(err, &held) {
+		// UseAll was refused a resource it needed alongside this one, so
+		// the work never ran
+		r.recordUse(workStart, false)
+		ev.Duration = r.clock.Now().Sub(workStart)
+		return err
+	}
+	if err != nil && ctx.Err() == nil && workCtx.Err() != nil {
+		// The use timeout fired, not the caller's deadline
+		err = fmt.Errorf("%w after %v: %w", ErrUseTimeout, useTimeout, err)
+	}
+	r.recordUse(workStart, err != nil && ctx.Err() == nil)
+	ev.Duration = r.clock.Now().Sub(workStart)
+	ev.Err = err
+	if ctx.Err() == nil {
+		// A cancelled use says nothing about the resource's health, but
+		// one that took too long does
+		r.reportOutcome(l, err)
+		r.breakerRecord(ticket, err)
+	}
+	if err != nil {
+		return fmt.Errorf("resource %s: %w", r.name, err)
+	}
 	return nil
 }
 
+// acquire takes a concurrency slot, if the resource has a cap, and a token
+// from the limiter. With waitSlot it waits for the slot until ctx is done
+// instead of failing straight away, and with waitToken likewise for the
+// token, as far as the limiter can block.
+func (r *Resource) acquire(ctx context.Context, l Limiter, waitSlot, waitToken bool, cost int) error {
+	if err := r.acquireSlot(ctx, waitSlot); err != nil {
+		return err
+	}
+	if err := r.acquireCaller(ctx); err != nil {
+		if r.sem != nil {
+			r.sem.Release()
+		}
+		return err
+	}
+
+	var err error
+	if cost != 1 {
+		err = r.acquireCost(ctx, l, waitToken, cost)
+	} else if a, ok := l.(interface{ Acquire(context.Context) error }); ok && waitToken {
+		if err = a.Acquire(ctx); err != nil {
+			err = fmt.Errorf("resource %s: %w", r.name, err)
+		}
+	} else if ok, retryAfter := allow(l); !ok {
+		rle := newRateLimitError(r.name, l, retryAfter)
+		rle.Caller = callerOf(ctx).String()
+		err = rle
+	}
+	if err != nil {
+		r.releaseCaller(ctx)
+		if r.sem != nil {
+			r.sem.Release()
+		}
+	}
+	return err
+}
+
 func main() {
-	// Create a shared resource with rate limiting
-	resource := NewResource("DatabaseConnection", 3, 1) // max 3 requests per second
+	// Stop starting operations on SIGINT or SIGTERM, then shut down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Register a shared resource allowing at most 3 concurrent users and 10
+	// requests per second. Callers over either limit wait their turn
+	// instead of giving up.
+	clock := Clock(realClock{})
+	// Per-use lines are debug messages, shown only with DEBUG set
+	logger := &Logger{}
+	if os.Getenv("DEBUG") != "" {
+		logger.SetLevel(LevelDebug)
+	}
+	manager := NewManager()
+	manager.Register("DatabaseConnection", func() *Resource {
+		resource, err := NewResourceFromConfig("DatabaseConnection", Config{
+			MaxRequests: 10,
+			Window:      time.Second,
+		}, WithClock(clock), WithLogger(logger), WithMaxConcurrent(3), WithBulkheadMode(BulkheadWait), WithRateLimitMode(RateLimitWait),
+			WithInit(func(context.Context) error {
+				logger.Info("initializing", ResourceField("DatabaseConnection"))
+				// Simulate opening the connection
+				clock.Sleep(100 * time.Millisecond)
+				return nil
+			}),
+			WithWork(func(ctx context.Context) error {
+				logger.Debug("using resource", ResourceField("DatabaseConnection"), CallerField(callerOf(ctx)))
+				// Simulate a query, giving up if the caller does
+				select {
+				case <-clock.After(200 * time.Millisecond):
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}))
+		if err != nil {
+			logger.Error("building resource failed", ResourceField("DatabaseConnection"), ErrorField(err))
+			return nil
+		}
+		return resource
+	})
+	resource, err := manager.Get("DatabaseConnection")
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Create multiple goroutines trying to access the resource
 	var wg sync.WaitGroup
 	numGoroutines := 10
+	var completed atomic.Int32
 
 	for i := 0; i < numGoroutines; i++ {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
 
-			// Each goroutine tries to use the resource multiple times
-			for j := 0; j < 3; j++ {
+			// Each goroutine uses the resource multiple times
+			for j := 0; j < 3 && ctx.Err() == nil; j++ {
 				if err := resource.Use(id); err != nil {
-					resource.logger.Log(fmt.Sprintf("Goroutine %d: %v", id, err))
+					logger.Warn("use failed", CallerField(goroutineCaller(id)), ErrorField(err))
+					continue
 				}
-				// Random delay between attempts
-				time.Sleep(time.Duration(100+id*50) * time.Millisecond)
+				completed.Add(1)
 			}
 		}(i)
 	}
 
-	wg.Wait()
-	resource.logger.Log("All goroutines completed")
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		logger.Info("all goroutines completed", NewField("succeeded", completed.Load()), NewField("operations", numGoroutines*3))
+	case <-ctx.Done():
+		logger.Info("shutting down, waiting for operations in flight", DurationField("timeout", 5*time.Second))
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := manager.Shutdown(shutdownCtx); err != nil {
+		logger.Error("shutdown failed", ErrorField(err))
+	}
 }
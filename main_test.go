@@ -2,13 +2,18 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func TestRateLimiter(t *testing.T) {
-	limiter := NewRateLimiter(3, 1) // 3 requests per second
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(3, 1, WithLimiterClock(clock)) // 3 requests per second
 
 	// Test basic acquisition
 	if !limiter.TryAcquire() {
@@ -29,10 +34,17 @@ func TestRateLimiter(t *testing.T) {
 	if !limiter.TryAcquire() {
 		t.Error("Acquisition after release should succeed")
 	}
+
+	// Test window reset
+	clock.Advance(time.Second)
+	if !limiter.TryAcquire() {
+		t.Error("Acquisition after the window resets should succeed")
+	}
 }
 
 func TestRateLimiterConcurrent(t *testing.T) {
-	limiter := NewRateLimiter(5, 1)
+	// The fake clock never advances, so the window can't reset mid-test
+	limiter := NewRateLimiter(5, 1, WithLimiterClock(NewFakeClock(time.Now())))
 	var wg sync.WaitGroup
 	successCount := 0
 	var mu sync.Mutex
@@ -59,23 +71,365 @@ func TestRateLimiterConcurrent(t *testing.T) {
 	}
 }
 
+func TestRateLimiterAcquireN(t *testing.T) {
+	limiter := NewRateLimiter(10, 1)
+
+	if limiter.TryAcquireN(0) || limiter.TryAcquireN(-1) {
+		t.Error("Non-positive acquisitions should fail")
+	}
+	if limiter.TryAcquireN(11) {
+		t.Error("Acquiring more than maxRequests should fail")
+	}
+	if !limiter.TryAcquireN(7) {
+		t.Error("Acquiring 7 of 10 should succeed")
+	}
+	if limiter.TryAcquireN(4) {
+		t.Error("Acquiring 4 with only 3 left should fail")
+	}
+	if !limiter.TryAcquireN(3) {
+		t.Error("Acquiring the remaining 3 should succeed")
+	}
+
+	limiter.ReleaseN(5)
+	if !limiter.TryAcquireN(5) {
+		t.Error("Acquiring 5 after releasing 5 should succeed")
+	}
+
+	// Releasing more than is held clamps at zero
+	limiter.ReleaseN(100)
+	if !limiter.TryAcquireN(10) {
+		t.Error("Acquiring the full limit after over-release should succeed")
+	}
+	if limiter.TryAcquire() {
+		t.Error("Over-release must not grant extra capacity")
+	}
+}
+
+func TestRateLimiterAcquireNAcrossReset(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(10, 1, WithLimiterClock(clock))
+	if !limiter.TryAcquireN(8) {
+		t.Fatal("Acquiring 8 of 10 should succeed")
+	}
+
+	clock.Advance(time.Second)
+
+	if !limiter.TryAcquireN(10) {
+		t.Error("A fresh window should allow the full limit")
+	}
+	if limiter.TryAcquireN(1) {
+		t.Error("Tokens from the previous window must not carry over")
+	}
+}
+
+func TestRateLimiterZeroWindow(t *testing.T) {
+	// A zero window is over as soon as it starts, so nothing is ever held
+	// back, and it mustn't divide by zero working out what was earned
+	for _, limiter := range []*RateLimiter{
+		NewRateLimiter(3, 0),
+		NewRateLimiterWithBurst(3, 0, 5),
+		NewRateLimiterDuration(3, 0),
+	} {
+		for i := 0; i < 10; i++ {
+			if !limiter.TryAcquire() {
+				t.Fatalf("Expected acquisition %d in a zero window to succeed", i)
+			}
+		}
+		if err := limiter.Acquire(context.Background()); err != nil {
+			t.Errorf("Expected Acquire in a zero window to succeed, got %v", err)
+		}
+		limiter.Stats()
+	}
+	if kl := NewKeyedLimiter(3, 0); !kl.TryAcquire("a") || !kl.TryAcquire("a") || !kl.TryAcquire("a") || !kl.TryAcquire("a") {
+		t.Error("Expected a keyed limiter with a zero window to keep allowing")
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiterWithBurst(2, time.Second, 5, WithLimiterClock(clock))
+
+	// A new limiter starts with the full burst available
+	if !limiter.TryAcquireN(5) {
+		t.Fatal("Acquiring exactly the burst should succeed")
+	}
+	if limiter.TryAcquire() {
+		t.Error("Acquiring past the burst should fail")
+	}
+	if limiter.TryAcquireN(6) {
+		t.Error("Requests larger than the burst can never succeed")
+	}
+
+	// After a fully used window only the sustained rate is earned
+	clock.Advance(time.Second)
+	if !limiter.TryAcquireN(2) {
+		t.Error("Acquiring the sustained rate after a busy window should succeed")
+	}
+	if limiter.TryAcquire() {
+		t.Error("A busy window should not earn more than the sustained rate")
+	}
+
+	// Quiet windows bank capacity up to exactly the burst
+	limiter.lastReset = limiter.lastReset.Add(-10 * time.Second)
+	if !limiter.TryAcquireN(5) {
+		t.Error("Acquiring the full burst after quiet windows should succeed")
+	}
+	if limiter.TryAcquire() {
+		t.Error("Banked capacity must be capped at the burst")
+	}
+}
+
+func TestRateLimiterBurstPartialCarry(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiterWithBurst(2, time.Second, 5, WithLimiterClock(clock))
+	if !limiter.TryAcquireN(4) {
+		t.Fatal("Acquiring 4 of the burst should succeed")
+	}
+
+	// One unused token carries over on top of the sustained rate
+	clock.Advance(time.Second)
+	if !limiter.TryAcquireN(3) {
+		t.Error("Expected 1 carried plus 2 earned tokens")
+	}
+	if limiter.TryAcquire() {
+		t.Error("No more than 3 tokens should be available")
+	}
+}
+
+func TestRateLimiterSetLimit(t *testing.T) {
+	limiter := NewRateLimiter(5, 60)
+	if !limiter.TryAcquireN(4) {
+		t.Fatal("Acquiring 4 of 5 should succeed")
+	}
+
+	// Shrinking below the in-window count denies without going negative
+	limiter.SetLimit(2)
+	if limiter.TryAcquire() {
+		t.Error("Acquisition after shrinking below the current count should fail")
+	}
+	limiter.ReleaseN(3)
+	if !limiter.TryAcquire() {
+		t.Error("Acquisition should succeed once the count drops below the new limit")
+	}
+	if limiter.TryAcquire() {
+		t.Error("The shrunk limit of 2 should be enforced")
+	}
+
+	// Growing applies to the current window immediately
+	limiter.SetLimit(6)
+	if !limiter.TryAcquireN(4) {
+		t.Error("Acquiring up to the raised limit should succeed")
+	}
+	if limiter.TryAcquire() {
+		t.Error("The raised limit of 6 should be enforced")
+	}
+}
+
+func TestRateLimiterSetWindow(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 60, WithLimiterClock(clock))
+	if !limiter.TryAcquire() {
+		t.Fatal("First acquisition should succeed")
+	}
+
+	// Ten seconds into the window, shortening it to 5s ends it at once
+	clock.Advance(10 * time.Second)
+	limiter.SetWindow(5 * time.Second)
+	if !limiter.TryAcquire() {
+		t.Error("Acquisition after the shortened window elapsed should succeed")
+	}
+
+	limiter.SetWindow(time.Hour)
+	limiter.SetWindow(0) // ignored
+	if limiter.TryAcquire() {
+		t.Error("The lengthened window should still be in progress")
+	}
+}
+
+func TestRateLimiterReconfigureConcurrent(t *testing.T) {
+	limiter := NewRateLimiter(10, 1)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if limiter.TryAcquire() {
+					limiter.Release()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 1000; i++ {
+		limiter.SetLimit(i % 20)
+		limiter.SetWindow(time.Duration(1+i%5) * time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+
+	limiter.lock()
+	defer limiter.unlock()
+	if limiter.currRequests < 0 || limiter.allowance < 0 {
+		t.Errorf("Counts went negative: current %d, allowance %d", limiter.currRequests, limiter.allowance)
+	}
+	if limiter.allowance > limiter.burst {
+		t.Errorf("Allowance %d exceeds burst %d", limiter.allowance, limiter.burst)
+	}
+}
+
+func TestRateLimiterAcquireCancelled(t *testing.T) {
+	limiter := NewRateLimiter(1, 60)
+	if !limiter.TryAcquire() {
+		t.Fatal("First acquisition should succeed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := limiter.Acquire(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	limiter.mu.Lock()
+	waiting := limiter.waiters.Len()
+	limiter.mu.Unlock()
+	if waiting != 0 {
+		t.Errorf("Expected cancelled waiter to leave the queue, %d still waiting", waiting)
+	}
+}
+
+// waitForWaiters blocks until n goroutines are queued in Acquire
+func waitForWaiters(limiter *RateLimiter, n int) {
+	for {
+		limiter.mu.Lock()
+		queued := limiter.waiters.Len()
+		limiter.mu.Unlock()
+		if queued >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRateLimiterAcquireWakesOnWindowReset(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 1, WithLimiterClock(clock))
+	if !limiter.TryAcquire() {
+		t.Fatal("First acquisition should succeed")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- limiter.Acquire(context.Background())
+	}()
+	waitForWaiters(limiter, 1)
+
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("Acquire returned before the window reset: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clock.Advance(time.Millisecond)
+	if err := <-done; err != nil {
+		t.Errorf("Acquire should succeed after the window resets, got %v", err)
+	}
+}
+
+func TestRateLimiterWaitTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 1, WithLimiterClock(clock))
+	if !limiter.TryAcquire() {
+		t.Fatal("First acquisition should succeed")
+	}
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- limiter.WaitTimeout(50 * time.Millisecond)
+	}()
+	waitForWaiters(limiter, 1)
+	clock.BlockUntil(2) // the timeout and the window reset
+	clock.Advance(50 * time.Millisecond)
+	if <-done {
+		t.Error("WaitTimeout shorter than the window should fail")
+	}
+
+	go func() {
+		done <- limiter.WaitTimeout(1500 * time.Millisecond)
+	}()
+	waitForWaiters(limiter, 1)
+	clock.Advance(950 * time.Millisecond)
+	if !<-done {
+		t.Error("WaitTimeout longer than the window should succeed after the reset")
+	}
+}
+
+func TestRateLimiterAcquireOrder(t *testing.T) {
+	limiter := NewRateLimiter(1, 60)
+	if !limiter.TryAcquire() {
+		t.Fatal("First acquisition should succeed")
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var order []int
+
+	// Queue the waiters one at a time so their arrival order is known
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if err := limiter.Acquire(context.Background()); err != nil {
+				t.Errorf("Goroutine %d: %v", id, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, id)
+			mu.Unlock()
+			limiter.Release()
+		}(i)
+		waitForWaiters(limiter, i+1)
+	}
+
+	limiter.Release()
+	wg.Wait()
+
+	if len(order) != 5 {
+		t.Fatalf("Expected 5 waiters to acquire, got %d", len(order))
+	}
+	for i, id := range order {
+		if id != i {
+			t.Fatalf("Expected waiters to unblock in arrival order, got %v", order)
+		}
+	}
+}
+
 func TestResourceInitialization(t *testing.T) {
-	resource := NewResource("TestResource", 3, 1)
 	var wg sync.WaitGroup
 	initCount := 0
 	var mu sync.Mutex
+	resource := NewResource("TestResource", 3, 1, WithInit(func(context.Context) error {
+		mu.Lock()
+		initCount++
+		mu.Unlock()
+		return nil
+	}))
 
-	// Launch multiple goroutines to test sync.Once behavior
+	// Launch multiple goroutines to test that a successful init runs once
 	for i := 0; i < 5; i++ {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
-			// Override initialize for testing
-			resource.initOnce.Do(func() {
-				mu.Lock()
-				initCount++
-				mu.Unlock()
-			})
 			_ = resource.Use(id)
 		}(i)
 	}
@@ -87,28 +441,460 @@ func TestResourceInitialization(t *testing.T) {
 	}
 }
 
-func TestResourceRateLimiting(t *testing.T) {
-	resource := NewResource("TestResource", 2, 1) // 2 requests per second
+// initCycle starts n uses of resource at once while its init is blocked,
+// then lets the init finish and collects their errors
+func initCycle(resource *Resource, n int, started, finish chan struct{}) []error {
+	errs := make(chan error, n)
 	var wg sync.WaitGroup
-	errorCount := 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- resource.UseFunc(context.Background(), func(context.Context) error { return nil })
+		}()
+	}
+	<-started
+	// Let the other callers pile up behind the attempt in flight
+	for {
+		resource.initMu.Lock()
+		a := resource.initAttempt
+		resource.initMu.Unlock()
+		if a != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	finish <- struct{}{}
+	wg.Wait()
+	close(errs)
+
+	var all []error
+	for err := range errs {
+		all = append(all, err)
+	}
+	return all
+}
+
+func TestResourceInitRetry(t *testing.T) {
+	errDial := errors.New("connection refused")
+	const users = 50
 	var mu sync.Mutex
+	var attempts int
+	fail := true
+	started := make(chan struct{}, 1)
+	finish := make(chan struct{})
+	resource := NewResource("db", users, 1, WithClock(NewFakeClock(time.Now())), WithInit(func(ctx context.Context) error {
+		mu.Lock()
+		attempts++
+		f := fail
+		mu.Unlock()
+		started <- struct{}{}
+		<-finish
+		if f {
+			return errDial
+		}
+		return nil
+	}))
 
-	// Launch 5 concurrent requests
+	// Two failure cycles, each a single attempt whose error every caller
+	// waiting on it sees
+	for cycle := 1; cycle <= 2; cycle++ {
+		for _, err := range initCycle(resource, users, started, finish) {
+			if !errors.Is(err, ErrInitFailed) || !errors.Is(err, errDial) {
+				t.Errorf("Cycle %d: expected ErrInitFailed wrapping the init error, got %v", cycle, err)
+			}
+		}
+		if attempts != cycle {
+			t.Errorf("Cycle %d: expected %d init attempts in total, got %d", cycle, cycle, attempts)
+		}
+	}
+	if n := resource.limiter.(*RateLimiter).Remaining(); n != users {
+		t.Errorf("Expected no tokens taken by failed uses, %d remaining", n)
+	}
+
+	// Then the database comes back and one more attempt serves everyone
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	for _, err := range initCycle(resource, users, started, finish) {
+		if err != nil {
+			t.Errorf("Expected uses to succeed once init does, got %v", err)
+		}
+	}
+	if err := resource.UseFunc(context.Background(), func(context.Context) error { return nil }); err != nil {
+		t.Errorf("Expected later uses to skip init, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected a successful init to run exactly once, %d attempts in total", attempts)
+	}
+}
+
+func TestResourceInitPanic(t *testing.T) {
+	calls := 0
+	resource := NewResource("db", 10, 1, WithInit(func(context.Context) error {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		return nil
+	}))
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("Expected the init panic to carry on, recovered %v", p)
+			}
+		}()
+		resource.initialize(context.Background())
+	}()
+	if err := resource.initialize(context.Background()); err != nil {
+		t.Errorf("Expected a retry after the panic to succeed, got %v", err)
+	}
+}
+
+func TestResourceInit(t *testing.T) {
+	errDial := errors.New("connection refused")
+	var attempts atomic.Int32
+	started := make(chan struct{}, 1)
+	finish := make(chan struct{})
+	resource := NewResource("db", 10, 1, WithInit(func(ctx context.Context) error {
+		n := attempts.Add(1)
+		started <- struct{}{}
+		<-finish
+		if n == 1 {
+			return errDial
+		}
+		return nil
+	}))
+
+	// An Init and a first use arriving together share one attempt, and its
+	// error reaches both
+	for cycle := 1; cycle <= 2; cycle++ {
+		initErr := make(chan error)
+		go func() { initErr <- resource.Init(context.Background()) }()
+		<-started
+		useErr := make(chan error)
+		go func() { useErr <- resource.UseFunc(context.Background(), noWork) }()
+		time.Sleep(10 * time.Millisecond)
+		finish <- struct{}{}
+
+		errI, errU := <-initErr, <-useErr
+		if cycle == 1 && (!errors.Is(errI, errDial) || !errors.Is(errI, ErrInitFailed) || errI.Error() != errU.Error()) {
+			t.Errorf("Expected Init and the use to fail alike, got %v and %v", errI, errU)
+		}
+		if cycle == 2 && (errI != nil || errU != nil) {
+			t.Errorf("Expected Init and the use to succeed on the retry, got %v and %v", errI, errU)
+		}
+		if n := attempts.Load(); int(n) != cycle {
+			t.Errorf("Cycle %d: expected %d init attempts in total, got %d", cycle, cycle, n)
+		}
+	}
+
+	if err := resource.Init(context.Background()); err != nil {
+		t.Errorf("Expected Init of an initialized resource to succeed, got %v", err)
+	}
+	if attempts.Load() != 2 {
+		t.Errorf("Expected Init not to initialize again, %d attempts", attempts.Load())
+	}
+	resource.Close(context.Background())
+	if err := resource.Init(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected Init after Close to fail with ErrClosed, got %v", err)
+	}
+}
+
+func TestResourceRateLimiting(t *testing.T) {
+	// 2 requests per second, on a clock that won't reset the window mid-test,
+	// and work that holds its token until released
+	release := make(chan struct{})
+	resource := NewResource("TestResource", 2, 1, WithClock(NewFakeClock(time.Now())),
+		WithWork(func(context.Context) error {
+			<-release
+			return nil
+		}))
+
+	// Launch 5 concurrent requests. The denied ones return first, as the
+	// others are stuck in their work.
+	errs := make(chan error, 5)
 	for i := 0; i < 5; i++ {
-		wg.Add(1)
-		go func(id int) {
-			defer wg.Done()
-			if err := resource.Use(id); err != nil {
-				mu.Lock()
-				errorCount++
-				mu.Unlock()
+		go func(id int) { errs <- resource.Use(id) }(i)
+	}
+	for i := 0; i < 3; i++ { // 5 requests - 2 allowed = 3 errors
+		if err := <-errs; !errors.Is(err, ErrRateLimited) {
+			t.Errorf("Expected a rate limit error, got %v", err)
+		}
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Expected the 2 allowed requests to succeed, got %v", err)
+		}
+	}
+}
+
+func TestUseContextCancelledBeforeAcquire(t *testing.T) {
+	resource := NewResource("TestResource", 1, 60)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := resource.UseContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if n := resource.limiter.(*RateLimiter).Remaining(); n != 1 {
+		t.Errorf("Expected no token to be taken, %d remaining", n)
+	}
+}
+
+func TestUseContextCancelledWhileRateLimited(t *testing.T) {
+	resource := NewResource("TestResource", 1, 60, WithClock(NewFakeClock(time.Now())))
+	resource.initDone = true
+	limiter := resource.limiter.(*RateLimiter)
+	limiter.TryAcquire()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := resource.UseContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if stats := limiter.Stats(); stats.Waiters != 0 || stats.Current != 1 {
+		t.Errorf("Expected the wait to leave the limiter as it was, got %+v", stats)
+	}
+}
+
+func TestUseContextCancelledMidWork(t *testing.T) {
+	resource := NewResource("TestResource", 1, 60, WithWork(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := resource.UseContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if n := resource.limiter.(*RateLimiter).Remaining(); n != 1 {
+		t.Errorf("Expected the token to be released, %d remaining", n)
+	}
+}
+
+func TestUseFunc(t *testing.T) {
+	resource := NewResource("db", 1, 60)
+	resource.initDone = true
+	limiter := resource.limiter.(*RateLimiter)
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	errWork := errors.New("query failed")
+	err := resource.UseFunc(ctx, func(ctx context.Context) error {
+		if ctx.Value(key{}) != "value" {
+			t.Error("Expected fn to get the caller's context")
+		}
+		if limiter.Remaining() != 0 {
+			t.Error("Expected fn to run holding the token")
+		}
+		return errWork
+	})
+	if !errors.Is(err, errWork) || err.Error() != "resource db: query failed" {
+		t.Errorf("Expected fn's error wrapped with the resource name, got %v", err)
+	}
+	if n := limiter.Remaining(); n != 1 {
+		t.Errorf("Expected the token back after fn returns, %d remaining", n)
+	}
+}
+
+func TestUseFuncPanicReleases(t *testing.T) {
+	resource := NewResource("db", 1, 60, WithMaxConcurrent(1))
+	resource.initDone = true
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("Expected the panic to carry on, recovered %v", p)
 			}
-		}(i)
+		}()
+		resource.UseFunc(context.Background(), func(context.Context) error {
+			panic("boom")
+		})
+	}()
+
+	if n := resource.sem.Held(); n != 0 {
+		t.Errorf("Expected the concurrency slot to be released, %d held", n)
 	}
+}
 
-	wg.Wait()
+func TestUseFuncPanicRecovery(t *testing.T) {
+	var reported error
+	resource := NewResource("db", 1, 60, WithMaxConcurrent(1), WithPanicRecovery(true),
+		WithOnError(func(_ context.Context, ev UseEvent) { reported = ev.Err }))
+
+	err := resource.UseFunc(context.Background(), func(context.Context) error {
+		panic("boom")
+	})
+	var pe *PanicError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrPanic) {
+		t.Fatalf("Expected the panic as a PanicError, got %v", err)
+	}
+	if pe.Value != "boom" || err.Error() != "resource db: panic: boom" {
+		t.Errorf("Expected the panic value in the error, got %v", err)
+	}
+	if !strings.Contains(string(pe.Stack), "TestUseFuncPanicRecovery") {
+		t.Errorf("Expected the stack of the panicking goroutine, got %s", pe.Stack)
+	}
+	if !errors.Is(reported, ErrPanic) {
+		t.Errorf("Expected OnError to get the panic, got %v", reported)
+	}
+	if n := resource.sem.Held(); n != 0 {
+		t.Errorf("Expected the concurrency slot to be released, %d held", n)
+	}
+	if m := resource.Metrics(); m.Errors != 1 || m.InFlight != 0 {
+		t.Errorf("Expected the panic to count as a failed use, got %+v", m)
+	}
+}
+
+func TestUseFuncPanicReportedWithoutRecovery(t *testing.T) {
+	var reported error
+	resource := NewResource("db", 1, 60, WithOnError(func(_ context.Context, ev UseEvent) { reported = ev.Err }))
+
+	func() {
+		defer func() { recover() }()
+		resource.UseFunc(context.Background(), func(context.Context) error { panic("boom") })
+	}()
+	var pe *PanicError
+	if !errors.As(reported, &pe) || pe.Value != "boom" {
+		t.Errorf("Expected OnError to get the PanicError as the panic carries on, got %v", reported)
+	}
+}
+
+func TestRateLimiterSubSecondWindow(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	limiter := NewRateLimiterDuration(2, 50*time.Millisecond, WithLimiterClock(clock))
+
+	if !limiter.TryAcquire() || !limiter.TryAcquire() {
+		t.Fatal("Expected two acquisitions in the first 50ms window")
+	}
+	if limiter.TryAcquire() {
+		t.Error("Expected the third acquisition in the window to be denied")
+	}
+
+	clock.Advance(30 * time.Millisecond)
+	if d := limiter.RetryAfter(); d != 20*time.Millisecond {
+		t.Errorf("Expected to retry after 20ms, got %v", d)
+	}
+	if at := limiter.NextReset(); !at.Equal(time.Unix(1000, int64(50*time.Millisecond))) {
+		t.Errorf("Expected the window to end 50ms after it started, got %v", at)
+	}
+	if limiter.TryAcquire() {
+		t.Error("Expected the window to still be full after 30ms")
+	}
+
+	clock.Advance(20 * time.Millisecond)
+	if !limiter.TryAcquire() {
+		t.Error("Expected a new window after 50ms")
+	}
+	if d := limiter.NextReset().Sub(clock.Now()); d != 50*time.Millisecond {
+		t.Errorf("Expected the new window to last 50ms, got %v", d)
+	}
+
+	// Several short windows pass between calls
+	clock.Advance(175 * time.Millisecond)
+	if n := limiter.Remaining(); n != 2 {
+		t.Errorf("Expected a fresh window after 175ms, got %d remaining", n)
+	}
+}
+
+func TestRateLimiterClockStepsBack(t *testing.T) {
+	start := time.Now()
+	clock := NewFakeClock(start)
+	limiter := NewRateLimiter(2, 1, WithLimiterClock(clock))
+	limiter.TryAcquireN(2)
+
+	// Stepping back an hour must not hand out a fresh allowance...
+	clock.Set(start.Add(-time.Hour))
+	if limiter.TryAcquire() {
+		t.Error("Expected the limit to hold after the clock stepped back")
+	}
+	if d := limiter.NextReset().Sub(clock.Now()); d != time.Second {
+		t.Errorf("Expected the window to restart from the step, ending in 1s, got %v", d)
+	}
+
+	// ...nor freeze the window until the clock catches up
+	clock.Advance(time.Second)
+	if !limiter.TryAcquireN(2) {
+		t.Error("Expected a new window one window after the step")
+	}
+	if limiter.TryAcquire() {
+		t.Error("Expected the new window to enforce the limit")
+	}
+}
+
+func TestRateLimiterClockStepsForward(t *testing.T) {
+	start := time.Now()
+	clock := NewFakeClock(start)
+	limiter := NewRateLimiter(2, 1, WithLimiterClock(clock))
+	limiter.TryAcquireN(2)
+
+	// A jump forward starts one fresh window, it doesn't lift the limit
+	clock.Set(start.Add(time.Hour))
+	if !limiter.TryAcquireN(2) {
+		t.Error("Expected a fresh window after the clock jumped forward")
+	}
+	if limiter.TryAcquire() {
+		t.Error("Expected the limit to hold after the jump")
+	}
+}
+
+func TestResourceUseTimeout(t *testing.T) {
+	resource := NewResource("slow", 5, 60, WithUseTimeout(20*time.Millisecond),
+		WithInit(func(context.Context) error { return nil }))
+	limiter := resource.limiter.(*RateLimiter)
+	block := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	// The use timeout fires before the caller's deadline
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	start := time.Now()
+	err := resource.UseFunc(ctx, block)
+	if !errors.Is(err, ErrUseTimeout) {
+		t.Errorf("Expected ErrUseTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the use to stop at its timeout, took %v", elapsed)
+	}
+	if n := limiter.Remaining(); n != 5 {
+		t.Errorf("Expected the token back after a timed out use, %d remaining", n)
+	}
+
+	// The caller's shorter deadline fires first and is reported as its own
+	resource.useTimeout = time.Minute
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = resource.UseFunc(ctx, block)
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrUseTimeout) {
+		t.Errorf("Expected the caller's deadline error, got %v", err)
+	}
+	if n := limiter.Remaining(); n != 5 {
+		t.Errorf("Expected the token back after a cancelled use, %d remaining", n)
+	}
+
+	// Work that fits in the timeout succeeds
+	if err := resource.UseFunc(context.Background(), func(context.Context) error { return nil }); err != nil {
+		t.Errorf("Expected a quick use to succeed, got %v", err)
+	}
+}
+
+func TestResourceUseTimeoutCountsAsFailure(t *testing.T) {
+	cb := NewCircuitBreaker(1, time.Minute)
+	resource := NewResource("slow", 5, 60, WithUseTimeout(time.Millisecond), WithCircuitBreaker(cb),
+		WithInit(func(context.Context) error { return nil }))
 
-	if errorCount != 3 { // 5 requests - 2 allowed = 3 errors
-		t.Errorf("Expected 3 rate limit errors, got %d", errorCount)
+	resource.UseFunc(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if cb.State() != BreakerOpen {
+		t.Errorf("Expected a timed out use to count as a failure, breaker %v", cb.State())
 	}
 }
@@ -0,0 +1,241 @@
+// manager.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownResource is matched by every UnknownResourceError
+var ErrUnknownResource = errors.New("unknown resource")
+
+// UnknownResourceError is returned by Manager.Get for a name nobody
+// registered
+type UnknownResourceError struct {
+	Name string
+}
+
+func (e *UnknownResourceError) Error() string {
+	return fmt.Sprintf("unknown resource %s", e.Name)
+}
+
+// Unwrap lets errors.Is match ErrUnknownResource
+func (e *UnknownResourceError) Unwrap() error {
+	return ErrUnknownResource
+}
+
+// Manager builds named resources on first use, so packages that share a
+// resource such as "orders-db" look it up instead of creating their own
+type Manager struct {
+	mu      sync.Mutex
+	entries map[string]*managedResource
+	closed  bool
+}
+
+// managedResource is a registered factory and, once built, its resource
+type managedResource struct {
+	factory  func() *Resource
+	priority int // shutdown priority, higher closes first
+	once     sync.Once
+	resource *Resource
+}
+
+// NewManager creates a manager with nothing registered
+func NewManager() *Manager {
+	return &Manager{entries: make(map[string]*managedResource)}
+}
+
+// Register makes factory the way to build the resource called name. Nothing
+// is built until the first Get. A name can only be registered once.
+func (m *Manager) Register(name string, factory func() *Resource) error {
+	if factory == nil {
+		return fmt.Errorf("manager: nil factory for %s", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return fmt.Errorf("manager: %w", ErrClosed)
+	}
+	if _, ok := m.entries[name]; ok {
+		return fmt.Errorf("manager: %w: %s", ErrAlreadyRegistered, name)
+	}
+	m.entries[name] = &managedResource{factory: factory}
+	return nil
+}
+
+// Get returns the resource called name, building it on the first call.
+// Concurrent first calls share a single build. An unregistered name is an
+// UnknownResourceError, and once CloseAll has been called Get fails with
+// ErrClosed.
+func (m *Manager) Get(name string) (*Resource, error) {
+	m.mu.Lock()
+	e, ok := m.entries[name]
+	closed := m.closed
+	m.mu.Unlock()
+
+	if closed {
+		return nil, fmt.Errorf("manager: %w", ErrClosed)
+	}
+	if !ok {
+		return nil, &UnknownResourceError{Name: name}
+	}
+	e.once.Do(func() {
+		e.resource = e.factory()
+	})
+	if e.resource == nil {
+		m.mu.Lock()
+		closed = m.closed
+		m.mu.Unlock()
+		if closed {
+			// CloseAll got to the entry first and stopped the build
+			return nil, fmt.Errorf("manager: %w", ErrClosed)
+		}
+		return nil, fmt.Errorf("manager: factory for %s returned no resource", name)
+	}
+	return e.resource, nil
+}
+
+// CloseAll closes every resource that has been built, all at once so they
+// drain in parallel, and returns their errors joined. Resources that were
+// never built are skipped. Later Gets and Registers fail with ErrClosed;
+// calling CloseAll again retries the resources whose Close failed, such as
+// those that hadn't drained before ctx ended. Use Shutdown to honour
+// shutdown priorities.
+func (m *Manager) CloseAll(ctx context.Context) error {
+	m.mu.Lock()
+	m.closed = true
+	names := sortedKeys(m.entries)
+	entries := make([]*managedResource, len(names))
+	for i, name := range names {
+		entries[i] = m.entries[name]
+	}
+	m.mu.Unlock()
+
+	errs := make([]error, len(entries))
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		// Finish any build in flight, and make sure none starts later
+		e.once.Do(func() {})
+		if e.resource == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, r *Resource) {
+			defer wg.Done()
+			errs[i] = r.Close(ctx)
+		}(i, e.resource)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// SetShutdownPriority sets when Shutdown closes the resource called name:
+// resources with a higher priority are closed first, so one that depends on
+// another, such as a cache in front of a database, should have the higher
+// priority. Resources default to priority 0.
+func (m *Manager) SetShutdownPriority(name string, priority int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[name]
+	if !ok {
+		return &UnknownResourceError{Name: name}
+	}
+	e.priority = priority
+	return nil
+}
+
+// Shutdown closes every resource that has been built in order of shutdown
+// priority, and returns their errors joined. All of them stop accepting
+// uses straight away; then each priority in turn, highest first, drains
+// and tears down, the resources within a priority at once. If ctx ends
+// while a priority is draining, its stragglers and every lower priority
+// are left untorn down and fail with ctx.Err(), since what they depend on
+// may still be in use. Later Gets and Registers fail with ErrClosed, and
+// calling Shutdown again retries the resources that didn't close.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.closed = true
+	names := sortedKeys(m.entries)
+	entries := make([]*managedResource, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, m.entries[name])
+	}
+	m.mu.Unlock()
+
+	var built []*managedResource
+	for _, e := range entries {
+		e.once.Do(func() {})
+		if e.resource == nil {
+			continue
+		}
+		e.resource.stopUses()
+		built = append(built, e)
+	}
+	sort.SliceStable(built, func(i, j int) bool { return built[i].priority > built[j].priority })
+
+	errs := make([]error, len(built))
+	for start := 0; start < len(built); {
+		end := start + 1
+		for end < len(built) && built[end].priority == built[start].priority {
+			end++
+		}
+		if err := ctx.Err(); err != nil {
+			for i := start; i < len(built); i++ {
+				errs[i] = fmt.Errorf("resource %s: %w", built[i].resource.name, err)
+			}
+			break
+		}
+
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = built[i].resource.Close(ctx)
+			}(i)
+		}
+		wg.Wait()
+		start = end
+	}
+	return errors.Join(errs...)
+}
+
+// WarmupAll builds every registered resource and initializes it with Init,
+// running at most parallelism initializations at once (one at a time if
+// parallelism is less than one), so startup pays for them instead of the
+// first requests. It waits for them all and returns their errors joined,
+// in name order.
+func (m *Manager) WarmupAll(ctx context.Context, parallelism int) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	m.mu.Lock()
+	names := sortedKeys(m.entries)
+	m.mu.Unlock()
+
+	errs := make([]error, len(names))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			r, err := m.Get(name)
+			if err == nil {
+				err = r.Init(ctx)
+			}
+			errs[i] = err
+		}(i, name)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
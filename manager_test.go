@@ -0,0 +1,281 @@
+// manager_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestManagerBuildsOnce(t *testing.T) {
+	m := NewManager()
+	var builds atomic.Int32
+	if err := m.Register("orders-db", func() *Resource {
+		builds.Add(1)
+		// Give concurrent first Gets time to pile up
+		time.Sleep(10 * time.Millisecond)
+		return NewResource("orders-db", 10, 60)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if builds.Load() != 0 {
+		t.Error("Expected Register not to build the resource")
+	}
+
+	const callers = 50
+	got := make([]*Resource, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r, err := m.Get("orders-db")
+			if err != nil {
+				t.Error(err)
+			}
+			got[i] = r
+		}(i)
+	}
+	wg.Wait()
+
+	if builds.Load() != 1 {
+		t.Errorf("Expected a single build, got %d", builds.Load())
+	}
+	for _, r := range got {
+		if r != got[0] || r == nil {
+			t.Fatal("Expected every Get to return the same instance")
+		}
+	}
+}
+
+func TestManagerUnknownName(t *testing.T) {
+	m := NewManager()
+	_, err := m.Get("payments-api")
+
+	var unknown *UnknownResourceError
+	if !errors.As(err, &unknown) || unknown.Name != "payments-api" {
+		t.Errorf("Expected an UnknownResourceError naming the resource, got %v", err)
+	}
+	if !errors.Is(err, ErrUnknownResource) {
+		t.Errorf("Expected the error to match ErrUnknownResource, got %v", err)
+	}
+}
+
+func TestManagerRegisterTwice(t *testing.T) {
+	m := NewManager()
+	factory := func() *Resource { return NewResource("a", 1, 1) }
+	m.Register("a", factory)
+	if err := m.Register("a", factory); !errors.Is(err, ErrAlreadyRegistered) {
+		t.Errorf("Expected ErrAlreadyRegistered, got %v", err)
+	}
+	if err := m.Register("b", nil); err == nil {
+		t.Error("Expected an error for a nil factory")
+	}
+}
+
+func TestManagerCloseAll(t *testing.T) {
+	m := NewManager()
+	var tornDown []string
+	var mu sync.Mutex
+	for _, name := range []string{"orders-db", "payments-api", "unused"} {
+		name := name
+		m.Register(name, func() *Resource {
+			return NewResource(name, 10, 60, WithTeardown(func(context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				tornDown = append(tornDown, name)
+				return nil
+			}))
+		})
+	}
+	orders, _ := m.Get("orders-db")
+	m.Get("payments-api")
+
+	if err := m.CloseAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(tornDown) != 2 {
+		t.Errorf("Expected the two built resources to be closed, got %v", tornDown)
+	}
+	if err := orders.Use(1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected a closed resource to refuse uses, got %v", err)
+	}
+	if _, err := m.Get("unused"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected Get to fail once closed, got %v", err)
+	}
+	if err := m.Register("late", func() *Resource { return nil }); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected Register to fail once closed, got %v", err)
+	}
+}
+
+func TestManagerCloseAllTimeout(t *testing.T) {
+	m := NewManager()
+	m.Register("slow", func() *Resource {
+		return NewResource("slow", 10, 60, WithInit(func(context.Context) error { return nil }))
+	})
+	r, _ := m.Get("slow")
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go r.UseFunc(context.Background(), func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.CloseAll(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected CloseAll to report a resource that didn't drain, got %v", err)
+	}
+	close(release)
+	if err := m.CloseAll(context.Background()); err != nil {
+		t.Errorf("Expected a second CloseAll to finish the job, got %v", err)
+	}
+}
+
+func TestManagerWarmupAll(t *testing.T) {
+	m := NewManager()
+	var inits, inside, most atomic.Int32
+	errDial := errors.New("connection refused")
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		name := name
+		m.Register(name, func() *Resource {
+			return NewResource(name, 10, 60, WithInit(func(context.Context) error {
+				inits.Add(1)
+				n := inside.Add(1)
+				defer inside.Add(-1)
+				for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+				}
+				time.Sleep(10 * time.Millisecond)
+				if name == "c" {
+					return errDial
+				}
+				return nil
+			}))
+		})
+	}
+
+	err := m.WarmupAll(context.Background(), 2)
+	if !errors.Is(err, errDial) || !errors.Is(err, ErrInitFailed) {
+		t.Errorf("Expected the failed init in WarmupAll's error, got %v", err)
+	}
+	if inits.Load() != 6 {
+		t.Errorf("Expected every resource to be initialized, got %d inits", inits.Load())
+	}
+	if most.Load() != 2 {
+		t.Errorf("Expected 2 initializations at once, at most %d were", most.Load())
+	}
+
+	// The warmed resources don't initialize again on use
+	r, _ := m.Get("a")
+	r.UseFunc(context.Background(), func(context.Context) error { return nil })
+	if inits.Load() != 6 {
+		t.Errorf("Expected a warmed resource to skip init, got %d inits", inits.Load())
+	}
+}
+
+func TestManagerShutdownPriority(t *testing.T) {
+	m := NewManager()
+	var tornDown []string
+	var mu sync.Mutex
+	for _, name := range []string{"cache", "db", "queue"} {
+		name := name
+		m.Register(name, func() *Resource {
+			return NewResource(name, 10, 60, WithInit(noWork), WithTeardown(func(context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				tornDown = append(tornDown, name)
+				return nil
+			}))
+		})
+	}
+	if err := m.SetShutdownPriority("cache", 1); err != nil {
+		t.Fatal(err)
+	}
+	m.SetShutdownPriority("queue", 2)
+	if err := m.SetShutdownPriority("nope", 1); !errors.Is(err, ErrUnknownResource) {
+		t.Errorf("Expected an unknown name to be refused, got %v", err)
+	}
+	cache, _ := m.Get("cache")
+	db, _ := m.Get("db")
+	m.Get("queue")
+
+	// The cache is busy, so the database can't close before it drains, but
+	// neither accepts new uses meanwhile
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go cache.UseFunc(context.Background(), func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	shutdown := make(chan error)
+	go func() { shutdown <- m.Shutdown(context.Background()) }()
+	if err := db.WaitForState(context.Background(), ResourceClosing); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected every resource to refuse uses once Shutdown starts, got %v", err)
+	}
+	if s := db.State(); s != ResourceClosing {
+		t.Errorf("Expected the database to wait for the cache, it is %v", s)
+	}
+	close(release)
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"queue", "cache", "db"}
+	if len(tornDown) != len(want) || tornDown[0] != want[0] || tornDown[1] != want[1] || tornDown[2] != want[2] {
+		t.Errorf("Expected teardowns in order %v, got %v", want, tornDown)
+	}
+}
+
+func TestManagerShutdownDeadline(t *testing.T) {
+	m := NewManager()
+	var dbTornDown atomic.Bool
+	m.Register("cache", func() *Resource { return NewResource("cache", 10, 60, WithInit(noWork)) })
+	m.Register("db", func() *Resource {
+		return NewResource("db", 10, 60, WithInit(noWork), WithTeardown(func(context.Context) error {
+			dbTornDown.Store(true)
+			return nil
+		}))
+	})
+	m.SetShutdownPriority("cache", 1)
+	cache, _ := m.Get("cache")
+	m.Get("db")
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go cache.UseFunc(context.Background(), func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := m.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Shutdown to report the straggler, got %v", err)
+	}
+	if dbTornDown.Load() {
+		t.Error("Expected the database to be left up while the cache hadn't drained")
+	}
+
+	close(release)
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Errorf("Expected a second Shutdown to finish the job, got %v", err)
+	}
+	if !dbTornDown.Load() {
+		t.Error("Expected the second Shutdown to tear the database down")
+	}
+}
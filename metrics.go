@@ -0,0 +1,255 @@
+// metrics.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsSink receives measurements from resources configured with
+// WithMetrics
+type MetricsSink interface {
+	ObserveUse(resource string, d time.Duration)
+}
+
+// WithMetrics reports how long each use of the resource takes to sink
+func WithMetrics(sink MetricsSink) Option {
+	return func(r *Resource) {
+		r.metrics = sink
+	}
+}
+
+// observeUse reports a use of the resource that started at start
+func (r *Resource) observeUse(start time.Time) {
+	if r.metrics != nil {
+		r.metrics.ObserveUse(r.name, r.clock.Now().Sub(start))
+	}
+}
+
+// statsSource is implemented by limiters that report LimiterStats
+type statsSource interface {
+	Stats() LimiterStats
+}
+
+// useDurationBuckets are the upper bounds, in seconds, of the use duration
+// histogram
+var useDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type useHistogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// MetricsRegistry exposes limiter and resource metrics in the Prometheus
+// text format without depending on the Prometheus client. Limiter counters
+// are read from Stats at scrape time, so ResetStats resets them too.
+type MetricsRegistry struct {
+	mu        sync.Mutex
+	limiters  map[string]statsSource
+	durations map[string]*useHistogram
+	resources map[string]*Resource
+}
+
+// NewMetricsRegistry creates an empty registry
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		limiters:  make(map[string]statsSource),
+		durations: make(map[string]*useHistogram),
+		resources: make(map[string]*Resource),
+	}
+}
+
+// RegisterLimiter exposes l's stats labelled with name. Registering a name
+// again replaces the earlier limiter.
+func (m *MetricsRegistry) RegisterLimiter(name string, l statsSource) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.limiters[name] = l
+}
+
+// RegisterResource exposes r's Metrics and the stats of its limiter
+// labelled with r's name. Use durations are only recorded if r was also
+// given WithMetrics(m).
+func (m *MetricsRegistry) RegisterResource(r *Resource) {
+	if s, ok := r.limiterFor(AccessWrite).(statsSource); ok {
+		m.RegisterLimiter(r.name, s)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.resources[r.name] = r
+}
+
+// ObserveUse records one use of resource lasting d
+func (m *MetricsRegistry) ObserveUse(resource string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.durations[resource]
+	if !ok {
+		h = &useHistogram{counts: make([]uint64, len(useDurationBuckets))}
+		m.durations[resource] = h
+	}
+	seconds := d.Seconds()
+	for i, le := range useDurationBuckets {
+		if seconds <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// WriteTo writes every metric to w in the Prometheus text format
+func (m *MetricsRegistry) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	names := sortedKeys(m.limiters)
+	stats := make([]LimiterStats, len(names))
+	limiters := make([]statsSource, len(names))
+	for i, name := range names {
+		limiters[i] = m.limiters[name]
+	}
+	resources := sortedKeys(m.durations)
+	durations := make([]useHistogram, len(resources))
+	for i, name := range resources {
+		h := m.durations[name]
+		durations[i] = useHistogram{counts: append([]uint64(nil), h.counts...), count: h.count, sum: h.sum}
+	}
+	used := sortedKeys(m.resources)
+	usage := make([]ResourceMetrics, len(used))
+	registered := make([]*Resource, len(used))
+	for i, name := range used {
+		registered[i] = m.resources[name]
+	}
+	m.mu.Unlock()
+
+	// Read the limiters and resources outside our lock, they take their own
+	for i, l := range limiters {
+		stats[i] = l.Stats()
+	}
+	for i, r := range registered {
+		usage[i] = r.Metrics()
+	}
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	writeFamily(cw, "requests_allowed_total", "counter", "Requests allowed by the limiter.", names, func(i int) string {
+		return fmt.Sprint(stats[i].Acquired)
+	})
+	writeFamily(cw, "requests_denied_total", "counter", "Requests denied by the limiter.", names, func(i int) string {
+		return fmt.Sprint(stats[i].Denied)
+	})
+	writeFamily(cw, "current_in_window", "gauge", "Tokens held in the limiter's current window.", names, func(i int) string {
+		return fmt.Sprint(stats[i].Current)
+	})
+
+	writeFamily(cw, "resource_uses_total", "counter", "Uses of the resource whose work ran.", used, func(i int) string {
+		return fmt.Sprint(usage[i].Uses)
+	})
+	writeFamily(cw, "resource_units_total", "counter", "Limiter units charged by uses whose work ran.", used, func(i int) string {
+		return fmt.Sprint(usage[i].Units)
+	})
+	writeFamily(cw, "resource_reads_total", "counter", "Uses whose work ran in read mode.", used, func(i int) string {
+		return fmt.Sprint(usage[i].Reads)
+	})
+	writeFamily(cw, "resource_rate_limited_total", "counter", "Uses turned away by the limiter or the concurrency cap.", used, func(i int) string {
+		return fmt.Sprint(usage[i].RateLimited)
+	})
+	writeFamily(cw, "resource_errors_total", "counter", "Uses whose work failed.", used, func(i int) string {
+		return fmt.Sprint(usage[i].Errors)
+	})
+	writeFamily(cw, "resource_in_flight", "gauge", "Uses running their work right now.", used, func(i int) string {
+		return fmt.Sprint(usage[i].InFlight)
+	})
+	if len(used) > 0 {
+		fmt.Fprintln(cw, "# HELP resource_use_latency_seconds Latency of the resource's work over the last minute.")
+		fmt.Fprintln(cw, "# TYPE resource_use_latency_seconds summary")
+	}
+	for i, name := range used {
+		label := labelValue(name)
+		for _, q := range []struct {
+			quantile string
+			d        time.Duration
+		}{{"0.5", usage[i].P50}, {"0.95", usage[i].P95}, {"0.99", usage[i].P99}} {
+			fmt.Fprintf(cw, "resource_use_latency_seconds{resource=\"%s\",quantile=\"%s\"} %g\n", label, q.quantile, q.d.Seconds())
+		}
+	}
+
+	if len(resources) > 0 {
+		fmt.Fprintln(cw, "# HELP resource_use_duration_seconds How long each use of the resource took.")
+		fmt.Fprintln(cw, "# TYPE resource_use_duration_seconds histogram")
+	}
+	for i, name := range resources {
+		h := durations[i]
+		label := labelValue(name)
+		var cumulative uint64
+		for j, le := range useDurationBuckets {
+			cumulative += h.counts[j]
+			fmt.Fprintf(cw, "resource_use_duration_seconds_bucket{resource=\"%s\",le=\"%g\"} %d\n", label, le, cumulative)
+		}
+		fmt.Fprintf(cw, "resource_use_duration_seconds_bucket{resource=\"%s\",le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(cw, "resource_use_duration_seconds_sum{resource=\"%s\"} %g\n", label, h.sum)
+		fmt.Fprintf(cw, "resource_use_duration_seconds_count{resource=\"%s\"} %d\n", label, h.count)
+	}
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves the metrics for a Prometheus scrape
+func (m *MetricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+func writeFamily(w io.Writer, name, typ, help string, labels []string, value func(int) string) {
+	if len(labels) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+	for i, label := range labels {
+		fmt.Fprintf(w, "%s{resource=\"%s\"} %s\n", name, labelValue(label), value(i))
+	}
+}
+
+// labelValue escapes s for use as a label value
+func labelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// countingWriter remembers the bytes written and the first error
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
@@ -0,0 +1,82 @@
+// metrics_test.go
+package main
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, m *MetricsRegistry) string {
+	t.Helper()
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func expectMetric(t *testing.T, body, line string) {
+	t.Helper()
+	for _, l := range strings.Split(body, "\n") {
+		if l == line {
+			return
+		}
+	}
+	t.Errorf("Expected %q in the scrape:\n%s", line, body)
+}
+
+func TestMetricsRegistryCounters(t *testing.T) {
+	registry := NewMetricsRegistry()
+	limiter := NewRateLimiter(2, 60)
+	registry.RegisterLimiter("api", limiter)
+
+	body := scrape(t, registry)
+	expectMetric(t, body, `requests_allowed_total{resource="api"} 0`)
+	expectMetric(t, body, `# TYPE requests_allowed_total counter`)
+
+	limiter.TryAcquire()
+	limiter.TryAcquire()
+	limiter.TryAcquire()
+
+	body = scrape(t, registry)
+	expectMetric(t, body, `requests_allowed_total{resource="api"} 2`)
+	expectMetric(t, body, `requests_denied_total{resource="api"} 1`)
+	expectMetric(t, body, `current_in_window{resource="api"} 2`)
+}
+
+func TestMetricsRegistryResource(t *testing.T) {
+	registry := NewMetricsRegistry()
+	clock := NewFakeClock(time.Now())
+	resource, _ := NewResourceFromConfig("db", Config{MaxRequests: 3, Window: time.Minute}, WithMetrics(registry),
+		WithClock(clock), WithWork(func(context.Context) error {
+			clock.Advance(200 * time.Millisecond)
+			return nil
+		}))
+	registry.RegisterResource(resource)
+
+	if err := resource.Use(1); err != nil {
+		t.Fatal(err)
+	}
+	registry.ObserveUse("db", 30*time.Millisecond)
+
+	body := scrape(t, registry)
+	expectMetric(t, body, `requests_allowed_total{resource="db"} 1`)
+	expectMetric(t, body, `# TYPE resource_use_duration_seconds histogram`)
+	expectMetric(t, body, `resource_use_duration_seconds_count{resource="db"} 2`)
+	// Only the simulated 30ms use falls under the 50ms bucket; Use takes
+	// 200ms
+	expectMetric(t, body, `resource_use_duration_seconds_bucket{resource="db",le="0.05"} 1`)
+	expectMetric(t, body, `resource_use_duration_seconds_bucket{resource="db",le="+Inf"} 2`)
+}
@@ -0,0 +1,98 @@
+// middleware.go
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Middleware rate limits next with l, taking a token per request and
+// releasing it when the handler returns. Denied requests get a 429 with a
+// Retry-After header. Limiters that can report their window, such as
+// RateLimiter, also set X-RateLimit-* headers on every response. Requests a
+// ThresholdLimiter grants past its soft limit are served with an
+// X-RateLimit-Degraded header.
+func Middleware(l Limiter, next http.Handler) http.Handler {
+	hs, _ := l.(headerSetter)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision, retryAfter := decide(l)
+		if hs != nil {
+			hs.SetHeaders(w)
+		}
+		switch decision {
+		case DecisionDenied:
+			tooManyRequests(w, newRateLimitError(r.URL.Path, l, retryAfter))
+			return
+		case DecisionDegraded:
+			w.Header().Set("X-RateLimit-Degraded", "true")
+		}
+		defer l.Release()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// KeyedMiddleware is like Middleware but limits each key returned by
+// keyFunc separately, e.g. per client IP or API token, and reports each
+// key's own X-RateLimit-* headers
+func KeyedMiddleware(kl *KeyedLimiter, keyFunc func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := keyFunc(r)
+		ok := kl.TryAcquire(key)
+		kl.SetHeaders(key, w)
+		if !ok {
+			tooManyRequests(w, &RateLimitError{Resource: r.URL.Path, Limit: kl.Limit(key), RetryAfter: kl.RetryAfter(key)})
+			return
+		}
+		defer kl.Release(key)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decide is allow for limiters that can also grant in a degraded state
+func decide(l Limiter) (Decision, time.Duration) {
+	if d, ok := l.(interface{ Decide() Decision }); ok {
+		if decision := d.Decide(); decision != DecisionDenied {
+			return decision, 0
+		}
+		return DecisionDenied, retryAfter(l)
+	}
+	if ok, retryAfter := allow(l); !ok {
+		return DecisionDenied, retryAfter
+	}
+	return DecisionAllowed, 0
+}
+
+// allow takes a token from l and, on denial, works out the retry-after
+// delay from whatever the limiter can report
+func allow(l Limiter) (bool, time.Duration) {
+	if a, ok := l.(interface{ Allow() (bool, time.Duration) }); ok {
+		return a.Allow()
+	}
+	if l.TryAcquire() {
+		return true, 0
+	}
+	return false, retryAfter(l)
+}
+
+// retryAfter returns l's retry-after hint, or zero if it has none
+func retryAfter(l Limiter) time.Duration {
+	if r, ok := l.(interface{ RetryAfter() time.Duration }); ok {
+		return r.RetryAfter()
+	}
+	return 0
+}
+
+// tooManyRequests writes err as a 429 response with Retry-After in whole
+// seconds, rounded up and never less than one
+func tooManyRequests(w http.ResponseWriter, err *RateLimitError) {
+	seconds := int(math.Ceil(err.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
@@ -0,0 +1,126 @@
+// middleware_test.go
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestMiddlewareAllowAndDeny(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 60, WithLimiterClock(clock))
+
+	// Hold the only token for the duration of the first request
+	inFlight := make(chan struct{})
+	proceed := make(chan struct{})
+	handler := Middleware(limiter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(inFlight)
+		<-proceed
+	}))
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/", nil))
+		close(done)
+	}()
+	<-inFlight
+
+	clock.Advance(20 * time.Second)
+	denied := httptest.NewRecorder()
+	handler.ServeHTTP(denied, httptest.NewRequest(http.MethodGet, "/", nil))
+	if denied.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 while the token is held, got %d", denied.Code)
+	}
+	if got := denied.Header().Get("Retry-After"); got != "40" {
+		t.Errorf("Expected Retry-After 40, got %q", got)
+	}
+	if body := denied.Body.String(); body != "rate limit exceeded for resource /\n" {
+		t.Errorf("Expected the rate limit error as the body, got %q", body)
+	}
+
+	close(proceed)
+	<-done
+	if first.Code != http.StatusOK {
+		t.Errorf("Expected 200 for the first request, got %d", first.Code)
+	}
+
+	// The token was released when the first handler returned
+	again := httptest.NewRecorder()
+	Middleware(limiter, okHandler()).ServeHTTP(again, httptest.NewRequest(http.MethodGet, "/", nil))
+	if again.Code != http.StatusOK {
+		t.Errorf("Expected 200 after the token was released, got %d", again.Code)
+	}
+}
+
+func TestMiddlewareGCRARetryAfter(t *testing.T) {
+	limiter := NewGCRALimiter(0.5, 1) // one request every 2 seconds
+	limiter.clock = NewFakeClock(time.Now())
+	handler := Middleware(limiter, okHandler())
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	denied := httptest.NewRecorder()
+	handler.ServeHTTP(denied, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if denied.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", denied.Code)
+	}
+	if got := denied.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Expected Retry-After 2, got %q", got)
+	}
+}
+
+func TestKeyedMiddleware(t *testing.T) {
+	limiter := NewKeyedLimiter(1, 60)
+	byHeader := func(r *http.Request) string { return r.Header.Get("X-User") }
+
+	// Use up alice's only token
+	limiter.TryAcquire("alice")
+	handler := KeyedMiddleware(limiter, byHeader, okHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User", "alice")
+	denied := httptest.NewRecorder()
+	handler.ServeHTTP(denied, req)
+	if denied.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for alice, got %d", denied.Code)
+	}
+	if denied.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header on denial")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User", "bob")
+	allowed := httptest.NewRecorder()
+	handler.ServeHTTP(allowed, req)
+	if allowed.Code != http.StatusOK {
+		t.Errorf("Expected 200 for bob, got %d", allowed.Code)
+	}
+}
+
+func TestMiddlewareSubSecondRetryAfter(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	limiter := NewRateLimiterDuration(1, 250*time.Millisecond, WithLimiterClock(clock))
+	limiter.TryAcquire()
+
+	rec := httptest.NewRecorder()
+	Middleware(limiter, okHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rec.Code)
+	}
+	// Retry-After has whole seconds, so 250ms rounds up to 1
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Expected Retry-After 1, got %q", got)
+	}
+	if got := rec.Header().Get("X-RateLimit-Reset"); got != "1001" {
+		t.Errorf("Expected X-RateLimit-Reset rounded up to 1001, got %q", got)
+	}
+}
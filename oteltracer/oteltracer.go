@@ -0,0 +1,96 @@
+// oteltracer.go
+
+// Package oteltracer adapts an OpenTelemetry tracer to the Tracer interface
+// used by Resource.UseContext, keeping the OpenTelemetry dependency out of
+// the core package
+package oteltracer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span is the span interface the core package expects. It is the same
+// interface literal, so Tracer satisfies the core Tracer without importing
+// it.
+type Span = interface {
+	SetAttributes(attrs map[string]any)
+	AddEvent(name string, attrs map[string]any)
+	End()
+}
+
+// Tracer starts OpenTelemetry spans
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New wraps t, e.g. otel.Tracer("GoConcur")
+func New(t trace.Tracer) Tracer {
+	return Tracer{tracer: t}
+}
+
+// Start starts a span named name as a child of any span in ctx
+func (t Tracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	ctx, s := t.tracer.Start(ctx, name)
+	return ctx, span{s}
+}
+
+// FromContext returns the OpenTelemetry span already in ctx, for passing to
+// ContextWithSpan so a bare RateLimiter.Acquire records its waits on it
+func FromContext(ctx context.Context) Span {
+	return span{trace.SpanFromContext(ctx)}
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s span) SetAttributes(attrs map[string]any) {
+	s.span.SetAttributes(keyValues(attrs)...)
+}
+
+func (s span) AddEvent(name string, attrs map[string]any) {
+	s.span.AddEvent(name, trace.WithAttributes(keyValues(attrs)...))
+}
+
+func (s span) End() {
+	s.span.End()
+}
+
+// keyValues converts attrs to OpenTelemetry attributes in key order
+func keyValues(attrs map[string]any) []attribute.KeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]attribute.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, keyValue(k, attrs[k]))
+	}
+	return kvs
+}
+
+func keyValue(k string, v any) attribute.KeyValue {
+	switch v := v.(type) {
+	case bool:
+		return attribute.Bool(k, v)
+	case int:
+		return attribute.Int(k, v)
+	case int64:
+		return attribute.Int64(k, v)
+	case float64:
+		return attribute.Float64(k, v)
+	case string:
+		return attribute.String(k, v)
+	case time.Duration:
+		return attribute.Float64(k, v.Seconds())
+	}
+	return attribute.String(k, fmt.Sprint(v))
+}
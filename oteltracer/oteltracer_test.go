@@ -0,0 +1,92 @@
+// oteltracer_test.go
+package oteltracer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingSpan keeps what the adapter sets on it
+type recordingSpan struct {
+	noop.Span
+	attrs  []attribute.KeyValue
+	events map[string][]attribute.KeyValue
+	ended  bool
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.attrs = append(s.attrs, kv...)
+}
+
+func (s *recordingSpan) AddEvent(name string, opts ...trace.EventOption) {
+	cfg := trace.NewEventConfig(opts...)
+	s.events[name] = cfg.Attributes()
+}
+
+func (s *recordingSpan) End(...trace.SpanEndOption) {
+	s.ended = true
+}
+
+type recordingTracer struct {
+	noop.Tracer
+	names []string
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	s := &recordingSpan{events: make(map[string][]attribute.KeyValue)}
+	t.names = append(t.names, name)
+	t.spans = append(t.spans, s)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func TestTracer(t *testing.T) {
+	rec := &recordingTracer{}
+	ctx, s := New(rec).Start(context.Background(), "db")
+
+	s.SetAttributes(map[string]any{
+		"b": true,
+		"n": 3,
+		"f": 0.5,
+		"d": 2 * time.Second,
+		"s": "x",
+	})
+	s.AddEvent("limiter.wait", map[string]any{"limiter.acquired": false})
+	s.End()
+
+	if len(rec.spans) != 1 || rec.names[0] != "db" {
+		t.Fatalf("Expected one span named db, got %v", rec.names)
+	}
+	got := rec.spans[0]
+	want := []attribute.KeyValue{
+		attribute.Bool("b", true),
+		attribute.Float64("d", 2),
+		attribute.Float64("f", 0.5),
+		attribute.Int("n", 3),
+		attribute.String("s", "x"),
+	}
+	if len(got.attrs) != len(want) {
+		t.Fatalf("Expected %d attributes, got %v", len(want), got.attrs)
+	}
+	for i := range want {
+		if got.attrs[i] != want[i] {
+			t.Errorf("Expected attribute %v, got %v", want[i], got.attrs[i])
+		}
+	}
+	if ev := got.events["limiter.wait"]; len(ev) != 1 || ev[0] != attribute.Bool("limiter.acquired", false) {
+		t.Errorf("Expected a limiter.wait event, got %v", got.events)
+	}
+	if !got.ended {
+		t.Error("Expected End to end the span")
+	}
+
+	// The returned context carries the OpenTelemetry span for children
+	if FromContext(ctx).(span).span != got {
+		t.Error("Expected FromContext to find the started span")
+	}
+}
@@ -0,0 +1,144 @@
+// override.go
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// keyQuota is the limit a KeyedLimiter applies to one key
+type keyQuota struct {
+	max    int
+	window time.Duration
+}
+
+// SetOverride gives key its own limit of max requests per window instead of
+// the default. A key that is already tracked finishes its current window
+// under the old limit and switches when that window resets, so raising or
+// lowering a quota never cuts a window short or hands out extra tokens. A
+// negative max or a window that isn't positive is an ErrInvalidConfig, and
+// leaves key's limit as it was.
+func (kl *KeyedLimiter) SetOverride(key string, max int, window time.Duration) error {
+	if max < 0 {
+		return fmt.Errorf("%w: override for %s: max must not be negative, got %d", ErrInvalidConfig, key, max)
+	}
+	if window <= 0 {
+		return fmt.Errorf("%w: override for %s: window must be positive, got %v", ErrInvalidConfig, key, window)
+	}
+	kl.setQuota(key, keyQuota{max: max, window: window}, true)
+	return nil
+}
+
+// ClearOverride puts key back on the default limit, from the next window
+// reset on, as with SetOverride
+func (kl *KeyedLimiter) ClearOverride(key string) {
+	kl.setQuota(key, kl.defaultQuota(), false)
+}
+
+// Stats returns the stats of key's limiter, or false if key isn't tracked
+func (kl *KeyedLimiter) Stats(key string) (LimiterStats, bool) {
+	s := kl.shard(key)
+	s.mu.Lock()
+	e, ok := kl.entryLocked(s, key, false)
+	s.mu.Unlock()
+
+	if !ok {
+		return LimiterStats{}, false
+	}
+	return e.limiter.Stats(), true
+}
+
+// Limit returns the requests per window key is currently allowed, which for
+// an untracked key is what it would start with
+func (kl *KeyedLimiter) Limit(key string) int {
+	s := kl.shard(key)
+	s.mu.Lock()
+	e, ok := kl.entryLocked(s, key, false)
+	q := kl.quotaLocked(s, key)
+	s.mu.Unlock()
+
+	if !ok {
+		return q.max
+	}
+	return e.limiter.Limit()
+}
+
+func (kl *KeyedLimiter) setQuota(key string, q keyQuota, override bool) {
+	s := kl.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if override {
+		if s.overrides == nil {
+			s.overrides = make(map[string]keyQuota)
+		}
+		s.overrides[key] = q
+	} else {
+		delete(s.overrides, key)
+	}
+	if e, ok := s.limiters[key]; ok {
+		e.pending = &q
+		e.switchAt = e.limiter.windowEnd()
+	}
+}
+
+func (kl *KeyedLimiter) defaultQuota() keyQuota {
+	return keyQuota{max: kl.maxRequests, window: kl.window}
+}
+
+// quotaLocked returns the limit key should get when its limiter is created
+func (kl *KeyedLimiter) quotaLocked(s *keyedShard, key string) keyQuota {
+	if q, ok := s.overrides[key]; ok {
+		return q
+	}
+	return kl.defaultQuota()
+}
+
+// entryLocked looks key up, creating it if create is set, and switches it
+// to a changed quota once the window it was changed in is over
+func (kl *KeyedLimiter) entryLocked(s *keyedShard, key string, create bool) (*keyedEntry, bool) {
+	e, ok := s.limiters[key]
+	if !ok {
+		if !create {
+			return nil, false
+		}
+		q := kl.quotaLocked(s, key)
+		e = &keyedEntry{limiter: NewRateLimiterDuration(q.max, q.window, WithLimiterClock(kl.clock))}
+		s.limiters[key] = e
+	}
+	if e.pending != nil && !kl.clock.Now().Before(e.switchAt) {
+		e.limiter.setQuota(e.pending.max, e.pending.window)
+		e.pending = nil
+	}
+	return e, true
+}
+
+// windowEnd returns when the current window ends. It may be in the past if
+// the window has expired but not yet been lazily reset.
+func (rl *RateLimiter) windowEnd() time.Time {
+	rl.lock()
+	defer rl.unlock()
+
+	return rl.windowStartLocked(rl.clock.Now()).Add(rl.window)
+}
+
+// setQuota ends the window if it has expired and starts the next one with a
+// new limit and window length
+func (rl *RateLimiter) setQuota(max int, window time.Duration) {
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	now := rl.clock.Now()
+	rl.resetIfExpiredLocked(now)
+
+	rl.maxRequests = max
+	rl.burst = max
+	rl.allowance = max
+	rl.window = window
+	if rl.resetTimer != nil {
+		rl.resetTimer.Stop()
+		rl.resetTimer = nil
+	}
+	rl.dispatchLocked(now)
+}
@@ -0,0 +1,129 @@
+// override_test.go
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestKeyedLimiter(max, windowSeconds int) (*KeyedLimiter, *FakeClock) {
+	clock := NewFakeClock(time.Now())
+	kl := NewKeyedLimiter(max, windowSeconds)
+	kl.clock = clock
+	return kl, clock
+}
+
+func acquireAll(kl *KeyedLimiter, key string) int {
+	n := 0
+	for kl.TryAcquire(key) {
+		n++
+	}
+	return n
+}
+
+func TestKeyedOverrideForNewKey(t *testing.T) {
+	kl, _ := newTestKeyedLimiter(2, 60)
+	kl.SetOverride("paying", 5, time.Minute)
+
+	if n := acquireAll(kl, "paying"); n != 5 {
+		t.Errorf("Expected the override to allow 5, got %d", n)
+	}
+	if n := acquireAll(kl, "free"); n != 2 {
+		t.Errorf("Expected other keys to keep the default of 2, got %d", n)
+	}
+	if n := kl.Limit("paying"); n != 5 {
+		t.Errorf("Expected Limit to report 5, got %d", n)
+	}
+	if n := kl.Limit("unseen"); n != 2 {
+		t.Errorf("Expected an untracked key to report the default, got %d", n)
+	}
+}
+
+func TestKeyedOverrideAppliesAtNextReset(t *testing.T) {
+	kl, clock := newTestKeyedLimiter(2, 60)
+	if n := acquireAll(kl, "tenant"); n != 2 {
+		t.Fatalf("Expected the default of 2, got %d", n)
+	}
+
+	// Mid-window the old limit still holds
+	clock.Advance(30 * time.Second)
+	kl.SetOverride("tenant", 4, 10*time.Second)
+	if kl.TryAcquire("tenant") {
+		t.Error("Expected the override to wait for the window to reset")
+	}
+	if stats, _ := kl.Stats("tenant"); stats.Current != 2 {
+		t.Errorf("Expected the current window to keep its 2 tokens, got %d", stats.Current)
+	}
+
+	// From the reset on the new limit and window apply
+	clock.Advance(30 * time.Second)
+	if n := acquireAll(kl, "tenant"); n != 4 {
+		t.Errorf("Expected 4 after the reset, got %d", n)
+	}
+	clock.Advance(10 * time.Second)
+	if n := acquireAll(kl, "tenant"); n != 4 {
+		t.Errorf("Expected the 10s window to reset after 10s with 4, got %d", n)
+	}
+
+	kl.ClearOverride("tenant")
+	if kl.TryAcquire("tenant") {
+		t.Error("Expected clearing the override to wait for the window to reset")
+	}
+	clock.Advance(10 * time.Second)
+	if n := acquireAll(kl, "tenant"); n != 2 {
+		t.Errorf("Expected the default of 2 after clearing, got %d", n)
+	}
+	if until := kl.RetryAfter("tenant"); until != time.Minute {
+		t.Errorf("Expected the default 60s window to be back, got %v", until)
+	}
+}
+
+func TestKeyedOverrideReleaseAcrossSwitch(t *testing.T) {
+	kl, clock := newTestKeyedLimiter(2, 60)
+	acquireAll(kl, "tenant")
+	kl.SetOverride("tenant", 1, time.Minute)
+
+	// Tokens from the old window must not free capacity in the new one
+	clock.Advance(time.Minute)
+	if !kl.TryAcquire("tenant") {
+		t.Fatal("Expected the new window to allow 1")
+	}
+	kl.Release("tenant")
+	kl.Release("tenant")
+	if kl.TryAcquire("tenant") {
+		t.Error("Expected releases of old tokens to leave the new window full")
+	}
+}
+
+func TestKeyedOverrideRejectsInvalidQuota(t *testing.T) {
+	kl, _ := newTestKeyedLimiter(2, 60)
+	for _, q := range []struct {
+		max    int
+		window time.Duration
+	}{{3, 0}, {3, -time.Second}, {-1, time.Minute}} {
+		if err := kl.SetOverride("a", q.max, q.window); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Expected an override of %d per %v to be rejected, got %v", q.max, q.window, err)
+		}
+	}
+	if n := acquireAll(kl, "a"); n != 2 {
+		t.Errorf("Expected the rejected overrides to leave the default of 2, got %d", n)
+	}
+	if err := kl.SetOverride("a", 0, time.Minute); err != nil {
+		t.Errorf("Expected a zero max to be a valid override, got %v", err)
+	}
+}
+
+func TestKeyedStats(t *testing.T) {
+	kl, _ := newTestKeyedLimiter(1, 60)
+	if _, ok := kl.Stats("alice"); ok {
+		t.Error("Expected no stats for an untracked key")
+	}
+	kl.TryAcquire("alice")
+	kl.TryAcquire("alice")
+
+	stats, ok := kl.Stats("alice")
+	if !ok || stats.Acquired != 1 || stats.Denied != 1 {
+		t.Errorf("Expected 1 acquired and 1 denied for alice, got %+v", stats)
+	}
+}
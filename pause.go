@@ -0,0 +1,87 @@
+// pause.go
+package main
+
+import "errors"
+
+// ErrPaused is returned by blocking calls and reservations on a paused
+// limiter
+var ErrPaused = errors.New("rate limiter: paused")
+
+// Mode is a kill switch for a RateLimiter, set with Pause, Bypass and
+// Resume
+type Mode int
+
+// Modes
+const (
+	ModeNormal Mode = iota // enforce the limit
+	ModePaused             // refuse every acquisition
+	ModeBypass             // allow every acquisition, still counting it
+)
+
+// String returns the mode's name
+func (m Mode) String() string {
+	switch m {
+	case ModeNormal:
+		return "normal"
+	case ModePaused:
+		return "paused"
+	case ModeBypass:
+		return "bypass"
+	}
+	return "unknown"
+}
+
+// Pause makes every acquisition fail until Resume or Bypass. Goroutines
+// blocked in Acquire return ErrPaused, as do later Acquire and Reserve
+// calls. Refusals while paused are not counted as denials. Tokens already
+// held can still be released.
+func (rl *RateLimiter) Pause() {
+	rl.setMode(ModePaused)
+}
+
+// Bypass makes every acquisition succeed until Resume or Pause, and grants
+// everything blocked in Acquire. Tokens are still counted, so releases
+// balance and Stats stays meaningful, but a window can end up over its
+// limit.
+func (rl *RateLimiter) Bypass() {
+	rl.setMode(ModeBypass)
+}
+
+// Resume goes back to enforcing the limit. Tokens taken in bypass mode
+// still count against the current window.
+func (rl *RateLimiter) Resume() {
+	rl.setMode(ModeNormal)
+}
+
+// Mode returns the limiter's current mode
+func (rl *RateLimiter) Mode() Mode {
+	rl.lock()
+	defer rl.unlock()
+
+	return rl.mode
+}
+
+func (rl *RateLimiter) setMode(m Mode) {
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	rl.mode = m
+	if m == ModePaused {
+		rl.failWaitersLocked(ErrPaused)
+		return
+	}
+	rl.dispatchLocked(rl.clock.Now())
+}
+
+// unavailableLocked returns why the limiter can't hand out tokens at all,
+// or nil if it can
+func (rl *RateLimiter) unavailableLocked() error {
+	if rl.closed {
+		return ErrClosed
+	}
+	if rl.mode == ModePaused {
+		return ErrPaused
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+// pause_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPauseWakesWaiters(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 60, WithLimiterClock(clock))
+	limiter.TryAcquire()
+
+	errs := make(chan error, 1)
+	go func() { errs <- limiter.Acquire(context.Background()) }()
+	waitForWaiters(limiter, 1)
+
+	limiter.Pause()
+	if err := <-errs; !errors.Is(err, ErrPaused) {
+		t.Errorf("Expected ErrPaused for a blocked Acquire, got %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	if limiter.TryAcquire() {
+		t.Error("Expected TryAcquire to fail while paused")
+	}
+	if err := limiter.Acquire(context.Background()); !errors.Is(err, ErrPaused) {
+		t.Errorf("Expected ErrPaused from Acquire while paused, got %v", err)
+	}
+	if _, err := limiter.Reserve(); !errors.Is(err, ErrPaused) {
+		t.Errorf("Expected ErrPaused from Reserve while paused, got %v", err)
+	}
+	stats := limiter.Stats()
+	if stats.Mode != ModePaused {
+		t.Errorf("Expected Stats to report paused, got %v", stats.Mode)
+	}
+	if stats.Denied != 0 {
+		t.Errorf("Expected refusals while paused not to count as denials, got %d", stats.Denied)
+	}
+
+	limiter.Resume()
+	if !limiter.TryAcquire() {
+		t.Error("Expected TryAcquire to succeed after Resume")
+	}
+	if mode := limiter.Mode(); mode != ModeNormal {
+		t.Errorf("Expected normal mode after Resume, got %v", mode)
+	}
+}
+
+func TestBypass(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 60, WithLimiterClock(clock))
+	limiter.TryAcquire()
+
+	errs := make(chan error, 1)
+	go func() { errs <- limiter.Acquire(context.Background()) }()
+	waitForWaiters(limiter, 1)
+
+	limiter.Bypass()
+	if err := <-errs; err != nil {
+		t.Errorf("Expected bypass to grant a blocked Acquire, got %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if !limiter.TryAcquire() {
+			t.Fatalf("Expected TryAcquire %d to succeed in bypass mode", i)
+		}
+	}
+	if stats := limiter.Stats(); stats.Current != 7 || stats.Mode != ModeBypass {
+		t.Errorf("Expected 7 counted tokens in bypass mode, got %+v", stats)
+	}
+
+	// Back to normal the window is over its limit until it resets
+	limiter.Resume()
+	limiter.ReleaseN(6)
+	if limiter.TryAcquire() {
+		t.Error("Expected the window to stay full after Resume")
+	}
+	clock.Advance(time.Minute)
+	if !limiter.TryAcquire() {
+		t.Error("Expected the next window to enforce the limit again")
+	}
+}
+
+func TestPauseUnderLoad(t *testing.T) {
+	limiter := NewRateLimiterDuration(50, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// phase is odd from just after Pause returns until just before the mode
+	// changes again. An acquisition that starts and ends in the same odd
+	// phase ran entirely while paused and must fail.
+	var phase atomic.Int64
+	var violations, attempts atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(blocking bool) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				before := phase.Load()
+				var ok bool
+				if blocking {
+					acquireCtx, done := context.WithTimeout(ctx, time.Millisecond)
+					ok = limiter.Acquire(acquireCtx) == nil
+					done()
+				} else {
+					ok = limiter.TryAcquire()
+				}
+				if ok && before%2 == 1 && phase.Load() == before {
+					violations.Add(1)
+				}
+				if ok {
+					limiter.Release()
+				}
+				attempts.Add(1)
+				runtime.Gosched()
+			}
+		}(i%2 == 0)
+	}
+
+	// Let the workers make some attempts in each mode
+	settle := func() {
+		for target := attempts.Load() + 20; attempts.Load() < target; {
+			runtime.Gosched()
+		}
+	}
+	for i := 0; i < 50; i++ {
+		limiter.Pause()
+		phase.Add(1)
+		settle()
+		phase.Add(1)
+		if i%2 == 0 {
+			limiter.Bypass()
+		} else {
+			limiter.Resume()
+		}
+		settle()
+	}
+	cancel()
+	wg.Wait()
+
+	if n := violations.Load(); n != 0 {
+		t.Errorf("Expected no acquisitions while paused, got %d", n)
+	}
+	limiter.Resume()
+	if stats := limiter.Stats(); stats.Current != 0 {
+		t.Errorf("Expected every token to be released, got %d held", stats.Current)
+	}
+}
@@ -0,0 +1,90 @@
+// percaller.go
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// callerQuota is the WithPerCallerLimit configuration
+type callerQuota struct {
+	max    int
+	window time.Duration
+}
+
+// WithPerCallerLimit caps each caller, as named by WithCaller, at max uses
+// per window on top of the resource's own limit, so no caller can spend
+// the whole of it. A use over its caller's quota fails with a
+// RateLimitError matching ErrCallerLimited, whatever the rate limit mode,
+// as waiting would only hold up a caller already over its share. Callers
+// without a Caller share the quota of "anonymous". Each use counts once
+// whatever its cost, and its quota is given back like the resource's
+// tokens are. Callers idle for two windows are forgotten.
+func WithPerCallerLimit(max int, window time.Duration) Option {
+	return func(r *Resource) {
+		r.callerQuota = &callerQuota{max: max, window: window}
+	}
+}
+
+// CallerStats is one caller's share of a resource, see Resource.CallerStats
+type CallerStats struct {
+	Caller string
+	LimiterStats
+}
+
+// CallerStats returns the stats of the callers WithPerCallerLimit is
+// tracking, most denied first and then by name, at most n of them unless
+// n is zero or less. It returns nil without WithPerCallerLimit.
+func (r *Resource) CallerStats(n int) []CallerStats {
+	if r.callers == nil {
+		return nil
+	}
+	var stats []CallerStats
+	for _, key := range r.callers.Keys() {
+		if s, ok := r.callers.Stats(key); ok {
+			stats = append(stats, CallerStats{Caller: key, LimiterStats: s})
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Denied > stats[j].Denied })
+	if n > 0 && len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats
+}
+
+// newCallerLimiter builds the per-caller limiter once the options are in,
+// so it reads time from the resource's clock
+func (r *Resource) newCallerLimiter() {
+	if r.callerQuota == nil {
+		return
+	}
+	q := r.callerQuota
+	r.callers = newKeyedLimiter(q.max, q.window, r.clock, WithKeyTTL(2*q.window))
+}
+
+// acquireCaller takes a use from the caller's quota, if the resource has
+// one
+func (r *Resource) acquireCaller(ctx context.Context) error {
+	if r.callers == nil {
+		return nil
+	}
+	caller := callerOf(ctx).String()
+	if r.callers.TryAcquire(caller) {
+		return nil
+	}
+	return &RateLimitError{
+		Resource:   r.name,
+		Limit:      r.callerQuota.max,
+		RetryAfter: r.callers.RetryAfter(caller),
+		Caller:     caller,
+		PerCaller:  true,
+	}
+}
+
+// releaseCaller gives back a use acquireCaller took
+func (r *Resource) releaseCaller(ctx context.Context) {
+	if r.callers != nil {
+		r.callers.Release(callerOf(ctx).String())
+	}
+}
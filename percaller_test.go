@@ -0,0 +1,122 @@
+// percaller_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func callerCtx(name string) context.Context {
+	return WithCaller(context.Background(), Caller{Name: name})
+}
+
+func TestPerCallerLimitIsDistinctFromShared(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	resource := NewResource("db", 3, 60, WithClock(clock), WithMaxConcurrent(10), WithPerCallerLimit(2, time.Minute))
+	defer resource.Close(context.Background())
+
+	for i := 0; i < 2; i++ {
+		if err := resource.UseFunc(callerCtx("alice"), noWork); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := resource.UseFunc(callerCtx("alice"), noWork)
+	if !errors.Is(err, ErrCallerLimited) || !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected alice to spend her own quota, got %v", err)
+	}
+	var rle *RateLimitError
+	if !errors.As(err, &rle) || !rle.PerCaller || rle.Caller != "alice" || rle.Limit != 2 || rle.RetryAfter <= 0 {
+		t.Errorf("Expected a per-caller RateLimitError for alice, got %+v", rle)
+	}
+
+	// Bob has his own quota, but only one token is left of the shared limit
+	if err := resource.UseFunc(callerCtx("bob"), noWork); err != nil {
+		t.Fatal(err)
+	}
+	err = resource.Use(1)
+	if !errors.Is(err, ErrRateLimited) || errors.Is(err, ErrCallerLimited) {
+		t.Errorf("Expected the shared limit to deny, got %v", err)
+	}
+	// The shared denial gave the caller's token back
+	for _, s := range resource.CallerStats(0) {
+		if s.Caller == "Goroutine 1" && s.Current != 0 {
+			t.Errorf("Expected Goroutine 1 to hold none of its quota, got %+v", s)
+		}
+	}
+
+	clock.Advance(time.Minute)
+	if err := resource.UseFunc(callerCtx("alice"), noWork); err != nil {
+		t.Errorf("Expected alice's quota to refill with the window, got %v", err)
+	}
+}
+
+func TestPerCallerLimitReleasesWithoutCap(t *testing.T) {
+	resource := NewResource("db", 10, 60, WithPerCallerLimit(1, time.Minute))
+	defer resource.Close(context.Background())
+
+	done := holdUses(1, func(_ context.Context, fn func(context.Context) error) error {
+		return resource.UseFunc(callerCtx("alice"), fn)
+	})
+	if err := resource.UseFunc(callerCtx("alice"), noWork); !errors.Is(err, ErrCallerLimited) {
+		t.Errorf("Expected a second concurrent use by alice to be denied, got %v", err)
+	}
+	done()
+	if err := resource.UseFunc(callerCtx("alice"), noWork); err != nil {
+		t.Errorf("Expected alice's token back once her use finished, got %v", err)
+	}
+}
+
+func TestCallerStatsTopN(t *testing.T) {
+	resource := NewResource("db", 100, 60, WithMaxConcurrent(10), WithPerCallerLimit(1, time.Minute))
+	defer resource.Close(context.Background())
+
+	for name, uses := range map[string]int{"alice": 2, "bob": 4, "carol": 1, "dave": 2} {
+		for i := 0; i < uses; i++ {
+			resource.UseFunc(callerCtx(name), noWork)
+		}
+	}
+	stats := resource.CallerStats(3)
+	if len(stats) != 3 {
+		t.Fatalf("Expected the top 3 callers, got %+v", stats)
+	}
+	want := []string{"bob", "alice", "dave"}
+	for i, s := range stats {
+		if s.Caller != want[i] {
+			t.Errorf("Expected caller %d to be %s, got %+v", i, want[i], stats)
+		}
+	}
+	if stats[0].Denied != 3 || stats[0].Acquired != 1 {
+		t.Errorf("Expected bob to be denied 3 times, got %+v", stats[0])
+	}
+	if len(resource.CallerStats(0)) != 4 {
+		t.Errorf("Expected all 4 callers without a limit")
+	}
+	if NewResource("other", 1, 1).CallerStats(0) != nil {
+		t.Error("Expected no caller stats without WithPerCallerLimit")
+	}
+}
+
+func TestPerCallerLimitEvictsIdleCallers(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	resource := NewResource("db", 100, 60, WithClock(clock), WithMaxConcurrent(10), WithPerCallerLimit(1, time.Minute))
+	defer resource.Close(context.Background())
+
+	resource.UseFunc(callerCtx("alice"), noWork)
+	clock.Advance(time.Minute)
+	resource.UseFunc(callerCtx("bob"), noWork)
+	clock.Advance(time.Minute)
+	resource.callers.evictIdle()
+
+	if s := resource.CallerStats(0); len(s) != 1 || s[0].Caller != "bob" {
+		t.Errorf("Expected only bob to be tracked after alice idled for two windows, got %+v", s)
+	}
+}
+
+func TestReconfigureRejectsPerCallerLimit(t *testing.T) {
+	resource := NewResource("db", 10, 1)
+	if err := resource.Reconfigure(WithPerCallerLimit(1, time.Second)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected Reconfigure to refuse WithPerCallerLimit, got %v", err)
+	}
+}
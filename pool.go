@@ -0,0 +1,156 @@
+// pool.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ResourcePool hands out up to size interchangeable instances, such as
+// connections, created on demand by a factory and sharing one rate limit
+type ResourcePool struct {
+	factory func(ctx context.Context) (any, error)
+	limiter Limiter    // nil for no rate limit
+	slots   *Semaphore // one per instance that may be checked out
+
+	mu      sync.Mutex
+	idle    []*PooledResource // most recently returned last
+	created int               // instances alive, idle or checked out
+}
+
+// PooledResource is an instance checked out of a ResourcePool. Give it back
+// with Put, or with PutBroken if it should not be used again.
+type PooledResource struct {
+	Value any
+
+	pool *ResourcePool
+	out  bool
+}
+
+// PoolStats is a point-in-time view of a ResourcePool
+type PoolStats struct {
+	Created int // instances alive, idle or checked out
+	Idle    int // instances waiting in the pool
+	InUse   int // instances checked out
+}
+
+// NewResourcePool creates a pool of at most size instances made by factory
+// when none is idle. Every Get takes a token from limiter, which may be nil
+// for no rate limit. Like a Resource with WithMaxConcurrent, the pool caps
+// how many instances are checked out, so the tokens are not given back by
+// Put and the limiter only counts Gets per window.
+func NewResourcePool(size int, limiter Limiter, factory func(ctx context.Context) (any, error)) *ResourcePool {
+	return &ResourcePool{
+		factory: factory,
+		limiter: limiter,
+		slots:   NewSemaphore(size),
+	}
+}
+
+// Get checks out an instance, waiting until ctx is done for one to be
+// returned if all size are in use, and for a token if the limiter can
+// block. The most recently returned idle instance is reused first; if none
+// is idle a new one is created. A factory error is returned wrapped.
+func (p *ResourcePool) Get(ctx context.Context) (*PooledResource, error) {
+	if err := p.slots.Acquire(ctx); err != nil {
+		return nil, fmt.Errorf("resource pool: %w", err)
+	}
+	if err := p.acquireToken(ctx); err != nil {
+		p.slots.Release()
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		pr := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		pr.out = true
+		p.mu.Unlock()
+		return pr, nil
+	}
+	// Holding a slot means there is room for one more instance
+	p.created++
+	p.mu.Unlock()
+
+	v, err := p.factory(ctx)
+	if err != nil {
+		p.mu.Lock()
+		p.created--
+		p.mu.Unlock()
+		p.slots.Release()
+		return nil, fmt.Errorf("resource pool: create: %w", err)
+	}
+	return &PooledResource{Value: v, pool: p, out: true}, nil
+}
+
+// acquireToken takes a token from the limiter, waiting for it if the
+// limiter can block
+func (p *ResourcePool) acquireToken(ctx context.Context) error {
+	if p.limiter == nil {
+		return nil
+	}
+	if a, ok := p.limiter.(interface{ Acquire(context.Context) error }); ok {
+		if err := a.Acquire(ctx); err != nil {
+			return fmt.Errorf("resource pool: %w", err)
+		}
+		return nil
+	}
+	if ok, retryAfter := allow(p.limiter); !ok {
+		return newRateLimitError("resource pool", p.limiter, retryAfter)
+	}
+	return nil
+}
+
+// Put returns an instance to the pool for the next Get. Putting an instance
+// that is not checked out is ignored.
+func (p *ResourcePool) Put(pr *PooledResource) {
+	if !p.checkIn(pr) {
+		return
+	}
+	p.mu.Lock()
+	p.idle = append(p.idle, pr)
+	p.mu.Unlock()
+	p.slots.Release()
+}
+
+// PutBroken discards an instance that should not be used again, closing its
+// Value if it is an io.Closer, so a later Get creates a fresh one. Putting
+// an instance that is not checked out is ignored.
+func (p *ResourcePool) PutBroken(pr *PooledResource) {
+	if !p.checkIn(pr) {
+		return
+	}
+	if c, ok := pr.Value.(io.Closer); ok {
+		c.Close()
+	}
+	p.mu.Lock()
+	p.created--
+	p.mu.Unlock()
+	p.slots.Release()
+}
+
+// checkIn marks pr as no longer checked out, reporting whether it was
+func (p *ResourcePool) checkIn(pr *PooledResource) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pr == nil || pr.pool != p || !pr.out {
+		return false
+	}
+	pr.out = false
+	return true
+}
+
+// Stats returns how many instances the pool has and where they are
+func (p *ResourcePool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return PoolStats{
+		Created: p.created,
+		Idle:    len(p.idle),
+		InUse:   p.created - len(p.idle),
+	}
+}
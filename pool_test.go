@@ -0,0 +1,219 @@
+// pool_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// conn is a pooled instance that records being closed
+type conn struct {
+	id     int
+	closed bool
+}
+
+func (c *conn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// connFactory returns a factory of conns numbered from 1
+func connFactory() (func(context.Context) (any, error), func() int) {
+	var mu sync.Mutex
+	made := 0
+	factory := func(context.Context) (any, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		made++
+		return &conn{id: made}, nil
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return made
+	}
+	return factory, count
+}
+
+func TestResourcePoolExhaustion(t *testing.T) {
+	factory, made := connFactory()
+	pool := NewResourcePool(2, nil, factory)
+
+	a, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if made() != 2 {
+		t.Errorf("Expected instances to be created lazily, %d made", made())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Get on an exhausted pool to wait out its context, got %v", err)
+	}
+
+	got := make(chan *PooledResource)
+	go func() {
+		pr, err := pool.Get(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		got <- pr
+	}()
+	pool.Put(a)
+	if pr := <-got; pr != a {
+		t.Error("Expected a waiting Get to receive the instance put back")
+	}
+	if made() != 2 {
+		t.Errorf("Expected no instances beyond the pool size, %d made", made())
+	}
+}
+
+func TestResourcePoolReuseOrder(t *testing.T) {
+	factory, made := connFactory()
+	pool := NewResourcePool(3, nil, factory)
+
+	var got []*PooledResource
+	for i := 0; i < 3; i++ {
+		pr, err := pool.Get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, pr)
+	}
+	for _, pr := range got {
+		pool.Put(pr)
+	}
+
+	// The most recently returned instance comes back first
+	for i := 2; i >= 0; i-- {
+		pr, _ := pool.Get(context.Background())
+		if pr != got[i] {
+			t.Errorf("Expected conn %d to be reused next, got conn %d", got[i].Value.(*conn).id, pr.Value.(*conn).id)
+		}
+	}
+	if made() != 3 {
+		t.Errorf("Expected idle instances to be reused, %d made", made())
+	}
+}
+
+func TestResourcePoolPutBroken(t *testing.T) {
+	factory, made := connFactory()
+	pool := NewResourcePool(1, nil, factory)
+
+	pr, _ := pool.Get(context.Background())
+	c := pr.Value.(*conn)
+	pool.PutBroken(pr)
+	if !c.closed {
+		t.Error("Expected a broken instance to be closed")
+	}
+	// Putting it back again is ignored rather than freeing a second slot
+	pool.Put(pr)
+	if stats := pool.Stats(); stats.Created != 0 || stats.Idle != 0 {
+		t.Errorf("Expected the broken instance to be gone, got %+v", stats)
+	}
+
+	pr, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Value.(*conn) == c || made() != 2 {
+		t.Error("Expected a fresh instance in place of the broken one")
+	}
+}
+
+func TestResourcePoolFactoryError(t *testing.T) {
+	errDial := errors.New("connection refused")
+	pool := NewResourcePool(1, nil, func(context.Context) (any, error) { return nil, errDial })
+
+	for i := 0; i < 2; i++ {
+		// A failed create must give its slot back, or the second Get hangs
+		if _, err := pool.Get(context.Background()); !errors.Is(err, errDial) {
+			t.Errorf("Expected the factory error, got %v", err)
+		}
+	}
+	if stats := pool.Stats(); stats.Created != 0 {
+		t.Errorf("Expected nothing created, got %+v", stats)
+	}
+}
+
+func TestResourcePoolRateLimit(t *testing.T) {
+	limiter := NewRateLimiterDuration(2, time.Minute, WithLimiterClock(NewFakeClock(time.Now())))
+	factory, _ := connFactory()
+	pool := NewResourcePool(5, limiter, factory)
+
+	for i := 0; i < 2; i++ {
+		pr, err := pool.Get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.Put(pr)
+	}
+
+	// Putting instances back doesn't return tokens to the shared limit
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Get to wait for the rate limit, got %v", err)
+	}
+	if stats := pool.Stats(); stats.InUse != 0 {
+		t.Errorf("Expected a Get denied by the limit to hold no instance, got %+v", stats)
+	}
+}
+
+func TestResourcePoolConcurrent(t *testing.T) {
+	const size = 4
+	factory, made := connFactory()
+	pool := NewResourcePool(size, nil, factory)
+
+	var mu sync.Mutex
+	inUse := map[*PooledResource]bool{}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				pr, err := pool.Get(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				if inUse[pr] {
+					t.Error("Expected an instance to be checked out by one caller at a time")
+				}
+				inUse[pr] = true
+				if len(inUse) > size {
+					t.Errorf("Expected at most %d instances in use, got %d", size, len(inUse))
+				}
+				mu.Unlock()
+
+				mu.Lock()
+				delete(inUse, pr)
+				mu.Unlock()
+				if (i+j)%7 == 0 {
+					pool.PutBroken(pr)
+				} else {
+					pool.Put(pr)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := pool.Stats()
+	if stats.InUse != 0 || stats.Created > size || stats.Idle != stats.Created {
+		t.Errorf("Expected every instance back in the pool, got %+v", stats)
+	}
+	if made() <= size {
+		t.Errorf("Expected broken instances to be recreated, only %d made", made())
+	}
+}
@@ -0,0 +1,54 @@
+// ratelimitmode.go
+package main
+
+import "fmt"
+
+// RateLimitMode is what a use does when the resource's limiter has no token
+// to give
+type RateLimitMode int
+
+const (
+	// RateLimitPerCall makes Use fail straight away with ErrRateLimited and
+	// UseFunc and UseContext wait for the next token
+	RateLimitPerCall RateLimitMode = iota
+	// RateLimitFailFast makes every use fail straight away with
+	// ErrRateLimited
+	RateLimitFailFast
+	// RateLimitWait makes every use wait for a token, Use without a deadline
+	RateLimitWait
+)
+
+func (m RateLimitMode) String() string {
+	switch m {
+	case RateLimitPerCall:
+		return "per-call"
+	case RateLimitFailFast:
+		return "fail-fast"
+	case RateLimitWait:
+		return "wait"
+	}
+	return fmt.Sprintf("RateLimitMode(%d)", int(m))
+}
+
+// WithRateLimitMode sets what uses do when the limiter is out of tokens,
+// whichever of Use and UseFunc they come through. Waiting uses give up when
+// their context is done and are bounded by the limiter's WithMaxWaiters
+// cap, failing with ErrQueueFull past it. A limiter that can't block, having
+// no Acquire method, fails straight away whatever the mode.
+func WithRateLimitMode(mode RateLimitMode) Option {
+	return func(r *Resource) {
+		r.rateLimit = mode
+	}
+}
+
+// rateLimitWaits reports whether a use waits for a token, given whether the
+// call waits by default
+func (r *Resource) rateLimitWaits(wait bool) bool {
+	switch r.rateLimit {
+	case RateLimitFailFast:
+		return false
+	case RateLimitWait:
+		return true
+	}
+	return wait
+}
@@ -0,0 +1,73 @@
+// ratelimitmode_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimitWait(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 1, WithLimiterClock(clock))
+	resource := NewResource("db", 1, 1, WithLimiter(limiter), WithMaxConcurrent(1),
+		WithBulkheadMode(BulkheadWait), WithRateLimitMode(RateLimitWait), WithInit(noWork))
+
+	if err := resource.Use(1); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- resource.Use(2) }()
+	waitForWaiters(limiter, 1)
+	select {
+	case err := <-errs:
+		t.Fatalf("Expected Use to wait for the next window, returned %v", err)
+	default:
+	}
+	clock.Advance(time.Second)
+	if err := <-errs; err != nil {
+		t.Errorf("Expected the waiting Use to get the next window's token, got %v", err)
+	}
+}
+
+func TestRateLimitWaitCancelled(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 1, WithLimiterClock(clock), WithMaxWaiters(1))
+	resource := NewResource("db", 1, 1, WithLimiter(limiter), WithMaxConcurrent(2),
+		WithRateLimitMode(RateLimitWait), WithInit(noWork))
+	resource.UseFunc(context.Background(), noWork)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- resource.UseFunc(ctx, noWork) }()
+	waitForWaiters(limiter, 1)
+
+	// The queue is full, so a second waiter is turned away
+	if err := resource.UseFunc(context.Background(), noWork); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull past the waiter cap, got %v", err)
+	}
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the waiting use to end with its context, got %v", err)
+	}
+}
+
+func TestRateLimitFailFast(t *testing.T) {
+	resource := NewResource("db", 1, 60, WithRateLimitMode(RateLimitFailFast), WithMaxConcurrent(2), WithInit(noWork))
+	resource.UseFunc(context.Background(), noWork)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := resource.UseContext(ctx); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected UseContext to fail straight away, got %v", err)
+	}
+}
+
+func TestRateLimitModeString(t *testing.T) {
+	for mode, want := range map[RateLimitMode]string{RateLimitPerCall: "per-call", RateLimitFailFast: "fail-fast", RateLimitWait: "wait"} {
+		if mode.String() != want {
+			t.Errorf("Expected %q, got %q", want, mode.String())
+		}
+	}
+}
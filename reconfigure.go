@@ -0,0 +1,222 @@
+// reconfigure.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// LiveConfig describes the parts of a resource Reconfigure can change. The
+// work function is left out, as there is nothing to say about a func.
+type LiveConfig struct {
+	Limiter     string         // the limiter's type, and its limit if it reports one
+	ReadLimiter string         // likewise, empty without WithReadLimiter
+	UseTimeout  time.Duration  // zero for none
+	Retry       *BackoffPolicy // nil without WithRetry
+}
+
+// ConfigChange is the configuration before and after a Reconfigure
+type ConfigChange struct {
+	Old, New LiveConfig
+}
+
+// WithPreservedWindow makes Reconfigure carry the current window's usage
+// over from the RateLimiter it replaces to the new one, as Restore does,
+// instead of the new limiter starting afresh. It needs both limiters to be
+// RateLimiters, and does nothing outside Reconfigure.
+func WithPreservedWindow() Option {
+	return func(r *Resource) {
+		r.preserveWindow = true
+	}
+}
+
+// Reconfigure changes a live resource, applying opts all at once or, if any
+// is rejected, not at all. It can swap the limiter and read limiter, the
+// work, the retry policy and the use timeout: WithLimiter,
+// WithReadLimiter, WithWork, WithRetry, WithUseTimeout and
+// WithPreservedWindow. Any other option is an ErrInvalidConfig. Uses
+// already in flight carry on with the configuration they started with,
+// giving their tokens back to the limiter they took them from; the old
+// limiter isn't closed, so close it once they are done if it needs it.
+// Concurrent calls take turns, and each change is sent to subscribers as an
+// EventReconfigure. A closed resource can't be reconfigured.
+func (r *Resource) Reconfigure(opts ...Option) error {
+	r.reconfigMu.Lock()
+	defer r.reconfigMu.Unlock()
+
+	r.cfgMu.RLock()
+	next := &Resource{
+		name:        r.name,
+		limiter:     r.limiter,
+		readLimiter: r.readLimiter,
+		work:        r.work,
+		retry:       r.retry,
+		useTimeout:  r.useTimeout,
+	}
+	r.cfgMu.RUnlock()
+	old := next.liveConfig()
+	oldLimiter := next.limiter
+
+	for _, opt := range opts {
+		opt(next)
+	}
+	if err := r.checkReconfigure(next, oldLimiter); err != nil {
+		return fmt.Errorf("resource %s: %w", r.name, err)
+	}
+	// Held across the swap, so a concurrent Close either comes first and
+	// is seen here or comes after and sees the new configuration
+	r.closeMu.Lock()
+	if r.closed {
+		r.closeMu.Unlock()
+		return fmt.Errorf("resource %s: %w", r.name, ErrClosed)
+	}
+
+	r.cfgMu.Lock()
+	if next.preserveWindow {
+		// Under the lock, so no use takes a token from the old limiter
+		// after the snapshot
+		if err := next.limiter.(*RateLimiter).Restore(r.limiter.(*RateLimiter).Snapshot()); err != nil {
+			r.cfgMu.Unlock()
+			r.closeMu.Unlock()
+			return fmt.Errorf("resource %s: %w", r.name, err)
+		}
+	}
+	if next.limiter != oldLimiter {
+		// The new limiter was passed in, so Close leaves it open
+		r.ownsLimiter = false
+	}
+	r.limiter = next.limiter
+	r.readLimiter = next.readLimiter
+	r.work = next.work
+	r.retry = next.retry
+	r.useTimeout = next.useTimeout
+	r.cfgMu.Unlock()
+	r.closeMu.Unlock()
+
+	if next.limiter != oldLimiter {
+		r.reregister(oldLimiter)
+	}
+	r.publishEvent(Event{
+		Kind:     EventReconfigure,
+		UseEvent: UseEvent{Resource: r.name},
+		Config:   &ConfigChange{Old: old, New: next.liveConfig()},
+	})
+	return nil
+}
+
+// checkReconfigure rejects a next configuration that changes more than
+// Reconfigure can, or makes no sense
+func (r *Resource) checkReconfigure(next *Resource, oldLimiter Limiter) error {
+	unsupported := func(option string) error {
+		return fmt.Errorf("%w: %s can't be changed by Reconfigure", ErrInvalidConfig, option)
+	}
+	switch {
+	case next.clock != nil:
+		return unsupported("WithClock")
+	case next.sem != nil:
+		return unsupported("WithMaxConcurrent")
+	case next.bulkhead != BulkheadPerCall:
+		return unsupported("WithBulkheadMode")
+	case next.rateLimit != RateLimitPerCall:
+		return unsupported("WithRateLimitMode")
+	case next.recoverPanics:
+		return unsupported("WithPanicRecovery")
+	case next.callerQuota != nil:
+		return unsupported("WithPerCallerLimit")
+	case next.metrics != nil, next.registry != nil, next.tracer != nil, next.logger != nil, next.audit != nil:
+		return unsupported("the metrics, registry, tracer, logger or audit sink")
+	case next.init != nil, next.teardown != nil, next.idleAfter != 0:
+		return unsupported("the lifecycle")
+	case next.health != nil, next.unhealthyAfter != 0, next.breaker != nil:
+		return unsupported("the health check or circuit breaker")
+	case len(next.hooks.onInit)+len(next.hooks.onAcquire)+len(next.hooks.onRelease)+len(next.hooks.onError) > 0:
+		return unsupported("the hooks")
+	}
+
+	if next.limiter == nil {
+		return fmt.Errorf("%w: nil limiter", ErrInvalidConfig)
+	}
+	if next.limiter != oldLimiter && r.shared {
+		return fmt.Errorf("%w: the limiter is shared with a resource group", ErrInvalidConfig)
+	}
+	if next.work == nil {
+		return fmt.Errorf("%w: nil work", ErrInvalidConfig)
+	}
+	if next.useTimeout < 0 {
+		return fmt.Errorf("%w: use timeout must not be negative, got %v", ErrInvalidConfig, next.useTimeout)
+	}
+	if next.retry != nil && next.retry.backoff.MaxAttempts < 0 {
+		return fmt.Errorf("%w: retry attempts must not be negative, got %d", ErrInvalidConfig, next.retry.backoff.MaxAttempts)
+	}
+	if next.preserveWindow {
+		_, oldOK := oldLimiter.(*RateLimiter)
+		_, newOK := next.limiter.(*RateLimiter)
+		switch {
+		case next.limiter == oldLimiter:
+			return fmt.Errorf("%w: WithPreservedWindow without a new limiter", ErrInvalidConfig)
+		case !oldOK || !newOK:
+			return fmt.Errorf("%w: WithPreservedWindow needs the old and new limiters to be RateLimiters", ErrInvalidConfig)
+		}
+	}
+	return nil
+}
+
+// reregister points the WithRegistry registry and a WithMetrics registry
+// the resource is exposed through at its new limiter
+func (r *Resource) reregister(old Limiter) {
+	l := r.limiterFor(AccessWrite)
+	if r.registry != nil {
+		if current, ok := r.registry.Get(r.name); ok && current == old {
+			r.registry.Unregister(r.name)
+			if err := r.registry.Register(r.name, l); err != nil {
+				r.log(LevelError, "reregistration failed", ErrorField(err))
+			}
+		}
+	}
+	if m, ok := r.metrics.(*MetricsRegistry); ok {
+		m.mu.Lock()
+		exposed := m.resources[r.name] == r
+		m.mu.Unlock()
+		if s, ok := l.(statsSource); ok && exposed {
+			m.RegisterLimiter(r.name, s)
+		}
+	}
+}
+
+// liveConfig describes the parts of the resource Reconfigure can change
+func (r *Resource) liveConfig() LiveConfig {
+	c := LiveConfig{Limiter: describeLimiter(r.limiter), UseTimeout: r.useTimeout}
+	if r.readLimiter != nil {
+		c.ReadLimiter = describeLimiter(r.readLimiter)
+	}
+	if r.retry != nil {
+		backoff := r.retry.backoff
+		c.Retry = &backoff
+	}
+	return c
+}
+
+// describeLimiter names l's type, with its limit if it reports one
+func describeLimiter(l Limiter) string {
+	if lim, ok := l.(interface{ Limit() int }); ok {
+		return fmt.Sprintf("%T(%d)", l, lim.Limit())
+	}
+	return fmt.Sprintf("%T", l)
+}
+
+// workFunc returns the resource's WithWork function
+func (r *Resource) workFunc() func(ctx context.Context) error {
+	r.cfgMu.RLock()
+	defer r.cfgMu.RUnlock()
+
+	return r.work
+}
+
+// currentRetry returns the resource's WithRetry policy, nil without one
+func (r *Resource) currentRetry() *retryPolicy {
+	r.cfgMu.RLock()
+	defer r.cfgMu.RUnlock()
+
+	return r.retry
+}
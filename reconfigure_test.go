@@ -0,0 +1,187 @@
+// reconfigure_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReconfigureSwapsLimiter(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	oldLimiter := newRateLimiter(1, time.Minute, 1, WithLimiterClock(clock))
+	resource := NewResource("db", 0, 0, WithClock(clock), WithLimiter(oldLimiter), WithRateLimitMode(RateLimitFailFast))
+	doneOld := holdUses(1, resource.UseFunc)
+
+	newLimiter := newRateLimiter(2, time.Minute, 2, WithLimiterClock(clock))
+	if err := resource.Reconfigure(WithLimiter(newLimiter)); err != nil {
+		t.Fatal(err)
+	}
+	// The use holding the old limiter's token doesn't count against the
+	// new one
+	doneNew := holdUses(2, resource.UseFunc)
+	if err := resource.UseFunc(context.Background(), noWork); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected the new limit of 2 to apply, got %v", err)
+	}
+	doneOld()
+	doneNew()
+	if old, cur := oldLimiter.Stats().Current, newLimiter.Stats().Current; old != 0 || cur != 0 {
+		t.Errorf("Expected each use to give its token back where it took it, %d and %d still held", old, cur)
+	}
+
+	var ran atomic.Bool
+	resource.Reconfigure(WithWork(func(context.Context) error { ran.Store(true); return nil }))
+	if err := resource.Use(1); err != nil || !ran.Load() {
+		t.Errorf("Expected Use to run the new work, got %v", err)
+	}
+}
+
+func TestReconfigurePreservedWindow(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	resource := NewResource("db", 0, 0, WithClock(clock), WithMaxConcurrent(10),
+		WithLimiter(newRateLimiter(5, time.Minute, 5, WithLimiterClock(clock))))
+	for i := 0; i < 3; i++ {
+		resource.Use(i)
+	}
+
+	kept := newRateLimiter(5, time.Minute, 5, WithLimiterClock(clock))
+	if err := resource.Reconfigure(WithLimiter(kept), WithPreservedWindow()); err != nil {
+		t.Fatal(err)
+	}
+	if n := kept.Remaining(); n != 2 {
+		t.Errorf("Expected the window's 3 uses carried over, %d remaining", n)
+	}
+
+	fresh := newRateLimiter(5, time.Minute, 5, WithLimiterClock(clock))
+	resource.Reconfigure(WithLimiter(fresh))
+	if n := fresh.Remaining(); n != 5 {
+		t.Errorf("Expected a new limiter to start afresh by default, %d remaining", n)
+	}
+}
+
+func TestReconfigureRejectsInvalid(t *testing.T) {
+	resource := NewResource("db", 10, 60, WithUseTimeout(time.Second))
+	for _, opts := range [][]Option{
+		{WithUseTimeout(time.Minute), WithMaxConcurrent(2)},
+		{WithUseTimeout(time.Minute), WithOnAcquire(func(context.Context, UseEvent) {})},
+		{WithUseTimeout(-time.Second)},
+		{WithPreservedWindow()},
+		{WithLimiter(NewTokenBucketLimiter(10, 1)), WithPreservedWindow()},
+		{WithLimiter(nil)},
+	} {
+		if err := resource.Reconfigure(opts...); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig, got %v", err)
+		}
+	}
+	if resource.useTimeout != time.Second {
+		t.Errorf("Expected rejected changes not to be applied, use timeout is %v", resource.useTimeout)
+	}
+
+	resource.Close(context.Background())
+	if err := resource.Reconfigure(WithUseTimeout(time.Minute)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected a closed resource to refuse, got %v", err)
+	}
+}
+
+func TestReconfigureEvent(t *testing.T) {
+	resource := NewResource("db", 10, 60)
+	events, unsubscribe := resource.Subscribe(4)
+	defer unsubscribe()
+
+	if err := resource.Reconfigure(WithUseTimeout(time.Second), WithRetry(3, BackoffPolicy{}, nil)); err != nil {
+		t.Fatal(err)
+	}
+	got := drain(events)
+	expectKinds(t, got, EventReconfigure)
+	change := got[0].Config
+	if change == nil || change.Old.UseTimeout != 0 || change.New.UseTimeout != time.Second {
+		t.Fatalf("Expected the use timeout change, got %+v", change)
+	}
+	if change.Old.Retry != nil || change.New.Retry == nil || change.New.Retry.MaxAttempts != 3 {
+		t.Errorf("Expected retries to be turned on, got %+v", change)
+	}
+	if change.Old.Limiter != "*main.RateLimiter(10)" || change.New.Limiter != change.Old.Limiter {
+		t.Errorf("Expected the limiter described and unchanged, got %q and %q", change.Old.Limiter, change.New.Limiter)
+	}
+}
+
+func TestReconfigureUnderLoad(t *testing.T) {
+	resource := NewResource("db", 1000, 60, WithReadLimiter(NewRateLimiter(1000, 60)))
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				var err error
+				if i%2 == 0 {
+					err = resource.UseRead(ctx, noWork)
+				} else {
+					err = resource.Use(i)
+				}
+				if err != nil && ctx.Err() == nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+
+	// Reconfigure from two goroutines at once; each call is applied whole
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				err := resource.Reconfigure(WithLimiter(NewRateLimiter(1000, 60)),
+					WithReadLimiter(NewRateLimiter(1000, 60)), WithUseTimeout(time.Duration(i)*time.Second), WithWork(noWork))
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	if m := resource.Metrics(); m.InFlight != 0 || m.Errors != 0 {
+		t.Errorf("Expected every use to finish cleanly, got %+v", m)
+	}
+}
+
+func TestReconfigureRacingClose(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		resource := NewResource("db", 100, 3600)
+		built := resource.limiter.(*RateLimiter)
+
+		var wg sync.WaitGroup
+		var err error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			err = resource.Reconfigure(WithLimiter(NewRateLimiter(100, 3600)))
+		}()
+		go func() {
+			defer wg.Done()
+			resource.Close(context.Background())
+		}()
+		wg.Wait()
+
+		// Either the swap came first and Close found the new limiter, or
+		// Close came first and the swap was refused
+		open := built.TryAcquire()
+		switch {
+		case err == nil && !open:
+			t.Fatal("Expected a swap that succeeded to leave Close the new limiter")
+		case err != nil && !errors.Is(err, ErrClosed):
+			t.Fatalf("Expected ErrClosed from a refused swap, got %v", err)
+		case err != nil && open:
+			t.Fatal("Expected Close to close the limiter it found")
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// redisstore.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// RedisScripter is the one call RedisStore needs from a Redis client. Most
+// clients can be adapted in a line, e.g. for go-redis:
+//
+//	func (a adapter) Eval(ctx context.Context, script string, keys []string, args ...any) (any, error) {
+//		return a.Client.Eval(ctx, script, keys, args...).Result()
+//	}
+type RedisScripter interface {
+	Eval(ctx context.Context, script string, keys []string, args ...any) (any, error)
+}
+
+// incrScript increments the counter and starts its window atomically, so
+// a crash between INCR and EXPIRE can never leave a counter that never
+// expires
+const incrScript = `
+local count = redis.call('INCRBY', KEYS[1], ARGV[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	ttl = tonumber(ARGV[2])
+end
+return {count, ttl}
+`
+
+const getScript = `return redis.call('GET', KEYS[1])`
+
+const resetScript = `return redis.call('DEL', KEYS[1])`
+
+// RedisStore is a CounterStore shared through Redis
+type RedisStore struct {
+	client RedisScripter
+	prefix string
+}
+
+// NewRedisStore creates a store keeping counters under prefix in Redis
+func NewRedisStore(client RedisScripter, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// IncrWithinWindow implements CounterStore
+func (rs *RedisStore) IncrWithinWindow(ctx context.Context, key string, n int64, window time.Duration) (int64, time.Duration, error) {
+	// PEXPIRE with 0 deletes the key at once, so a window under a
+	// millisecond still lasts one
+	ttl := max(window.Milliseconds(), 1)
+	res, err := rs.client.Eval(ctx, incrScript, []string{rs.prefix + key}, n, ttl)
+	if err != nil {
+		return 0, 0, err
+	}
+	vals, ok := res.([]any)
+	if !ok || len(vals) != 2 {
+		return 0, 0, fmt.Errorf("redis store: unexpected reply %v", res)
+	}
+	count, err := redisInt(vals[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	left, err := redisInt(vals[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, time.Duration(left) * time.Millisecond, nil
+}
+
+// Get implements CounterStore
+func (rs *RedisStore) Get(ctx context.Context, key string) (int64, error) {
+	res, err := rs.client.Eval(ctx, getScript, []string{rs.prefix + key})
+	if err != nil || res == nil {
+		return 0, err
+	}
+	return redisInt(res)
+}
+
+// Reset implements CounterStore
+func (rs *RedisStore) Reset(ctx context.Context, key string) error {
+	_, err := rs.client.Eval(ctx, resetScript, []string{rs.prefix + key})
+	return err
+}
+
+// redisInt converts an integer or bulk string reply
+func redisInt(v any) (int64, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	default:
+		return 0, fmt.Errorf("redis store: unexpected reply %v", v)
+	}
+}
@@ -0,0 +1,117 @@
+// registry.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrAlreadyRegistered is returned when registering a limiter under a name
+// that is already taken
+var ErrAlreadyRegistered = errors.New("rate limiter: name already registered")
+
+// LimiterRegistry maps names to limiters so that admin endpoints and
+// metrics can find every limiter in the process
+type LimiterRegistry struct {
+	mu       sync.RWMutex
+	limiters map[string]Limiter
+}
+
+// DefaultRegistry is the registry used by the package-level Register, Get
+// and Range
+var DefaultRegistry = NewLimiterRegistry()
+
+// NewLimiterRegistry creates an empty registry
+func NewLimiterRegistry() *LimiterRegistry {
+	return &LimiterRegistry{limiters: make(map[string]Limiter)}
+}
+
+// Register adds l under name. A name can only be registered once.
+func (reg *LimiterRegistry) Register(name string, l Limiter) error {
+	if l == nil {
+		return fmt.Errorf("rate limiter: nil limiter for %s", name)
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, ok := reg.limiters[name]; ok {
+		return fmt.Errorf("%w: %s", ErrAlreadyRegistered, name)
+	}
+	reg.limiters[name] = l
+	return nil
+}
+
+// Unregister removes the limiter registered under name, if any
+func (reg *LimiterRegistry) Unregister(name string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	delete(reg.limiters, name)
+}
+
+// Get returns the limiter registered under name
+func (reg *LimiterRegistry) Get(name string) (Limiter, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	l, ok := reg.limiters[name]
+	return l, ok
+}
+
+// Range calls fn for each registered limiter in name order until fn
+// returns false. It works on a copy taken up front, so fn may register or
+// unregister limiters; those changes are not seen by the current Range.
+func (reg *LimiterRegistry) Range(fn func(name string, l Limiter) bool) {
+	reg.mu.RLock()
+	names := sortedKeys(reg.limiters)
+	limiters := make([]Limiter, len(names))
+	for i, name := range names {
+		limiters[i] = reg.limiters[name]
+	}
+	reg.mu.RUnlock()
+
+	for i, name := range names {
+		if !fn(name, limiters[i]) {
+			return
+		}
+	}
+}
+
+// Register adds l to DefaultRegistry under name
+func Register(name string, l Limiter) error {
+	return DefaultRegistry.Register(name, l)
+}
+
+// Get returns the limiter registered in DefaultRegistry under name
+func Get(name string) (Limiter, bool) {
+	return DefaultRegistry.Get(name)
+}
+
+// Range calls fn for each limiter in DefaultRegistry, see
+// LimiterRegistry.Range
+func Range(fn func(name string, l Limiter) bool) {
+	DefaultRegistry.Range(fn)
+}
+
+// WithRegistry registers the resource's limiter in reg under the resource
+// name once the resource is built. Use DefaultRegistry for the
+// package-level lookup.
+func WithRegistry(reg *LimiterRegistry) Option {
+	return func(r *Resource) {
+		r.registry = reg
+	}
+}
+
+// register adds the resource's limiter to the registry chosen with
+// WithRegistry, if any
+func (r *Resource) register() error {
+	if r.registry == nil {
+		return nil
+	}
+	if err := r.registry.Register(r.name, r.limiter); err != nil {
+		return fmt.Errorf("resource %s: %w", r.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// registry_test.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiterRegistry(t *testing.T) {
+	reg := NewLimiterRegistry()
+	a := NewRateLimiterDuration(1, time.Second)
+	b := NewRateLimiterDuration(2, time.Second)
+
+	if err := reg.Register("b", b); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("a", a); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("a", b); !errors.Is(err, ErrAlreadyRegistered) {
+		t.Errorf("Expected ErrAlreadyRegistered for a duplicate name, got %v", err)
+	}
+	if err := reg.Register("nil", nil); err == nil {
+		t.Error("Expected an error registering a nil limiter")
+	}
+
+	if l, ok := reg.Get("a"); !ok || l != a {
+		t.Error("Expected Get to return the limiter registered under a")
+	}
+	if _, ok := reg.Get("missing"); ok {
+		t.Error("Expected Get to miss an unregistered name")
+	}
+
+	var names []string
+	reg.Range(func(name string, _ Limiter) bool {
+		names = append(names, name)
+		return true
+	})
+	if fmt.Sprint(names) != "[a b]" {
+		t.Errorf("Expected Range to visit a then b, got %v", names)
+	}
+
+	visited := 0
+	reg.Range(func(string, Limiter) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Errorf("Expected Range to stop when fn returns false, visited %d", visited)
+	}
+
+	reg.Unregister("a")
+	if _, ok := reg.Get("a"); ok {
+		t.Error("Expected a to be gone after Unregister")
+	}
+	if err := reg.Register("a", a); err != nil {
+		t.Errorf("Expected a to be registrable again, got %v", err)
+	}
+}
+
+func TestLimiterRegistryConcurrent(t *testing.T) {
+	reg := NewLimiterRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				reg.Register(fmt.Sprintf("limiter-%d-%d", i, j), NewRateLimiterDuration(1, time.Second))
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				// Registering from inside fn must not deadlock
+				reg.Range(func(_ string, l Limiter) bool {
+					reg.Register(fmt.Sprintf("range-%d-%d", i, j), l)
+					return false
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	count := 0
+	reg.Range(func(string, Limiter) bool {
+		count++
+		return true
+	})
+	if count < 400 {
+		t.Errorf("Expected at least 400 limiters, got %d", count)
+	}
+}
+
+func TestResourceWithRegistry(t *testing.T) {
+	reg := NewLimiterRegistry()
+	cfg := Config{MaxRequests: 1, Window: time.Second}
+
+	resource, err := NewResourceFromConfig("db", cfg, WithRegistry(reg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, ok := reg.Get("db"); !ok || l != resource.limiter {
+		t.Error("Expected the resource's limiter to be registered under its name")
+	}
+	if _, err := NewResourceFromConfig("db", cfg, WithRegistry(reg)); !errors.Is(err, ErrAlreadyRegistered) {
+		t.Errorf("Expected ErrAlreadyRegistered for a second db resource, got %v", err)
+	}
+	if _, err := NewResourceFromConfig("cache", cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reg.Get("cache"); ok {
+		t.Error("Expected no registration without WithRegistry")
+	}
+}
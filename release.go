@@ -0,0 +1,137 @@
+// release.go
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnbalancedRelease is returned by ReleaseChecked for tokens that were
+// never acquired or were already released
+var ErrUnbalancedRelease = errors.New("rate limiter: release without matching acquire")
+
+// ReleaseCheck selects what a RateLimiter does about unbalanced releases
+type ReleaseCheck int
+
+const (
+	// ReleaseIgnore silently clamps the count at zero, as the limiter
+	// always has
+	ReleaseIgnore ReleaseCheck = iota
+	// ReleaseCount also counts the excess in Stats().UnbalancedReleases
+	ReleaseCount
+	// ReleasePanic counts the excess and then panics, which is meant for
+	// catching double releases in tests
+	ReleasePanic
+)
+
+// WithReleaseCheck sets how releases that don't match an acquisition are
+// handled
+func WithReleaseCheck(check ReleaseCheck) LimiterOption {
+	return func(rl *RateLimiter) {
+		rl.releaseCheck = check
+	}
+}
+
+// ReleaseChecked is like ReleaseN but returns ErrUnbalancedRelease if more
+// tokens are released than are held. The held tokens are still released.
+//
+// A release is matched against every token handed out and not yet given
+// back, whichever window it was acquired in. A plain release can't say
+// which window its token came from, so tokens from windows that have since
+// reset are assumed to go back first: they count as balanced but free
+// nothing, since the reset already cleared them, and the new window keeps
+// enforcing its limit. Use TryAcquireToken to release exactly the tokens
+// taken.
+func (rl *RateLimiter) ReleaseChecked(n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	now := rl.clock.Now()
+	rl.resetIfExpiredLocked(now)
+
+	var err error
+	if excess := n - rl.held; excess > 0 {
+		err = fmt.Errorf("%w: released %d, held %d", ErrUnbalancedRelease, n, rl.held)
+		if rl.releaseCheck != ReleaseIgnore {
+			rl.unbalanced += uint64(excess)
+		}
+		if rl.releaseCheck == ReleasePanic {
+			panic(err)
+		}
+	}
+
+	if stale := min(n, rl.stale); stale > 0 {
+		rl.releaseEpochLocked(stale, rl.epoch-1)
+		n -= stale
+	}
+	rl.releaseEpochLocked(n, rl.epoch)
+	rl.dispatchLocked(now)
+	return err
+}
+
+// releaseEpochLocked gives back n tokens acquired in window epoch: the
+// current window gets them back, an earlier one is already over so they
+// are only forgotten, and a later one loses that many reservations
+func (rl *RateLimiter) releaseEpochLocked(n int, epoch uint64) {
+	rl.held = max(rl.held-n, 0)
+	switch {
+	case epoch == rl.epoch:
+		rl.currRequests = max(rl.currRequests-n, 0)
+	case epoch < rl.epoch:
+		rl.stale = max(rl.stale-n, 0)
+	default:
+		rl.reservedNext = max(rl.reservedNext-n, 0)
+	}
+}
+
+// Token is a handle on tokens taken by TryAcquireToken. Releasing it only
+// frees capacity in the window the tokens were counted in.
+type Token struct {
+	limiter  *RateLimiter
+	n        int
+	epoch    uint64
+	released bool
+}
+
+// TryAcquireToken is like TryAcquireN but returns a handle to release the
+// tokens with, so a release after the window has reset can't free capacity
+// in the new window
+func (rl *RateLimiter) TryAcquireToken(n int) (*Token, bool) {
+	defer rl.fireEvents()
+	rl.lock()
+	ok := rl.tryAcquireOrDenyLocked(rl.clock.Now(), n)
+	epoch := rl.epoch
+	rl.unlock()
+
+	if !ok {
+		return nil, false
+	}
+	if ok, _ := rl.commitShared(n, epoch, true); !ok {
+		return nil, false
+	}
+	return &Token{limiter: rl, n: n, epoch: epoch}, true
+}
+
+// Release gives the tokens back. If their window has since reset there is
+// nothing left to free. Only the first call has any effect.
+func (t *Token) Release() {
+	rl := t.limiter
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	if t.released {
+		return
+	}
+	t.released = true
+
+	now := rl.clock.Now()
+	rl.resetIfExpiredLocked(now)
+	rl.releaseEpochLocked(t.n, t.epoch)
+	rl.dispatchLocked(now)
+}
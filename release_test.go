@@ -0,0 +1,147 @@
+// release_test.go
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUnbalancedReleaseCounted(t *testing.T) {
+	limiter := NewRateLimiter(3, 60, WithReleaseCheck(ReleaseCount))
+
+	limiter.TryAcquire()
+	if err := limiter.ReleaseChecked(1); err != nil {
+		t.Errorf("Expected a matched release to succeed, got %v", err)
+	}
+	if err := limiter.ReleaseChecked(1); !errors.Is(err, ErrUnbalancedRelease) {
+		t.Errorf("Expected ErrUnbalancedRelease for a double release, got %v", err)
+	}
+	limiter.Release()
+	if n := limiter.Stats().UnbalancedReleases; n != 2 {
+		t.Errorf("Expected 2 unbalanced releases, got %d", n)
+	}
+
+	// Releasing more than is held frees what is held and counts the rest
+	limiter.TryAcquireN(2)
+	limiter.ReleaseN(3)
+	stats := limiter.Stats()
+	if stats.Current != 0 || stats.UnbalancedReleases != 3 {
+		t.Errorf("Expected nothing held and 3 unbalanced releases, got %+v", stats)
+	}
+}
+
+func TestUnbalancedReleaseIgnoredByDefault(t *testing.T) {
+	limiter := NewRateLimiter(3, 60)
+	limiter.Release()
+	if n := limiter.Stats().UnbalancedReleases; n != 0 {
+		t.Errorf("Expected the default mode not to count, got %d", n)
+	}
+	if err := limiter.ReleaseChecked(1); !errors.Is(err, ErrUnbalancedRelease) {
+		t.Errorf("Expected ReleaseChecked to report the release anyway, got %v", err)
+	}
+}
+
+func TestUnbalancedReleasePanics(t *testing.T) {
+	limiter := NewRateLimiter(3, 60, WithReleaseCheck(ReleasePanic))
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected an unbalanced release to panic")
+		}
+		// The limiter must still be usable after the panic
+		if !limiter.TryAcquire() {
+			t.Error("Expected the limiter to keep working after a panic")
+		}
+	}()
+	limiter.Release()
+}
+
+func TestReleaseAfterWindowReset(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(2, 1, WithLimiterClock(clock), WithReleaseCheck(ReleaseCount))
+
+	limiter.TryAcquire()
+	clock.Advance(time.Second)
+	limiter.TryAcquire()
+
+	// Both releases match an acquisition, even though the reset already
+	// dropped the first token from the window's count
+	if err := limiter.ReleaseChecked(1); err != nil {
+		t.Errorf("Expected a release after a reset to be balanced, got %v", err)
+	}
+	if err := limiter.ReleaseChecked(1); err != nil {
+		t.Errorf("Expected the second release to be balanced, got %v", err)
+	}
+	if err := limiter.ReleaseChecked(1); !errors.Is(err, ErrUnbalancedRelease) {
+		t.Errorf("Expected a third release to be unbalanced, got %v", err)
+	}
+	if n := limiter.Stats().UnbalancedReleases; n != 1 {
+		t.Errorf("Expected 1 unbalanced release, got %d", n)
+	}
+}
+
+func TestCanceledReservationIsNotHeld(t *testing.T) {
+	limiter := NewRateLimiter(1, 60, WithReleaseCheck(ReleaseCount))
+	r, err := limiter.Reserve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Cancel()
+	if err := limiter.ReleaseChecked(1); !errors.Is(err, ErrUnbalancedRelease) {
+		t.Errorf("Expected releasing a canceled reservation to be unbalanced, got %v", err)
+	}
+}
+
+func TestStaleReleaseDoesNotFreeNewWindow(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(3, 1, WithLimiterClock(clock))
+
+	// Take every token just before the window rolls over and hold them
+	// across the reset
+	clock.Advance(999 * time.Millisecond)
+	limiter.TryAcquireN(3)
+	clock.Advance(time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if !limiter.TryAcquire() {
+			t.Fatalf("Expected acquisition %d in the new window to succeed", i+1)
+		}
+	}
+	// Releasing the previous window's tokens must not make room
+	limiter.ReleaseN(3)
+	if limiter.TryAcquire() {
+		t.Error("Expected the new window to still enforce exactly 3")
+	}
+
+	// The new window's own releases still free capacity
+	limiter.Release()
+	if !limiter.TryAcquire() {
+		t.Error("Expected a release from the current window to free a token")
+	}
+}
+
+func TestTokenReleaseIsEpochAware(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(2, 1, WithLimiterClock(clock))
+
+	old, ok := limiter.TryAcquireToken(2)
+	if !ok {
+		t.Fatal("Expected to acquire the whole first window")
+	}
+	clock.Advance(time.Second)
+
+	current, ok := limiter.TryAcquireToken(2)
+	if !ok {
+		t.Fatal("Expected to acquire the whole second window")
+	}
+	old.Release()
+	if limiter.TryAcquire() {
+		t.Error("Expected a token from the previous window to free nothing")
+	}
+
+	current.Release()
+	current.Release()
+	if n := limiter.Remaining(); n != 2 {
+		t.Errorf("Expected the current token's release, once, to free 2, got %d", n)
+	}
+}
@@ -0,0 +1,80 @@
+// reservation.go
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoReservation is returned by Reserve when neither the current nor the
+// next window has room
+var ErrNoReservation = errors.New("rate limiter: no capacity in the current or next window")
+
+// Reservation is a token held for the caller, usable after Delay
+type Reservation struct {
+	limiter  *RateLimiter
+	epoch    uint64 // window the token is counted in
+	at       time.Time
+	canceled bool
+}
+
+// Reserve takes a token from the current window if it has room, or from the
+// next window otherwise. It never blocks; the caller should wait for the
+// reservation's Delay before proceeding and Release when done, or Cancel if
+// it decides not to proceed.
+func (rl *RateLimiter) Reserve() (*Reservation, error) {
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	if err := rl.unavailableLocked(); err != nil {
+		return nil, err
+	}
+	now := rl.clock.Now()
+	if rl.tryAcquireLocked(now, 1) {
+		return &Reservation{limiter: rl, epoch: rl.epoch, at: now}, nil
+	}
+
+	// Every window earns at least maxRequests, so that many tokens can
+	// safely be promised to the next one
+	if rl.reservedNext >= rl.maxRequests {
+		rl.denied++
+		rl.queueEventLocked(limiterEvent{now: now, current: rl.currRequests, max: rl.allowance})
+		return nil, ErrNoReservation
+	}
+	rl.reservedNext++
+	rl.held++
+	rl.acquired++
+	return &Reservation{
+		limiter: rl,
+		epoch:   rl.epoch + 1,
+		at:      rl.windowStartLocked(now).Add(rl.window),
+	}, nil
+}
+
+// Delay returns how long the caller must wait before using the reservation
+func (r *Reservation) Delay() time.Duration {
+	if d := r.at.Sub(r.limiter.clock.Now()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Cancel returns the reserved token. It undoes the accounting in whichever
+// window the token ended up in, and does nothing once that window is over
+// or if called more than once.
+func (r *Reservation) Cancel() {
+	rl := r.limiter
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	if r.canceled {
+		return
+	}
+	r.canceled = true
+
+	rl.resetIfExpiredLocked(rl.clock.Now())
+	rl.releaseEpochLocked(1, r.epoch)
+	rl.dispatchLocked(rl.clock.Now())
+}
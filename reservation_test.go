@@ -0,0 +1,89 @@
+// reservation_test.go
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReserveCurrentAndNextWindow(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(2, 60, WithLimiterClock(clock))
+
+	for i := 0; i < 2; i++ {
+		r, err := limiter.Reserve()
+		if err != nil {
+			t.Fatalf("Reservation %d should succeed, got %v", i+1, err)
+		}
+		if d := r.Delay(); d != 0 {
+			t.Errorf("Reservation %d in the current window should not wait, got %v", i+1, d)
+		}
+	}
+
+	next, err := limiter.Reserve()
+	if err != nil {
+		t.Fatalf("Reservation in the next window should succeed, got %v", err)
+	}
+	if d := next.Delay(); d != time.Minute {
+		t.Errorf("Expected to wait for the next window, got %v", d)
+	}
+
+	limiter.Reserve()
+	if _, err := limiter.Reserve(); !errors.Is(err, ErrNoReservation) {
+		t.Errorf("Expected ErrNoReservation once both windows are full, got %v", err)
+	}
+
+	// Reserved tokens count against the next window once it starts
+	clock.Advance(time.Minute)
+	if limiter.TryAcquire() {
+		t.Error("The next window was fully reserved and should deny")
+	}
+}
+
+func TestReservationCancel(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 60, WithLimiterClock(clock))
+
+	r, _ := limiter.Reserve()
+	r.Cancel()
+	r.Cancel() // no-op
+	if !limiter.TryAcquire() {
+		t.Error("Cancelling a current-window reservation should free its token")
+	}
+
+	next, _ := limiter.Reserve()
+	next.Cancel()
+	clock.Advance(time.Minute)
+	if !limiter.TryAcquire() {
+		t.Error("Cancelling a next-window reservation should free its token")
+	}
+}
+
+func TestReservationCancelAfterRollover(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 60, WithLimiterClock(clock))
+	limiter.TryAcquire()
+
+	next, _ := limiter.Reserve()
+
+	// The reserved window becomes the current one before the cancel
+	clock.Advance(time.Minute)
+	next.Cancel()
+	if !limiter.TryAcquire() {
+		t.Error("Cancel after rollover should return the token to the now-current window")
+	}
+	if limiter.TryAcquire() {
+		t.Error("Cancel must not free more than one token")
+	}
+
+	// A reservation whose window has passed is not undone in a later one
+	clock.Advance(time.Minute)
+	stale, _ := limiter.Reserve()
+	clock.Advance(time.Minute)
+	limiter.TryAcquire()
+	stale.Cancel()
+	if limiter.TryAcquire() {
+		t.Error("Cancelling a reservation from an expired window must not free capacity")
+	}
+}
@@ -0,0 +1,32 @@
+// resourcegroup.go
+package main
+
+import "fmt"
+
+// NewResourceGroup creates one resource per name, all drawing on l, for
+// resources that are separate to callers but share a budget, such as two
+// databases on the same server. Heavy use of one leaves less for the others.
+// Closing a resource of the group leaves l open for the rest; close l itself
+// once they are all done with it.
+func NewResourceGroup(l Limiter, names ...string) []*Resource {
+	resources := make([]*Resource, len(names))
+	for i, name := range names {
+		r := newResource(name, []Option{WithLimiter(l)})
+		r.shared = true
+		if err := r.register(); err != nil {
+			r.log(LevelError, "registration failed", ErrorField(err))
+		}
+		resources[i] = r
+	}
+	return resources
+}
+
+// LimiterStats returns the stats of the resource's limiter, shared or not.
+// It fails for a limiter that doesn't report any.
+func (r *Resource) LimiterStats() (LimiterStats, error) {
+	s, ok := r.limiterFor(AccessWrite).(statsSource)
+	if !ok {
+		return LimiterStats{}, fmt.Errorf("limiter for resource %s does not report stats", r.name)
+	}
+	return s.Stats(), nil
+}
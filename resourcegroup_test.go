@@ -0,0 +1,50 @@
+// resourcegroup_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResourceGroupSharesLimiter(t *testing.T) {
+	limiter := NewRateLimiterDuration(3, time.Minute, WithLimiterClock(NewFakeClock(time.Now())))
+	group := NewResourceGroup(limiter, "reporting-db", "analytics-db")
+	reporting, analytics := group[0], group[1]
+	for _, r := range group {
+		r.init = func(context.Context) error { return nil }
+	}
+
+	// Reporting's uses in flight take the whole budget
+	done := fillBulkhead(reporting, 3)
+	if err := analytics.Use(1); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected reporting's load to throttle analytics, got %v", err)
+	}
+	for _, r := range group {
+		stats, err := r.LimiterStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Current != 3 || stats.Denied != 1 {
+			t.Errorf("Expected %s to see the shared limiter's 3 held and 1 denied, got %+v", r.name, stats)
+		}
+	}
+	done()
+	if err := analytics.Use(1); err != nil {
+		t.Errorf("Expected analytics to get a token once reporting's were back, got %v", err)
+	}
+
+	// Closing one member leaves the limiter to the other
+	reporting.Close(context.Background())
+	if err := analytics.UseFunc(context.Background(), noWork); err != nil {
+		t.Errorf("Expected analytics to keep working after reporting closed, got %v", err)
+	}
+}
+
+func TestResourceLimiterStatsUnsupported(t *testing.T) {
+	resource := NewResource("db", 1, 1, WithLimiter(NewSemaphore(1)))
+	if _, err := resource.LimiterStats(); err == nil {
+		t.Error("Expected an error for a limiter without stats")
+	}
+}
@@ -0,0 +1,62 @@
+// retry.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// retryPolicy is how UseFunc retries failed uses, see WithRetry
+type retryPolicy struct {
+	backoff BackoffPolicy
+	retryIf func(error) bool
+}
+
+// WithRetry makes UseFunc and UseWeighted, and UseContext through them, try a failed use
+// again up to maxAttempts times in all, waiting between attempts as
+// RetryWithBackoff does with backoff: on its exponential schedule, or for
+// a rate limit denial's RetryAfter. Each attempt is a use of its own,
+// taking a fresh slot and token and firing the hooks. Only errors retryIf
+// accepts are retried; a nil retryIf retries every error but a closed
+// resource's. A maxAttempts of zero sets no cap. Retries stop when ctx is
+// done, and the last error is returned with the number of attempts made.
+// Use is never retried.
+func WithRetry(maxAttempts int, backoff BackoffPolicy, retryIf func(error) bool) Option {
+	return func(r *Resource) {
+		backoff.MaxAttempts = maxAttempts
+		if retryIf == nil {
+			retryIf = func(err error) bool { return !errors.Is(err, ErrClosed) }
+		}
+		r.retry = &retryPolicy{backoff: backoff, retryIf: retryIf}
+	}
+}
+
+// useWithRetry runs use until it succeeds, fails with an error the policy
+// won't retry, runs out of attempts or ctx is done
+func (r *Resource) useWithRetry(ctx context.Context, rp *retryPolicy, mode AccessMode, cost int, fn func(ctx context.Context) error) error {
+	policy := rp.backoff
+	if policy.Clock == nil {
+		policy.Clock = r.clock
+	}
+
+	attempts := 0
+	var last error
+	err := RetryWithBackoff(ctx, policy, func() error {
+		attempts++
+		last = r.use(ctx, true, mode, cost, fn)
+		if last != nil && (ctx.Err() != nil || !rp.retryIf(last)) {
+			// Not worth another attempt; last is returned below
+			return nil
+		}
+		return last
+	})
+	if last == nil {
+		return nil
+	}
+	if err != nil && ctx.Err() != nil && !errors.Is(last, ctx.Err()) {
+		// ctx ended while waiting to try again
+		return fmt.Errorf("resource %s: %w waiting to retry, attempt %d: %w", r.name, err, attempts, last)
+	}
+	return fmt.Errorf("%w (attempt %d)", last, attempts)
+}
@@ -0,0 +1,113 @@
+// retry_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResourceRetry(t *testing.T) {
+	errBusy := errors.New("server busy")
+	var acquires atomic.Int32
+	resource := NewResource("db", 100, 1, WithInit(noWork),
+		WithRetry(5, BackoffPolicy{Initial: time.Millisecond}, nil),
+		WithOnAcquire(func(context.Context, UseEvent) { acquires.Add(1) }))
+
+	calls := 0
+	err := resource.UseFunc(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errBusy
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("Expected the third attempt to succeed, got %v after %d calls", err, calls)
+	}
+	if acquires.Load() != 3 {
+		t.Errorf("Expected every attempt to acquire afresh and fire hooks, got %d acquisitions", acquires.Load())
+	}
+	if m := resource.Metrics(); m.Uses != 3 || m.Errors != 2 {
+		t.Errorf("Expected each attempt to count as a use, got %+v", m)
+	}
+
+	// Out of attempts, the last error comes back with the count
+	calls = 0
+	err = resource.UseFunc(context.Background(), func(context.Context) error {
+		calls++
+		return errBusy
+	})
+	if !errors.Is(err, errBusy) || calls != 5 || !strings.Contains(err.Error(), "(attempt 5)") {
+		t.Errorf("Expected 5 attempts and the last error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestResourceRetryIf(t *testing.T) {
+	errBusy := errors.New("server busy")
+	errBadQuery := errors.New("syntax error")
+	resource := NewResource("db", 100, 1, WithInit(noWork),
+		WithRetry(5, BackoffPolicy{Initial: time.Millisecond}, func(err error) bool {
+			return errors.Is(err, errBusy)
+		}))
+
+	calls := 0
+	err := resource.UseFunc(context.Background(), func(context.Context) error {
+		calls++
+		if calls == 1 {
+			return errBusy
+		}
+		return errBadQuery
+	})
+	if !errors.Is(err, errBadQuery) || calls != 2 || !strings.Contains(err.Error(), "(attempt 2)") {
+		t.Errorf("Expected to stop at the error retryIf rejects, got %v after %d calls", err, calls)
+	}
+}
+
+func TestResourceRetryHonorsRetryAfter(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	resource := NewResource("db", 1, 60, WithClock(clock), WithInit(noWork), WithMaxConcurrent(2),
+		WithRateLimitMode(RateLimitFailFast),
+		WithRetry(3, BackoffPolicy{Initial: time.Millisecond}, nil))
+	if err := resource.UseFunc(context.Background(), noWork); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- resource.UseFunc(context.Background(), noWork) }()
+	// Denied, it waits out the window rather than the 1ms backoff
+	clock.BlockUntil(1)
+	clock.Advance(59 * time.Second)
+	select {
+	case err := <-errs:
+		t.Fatalf("Expected the retry to wait for the window, returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	clock.Advance(time.Second)
+	if err := <-errs; err != nil {
+		t.Errorf("Expected the retry in the next window to succeed, got %v", err)
+	}
+}
+
+func TestResourceRetryCancelled(t *testing.T) {
+	errBusy := errors.New("server busy")
+	resource := NewResource("db", 100, 1, WithInit(noWork),
+		WithRetry(0, BackoffPolicy{Initial: time.Hour}, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := resource.UseFunc(ctx, func(context.Context) error { return errBusy })
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, errBusy) {
+		t.Errorf("Expected the deadline and the last error, got %v", err)
+	}
+
+	resource.Close(context.Background())
+	calls := 0
+	err = resource.UseFunc(context.Background(), func(context.Context) error { calls++; return nil })
+	if !errors.Is(err, ErrClosed) || calls != 0 || !strings.Contains(err.Error(), "(attempt 1)") {
+		t.Errorf("Expected a closed resource not to be retried, got %v", err)
+	}
+}
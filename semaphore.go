@@ -0,0 +1,114 @@
+// semaphore.go
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Semaphore limits how many holders can be active at once. Unlike
+// RateLimiter it has no window: a slot is only freed by Release.
+type Semaphore struct {
+	mu       sync.Mutex
+	capacity int
+	held     int
+
+	// waiters queues the goroutines blocked in Acquire, oldest first
+	waiters list.List
+}
+
+// semWaiter is a goroutine blocked in Semaphore.Acquire
+type semWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// NewSemaphore creates a semaphore with capacity slots
+func NewSemaphore(capacity int) *Semaphore {
+	return &Semaphore{capacity: capacity}
+}
+
+// TryAcquire takes a slot if one is free and nobody is queued for it
+func (s *Semaphore) TryAcquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.held >= s.capacity || s.waiters.Len() > 0 {
+		return false
+	}
+	s.held++
+	return true
+}
+
+// Acquire blocks until a slot is free or ctx is done. Slots are handed out
+// in the order Acquire was called.
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.held < s.capacity && s.waiters.Len() == 0 {
+		s.held++
+		s.mu.Unlock()
+		return nil
+	}
+	w := &semWaiter{ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w.granted {
+		// The slot was handed over as we gave up; pass it on
+		s.releaseLocked()
+	} else {
+		s.waiters.Remove(elem)
+	}
+	return ctx.Err()
+}
+
+// Release frees a slot, handing it straight to the oldest waiter if there
+// is one. Releasing more than is held is ignored.
+func (s *Semaphore) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.releaseLocked()
+}
+
+func (s *Semaphore) releaseLocked() {
+	if s.held == 0 {
+		return
+	}
+	if front := s.waiters.Front(); front != nil {
+		w := s.waiters.Remove(front).(*semWaiter)
+		w.granted = true
+		close(w.ready)
+		return
+	}
+	s.held--
+}
+
+// Waiting returns how many goroutines are blocked in Acquire
+func (s *Semaphore) Waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.waiters.Len()
+}
+
+// Held returns how many slots are in use
+func (s *Semaphore) Held() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.held
+}
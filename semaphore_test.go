@@ -0,0 +1,129 @@
+// semaphore_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreTryAcquire(t *testing.T) {
+	sem := NewSemaphore(2)
+	if !sem.TryAcquire() || !sem.TryAcquire() {
+		t.Fatal("Expected two slots")
+	}
+	if sem.TryAcquire() {
+		t.Error("Expected the third acquisition to fail")
+	}
+	sem.Release()
+	if !sem.TryAcquire() {
+		t.Error("Expected a released slot to be reusable")
+	}
+
+	sem.Release()
+	sem.Release()
+	sem.Release()
+	if n := sem.Held(); n != 0 {
+		t.Errorf("Expected extra releases to be ignored, %d held", n)
+	}
+}
+
+func TestSemaphoreAcquireBlocks(t *testing.T) {
+	sem := NewSemaphore(1)
+	sem.TryAcquire()
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- sem.Acquire(context.Background()) }()
+
+	select {
+	case <-acquired:
+		t.Fatal("Expected Acquire to block while the slot is held")
+	case <-time.After(20 * time.Millisecond):
+	}
+	sem.Release()
+	if err := <-acquired; err != nil {
+		t.Errorf("Expected the waiter to get the released slot, got %v", err)
+	}
+	if n := sem.Held(); n != 1 {
+		t.Errorf("Expected the slot to pass to the waiter, %d held", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := sem.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+	sem.Release()
+	if !sem.TryAcquire() {
+		t.Error("Expected a timed out waiter not to keep the slot")
+	}
+}
+
+func TestSemaphoreBoundsConcurrency(t *testing.T) {
+	sem := NewSemaphore(3)
+	var active, peak int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sem.Acquire(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			n := atomic.AddInt32(&active, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			sem.Release()
+		}()
+	}
+	wg.Wait()
+
+	if peak > 3 {
+		t.Errorf("Expected at most 3 concurrent holders, saw %d", peak)
+	}
+}
+
+func TestResourceMaxConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	resource, err := NewResourceFromConfig("test", Config{MaxRequests: 2, Window: time.Minute}, WithMaxConcurrent(1),
+		WithWork(func(context.Context) error {
+			<-release
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- resource.Use(1) }()
+	for resource.sem.Held() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := resource.Use(2); !errors.Is(err, ErrTooManyConcurrent) {
+		t.Errorf("Expected a concurrency error while the resource is busy, got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Without concurrent use only the rate limit applies, and finishing
+	// doesn't hand the window's tokens back
+	if err := resource.Use(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := resource.Use(4); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected the third request in the window to be rate limited, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+// sharded.go
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync/atomic"
+)
+
+// ShardedLimiter splits one limit across several RateLimiters so that very
+// high limits don't contend on a single counter. Each acquisition goes to a
+// randomly picked shard and, unless borrowing is disabled, moves on to the
+// others when that shard is exhausted, so the aggregate limit is still
+// reached exactly.
+type ShardedLimiter struct {
+	shards   []*RateLimiter
+	shardsN  int
+	noBorrow bool
+	denied   atomic.Uint64
+}
+
+// ShardedOption configures a ShardedLimiter
+type ShardedOption func(*ShardedLimiter)
+
+// WithShards sets the number of shards. It defaults to GOMAXPROCS and is
+// capped at the limit so every shard allows at least one request.
+func WithShards(n int) ShardedOption {
+	return func(sl *ShardedLimiter) {
+		sl.shardsN = n
+	}
+}
+
+// WithBorrowing controls whether an exhausted shard borrows from the
+// others. Without it acquisitions are cheaper, but a request can be denied
+// while other shards still have room.
+func WithBorrowing(enabled bool) ShardedOption {
+	return func(sl *ShardedLimiter) {
+		sl.noBorrow = !enabled
+	}
+}
+
+// NewShardedLimiter creates a limiter enforcing cfg with its limit and
+// burst split evenly over the shards
+func NewShardedLimiter(cfg Config, opts ...ShardedOption) (*ShardedLimiter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	sl := &ShardedLimiter{shardsN: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(sl)
+	}
+	n := min(max(sl.shardsN, 1), cfg.MaxRequests)
+	burst := cfg.Burst
+	if burst == 0 {
+		burst = cfg.MaxRequests
+	}
+
+	sl.shards = make([]*RateLimiter, n)
+	for i := range sl.shards {
+		shard := cfg
+		shard.MaxRequests = split(cfg.MaxRequests, n, i)
+		shard.Burst = split(burst, n, i)
+		rl, err := NewRateLimiterFromConfig(shard)
+		if err != nil {
+			return nil, fmt.Errorf("shard %d: %w", i, err)
+		}
+		sl.shards[i] = rl
+	}
+	return sl, nil
+}
+
+// split returns shard i's part of total spread over n shards, with the
+// remainder going to the first ones
+func split(total, n, i int) int {
+	part := total / n
+	if i < total%n {
+		part++
+	}
+	return part
+}
+
+// TryAcquire takes a token from a random shard, borrowing from the others
+// if it is exhausted
+func (sl *ShardedLimiter) TryAcquire() bool {
+	start := rand.Intn(len(sl.shards))
+	if sl.shards[start].TryAcquire() {
+		return true
+	}
+	if !sl.noBorrow {
+		for i := 1; i < len(sl.shards); i++ {
+			if sl.shards[(start+i)%len(sl.shards)].TryAcquire() {
+				return true
+			}
+		}
+	}
+	sl.denied.Add(1)
+	return false
+}
+
+// Release returns a token to a shard holding one
+func (sl *ShardedLimiter) Release() {
+	start := rand.Intn(len(sl.shards))
+	for i := range sl.shards {
+		if sl.shards[(start+i)%len(sl.shards)].ReleaseChecked(1) == nil {
+			return
+		}
+	}
+}
+
+// Shards returns the number of shards
+func (sl *ShardedLimiter) Shards() int {
+	return len(sl.shards)
+}
+
+// Stats adds up the shards' stats. Denied counts requests the limiter as a
+// whole refused, not every shard that was tried, and UntilReset is the
+// longest any shard has left.
+func (sl *ShardedLimiter) Stats() LimiterStats {
+	var stats LimiterStats
+	for _, shard := range sl.shards {
+		s := shard.Stats()
+		stats.Acquired += s.Acquired
+		stats.Current += s.Current
+		stats.UnbalancedReleases += s.UnbalancedReleases
+		stats.UntilReset = max(stats.UntilReset, s.UntilReset)
+	}
+	stats.Denied = sl.denied.Load()
+	return stats
+}
+
+// Remaining adds up what every shard can still grant in its window
+func (sl *ShardedLimiter) Remaining() int {
+	total := 0
+	for _, shard := range sl.shards {
+		total += shard.Remaining()
+	}
+	return total
+}
@@ -0,0 +1,116 @@
+// sharded_test.go
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShardedLimiterAggregateLimit(t *testing.T) {
+	limiter, err := NewShardedLimiter(Config{MaxRequests: 10, Window: time.Minute}, WithShards(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := limiter.Shards(); n != 4 {
+		t.Fatalf("Expected 4 shards, got %d", n)
+	}
+
+	for i := 0; i < 10; i++ {
+		if !limiter.TryAcquire() {
+			t.Fatalf("Expected acquisition %d to borrow from another shard if needed", i+1)
+		}
+	}
+	if limiter.TryAcquire() {
+		t.Error("Expected the aggregate limit of 10 to hold")
+	}
+
+	stats := limiter.Stats()
+	if stats.Acquired != 10 || stats.Denied != 1 || stats.Current != 10 {
+		t.Errorf("Unexpected aggregate stats %+v", stats)
+	}
+
+	// A release frees a token somewhere, and it can be acquired again from
+	// any shard
+	limiter.Release()
+	if !limiter.TryAcquire() {
+		t.Error("Expected the released token to be reusable")
+	}
+}
+
+func TestShardedLimiterWithoutBorrowing(t *testing.T) {
+	limiter, _ := NewShardedLimiter(Config{MaxRequests: 100, Window: time.Minute}, WithShards(10), WithBorrowing(false))
+
+	acquired := 0
+	for i := 0; i < 1000; i++ {
+		if limiter.TryAcquire() {
+			acquired++
+		}
+	}
+	if acquired != 100 {
+		t.Errorf("Expected repeated tries to eventually use every shard's 100, got %d", acquired)
+	}
+}
+
+func TestShardedLimiterShardsCappedAtLimit(t *testing.T) {
+	limiter, _ := NewShardedLimiter(Config{MaxRequests: 3, Window: time.Minute}, WithShards(8))
+	if n := limiter.Shards(); n != 3 {
+		t.Errorf("Expected the shard count to be capped at the limit of 3, got %d", n)
+	}
+	if _, err := NewShardedLimiter(Config{Window: time.Minute}); err == nil {
+		t.Error("Expected an invalid config to be rejected")
+	}
+}
+
+func TestShardedLimiterConcurrent(t *testing.T) {
+	limiter, _ := NewShardedLimiter(Config{MaxRequests: 500, Window: time.Hour}, WithShards(8))
+
+	var acquired int64
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if limiter.TryAcquire() {
+					atomic.AddInt64(&acquired, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 500 {
+		t.Errorf("Expected exactly the limit of 500 to be acquired, got %d", acquired)
+	}
+}
+
+func BenchmarkShardedVsSingle(b *testing.B) {
+	const limit = 1 << 30
+	for _, goroutines := range []int{1, 8, 64} {
+		single, _ := NewRateLimiterFromConfig(Config{MaxRequests: limit, Window: time.Hour})
+		sharded, _ := NewShardedLimiter(Config{MaxRequests: limit, Window: time.Hour})
+		for _, l := range []struct {
+			name    string
+			limiter Limiter
+		}{{"single", single}, {"sharded", sharded}} {
+			b.Run(fmt.Sprintf("%s/goroutines=%d", l.name, goroutines), func(b *testing.B) {
+				per := b.N/goroutines + 1
+				b.ResetTimer()
+				var wg sync.WaitGroup
+				for i := 0; i < goroutines; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for j := 0; j < per; j++ {
+							l.limiter.TryAcquire()
+						}
+					}()
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// simulate.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimeWentBackwards is returned by AcquireNAt for a timestamp earlier
+// than one the limiter has already been asked about
+var ErrTimeWentBackwards = errors.New("rate limiter: timestamps must not decrease")
+
+// AcquireNAt tries to take n tokens as if the current time were t, without
+// consulting the limiter's clock. It lets recorded traffic be replayed
+// against a limiter faster than real time. Timestamps passed to a limiter
+// must not decrease; an earlier one fails with ErrTimeWentBackwards. A
+// first timestamp before the limiter was created simply starts its first
+// window.
+func (rl *RateLimiter) AcquireNAt(t time.Time, n int) (bool, error) {
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	if t.Before(rl.lastAt) {
+		return false, fmt.Errorf("%w: %v is before %v", ErrTimeWentBackwards, t, rl.lastAt)
+	}
+	rl.lastAt = t
+	return rl.tryAcquireOrDenyLocked(t, n), nil
+}
+
+// AllowAt is AcquireNAt for a single token. It panics if t is earlier than
+// a timestamp already seen, which in a simulation means the input is out of
+// order.
+func (rl *RateLimiter) AllowAt(t time.Time) bool {
+	ok, err := rl.AcquireNAt(t, 1)
+	if err != nil {
+		panic(err)
+	}
+	return ok
+}
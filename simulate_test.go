@@ -0,0 +1,80 @@
+// simulate_test.go
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAllowAtReplay(t *testing.T) {
+	base := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return base.Add(time.Duration(ms) * time.Millisecond) }
+
+	tests := []struct {
+		name   string
+		max    int
+		window time.Duration
+		burst  int
+		times  []int // request timestamps in ms
+		want   []bool
+	}{
+		{
+			name: "steady", max: 2, window: time.Second,
+			times: []int{0, 100, 200, 1000, 1100, 1200},
+			want:  []bool{true, true, false, true, true, false},
+		},
+		{
+			name: "window starts at the first request", max: 1, window: time.Second,
+			times: []int{500, 1400, 1500},
+			want:  []bool{true, false, true},
+		},
+		{
+			name: "quiet windows bank up to the burst", max: 1, window: time.Second, burst: 3,
+			times: []int{0, 5000, 5001, 5002, 5003},
+			want:  []bool{true, true, true, true, false},
+		},
+		{
+			name: "identical timestamps", max: 2, window: 100 * time.Millisecond,
+			times: []int{0, 0, 0, 100},
+			want:  []bool{true, true, false, true},
+		},
+	}
+	for _, tt := range tests {
+		// The limiter's own clock is far from the recorded traffic and
+		// never moves; only the replayed timestamps matter
+		limiter, err := NewRateLimiterFromConfig(Config{
+			MaxRequests: tt.max,
+			Window:      tt.window,
+			Burst:       tt.burst,
+			Clock:       NewFakeClock(time.Now()),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, ms := range tt.times {
+			if got := limiter.AllowAt(at(ms)); got != tt.want[i] {
+				t.Errorf("%s: request %d at %dms: expected %v, got %v", tt.name, i, ms, tt.want[i], got)
+			}
+		}
+	}
+}
+
+func TestAcquireNAtRejectsDecreasingTime(t *testing.T) {
+	limiter := NewRateLimiterDuration(5, time.Second)
+	now := time.Now()
+
+	if ok, err := limiter.AcquireNAt(now, 2); !ok || err != nil {
+		t.Fatalf("Expected the first acquisition to succeed, got %v, %v", ok, err)
+	}
+	if _, err := limiter.AcquireNAt(now.Add(-time.Millisecond), 1); !errors.Is(err, ErrTimeWentBackwards) {
+		t.Errorf("Expected ErrTimeWentBackwards, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected AllowAt to panic on a decreasing timestamp")
+		}
+	}()
+	limiter.AllowAt(now.Add(-time.Second))
+}
@@ -0,0 +1,61 @@
+// slidingwindow.go
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// SlidingWindowLimiter keeps a log of recent acquisition times and allows at
+// most maxRequests within any trailing window
+type SlidingWindowLimiter struct {
+	mu          sync.Mutex
+	maxRequests int
+	window      time.Duration
+	// log is a ring buffer of the last maxRequests acquisition times,
+	// holding count entries starting at head
+	log   []time.Time
+	head  int
+	count int
+	clock Clock
+}
+
+// NewSlidingWindowLimiter creates a limiter allowing maxRequests in any
+// trailing window of windowSeconds
+func NewSlidingWindowLimiter(maxRequests, windowSeconds int) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{
+		maxRequests: maxRequests,
+		window:      time.Duration(windowSeconds) * time.Second,
+		log:         make([]time.Time, maxRequests),
+		clock:       realClock{},
+	}
+}
+
+// pruneLocked drops timestamps that have fallen out of the trailing window
+func (sw *SlidingWindowLimiter) pruneLocked(now time.Time) {
+	for sw.count > 0 && now.Sub(sw.log[sw.head]) >= sw.window {
+		sw.head = (sw.head + 1) % len(sw.log)
+		sw.count--
+	}
+}
+
+// TryAcquire records an acquisition if fewer than maxRequests happened in
+// the trailing window
+func (sw *SlidingWindowLimiter) TryAcquire() bool {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	now := sw.clock.Now()
+	sw.pruneLocked(now)
+
+	if sw.count >= sw.maxRequests {
+		return false
+	}
+	sw.log[(sw.head+sw.count)%len(sw.log)] = now
+	sw.count++
+	return true
+}
+
+// Release is a no-op: an acquisition always counts against the trailing
+// window until it ages out
+func (sw *SlidingWindowLimiter) Release() {}
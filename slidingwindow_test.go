@@ -0,0 +1,72 @@
+// slidingwindow_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlidingWindowBoundaryBurst(t *testing.T) {
+	// The fixed window forgets everything at the boundary: 3 requests at
+	// the end of one window and 3 at the start of the next all succeed
+	clock := NewFakeClock(time.Now())
+	fixed := NewRateLimiter(3, 1, WithLimiterClock(clock))
+	clock.Advance(900 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if !fixed.TryAcquire() {
+			t.Fatalf("Fixed window acquisition %d should succeed", i+1)
+		}
+	}
+	clock.Advance(100 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if !fixed.TryAcquire() {
+			t.Fatalf("Fixed window allows a second burst right after the boundary, acquisition %d failed", i+1)
+		}
+	}
+
+	// The sliding window sees all 6 inside one trailing second
+	clock = NewFakeClock(time.Now())
+	sliding := NewSlidingWindowLimiter(3, 1)
+	sliding.clock = clock
+
+	clock.Advance(900 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if !sliding.TryAcquire() {
+			t.Fatalf("Sliding window acquisition %d should succeed", i+1)
+		}
+	}
+	clock.Advance(200 * time.Millisecond)
+	if sliding.TryAcquire() {
+		t.Error("Sliding window should deny a burst straddling the boundary")
+	}
+
+	// Once the earlier requests age out, capacity returns
+	clock.Advance(time.Second)
+	for i := 0; i < 3; i++ {
+		if !sliding.TryAcquire() {
+			t.Errorf("Acquisition %d after the window slid past should succeed", i+1)
+		}
+	}
+}
+
+func TestSlidingWindowPartialExpiry(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	sliding := NewSlidingWindowLimiter(2, 1)
+	sliding.clock = clock
+
+	sliding.TryAcquire()
+	clock.Advance(600 * time.Millisecond)
+	sliding.TryAcquire()
+	if sliding.TryAcquire() {
+		t.Fatal("Third acquisition within the window should fail")
+	}
+
+	// Only the first timestamp has expired
+	clock.Advance(500 * time.Millisecond)
+	if !sliding.TryAcquire() {
+		t.Error("Expiry of the oldest entry should free one slot")
+	}
+	if sliding.TryAcquire() {
+		t.Error("The second entry is still inside the window")
+	}
+}
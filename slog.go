@@ -0,0 +1,62 @@
+// slog.go
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// NewSlogLogger creates a logger that hands every message to h as a
+// slog.Record, with its level, its fields as attributes and the context of
+// the use it is about, so a resource logs through the handler the rest of
+// the program uses. Messages below the handler's level, or the logger's
+// if SetLevel raises it, are dropped before any record is built.
+func NewSlogLogger(h slog.Handler) *Logger {
+	l := &Logger{handler: h}
+	l.SetLevel(LevelDebug)
+	return l
+}
+
+// slogLevel is the slog.Level matching l
+func (l Level) slogLevel() slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// handle passes one message to the logger's slog.Handler
+func (l *Logger) handle(ctx context.Context, level Level, message string, fields []Field) {
+	record := slog.NewRecord(time.Now(), level.slogLevel(), message, 0)
+	if l.name != "" {
+		record.AddAttrs(slog.String("logger", l.name))
+	}
+	record.AddAttrs(slogAttrs(l.fields)...)
+	record.AddAttrs(slogAttrs(fields)...)
+	// A handler's error has nowhere better to go than its own output
+	_ = l.root().handler.Handle(ctx, record)
+}
+
+// slogAttrs converts fields to attributes, a group to a slog group
+func slogAttrs(fields []Field) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		switch v := f.Value.(type) {
+		case []Field:
+			attrs = append(attrs, slog.Attr{Key: f.Key, Value: slog.GroupValue(slogAttrs(v)...)})
+		case error:
+			attrs = append(attrs, slog.Any(f.Key, v))
+		case time.Time, time.Duration:
+			attrs = append(attrs, slog.Any(f.Key, v))
+		default:
+			attrs = append(attrs, slog.Any(f.Key, fieldValue(v)))
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,133 @@
+// slog_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// traceKey is the context key recordHandler picks trace IDs out of
+type traceKey struct{}
+
+// recordHandler is a slog.Handler keeping every record it is given, with
+// the trace ID of the context it came with
+type recordHandler struct {
+	mu      sync.Mutex
+	level   slog.Level
+	records []slog.Record
+	traces  []string
+}
+
+func (h *recordHandler) Enabled(_ context.Context, level slog.Level) bool { return level >= h.level }
+
+func (h *recordHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	trace, _ := ctx.Value(traceKey{}).(string)
+	h.records = append(h.records, r)
+	h.traces = append(h.traces, trace)
+	return nil
+}
+
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler      { return h }
+
+// attrs returns a record's attributes by key
+func attrs(r slog.Record) map[string]slog.Value {
+	m := make(map[string]slog.Value)
+	r.Attrs(func(a slog.Attr) bool {
+		m[a.Key] = a.Value
+		return true
+	})
+	return m
+}
+
+func TestSlogLoggerRecords(t *testing.T) {
+	h := &recordHandler{level: slog.LevelDebug}
+	resource := NewResource("db", 1, 60, WithLogger(NewSlogLogger(h).With(NewField("service", "orders"))),
+		WithMaxConcurrent(10), WithRateLimitMode(RateLimitFailFast))
+	defer resource.Close(context.Background())
+
+	ctx := context.WithValue(WithCaller(context.Background(), Caller{Name: "alice"}), traceKey{}, "trace-1")
+	resource.UseFunc(ctx, noWork)
+	err := resource.UseFunc(context.WithValue(WithCaller(context.Background(), Caller{Name: "bob"}), traceKey{}, "trace-2"), noWork)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	want := []struct {
+		level slog.Level
+		msg   string
+		trace string
+	}{
+		{slog.LevelInfo, "state changed", ""},
+		{slog.LevelInfo, "state changed", ""},
+		{slog.LevelDebug, "use acquired", "trace-1"},
+		{slog.LevelWarn, "use denied", "trace-2"},
+	}
+	if len(h.records) != len(want) {
+		t.Fatalf("Expected %d records, got %d", len(want), len(h.records))
+	}
+	for i, w := range want {
+		r := h.records[i]
+		if r.Level != w.level || r.Message != w.msg || h.traces[i] != w.trace {
+			t.Errorf("Expected record %d to be %v %q with trace %q, got %v %q with trace %q", i, w.level, w.msg, w.trace, r.Level, r.Message, h.traces[i])
+		}
+		if a := attrs(r); a["service"].String() != "orders" || a["resource"].String() != "db" {
+			t.Errorf("Expected record %d to carry the service and resource, got %v", i, a)
+		}
+	}
+
+	if a := attrs(h.records[1]); a["from"].String() != "initializing" || a["to"].String() != "ready" {
+		t.Errorf("Expected the transition to ready, got %v", a)
+	}
+	if a := attrs(h.records[2]); a["caller"].String() != "alice" || a["wait"].Kind() != slog.KindDuration {
+		t.Errorf("Expected alice's wait as a duration, got %v", a)
+	}
+	denied := attrs(h.records[3])["error"].Any()
+	if e, ok := denied.(error); !ok || !errors.Is(e, ErrRateLimited) || e.Error() != err.Error() {
+		t.Errorf("Expected the denial's error as an error attribute, got %v", denied)
+	}
+}
+
+func TestSlogLoggerHandlerLevel(t *testing.T) {
+	h := &recordHandler{level: slog.LevelWarn}
+	logger := NewSlogLogger(h)
+	if logger.Enabled(LevelInfo) || !logger.Enabled(LevelWarn) {
+		t.Error("Expected the handler's level to decide what is enabled")
+	}
+	logger.Info("dropped")
+	logger.SetLevel(LevelError)
+	logger.Warn("dropped too")
+	logger.Error("kept", GroupField("req", NewField("id", 7)), DurationField("took", time.Second))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.records) != 1 || h.records[0].Message != "kept" {
+		t.Fatalf("Expected only the error record, got %v", h.records)
+	}
+	req := attrs(h.records[0])["req"]
+	if req.Kind() != slog.KindGroup || req.Group()[0].Key != "id" || req.Group()[0].Value.Int64() != 7 {
+		t.Errorf("Expected the group as a slog group, got %v", req)
+	}
+}
+
+func ExampleNewSlogLogger() {
+	h := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	resource := NewResource("db", 10, 1, WithLogger(NewSlogLogger(h)))
+	resource.Close(context.Background())
+	// Output:
+	// level=INFO msg="state changed" resource=db from=uninitialized to=closing
+	// level=INFO msg="state changed" resource=db from=closing to=closed
+}
@@ -0,0 +1,76 @@
+// snapshot.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidSnapshot is returned when restoring a snapshot that no limiter
+// could have produced
+var ErrInvalidSnapshot = errors.New("rate limiter: invalid snapshot")
+
+// Snapshot is a RateLimiter's persistable state. It marshals to JSON as is,
+// with the window in nanoseconds.
+type Snapshot struct {
+	MaxRequests  int           `json:"max_requests"`
+	Burst        int           `json:"burst"`
+	Window       time.Duration `json:"window"`
+	Allowance    int           `json:"allowance"`
+	Current      int           `json:"current"`
+	ReservedNext int           `json:"reserved_next"`
+	LastReset    time.Time     `json:"last_reset"`
+}
+
+// Snapshot captures the limiter's configuration and current window so it
+// can survive a restart
+func (rl *RateLimiter) Snapshot() Snapshot {
+	rl.lock()
+	defer rl.unlock()
+
+	return Snapshot{
+		MaxRequests:  rl.maxRequests,
+		Burst:        rl.burst,
+		Window:       rl.window,
+		Allowance:    rl.allowance,
+		Current:      rl.currRequests,
+		ReservedNext: rl.reservedNext,
+		LastReset:    rl.lastReset,
+	}
+}
+
+// Restore loads the window usage saved in s. The limiter keeps its own
+// configuration: if s was taken with a different limit or burst, the saved
+// allowance is dropped in favour of the limiter's own and the usage is
+// clamped to it. A window that has expired by now is reset straight away,
+// so an old snapshot gives a clean window. Tokens that were held when s was
+// taken stay counted as used but can no longer be released.
+func (rl *RateLimiter) Restore(s Snapshot) error {
+	if s.Allowance < 0 || s.Current < 0 || s.ReservedNext < 0 {
+		return fmt.Errorf("%w: negative counts", ErrInvalidSnapshot)
+	}
+
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	now := rl.clock.Now()
+	if s.MaxRequests == rl.maxRequests && s.Burst == rl.burst {
+		rl.allowance = s.Allowance
+	}
+	rl.allowance = min(rl.allowance, rl.burst)
+	rl.currRequests = min(s.Current, rl.allowance)
+	rl.reservedNext = min(s.ReservedNext, rl.maxRequests)
+	// Rebuild the window start from now, so it keeps now's monotonic
+	// reading instead of the bare wall time the snapshot carries
+	rl.lastReset = now.Add(-max(now.Sub(s.LastReset), 0))
+
+	// Handles from before the restore belong to another window
+	rl.held = 0
+	rl.stale = 0
+	rl.epoch++
+
+	rl.dispatchLocked(now)
+	return nil
+}
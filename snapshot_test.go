@@ -0,0 +1,89 @@
+// snapshot_test.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestoreJSON(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(5, 60, WithLimiterClock(clock))
+	limiter.TryAcquireN(4)
+
+	data, err := json.Marshal(limiter.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted process picks up where the old one left off
+	clock.Advance(10 * time.Second)
+	restarted := NewRateLimiter(5, 60, WithLimiterClock(clock))
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	if n := restarted.Remaining(); n != 1 {
+		t.Errorf("Expected the restored window to have 1 left, got %d", n)
+	}
+	if d := restarted.NextReset().Sub(clock.Now()); d != 50*time.Second {
+		t.Errorf("Expected the restored window to end in 50s, got %v", d)
+	}
+}
+
+func TestRestoreExpiredSnapshot(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(5, 60, WithLimiterClock(clock))
+	limiter.TryAcquireN(5)
+	snap := limiter.Snapshot()
+
+	clock.Advance(2 * time.Minute)
+	restarted := NewRateLimiter(5, 60, WithLimiterClock(clock))
+	if err := restarted.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	if stats := restarted.Stats(); stats.Current != 0 || stats.UntilReset != time.Minute {
+		t.Errorf("Expected a clean window, got %+v", stats)
+	}
+	if n := restarted.Remaining(); n != 5 {
+		t.Errorf("Expected the full limit, got %d", n)
+	}
+}
+
+func TestRestoreDifferentLimit(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(10, 60, WithLimiterClock(clock))
+	limiter.TryAcquireN(8)
+	snap := limiter.Snapshot()
+
+	// The usage is clamped to the smaller limit rather than exceeding it
+	smaller := NewRateLimiter(5, 60, WithLimiterClock(clock))
+	if err := smaller.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	if stats := smaller.Stats(); stats.Current != 5 {
+		t.Errorf("Expected usage clamped to 5, got %d", stats.Current)
+	}
+	if smaller.TryAcquire() {
+		t.Error("Expected the smaller limit to be exhausted")
+	}
+
+	// A larger limit keeps its own allowance and the saved usage
+	larger := NewRateLimiter(20, 60, WithLimiterClock(clock))
+	if err := larger.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	if n := larger.Remaining(); n != 12 {
+		t.Errorf("Expected 12 left under the larger limit, got %d", n)
+	}
+
+	snap.Current = -1
+	if err := larger.Restore(snap); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("Expected ErrInvalidSnapshot, got %v", err)
+	}
+}
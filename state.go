@@ -0,0 +1,164 @@
+// state.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrIllegalTransition is returned for a state change the resource's state
+// machine doesn't allow
+var ErrIllegalTransition = errors.New("illegal resource state transition")
+
+// ResourceState is where a resource is in its life, see Resource.State
+type ResourceState int
+
+const (
+	// ResourceUninitialized resources initialize on their next use or
+	// Init. Resources start here and come back after a failed
+	// initialization or an idle teardown.
+	ResourceUninitialized ResourceState = iota
+	// ResourceInitializing resources are running their init
+	ResourceInitializing
+	// ResourceReady resources are initialized and serving uses
+	ResourceReady
+	// ResourceUnhealthy resources are initialized but failing their health
+	// check, so uses fail with ErrUnhealthy
+	ResourceUnhealthy
+	// ResourceClosing resources have been closed and are waiting for uses
+	// in flight to finish
+	ResourceClosing
+	// ResourceClosed resources have been torn down. No state follows.
+	ResourceClosed
+)
+
+func (s ResourceState) String() string {
+	switch s {
+	case ResourceUninitialized:
+		return "uninitialized"
+	case ResourceInitializing:
+		return "initializing"
+	case ResourceReady:
+		return "ready"
+	case ResourceUnhealthy:
+		return "unhealthy"
+	case ResourceClosing:
+		return "closing"
+	case ResourceClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("ResourceState(%d)", int(s))
+}
+
+// legalTransitions lists the states each state may move to
+var legalTransitions = map[ResourceState][]ResourceState{
+	ResourceUninitialized: {ResourceInitializing, ResourceClosing},
+	ResourceInitializing:  {ResourceReady, ResourceUnhealthy, ResourceUninitialized, ResourceClosing},
+	ResourceReady:         {ResourceUnhealthy, ResourceUninitialized, ResourceClosing},
+	ResourceUnhealthy:     {ResourceReady, ResourceUninitialized, ResourceClosing},
+	ResourceClosing:       {ResourceClosed},
+}
+
+// State returns the resource's current state. A resource failing its
+// health check only reports ResourceUnhealthy once it is initialized; before
+// that Health tells.
+func (r *Resource) State() ResourceState {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	return r.state
+}
+
+// WaitForState blocks until the resource is in state s or ctx is done. It
+// fails with ErrClosed if the resource closes before reaching s, as it can
+// never get there afterwards.
+func (r *Resource) WaitForState(ctx context.Context, s ResourceState) error {
+	for {
+		r.stateMu.Lock()
+		state := r.state
+		if r.stateChanged == nil {
+			r.stateChanged = make(chan struct{})
+		}
+		changed := r.stateChanged
+		r.stateMu.Unlock()
+
+		if state == s {
+			return nil
+		}
+		if state == ResourceClosed {
+			return fmt.Errorf("resource %s: %w before reaching %v", r.name, ErrClosed, s)
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// setState moves the resource to state to, logging the transition, or fails
+// with ErrIllegalTransition if the current state doesn't allow it. Moving
+// to ResourceReady while the health check is failing lands on
+// ResourceUnhealthy instead.
+func (r *Resource) setState(to ResourceState) error {
+	r.stateMu.Lock()
+	from := r.state
+	if to == ResourceReady && r.stateUnhealthy {
+		to = ResourceUnhealthy
+	}
+	if !transitionAllowed(from, to) {
+		r.stateMu.Unlock()
+		return fmt.Errorf("resource %s: %w %v -> %v", r.name, ErrIllegalTransition, from, to)
+	}
+	r.moveStateLocked(to)
+	r.stateMu.Unlock()
+
+	r.logStateChange(from, to)
+	return nil
+}
+
+// setStateHealth records the health check's verdict, moving an initialized
+// resource between ResourceReady and ResourceUnhealthy to match
+func (r *Resource) setStateHealth(healthy bool) {
+	r.stateMu.Lock()
+	r.stateUnhealthy = !healthy
+	from, to := r.state, r.state
+	switch {
+	case healthy && from == ResourceUnhealthy:
+		to = ResourceReady
+	case !healthy && from == ResourceReady:
+		to = ResourceUnhealthy
+	}
+	if to == from {
+		r.stateMu.Unlock()
+		return
+	}
+	r.moveStateLocked(to)
+	r.stateMu.Unlock()
+
+	r.logStateChange(from, to)
+}
+
+// moveStateLocked sets the state and wakes WaitForState callers
+func (r *Resource) moveStateLocked(to ResourceState) {
+	r.state = to
+	if r.stateChanged != nil {
+		close(r.stateChanged)
+		r.stateChanged = nil
+	}
+}
+
+func (r *Resource) logStateChange(from, to ResourceState) {
+	r.log(LevelInfo, "state changed", NewField("from", from), NewField("to", to))
+}
+
+// transitionAllowed reports whether legalTransitions lets from move to to
+func transitionAllowed(from, to ResourceState) bool {
+	for _, s := range legalTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
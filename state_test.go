@@ -0,0 +1,209 @@
+// state_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// stateRig drives a resource through its states
+type stateRig struct {
+	clock    *FakeClock
+	hc       *flakyCheck
+	resource *Resource
+	initErr  error
+	gate     chan struct{} // init waits on it while set
+	used     chan error    // the result of the use started by startInit
+}
+
+func newStateRig(opts ...Option) *stateRig {
+	rig := &stateRig{clock: NewFakeClock(time.Now()), hc: &flakyCheck{}}
+	rig.resource = NewResource("db", 100, 60, append([]Option{WithClock(rig.clock),
+		WithHealthCheck(rig.hc.check, time.Second), WithUnhealthyAfter(1),
+		WithIdleTimeout(time.Hour),
+		WithInit(func(context.Context) error {
+			if rig.gate != nil {
+				<-rig.gate
+			}
+			return rig.initErr
+		})}, opts...)...)
+	return rig
+}
+
+// settle waits for the health check to be waiting for its next tick,
+// alongside the idle timer if it is armed
+func (rig *stateRig) settle() {
+	rig.resource.closeMu.Lock()
+	timers := 1
+	if rig.resource.idleTimer != nil {
+		timers++
+	}
+	rig.resource.closeMu.Unlock()
+	rig.clock.BlockUntil(timers)
+}
+
+func (rig *stateRig) use() error {
+	err := rig.resource.UseFunc(context.Background(), noWork)
+	rig.settle()
+	return err
+}
+
+func (rig *stateRig) initOK()   { rig.use() }
+func (rig *stateRig) initFail() { rig.initErr = errors.New("connection refused"); rig.use() }
+
+// startInit begins a use whose init blocks until finishInit
+func (rig *stateRig) startInit() {
+	rig.gate = make(chan struct{})
+	rig.used = make(chan error, 1)
+	go func() { rig.used <- rig.resource.UseFunc(context.Background(), noWork) }()
+	rig.resource.WaitForState(context.Background(), ResourceInitializing)
+	rig.settle()
+}
+
+func (rig *stateRig) finishInit() {
+	close(rig.gate)
+	<-rig.used
+	rig.gate = nil
+}
+
+func (rig *stateRig) sicken() {
+	rig.hc.set(errors.New("ping timed out"))
+	rig.clock.Advance(time.Second)
+	rig.settle()
+}
+
+func (rig *stateRig) heal() {
+	rig.hc.set(nil)
+	rig.clock.Advance(time.Second)
+	rig.settle()
+}
+
+func (rig *stateRig) idle() {
+	rig.clock.Advance(time.Hour)
+	rig.settle()
+}
+
+// closeEarly closes the resource without waiting for the use in flight
+func (rig *stateRig) closeEarly() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	rig.resource.Close(ctx)
+}
+
+func (rig *stateRig) close() { rig.resource.Close(context.Background()) }
+
+type stateStep struct {
+	name string
+	do   func(*stateRig)
+	want ResourceState
+}
+
+var (
+	stepInitOK     = stateStep{"init", (*stateRig).initOK, ResourceReady}
+	stepInitFail   = stateStep{"failed init", (*stateRig).initFail, ResourceUninitialized}
+	stepStartInit  = stateStep{"start init", (*stateRig).startInit, ResourceInitializing}
+	stepSicken     = stateStep{"failed check", (*stateRig).sicken, ResourceUnhealthy}
+	stepHeal       = stateStep{"passed check", (*stateRig).heal, ResourceReady}
+	stepIdle       = stateStep{"idle", (*stateRig).idle, ResourceUninitialized}
+	stepCloseEarly = stateStep{"early close", (*stateRig).closeEarly, ResourceClosing}
+	stepClose      = stateStep{"close", (*stateRig).close, ResourceClosed}
+)
+
+func TestResourceStateTransitions(t *testing.T) {
+	logs := &CaptureWriter{}
+
+	// A check failing mid-init leaves the state alone until the init ends,
+	// and an init ending once the resource is closing leaves it closing
+	sickInit := stepSicken
+	sickInit.want = ResourceInitializing
+	unhealthyInit := stateStep{"finish init", (*stateRig).finishInit, ResourceUnhealthy}
+	closingInit := stateStep{"finish init", (*stateRig).finishInit, ResourceClosing}
+
+	paths := [][]stateStep{
+		{stepInitOK, stepClose},
+		{stepInitFail, stepClose},
+		{stepStartInit, sickInit, unhealthyInit, stepHeal, stepSicken, stepClose},
+		{stepInitOK, stepIdle, stepInitOK, stepSicken, stepIdle},
+		{stepStartInit, stepCloseEarly, closingInit, stepClose},
+	}
+	for i, path := range paths {
+		rig := newStateRig(WithLogger(NewLogger(logs)))
+		if s := rig.resource.State(); s != ResourceUninitialized {
+			t.Errorf("Path %d: expected a new resource to be uninitialized, got %v", i, s)
+		}
+		for _, step := range path {
+			step.do(rig)
+			if s := rig.resource.State(); s != step.want {
+				t.Errorf("Path %d: expected %v after %s, got %v", i, step.want, step.name, s)
+			}
+		}
+		rig.close()
+	}
+
+	// Between them the paths take every legal transition
+	seen := make(map[string]bool)
+	for _, m := range regexp.MustCompile(`msg="state changed" resource=db from=(\S+) to=(\S+)`).FindAllStringSubmatch(logs.String(), -1) {
+		seen[m[1]+" -> "+m[2]] = true
+	}
+	for from, tos := range legalTransitions {
+		for _, to := range tos {
+			if edge := fmt.Sprintf("%v -> %v", from, to); !seen[edge] {
+				t.Errorf("Expected the paths to take and log %s", edge)
+			}
+		}
+	}
+}
+
+func TestResourceIllegalTransition(t *testing.T) {
+	resource := NewResource("db", 100, 60)
+	if err := resource.setState(ResourceReady); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("Expected uninitialized -> ready to be rejected, got %v", err)
+	}
+	resource.Close(context.Background())
+	for _, s := range []ResourceState{ResourceUninitialized, ResourceInitializing, ResourceReady, ResourceUnhealthy, ResourceClosing} {
+		if err := resource.setState(s); !errors.Is(err, ErrIllegalTransition) {
+			t.Errorf("Expected closed -> %v to be rejected, got %v", s, err)
+		}
+	}
+	if s := resource.State(); s != ResourceClosed {
+		t.Errorf("Expected rejected transitions to leave the resource closed, got %v", s)
+	}
+}
+
+func TestResourceWaitForState(t *testing.T) {
+	resource := NewResource("db", 100, 60, WithInit(noWork))
+	ready := make(chan error, 1)
+	go func() { ready <- resource.WaitForState(context.Background(), ResourceReady) }()
+	time.Sleep(10 * time.Millisecond)
+	resource.Init(context.Background())
+	if err := <-ready; err != nil {
+		t.Errorf("Expected WaitForState to return once ready, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := resource.WaitForState(ctx, ResourceUnhealthy); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected WaitForState to give up with its context, got %v", err)
+	}
+
+	resource.Close(context.Background())
+	if err := resource.WaitForState(context.Background(), ResourceReady); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed waiting on a closed resource, got %v", err)
+	}
+	if err := resource.WaitForState(context.Background(), ResourceClosed); err != nil {
+		t.Errorf("Expected a closed resource to be closed, got %v", err)
+	}
+}
+
+func TestResourceStateString(t *testing.T) {
+	if s := ResourceUnhealthy.String(); s != "unhealthy" {
+		t.Errorf("Expected \"unhealthy\", got %q", s)
+	}
+	if s := ResourceState(42).String(); s != "ResourceState(42)" {
+		t.Errorf("Expected \"ResourceState(42)\", got %q", s)
+	}
+}
@@ -0,0 +1,123 @@
+// stats.go
+package main
+
+import "time"
+
+// LimiterStats is a point-in-time view of a RateLimiter
+type LimiterStats struct {
+	Acquired   uint64        // successful acquisitions since the last ResetStats
+	Denied     uint64        // refused TryAcquire calls since the last ResetStats
+	Current    int           // tokens held in the current window
+	UntilReset time.Duration // time left in the current window
+	Mode       Mode          // whether the limiter is paused, bypassed or normal
+	Waiters    int           // callers currently blocked in Acquire
+
+	// ExpiredLeases counts leases reclaimed at their TTL instead of being
+	// released, since the last ResetStats
+	ExpiredLeases uint64
+
+	// UnbalancedReleases counts tokens released without being held since
+	// the last ResetStats. It is only kept with ReleaseCount or ReleasePanic.
+	UnbalancedReleases uint64
+}
+
+// Stats returns the limiter's cumulative counters and current window usage
+func (rl *RateLimiter) Stats() LimiterStats {
+	rl.lock()
+	defer rl.unlock()
+
+	stats := LimiterStats{
+		Acquired:           rl.acquired,
+		Denied:             rl.denied,
+		UnbalancedReleases: rl.unbalanced,
+		Mode:               rl.mode,
+		Waiters:            rl.waiters.Len(),
+		ExpiredLeases:      rl.expiredLeases,
+	}
+	// A window that has expired but not yet been lazily reset is empty
+	now := rl.clock.Now()
+	if until := rl.windowStartLocked(now).Add(rl.window).Sub(now); until > 0 {
+		stats.Current = rl.currRequests
+		stats.UntilReset = until
+	}
+	return stats
+}
+
+// Limit returns the sustained requests allowed per window
+func (rl *RateLimiter) Limit() int {
+	rl.lock()
+	defer rl.unlock()
+
+	return rl.maxRequests
+}
+
+// ResetStats zeroes the cumulative counters without touching the window
+func (rl *RateLimiter) ResetStats() {
+	rl.lock()
+	defer rl.unlock()
+
+	rl.acquired = 0
+	rl.denied = 0
+	rl.unbalanced = 0
+	rl.expiredLeases = 0
+}
+
+// Remaining returns how many tokens can still be acquired in the current
+// window. A window that has expired but not yet been lazily reset reports
+// what the reset will make available. With WithCounterStore it is capped
+// by what the shared window had left at the store's last reply.
+func (rl *RateLimiter) Remaining() int {
+	rl.lock()
+	defer rl.unlock()
+
+	now := rl.clock.Now()
+	shared, _ := rl.sharedLeftLocked(now)
+	return min(rl.remainingLocked(now), shared)
+}
+
+// remainingLocked is Remaining for the local window alone
+func (rl *RateLimiter) remainingLocked(now time.Time) int {
+	if elapsed := now.Sub(rl.windowStartLocked(now)); elapsed >= rl.window {
+		return rl.earnedAllowanceLocked(elapsed)
+	}
+	if remaining := rl.allowance - rl.currRequests; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// NextReset returns when the current window ends. If it has already ended
+// but not yet been lazily reset, the next call starts a fresh window, so
+// the reset after that is reported.
+func (rl *RateLimiter) NextReset() time.Time {
+	rl.lock()
+	defer rl.unlock()
+
+	return rl.nextResetLocked(rl.clock.Now())
+}
+
+func (rl *RateLimiter) nextResetLocked(now time.Time) time.Time {
+	if end := rl.windowStartLocked(now).Add(rl.window); end.After(now) {
+		return end
+	}
+	return now.Add(rl.window)
+}
+
+// RetryAfter returns how long until a token may next be available: zero if
+// one is available now, otherwise the time until the window resets. With
+// WithCounterStore a shared window the store reported full counts as well,
+// until it resets.
+func (rl *RateLimiter) RetryAfter() time.Duration {
+	rl.lock()
+	defer rl.unlock()
+
+	now := rl.clock.Now()
+	var wait time.Duration
+	if rl.remainingLocked(now) == 0 {
+		wait = rl.nextResetLocked(now).Sub(now)
+	}
+	if left, reset := rl.sharedLeftLocked(now); left == 0 {
+		wait = max(wait, reset)
+	}
+	return wait
+}
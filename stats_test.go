@@ -0,0 +1,101 @@
+// stats_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterStats(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(3, 60, WithLimiterClock(clock))
+	for i := 0; i < 5; i++ {
+		limiter.TryAcquire()
+	}
+	limiter.Release()
+
+	stats := limiter.Stats()
+	if stats.Acquired != 3 || stats.Denied != 2 {
+		t.Errorf("Expected 3 acquired and 2 denied, got %d and %d", stats.Acquired, stats.Denied)
+	}
+	if stats.Current != 2 {
+		t.Errorf("Expected 2 tokens in the window, got %d", stats.Current)
+	}
+	clock.Advance(15 * time.Second)
+	if until := limiter.Stats().UntilReset; until != 45*time.Second {
+		t.Errorf("Expected 45s until reset, got %v", until)
+	}
+}
+
+func TestRateLimiterResetStats(t *testing.T) {
+	limiter := NewRateLimiter(1, 60)
+	limiter.TryAcquire()
+	limiter.TryAcquire()
+
+	limiter.ResetStats()
+	stats := limiter.Stats()
+	if stats.Acquired != 0 || stats.Denied != 0 {
+		t.Errorf("Expected zeroed counters, got %d acquired and %d denied", stats.Acquired, stats.Denied)
+	}
+	if stats.Current != 1 {
+		t.Errorf("ResetStats must not affect the live window, got current %d", stats.Current)
+	}
+	if limiter.TryAcquire() {
+		t.Error("The window should still be full after ResetStats")
+	}
+}
+
+func TestRateLimiterStatsExpiredWindow(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(2, 1, WithLimiterClock(clock))
+	limiter.TryAcquireN(2)
+	limiter.lastReset = limiter.lastReset.Add(-2 * time.Second)
+
+	stats := limiter.Stats()
+	if stats.Current != 0 || stats.UntilReset != 0 {
+		t.Errorf("Expected an expired window to report empty, got current %d and %v until reset", stats.Current, stats.UntilReset)
+	}
+}
+
+func TestRateLimiterRemaining(t *testing.T) {
+	limiter := NewRateLimiter(3, 60)
+	if n := limiter.Remaining(); n != 3 {
+		t.Errorf("Expected 3 remaining, got %d", n)
+	}
+	limiter.TryAcquireN(2)
+	if n := limiter.Remaining(); n != 1 {
+		t.Errorf("Expected 1 remaining, got %d", n)
+	}
+
+	// Shrinking below the current count clamps at zero
+	limiter.SetLimit(1)
+	if n := limiter.Remaining(); n != 0 {
+		t.Errorf("Expected remaining to clamp at 0, got %d", n)
+	}
+}
+
+func TestRateLimiterRemainingLazyReset(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(3, 1, WithLimiterClock(clock))
+	limiter.TryAcquireN(3)
+	start := clock.Now()
+
+	if n := limiter.Remaining(); n != 0 {
+		t.Fatalf("Expected a full window to have 0 remaining, got %d", n)
+	}
+	if reset := limiter.NextReset(); !reset.Equal(start.Add(time.Second)) {
+		t.Errorf("Expected reset at the end of the window, got %v", reset.Sub(start))
+	}
+
+	// The window is over but no call has reset it yet
+	clock.Advance(2 * time.Second)
+	if n := limiter.Remaining(); n != 3 {
+		t.Errorf("Expected an expired window to report the full limit, got %d", n)
+	}
+	if reset := limiter.NextReset(); !reset.Equal(clock.Now().Add(time.Second)) {
+		t.Errorf("Expected the next reset one window from now, got %v", reset.Sub(clock.Now()))
+	}
+	if !limiter.TryAcquireN(3) {
+		t.Error("The reported remaining tokens should be acquirable")
+	}
+}
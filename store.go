@@ -0,0 +1,230 @@
+// store.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CounterStore holds fixed-window counters, possibly shared between
+// processes so several replicas can enforce one limit
+type CounterStore interface {
+	// IncrWithinWindow adds n to key's counter, starting a new window of
+	// length window if none is active, and returns the new count and the
+	// time left in the window
+	IncrWithinWindow(ctx context.Context, key string, n int64, window time.Duration) (int64, time.Duration, error)
+	// Get returns key's count in the active window, or zero if none
+	Get(ctx context.Context, key string) (int64, error)
+	// Reset drops key's counter
+	Reset(ctx context.Context, key string) error
+}
+
+// MemoryStore is an in-process CounterStore
+type MemoryStore struct {
+	mu       sync.Mutex
+	clock    Clock
+	counters map[string]*memoryCounter
+}
+
+type memoryCounter struct {
+	count   int64
+	expires time.Time
+}
+
+// NewMemoryStore creates an empty in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		clock:    realClock{},
+		counters: make(map[string]*memoryCounter),
+	}
+}
+
+// IncrWithinWindow implements CounterStore
+func (ms *MemoryStore) IncrWithinWindow(ctx context.Context, key string, n int64, window time.Duration) (int64, time.Duration, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := ms.clock.Now()
+	c, ok := ms.counters[key]
+	if !ok || !now.Before(c.expires) {
+		c = &memoryCounter{expires: now.Add(window)}
+		ms.counters[key] = c
+	}
+	c.count += n
+	return c.count, c.expires.Sub(now), nil
+}
+
+// Get implements CounterStore
+func (ms *MemoryStore) Get(ctx context.Context, key string) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if c, ok := ms.counters[key]; ok && ms.clock.Now().Before(c.expires) {
+		return c.count, nil
+	}
+	return 0, nil
+}
+
+// Reset implements CounterStore
+func (ms *MemoryStore) Reset(ctx context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.counters, key)
+	return nil
+}
+
+// StoreLimiter is a fixed-window limiter whose counts live in a
+// CounterStore. Every attempt counts against the window, so Release is a
+// no-op.
+type StoreLimiter struct {
+	store       CounterStore
+	key         string
+	maxRequests int64
+	window      time.Duration
+	failOpen    bool
+	timeout     time.Duration
+}
+
+// StoreOption configures a StoreLimiter
+type StoreOption func(*StoreLimiter)
+
+// WithFailOpen sets whether requests are allowed (true) or denied (false,
+// the default) when the store can't be reached
+func WithFailOpen(failOpen bool) StoreOption {
+	return func(sl *StoreLimiter) {
+		sl.failOpen = failOpen
+	}
+}
+
+// WithStoreTimeout bounds each store call made by TryAcquire
+func WithStoreTimeout(d time.Duration) StoreOption {
+	return func(sl *StoreLimiter) {
+		sl.timeout = d
+	}
+}
+
+// NewStoreLimiter creates a limiter allowing maxRequests per window for key
+// in store. If store is nil an in-process MemoryStore is used.
+func NewStoreLimiter(store CounterStore, key string, maxRequests int, window time.Duration, opts ...StoreOption) *StoreLimiter {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	sl := &StoreLimiter{
+		store:       store,
+		key:         key,
+		maxRequests: int64(maxRequests),
+		window:      window,
+		timeout:     time.Second,
+	}
+	for _, opt := range opts {
+		opt(sl)
+	}
+	return sl
+}
+
+// AllowContext counts a request against the window. When the store fails
+// the outcome follows the fail-open setting and the error is returned
+// alongside it.
+func (sl *StoreLimiter) AllowContext(ctx context.Context) (bool, time.Duration, error) {
+	count, ttl, err := sl.store.IncrWithinWindow(ctx, sl.key, 1, sl.window)
+	if err != nil {
+		return sl.failOpen, 0, fmt.Errorf("counter store: %w", err)
+	}
+	if count > sl.maxRequests {
+		return false, ttl, nil
+	}
+	return true, 0, nil
+}
+
+// Allow counts a request against the window and, on denial, reports the
+// time left until it resets
+func (sl *StoreLimiter) Allow() (bool, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), sl.timeout)
+	defer cancel()
+
+	ok, retryAfter, _ := sl.AllowContext(ctx)
+	return ok, retryAfter
+}
+
+// TryAcquire counts a request against the window
+func (sl *StoreLimiter) TryAcquire() bool {
+	ok, _ := sl.Allow()
+	return ok
+}
+
+// Release is a no-op: shared windows count requests, not concurrency
+func (sl *StoreLimiter) Release() {}
+
+// WithCounterStore runs the limiter's window against key in store as well,
+// so replicas sharing the store share one limit of maxRequests per window.
+// Tokens taken from the local window are then counted in the store, outside
+// the limiter's lock, and given back if the store's count passes the limit;
+// Remaining and RetryAfter take the store's last reply into account. The
+// fast path is off, since every acquisition waits on the store. Reserve and
+// AcquireNAt only count locally. If store is nil an in-process MemoryStore
+// is used. The StoreOptions set the failure mode and the timeout of each
+// call.
+func WithCounterStore(store CounterStore, key string, opts ...StoreOption) LimiterOption {
+	return func(rl *RateLimiter) {
+		rl.shared = NewStoreLimiter(store, key, 0, 0, opts...)
+	}
+}
+
+// commitShared counts n tokens, taken from window epoch under the lock,
+// against the shared window, if there is one. It must be called without
+// the lock held and with events fired afterwards. If the store refuses the
+// tokens they are given back, and the attempt counts as a denial instead of
+// an acquisition if counted says it was one. The error is the store's, when
+// it couldn't be reached.
+func (rl *RateLimiter) commitShared(n int, epoch uint64, counted bool) (bool, error) {
+	if rl.shared == nil {
+		return true, nil
+	}
+	rl.lock()
+	bypass, limit, window := rl.mode == ModeBypass, rl.maxRequests, rl.window
+	rl.unlock()
+	if bypass {
+		return true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rl.shared.timeout)
+	count, ttl, err := rl.shared.store.IncrWithinWindow(ctx, rl.shared.key, int64(n), window)
+	cancel()
+
+	rl.lock()
+	defer rl.unlock()
+
+	now := rl.clock.Now()
+	ok := rl.shared.failOpen
+	if err != nil {
+		err = fmt.Errorf("counter store: %w", err)
+	} else {
+		rl.sharedCount, rl.sharedEnd = count, now.Add(ttl)
+		ok = count <= int64(limit)
+	}
+	if ok {
+		return true, err
+	}
+
+	rl.releaseEpochLocked(n, epoch)
+	if counted {
+		rl.acquired--
+	}
+	rl.denied++
+	rl.queueEventLocked(limiterEvent{now: now, current: rl.currRequests, max: rl.allowance})
+	rl.dispatchLocked(now)
+	return false, err
+}
+
+// sharedLeftLocked returns how many tokens the shared window had left as
+// of the store's last reply, or the burst if that window is over or there
+// is none, and how long it has to run
+func (rl *RateLimiter) sharedLeftLocked(now time.Time) (int, time.Duration) {
+	if rl.shared == nil || !now.Before(rl.sharedEnd) {
+		return rl.burst, 0
+	}
+	return int(max(int64(rl.maxRequests)-rl.sharedCount, 0)), rl.sharedEnd.Sub(now)
+}
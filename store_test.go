@@ -0,0 +1,255 @@
+// store_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStoreLimiterMemory(t *testing.T) {
+	store := NewMemoryStore()
+	clock := NewFakeClock(time.Now())
+	store.clock = clock
+
+	// Two limiters on the same key share one budget, like two replicas
+	a := NewStoreLimiter(store, "api", 3, time.Second)
+	b := NewStoreLimiter(store, "api", 3, time.Second)
+
+	if !a.TryAcquire() || !b.TryAcquire() || !a.TryAcquire() {
+		t.Fatal("The first 3 requests across both limiters should succeed")
+	}
+	ok, retryAfter := b.Allow()
+	if ok {
+		t.Error("The 4th request should be denied by the shared count")
+	}
+	if retryAfter != time.Second {
+		t.Errorf("Expected retry after 1s, got %v", retryAfter)
+	}
+
+	clock.Advance(time.Second)
+	if !b.TryAcquire() {
+		t.Error("A new window should allow requests again")
+	}
+	if n, _ := store.Get(context.Background(), "api"); n != 1 {
+		t.Errorf("Expected a count of 1 in the new window, got %d", n)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) IncrWithinWindow(context.Context, string, int64, time.Duration) (int64, time.Duration, error) {
+	return 0, 0, errors.New("connection refused")
+}
+
+func (failingStore) Get(context.Context, string) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+func (failingStore) Reset(context.Context, string) error {
+	return errors.New("connection refused")
+}
+
+func TestStoreLimiterFailureMode(t *testing.T) {
+	closed := NewStoreLimiter(failingStore{}, "api", 10, time.Second)
+	if closed.TryAcquire() {
+		t.Error("Fail-closed limiter should deny when the store is down")
+	}
+	if _, _, err := closed.AllowContext(context.Background()); err == nil {
+		t.Error("Expected the store error to be reported")
+	}
+
+	open := NewStoreLimiter(failingStore{}, "api", 10, time.Second, WithFailOpen(true))
+	if !open.TryAcquire() {
+		t.Error("Fail-open limiter should allow when the store is down")
+	}
+}
+
+// fakeRedis emulates the scripts RedisStore sends
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]int64
+	ttls   map[string]int64
+}
+
+func (f *fakeRedis) Eval(ctx context.Context, script string, keys []string, args ...any) (any, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := keys[0]
+	switch script {
+	case incrScript:
+		f.values[key] += args[0].(int64)
+		if _, ok := f.ttls[key]; !ok {
+			f.ttls[key] = args[1].(int64)
+		}
+		return []any{f.values[key], f.ttls[key]}, nil
+	case getScript:
+		v, ok := f.values[key]
+		if !ok {
+			return nil, nil
+		}
+		return strconv.FormatInt(v, 10), nil
+	case resetScript:
+		delete(f.values, key)
+		delete(f.ttls, key)
+		return int64(1), nil
+	}
+	return nil, errors.New("unknown script")
+}
+
+func TestRedisStore(t *testing.T) {
+	redis := &fakeRedis{values: map[string]int64{}, ttls: map[string]int64{}}
+	store := NewRedisStore(redis, "limits:")
+	ctx := context.Background()
+
+	count, ttl, err := store.IncrWithinWindow(ctx, "api", 2, 1500*time.Millisecond)
+	if err != nil || count != 2 || ttl != 1500*time.Millisecond {
+		t.Fatalf("Expected count 2 and ttl 1.5s, got %d, %v, %v", count, ttl, err)
+	}
+	if _, ok := redis.values["limits:api"]; !ok {
+		t.Error("Expected the key to be prefixed")
+	}
+	if n, err := store.Get(ctx, "api"); err != nil || n != 2 {
+		t.Errorf("Expected Get to return 2, got %d, %v", n, err)
+	}
+	if err := store.Reset(ctx, "api"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := store.Get(ctx, "api"); err != nil || n != 0 {
+		t.Errorf("Expected 0 after Reset, got %d, %v", n, err)
+	}
+
+	limiter := NewStoreLimiter(store, "api", 1, time.Second)
+	if !limiter.TryAcquire() || limiter.TryAcquire() {
+		t.Error("Expected the Redis-backed limiter to allow exactly 1 request")
+	}
+}
+
+func TestRateLimiterCounterStore(t *testing.T) {
+	store := NewMemoryStore()
+	clock := NewFakeClock(time.Now())
+	store.clock = clock
+
+	// Two replicas with room for 3 each locally, sharing a limit of 3
+	a := NewRateLimiterDuration(3, time.Second, WithLimiterClock(clock), WithCounterStore(store, "api"))
+	b := NewRateLimiterDuration(3, time.Second, WithLimiterClock(clock), WithCounterStore(store, "api"))
+
+	if !a.TryAcquire() || !b.TryAcquire() || !a.TryAcquire() {
+		t.Fatal("The first 3 requests across both limiters should succeed")
+	}
+	if b.TryAcquire() {
+		t.Error("The 4th request should be denied by the shared window")
+	}
+	if s := b.Stats(); s.Denied != 1 || s.Current != 1 {
+		t.Errorf("Expected the shared denial to count as 1 denial and give its token back, got %d denied and %d held", s.Denied, s.Current)
+	}
+	if n, wait := b.Remaining(), b.RetryAfter(); n != 0 || wait != time.Second {
+		t.Errorf("Expected the shared window to leave 0 remaining for 1s, got %d for %v", n, wait)
+	}
+
+	clock.Advance(time.Second)
+	if !b.TryAcquire() {
+		t.Error("A new window should allow requests again")
+	}
+	if n, _ := store.Get(context.Background(), "api"); n != 1 {
+		t.Errorf("Expected a count of 1 in the new window, got %d", n)
+	}
+}
+
+func TestRateLimiterCounterStoreAcquireWaits(t *testing.T) {
+	store := NewMemoryStore()
+	clock := NewFakeClock(time.Now())
+	store.clock = clock
+	a := NewRateLimiterDuration(1, time.Minute, WithLimiterClock(clock), WithCounterStore(store, "api"))
+	b := NewRateLimiterDuration(1, time.Minute, WithLimiterClock(clock), WithCounterStore(store, "api"))
+	a.TryAcquire()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Acquire(context.Background()) }()
+	for {
+		clock.mu.Lock()
+		pending := len(clock.pending)
+		clock.mu.Unlock()
+		if pending > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Expected Acquire to wait for the shared window, got %v", err)
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	if err := <-done; err != nil {
+		t.Errorf("Expected Acquire to succeed once the shared window reset, got %v", err)
+	}
+}
+
+// slowStore blocks every increment until release is closed
+type slowStore struct {
+	*MemoryStore
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *slowStore) IncrWithinWindow(ctx context.Context, key string, n int64, window time.Duration) (int64, time.Duration, error) {
+	s.entered <- struct{}{}
+	<-s.release
+	return s.MemoryStore.IncrWithinWindow(ctx, key, n, window)
+}
+
+func TestRateLimiterCounterStoreOutsideLock(t *testing.T) {
+	store := &slowStore{MemoryStore: NewMemoryStore(), entered: make(chan struct{}), release: make(chan struct{})}
+	limiter := NewRateLimiterDuration(5, time.Minute, WithCounterStore(store, "api"))
+
+	done := make(chan bool)
+	go func() { done <- limiter.TryAcquire() }()
+	<-store.entered
+
+	// The limiter mustn't be locked while the store is slow
+	if s := limiter.Stats(); s.Current != 1 {
+		t.Errorf("Expected the token to be held while the store answers, got %d", s.Current)
+	}
+	if n := limiter.Remaining(); n != 4 {
+		t.Errorf("Expected 4 remaining while the store answers, got %d", n)
+	}
+
+	close(store.release)
+	if !<-done {
+		t.Error("Expected the store to allow the acquisition")
+	}
+}
+
+func TestRateLimiterCounterStoreFailureMode(t *testing.T) {
+	closed := NewRateLimiterDuration(10, time.Second, WithCounterStore(failingStore{}, "api"))
+	if closed.TryAcquire() {
+		t.Error("Fail-closed limiter should deny when the store is down")
+	}
+	if _, err := closed.Prefetch(2); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected Prefetch to be rate limited, got %v", err)
+	}
+
+	open := NewRateLimiterDuration(10, time.Second, WithCounterStore(failingStore{}, "api", WithFailOpen(true)))
+	if !open.TryAcquire() {
+		t.Error("Fail-open limiter should allow when the store is down")
+	}
+}
+
+func TestRedisStoreSubMillisecondWindow(t *testing.T) {
+	redis := &fakeRedis{values: map[string]int64{}, ttls: map[string]int64{}}
+	store := NewRedisStore(redis, "")
+
+	_, ttl, err := store.IncrWithinWindow(context.Background(), "api", 1, 500*time.Microsecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redis.ttls["api"] != 1 || ttl != time.Millisecond {
+		t.Errorf("Expected the TTL to be raised to 1ms, got %dms", redis.ttls["api"])
+	}
+}
@@ -0,0 +1,193 @@
+// suppress.go
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// suppressor collapses repeats of a message within a window, see
+// Logger.SetSuppression
+type suppressor struct {
+	window  time.Duration
+	maxKeys int
+	clock   Clock
+
+	mu      sync.Mutex
+	entries map[suppressKey]*list.Element
+	order   list.List // of *suppressed, oldest first
+}
+
+// suppressKey is what makes two messages the same: their level and message
+// and the resource and caller they are about
+type suppressKey struct {
+	level    Level
+	message  string
+	resource string
+	caller   string
+}
+
+// suppressed is a message seen in the current window and how many times it
+// has repeated since
+type suppressed struct {
+	key     suppressKey
+	logger  *Logger
+	fields  []Field // the resource and caller fields, for the summary
+	repeats int
+	timer   Timer
+}
+
+// SetSuppression collapses repeats of a message: the first time a level
+// and message are logged about a resource and caller the line is written,
+// but repeats within window are only counted, and once the window ends a
+// summary line says how many times it repeated. Other fields don't tell
+// messages apart, so two state changes of a resource within the window
+// count as a repeat. At most maxKeys messages
+// are tracked at once; a new one beyond that ends the oldest's window
+// early. A window of zero or less turns suppression off. It applies to the
+// logger and every logger With made from it or it was made from.
+func (l *Logger) SetSuppression(window time.Duration, maxKeys int) {
+	root := l.root()
+	var s *suppressor
+	if window > 0 {
+		s = &suppressor{
+			window:  window,
+			maxKeys: max(maxKeys, 1),
+			clock:   root.clock(),
+			entries: make(map[suppressKey]*list.Element),
+		}
+	}
+	if old := root.suppress.Swap(s); old != nil {
+		old.flush()
+	}
+}
+
+// SetSampling makes the logger write only the first of every n messages it
+// would otherwise write, counting across every logger With made from it or
+// it was made from. Suppression summaries are always written. An n of one
+// or less writes every message.
+func (l *Logger) SetSampling(n int) {
+	root := l.root()
+	root.sampleEvery.Store(int64(n))
+	root.sampled.Store(0)
+}
+
+// clock is the root logger's clock, for suppression windows
+func (l *Logger) clock() Clock {
+	if l.suppressClock != nil {
+		return l.suppressClock
+	}
+	return realClock{}
+}
+
+// admit reports whether a message that passed the level check should be
+// written, applying sampling then suppression
+func (l *Logger) admit(level Level, message string, fields []Field) bool {
+	root := l.root()
+	if n := root.sampleEvery.Load(); n > 1 && (root.sampled.Add(1)-1)%uint64(n) != 0 {
+		return false
+	}
+	if s := root.suppress.Load(); s != nil {
+		return s.admit(l, level, message, fields)
+	}
+	return true
+}
+
+// admit counts a message, reporting whether it is the first in its window
+func (s *suppressor) admit(l *Logger, level Level, message string, fields []Field) bool {
+	key := suppressKey{level: level, message: message}
+	var keyFields []Field // those l doesn't add itself
+	for i, f := range append(append([]Field(nil), l.fields...), fields...) {
+		switch f.Key {
+		case "resource":
+			key.resource = fmt.Sprint(fieldValue(f.Value))
+		case "caller":
+			key.caller = fmt.Sprint(fieldValue(f.Value))
+		default:
+			continue
+		}
+		if i >= len(l.fields) {
+			keyFields = append(keyFields, f)
+		}
+	}
+
+	s.mu.Lock()
+	if e, ok := s.entries[key]; ok {
+		e.Value.(*suppressed).repeats++
+		s.mu.Unlock()
+		return false
+	}
+	var evicted *suppressed
+	if s.order.Len() >= s.maxKeys {
+		evicted = s.removeLocked(s.order.Front())
+	}
+	m := &suppressed{key: key, logger: l, fields: keyFields}
+	s.entries[key] = s.order.PushBack(m)
+	m.timer = s.clock.AfterFunc(s.window, func() { s.expire(m) })
+	s.mu.Unlock()
+
+	evicted.summarize()
+	return true
+}
+
+// expire ends m's window, if it is still tracked
+func (s *suppressor) expire(m *suppressed) {
+	s.mu.Lock()
+	e, ok := s.entries[m.key]
+	if !ok || e.Value != m {
+		s.mu.Unlock()
+		return
+	}
+	s.removeLocked(e)
+	s.mu.Unlock()
+	m.summarize()
+}
+
+// flush ends every window, for a suppressor being replaced
+func (s *suppressor) flush() {
+	s.mu.Lock()
+	var ended []*suppressed
+	for s.order.Len() > 0 {
+		ended = append(ended, s.removeLocked(s.order.Front()))
+	}
+	s.mu.Unlock()
+	for _, m := range ended {
+		m.summarize()
+	}
+}
+
+// removeLocked stops tracking e's message and returns it
+func (s *suppressor) removeLocked(e *list.Element) *suppressed {
+	m := s.order.Remove(e).(*suppressed)
+	delete(s.entries, m.key)
+	m.timer.Stop()
+	return m
+}
+
+// summarize writes how many times m repeated in its window, if it did
+func (m *suppressed) summarize() {
+	if m == nil || m.repeats == 0 {
+		return
+	}
+	message := fmt.Sprintf("%s (repeated %s times)", m.key.message, groupThousands(m.repeats))
+	fields := append(append([]Field(nil), m.fields...), NewField("repeated", m.repeats))
+	m.logger.write(context.Background(), m.key.level, message, fields)
+}
+
+// groupThousands formats n with commas between groups of three digits
+func groupThousands(n int) string {
+	s := strconv.Itoa(n)
+	start := len(s) % 3
+	if start == 0 {
+		start = 3
+	}
+	out := s[:start]
+	for i := start; i < len(s); i += 3 {
+		out += "," + s[i:i+3]
+	}
+	return out
+}
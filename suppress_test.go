@@ -0,0 +1,151 @@
+// suppress_test.go
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSuppressingLogger returns a logger suppressing repeats within a
+// minute of clock, and what it writes
+func newSuppressingLogger(maxKeys int) (*Logger, *CaptureWriter, *FakeClock) {
+	logs := &CaptureWriter{}
+	clock := NewFakeClock(time.Now())
+	logger := NewLogger(logs)
+	logger.suppressClock = clock
+	logger.SetSuppression(time.Minute, maxKeys)
+	return logger, logs, clock
+}
+
+func TestSuppressionCollapsesRepeats(t *testing.T) {
+	logger, logs, clock := newSuppressingLogger(16)
+	db := logger.With(ResourceField("db"))
+	for i := 0; i < 10000; i++ {
+		db.Warn("use denied", CallerField(Caller{Name: "alice"}), NewField("n", i))
+	}
+	if lines := logs.Lines(); len(lines) != 1 || !strings.Contains(lines[0], "n=0") {
+		t.Fatalf("Expected only the first denial written straight away, got %d lines", len(lines))
+	}
+
+	clock.Advance(time.Minute)
+	lines := logs.Lines()
+	want := `level=WARN msg="use denied (repeated 9,999 times)" resource=db caller=alice repeated=9999`
+	if len(lines) != 2 || !strings.HasSuffix(lines[1], want) {
+		t.Fatalf("Expected a summary ending %q at the window's end, got %q", want, lines)
+	}
+
+	// The next window starts afresh, and one without repeats needs no summary
+	db.Warn("use denied", CallerField(Caller{Name: "alice"}))
+	clock.Advance(time.Minute)
+	if n := len(logs.Lines()); n != 3 {
+		t.Errorf("Expected the new window's first line and no summary, got %d lines", n)
+	}
+}
+
+func TestSuppressionKeysByResourceAndCaller(t *testing.T) {
+	logger, logs, clock := newSuppressingLogger(16)
+	for i := 0; i < 3; i++ {
+		logger.Warn("use denied", ResourceField("db"), CallerField(Caller{Name: "alice"}))
+		logger.Warn("use denied", ResourceField("db"), CallerField(Caller{Name: "bob"}))
+		logger.Warn("use denied", ResourceField("cache"), CallerField(Caller{Name: "alice"}))
+		logger.Error("use denied", ResourceField("db"), CallerField(Caller{Name: "alice"}))
+		logger.Warn("unhealthy", ResourceField("db"))
+	}
+	if n := len(logs.Lines()); n != 5 {
+		t.Fatalf("Expected each resource, caller, level and message once, got %d lines", n)
+	}
+	clock.Advance(time.Minute)
+	summaries := logs.Lines()[5:]
+	if len(summaries) != 5 {
+		t.Fatalf("Expected a summary for each, got %q", summaries)
+	}
+	for _, s := range summaries {
+		if !strings.Contains(s, "(repeated 2 times)") {
+			t.Errorf("Expected 2 repeats, got %q", s)
+		}
+	}
+}
+
+func TestSuppressionBoundsItsTable(t *testing.T) {
+	logger, logs, clock := newSuppressingLogger(2)
+	for _, name := range []string{"alice", "alice", "bob", "bob", "carol"} {
+		logger.Warn("use denied", CallerField(Caller{Name: name}))
+	}
+	// Tracking carol ended alice's window early
+	lines := logs.Lines()
+	if len(lines) != 4 || !strings.Contains(lines[2], `msg="use denied (repeated 1 times)" caller=alice`) {
+		t.Fatalf("Expected alice's summary when carol evicted her, got %q", lines)
+	}
+	s := logger.suppress.Load()
+	s.mu.Lock()
+	tracked := len(s.entries)
+	s.mu.Unlock()
+	if tracked != 2 {
+		t.Errorf("Expected at most 2 messages tracked, got %d", tracked)
+	}
+
+	clock.Advance(time.Minute)
+	if lines := logs.Lines(); len(lines) != 5 || !strings.Contains(lines[4], "caller=bob") {
+		t.Errorf("Expected only bob to need a summary, got %q", lines)
+	}
+	clock.mu.Lock()
+	pending := len(clock.pending)
+	clock.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("Expected no windows left open, %d timers pending", pending)
+	}
+}
+
+func TestSuppressionTurnedOffFlushes(t *testing.T) {
+	logger, logs, _ := newSuppressingLogger(16)
+	logger.Info("tick")
+	logger.Info("tick")
+	logger.SetSuppression(0, 0)
+	logger.Info("tick")
+	lines := logs.Lines()
+	if len(lines) != 3 || !strings.Contains(lines[1], "repeated 1 times") || !strings.Contains(lines[2], "msg=tick") {
+		t.Errorf("Expected the summary on turning suppression off, then every line, got %q", lines)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	logs := &CaptureWriter{}
+	logger := NewLogger(logs)
+	logger.SetSampling(3)
+	for i := 0; i < 9; i++ {
+		logger.With(ResourceField("db")).Info("tick", NewField("n", i))
+	}
+	lines := logs.Lines()
+	if len(lines) != 3 || lineN(lines[0]) != 0 || lineN(lines[1]) != 3 || lineN(lines[2]) != 6 {
+		t.Errorf("Expected 1 in every 3 lines, got %q", lines)
+	}
+	logger.SetSampling(1)
+	logger.Info("tick", NewField("n", 9))
+	if n := len(logs.Lines()); n != 4 {
+		t.Errorf("Expected every line once sampling is off, got %d", n)
+	}
+}
+
+func TestResourceDenialsSuppressed(t *testing.T) {
+	logger, logs, clock := newSuppressingLogger(16)
+	resource := NewResource("db", 1, 60, WithLogger(logger), WithMaxConcurrent(10), WithBulkheadMode(BulkheadFailFast))
+	defer resource.Close(context.Background())
+	resource.Use(1)
+	logs.Reset()
+
+	for i := 0; i < 100; i++ {
+		resource.Use(2)
+	}
+	clock.Advance(time.Minute)
+	var lines []string
+	for _, line := range logs.Lines() {
+		if strings.Contains(line, "use denied") {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 2 || !strings.Contains(lines[1], `msg="use denied (repeated 99 times)" resource=db caller="Goroutine 2"`) {
+		t.Errorf("Expected one denial and its summary, got %q", lines)
+	}
+}
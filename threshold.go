@@ -0,0 +1,140 @@
+// threshold.go
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Decision is the outcome of ThresholdLimiter.Decide
+type Decision int
+
+// Decisions, from best to worst
+const (
+	DecisionAllowed  Decision = iota // under the soft limit
+	DecisionDegraded                 // over the soft limit but granted
+	DecisionDenied                   // over the hard limit
+)
+
+// String returns the decision's name
+func (d Decision) String() string {
+	switch d {
+	case DecisionAllowed:
+		return "allowed"
+	case DecisionDegraded:
+		return "degraded"
+	case DecisionDenied:
+		return "denied"
+	}
+	return "unknown"
+}
+
+// MarshalText returns the decision's name, so it marshals to JSON as such
+func (d Decision) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// ThresholdLimiter adds a soft limit below a RateLimiter's own, hard,
+// limit. Requests past the soft limit are still granted but reported as
+// degraded, so callers can log or shed optional work; requests past the
+// hard limit are denied as usual.
+type ThresholdLimiter struct {
+	limiter *RateLimiter
+	soft    int
+	onSoft  func(now time.Time, current, soft int)
+}
+
+// ThresholdOption configures a ThresholdLimiter
+type ThresholdOption func(*ThresholdLimiter)
+
+// WithOnSoftLimit registers f to be told about every degraded grant, with
+// its time, the window's usage including it and the soft limit. Like the
+// RateLimiter callbacks it runs outside the limiter's lock, but it may be
+// called from several goroutines at once.
+func WithOnSoftLimit(f func(now time.Time, current, soft int)) ThresholdOption {
+	return func(tl *ThresholdLimiter) {
+		tl.onSoft = f
+	}
+}
+
+// NewThresholdLimiter creates a limiter that degrades once more than soft
+// tokens are taken in a window of limiter, which enforces the hard limit.
+// The soft limit must be positive and below the hard one.
+func NewThresholdLimiter(limiter *RateLimiter, soft int, opts ...ThresholdOption) (*ThresholdLimiter, error) {
+	if hard := limiter.Limit(); soft <= 0 || soft >= hard {
+		return nil, fmt.Errorf("%w: soft limit must be between 0 and %d, got %d", ErrInvalidConfig, hard, soft)
+	}
+	tl := &ThresholdLimiter{limiter: limiter, soft: soft}
+	for _, opt := range opts {
+		opt(tl)
+	}
+	return tl, nil
+}
+
+// Decide takes a token unless the hard limit is reached, and reports
+// whether the grant went past the soft limit
+func (tl *ThresholdLimiter) Decide() Decision {
+	ok, current, now := tl.limiter.tryAcquireCount(1)
+	switch {
+	case !ok:
+		return DecisionDenied
+	case current <= tl.soft:
+		return DecisionAllowed
+	}
+	if tl.onSoft != nil {
+		tl.onSoft(now, current, tl.soft)
+	}
+	return DecisionDegraded
+}
+
+// TryAcquire takes a token unless the hard limit is reached, degraded or not
+func (tl *ThresholdLimiter) TryAcquire() bool {
+	return tl.Decide() != DecisionDenied
+}
+
+// Release returns a token to the underlying limiter
+func (tl *ThresholdLimiter) Release() {
+	tl.limiter.Release()
+}
+
+// RetryAfter returns how long until the hard limit may grant again
+func (tl *ThresholdLimiter) RetryAfter() time.Duration {
+	return tl.limiter.RetryAfter()
+}
+
+// Limit returns the hard limit
+func (tl *ThresholdLimiter) Limit() int {
+	return tl.limiter.Limit()
+}
+
+// SoftLimit returns the soft limit
+func (tl *ThresholdLimiter) SoftLimit() int {
+	return tl.soft
+}
+
+// SetHeaders sets the X-RateLimit-* headers for the hard limit
+func (tl *ThresholdLimiter) SetHeaders(w http.ResponseWriter) {
+	tl.limiter.SetHeaders(w)
+}
+
+// Stats returns the underlying limiter's stats
+func (tl *ThresholdLimiter) Stats() LimiterStats {
+	return tl.limiter.Stats()
+}
+
+// tryAcquireCount is TryAcquireN that also returns the window's usage just
+// after the attempt and the time it was made at
+func (rl *RateLimiter) tryAcquireCount(n int) (bool, int, time.Time) {
+	defer rl.fireEvents()
+	rl.lock()
+	now := rl.clock.Now()
+	ok := rl.tryAcquireOrDenyLocked(now, n)
+	current, epoch := rl.currRequests, rl.epoch
+	rl.unlock()
+
+	if ok {
+		ok, _ = rl.commitShared(n, epoch, true)
+	}
+	return ok, current, now
+}
@@ -0,0 +1,90 @@
+// threshold_test.go
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestThresholdLimiterDecisions(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	var degraded []int
+	tl, err := NewThresholdLimiter(NewRateLimiter(4, 60, WithLimiterClock(clock)), 2,
+		WithOnSoftLimit(func(_ time.Time, current, soft int) {
+			if soft != 2 {
+				t.Errorf("Expected the soft limit 2 in the callback, got %d", soft)
+			}
+			degraded = append(degraded, current)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Decision{DecisionAllowed, DecisionAllowed, DecisionDegraded, DecisionDegraded, DecisionDenied}
+	for i, w := range want {
+		if got := tl.Decide(); got != w {
+			t.Errorf("Request %d: expected %v, got %v", i+1, w, got)
+		}
+	}
+	if len(degraded) != 2 || degraded[0] != 3 || degraded[1] != 4 {
+		t.Errorf("Expected the callback for requests 3 and 4, got %v", degraded)
+	}
+
+	// Dropping back under the soft limit is no longer degraded
+	tl.Release()
+	tl.Release()
+	tl.Release()
+	if got := tl.Decide(); got != DecisionAllowed {
+		t.Errorf("Expected allowed once usage is back under the soft limit, got %v", got)
+	}
+
+	clock.Advance(time.Minute)
+	if got := tl.Decide(); got != DecisionAllowed {
+		t.Errorf("Expected a fresh window to allow, got %v", got)
+	}
+}
+
+func TestThresholdLimiterValidation(t *testing.T) {
+	for _, soft := range []int{0, -1, 3, 4} {
+		if _, err := NewThresholdLimiter(NewRateLimiter(3, 60), soft); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Soft limit %d: expected ErrInvalidConfig, got %v", soft, err)
+		}
+	}
+}
+
+func TestMiddlewareDegraded(t *testing.T) {
+	tl, err := NewThresholdLimiter(NewRateLimiter(2, 60), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := Middleware(tl, okHandler())
+
+	// The token is released after each request, so hold them to climb up
+	tl.TryAcquire()
+	degraded := httptest.NewRecorder()
+	handler.ServeHTTP(degraded, httptest.NewRequest(http.MethodGet, "/", nil))
+	if degraded.Code != http.StatusOK || degraded.Header().Get("X-RateLimit-Degraded") != "true" {
+		t.Errorf("Expected a degraded 200, got %d with headers %v", degraded.Code, degraded.Header())
+	}
+	if degraded.Header().Get("X-RateLimit-Limit") != "2" {
+		t.Errorf("Expected the hard limit in the headers, got %q", degraded.Header().Get("X-RateLimit-Limit"))
+	}
+
+	tl.TryAcquire()
+	denied := httptest.NewRecorder()
+	handler.ServeHTTP(denied, httptest.NewRequest(http.MethodGet, "/", nil))
+	if denied.Code != http.StatusTooManyRequests || denied.Header().Get("X-RateLimit-Degraded") != "" {
+		t.Errorf("Expected a plain 429 past the hard limit, got %d with headers %v", denied.Code, denied.Header())
+	}
+
+	tl.Release()
+	tl.Release()
+	ok := httptest.NewRecorder()
+	handler.ServeHTTP(ok, httptest.NewRequest(http.MethodGet, "/", nil))
+	if ok.Code != http.StatusOK || ok.Header().Get("X-RateLimit-Degraded") != "" {
+		t.Errorf("Expected an undegraded 200 under the soft limit, got %d with headers %v", ok.Code, ok.Header())
+	}
+}
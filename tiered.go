@@ -0,0 +1,126 @@
+// tiered.go
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Tier is one quota of a TieredLimiter: at most Max requests per Window
+type Tier struct {
+	Max    int
+	Window time.Duration
+}
+
+// TierDenial describes the tier that refused a request. When several tiers
+// are full it is the one that stays full longest.
+type TierDenial struct {
+	Index      int // position of the tier in NewTieredLimiter's arguments
+	Tier       Tier
+	RetryAfter time.Duration
+}
+
+// TieredLimiter enforces several quotas at once, e.g. 10 per second and
+// 200 per minute. A request is granted by every tier or by none.
+type TieredLimiter struct {
+	mu    sync.Mutex
+	tiers []Tier
+	rls   []*RateLimiter
+}
+
+// NewTieredLimiter creates a limiter enforcing every tier
+func NewTieredLimiter(tiers ...Tier) (*TieredLimiter, error) {
+	return newTieredLimiter(realClock{}, tiers...)
+}
+
+func newTieredLimiter(clock Clock, tiers ...Tier) (*TieredLimiter, error) {
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("%w: no tiers", ErrInvalidConfig)
+	}
+	tl := &TieredLimiter{tiers: tiers}
+	for i, tier := range tiers {
+		rl, err := NewRateLimiterFromConfig(Config{MaxRequests: tier.Max, Window: tier.Window, Clock: clock})
+		if err != nil {
+			return nil, fmt.Errorf("tier %d: %w", i, err)
+		}
+		tl.rls = append(tl.rls, rl)
+	}
+	return tl, nil
+}
+
+// TryAcquireDetail takes a token from every tier if they all have room, and
+// otherwise takes nothing and reports the tier that blocked
+func (tl *TieredLimiter) TryAcquireDetail() (bool, TierDenial) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	// The tiers are only touched under our lock, so room seen here is
+	// still there when the tokens are taken below
+	var denial TierDenial
+	denied := false
+	for i, rl := range tl.rls {
+		if rl.Remaining() > 0 {
+			continue
+		}
+		if retryAfter := rl.RetryAfter(); !denied || retryAfter > denial.RetryAfter {
+			denial = TierDenial{Index: i, Tier: tl.tiers[i], RetryAfter: retryAfter}
+		}
+		denied = true
+	}
+	if denied {
+		return false, denial
+	}
+
+	for _, rl := range tl.rls {
+		rl.TryAcquire()
+	}
+	return true, TierDenial{}
+}
+
+// Allow is TryAcquireDetail reporting only the retry-after hint
+func (tl *TieredLimiter) Allow() (bool, time.Duration) {
+	ok, denial := tl.TryAcquireDetail()
+	return ok, denial.RetryAfter
+}
+
+// RetryAfter returns zero if every tier has room, otherwise how long until
+// the tier that stays full longest resets
+func (tl *TieredLimiter) RetryAfter() time.Duration {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	var longest time.Duration
+	for _, rl := range tl.rls {
+		if rl.Remaining() > 0 {
+			continue
+		}
+		longest = max(longest, rl.RetryAfter())
+	}
+	return longest
+}
+
+// TryAcquire takes a token from every tier or from none
+func (tl *TieredLimiter) TryAcquire() bool {
+	ok, _ := tl.TryAcquireDetail()
+	return ok
+}
+
+// Release returns a token to every tier
+func (tl *TieredLimiter) Release() {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	for _, rl := range tl.rls {
+		rl.Release()
+	}
+}
+
+// TierStats returns each tier's stats, in the order the tiers were given
+func (tl *TieredLimiter) TierStats() []LimiterStats {
+	stats := make([]LimiterStats, len(tl.rls))
+	for i, rl := range tl.rls {
+		stats[i] = rl.Stats()
+	}
+	return stats
+}
@@ -0,0 +1,92 @@
+// tiered_test.go
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTieredLimiterSecondTierBlocks(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter, err := newTieredLimiter(clock,
+		Tier{Max: 10, Window: time.Second},
+		Tier{Max: 25, Window: time.Minute},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	granted := 0
+	for s := 0; s < 3; s++ {
+		for i := 0; i < 10; i++ {
+			if limiter.TryAcquire() {
+				granted++
+			}
+		}
+		clock.Advance(time.Second)
+	}
+	if granted != 25 {
+		t.Fatalf("Expected the minute tier to cap the total at 25, got %d", granted)
+	}
+
+	// Now the seconds tier has room again but the minute tier is full
+	ok, denial := limiter.TryAcquireDetail()
+	if ok {
+		t.Fatal("Expected the minute tier to deny")
+	}
+	if denial.Index != 1 || denial.Tier.Window != time.Minute {
+		t.Errorf("Expected the minute tier to be reported, got %+v", denial)
+	}
+	if denial.RetryAfter != 57*time.Second {
+		t.Errorf("Expected to retry when the minute ends in 57s, got %v", denial.RetryAfter)
+	}
+
+	// A denial takes nothing from the tier that had room
+	if stats := limiter.TierStats(); stats[0].Current != 0 {
+		t.Errorf("Expected the seconds tier untouched by the denial, holding %d", stats[0].Current)
+	}
+}
+
+func TestTieredLimiterFirstTierBlocks(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter, _ := newTieredLimiter(clock,
+		Tier{Max: 2, Window: time.Second},
+		Tier{Max: 100, Window: time.Minute},
+	)
+
+	limiter.TryAcquire()
+	limiter.TryAcquire()
+	ok, retryAfter := limiter.Allow()
+	if ok || retryAfter != time.Second {
+		t.Errorf("Expected the seconds tier to deny for 1s, got %v and %v", ok, retryAfter)
+	}
+	if stats := limiter.TierStats(); stats[1].Current != 2 {
+		t.Errorf("Expected the minute tier to hold only the 2 granted, got %d", stats[1].Current)
+	}
+}
+
+func TestTieredLimiterValidation(t *testing.T) {
+	if _, err := NewTieredLimiter(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig without tiers, got %v", err)
+	}
+	if _, err := NewTieredLimiter(Tier{Max: 1, Window: 0}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for a zero window, got %v", err)
+	}
+}
+
+func TestTieredLimiterRetryAfter(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter, _ := newTieredLimiter(clock,
+		Tier{Max: 1, Window: time.Second},
+		Tier{Max: 1, Window: time.Minute},
+	)
+	if d := limiter.RetryAfter(); d != 0 {
+		t.Errorf("Expected no wait with room in every tier, got %v", d)
+	}
+	limiter.TryAcquire()
+	// Both tiers are full, and the minute tier decides
+	if d := limiter.RetryAfter(); d != time.Minute {
+		t.Errorf("Expected to wait for the minute tier, got %v", d)
+	}
+}
@@ -0,0 +1,62 @@
+// tokenbucket.go
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucketLimiter refills tokens continuously at a fixed rate up to a
+// capacity, so unlike the fixed window it has no burst at window boundaries
+type TokenBucketLimiter struct {
+	mu         sync.Mutex
+	rate       float64 // tokens per second
+	capacity   float64
+	tokens     float64
+	lastRefill time.Time
+	clock      Clock
+}
+
+// NewTokenBucketLimiter creates a full bucket holding up to capacity tokens
+// and refilling at rate tokens per second
+func NewTokenBucketLimiter(rate float64, capacity int) *TokenBucketLimiter {
+	tb := &TokenBucketLimiter{
+		rate:     rate,
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		clock:    realClock{},
+	}
+	tb.lastRefill = tb.clock.Now()
+	return tb
+}
+
+// refillLocked adds the tokens earned since the last refill
+func (tb *TokenBucketLimiter) refillLocked() {
+	now := tb.clock.Now()
+	elapsed := now.Sub(tb.lastRefill).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	tb.tokens += elapsed * tb.rate
+	if tb.tokens > tb.capacity {
+		tb.tokens = tb.capacity
+	}
+	tb.lastRefill = now
+}
+
+// TryAcquire takes a token from the bucket if one is available
+func (tb *TokenBucketLimiter) TryAcquire() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refillLocked()
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+// Release is a no-op: tokens come back only through refill, so a finished
+// request still counts against the rate
+func (tb *TokenBucketLimiter) Release() {}
@@ -0,0 +1,69 @@
+// tokenbucket_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketSmoothRefill(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	bucket := NewTokenBucketLimiter(10, 5) // 10 tokens per second, burst of 5
+	bucket.clock = clock
+	bucket.lastRefill = clock.Now()
+
+	for i := 0; i < 5; i++ {
+		if !bucket.TryAcquire() {
+			t.Fatalf("Acquisition %d from a full bucket should succeed", i+1)
+		}
+	}
+	if bucket.TryAcquire() {
+		t.Error("Empty bucket should deny")
+	}
+
+	// Half a token's worth of time is not enough
+	clock.Advance(50 * time.Millisecond)
+	if bucket.TryAcquire() {
+		t.Error("Half a refill interval should not grant a token")
+	}
+
+	// Crossing a one second boundary grants only what was earned, unlike
+	// a fixed window that would hand out a whole new window at once
+	clock.Advance(50 * time.Millisecond)
+	if !bucket.TryAcquire() {
+		t.Error("One refill interval should grant a token")
+	}
+	if bucket.TryAcquire() {
+		t.Error("One refill interval should grant only one token")
+	}
+}
+
+func TestTokenBucketCapacityCap(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	bucket := NewTokenBucketLimiter(10, 3)
+	bucket.clock = clock
+	bucket.lastRefill = clock.Now()
+
+	clock.Advance(time.Minute)
+
+	granted := 0
+	for bucket.TryAcquire() {
+		granted++
+	}
+	if granted != 3 {
+		t.Errorf("Expected an idle bucket to cap at 3 tokens, got %d", granted)
+	}
+}
+
+func TestResourceWithTokenBucket(t *testing.T) {
+	bucket := NewTokenBucketLimiter(1, 1)
+	resource := NewResource("TestResource", 100, 1, WithLimiter(bucket))
+
+	resource.initDone = true
+	if err := resource.Use(1); err != nil {
+		t.Errorf("First use should succeed, got %v", err)
+	}
+	if err := resource.Use(2); err == nil {
+		t.Error("Second use should be denied by the token bucket")
+	}
+}
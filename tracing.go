@@ -0,0 +1,61 @@
+// tracing.go
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Tracer starts spans for Resource.Use and UseContext. It is small enough to adapt
+// any tracing library; the oteltracer subpackage adapts OpenTelemetry.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer. It is an alias of an interface
+// literal, so an adapter in another package can declare the same literal
+// and satisfy Tracer without importing this one.
+type Span = interface {
+	SetAttributes(attrs map[string]any)
+	AddEvent(name string, attrs map[string]any)
+	End()
+}
+
+// Span attributes and events recorded by this package
+const (
+	attrAcquired    = "limiter.acquired"
+	attrWaitSeconds = "limiter.wait_seconds"
+	eventWait       = "limiter.wait"
+)
+
+// WithTracer traces each use of the resource with a span named after it,
+// recording whether the use got through and how long it waited
+func WithTracer(t Tracer) Option {
+	return func(r *Resource) {
+		r.tracer = t
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span, on which a blocking
+// RateLimiter.Acquire records a limiter.wait event. UseContext does this
+// for its own span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func spanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
+
+// recordWait adds a limiter.wait event to the span in ctx, if any
+func recordWait(ctx context.Context, waited time.Duration, err error) {
+	if span := spanFromContext(ctx); span != nil {
+		span.AddEvent(eventWait, map[string]any{
+			attrAcquired:    err == nil,
+			attrWaitSeconds: waited.Seconds(),
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// tracing_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"GoConcur/oteltracer"
+)
+
+// The OpenTelemetry adapter satisfies Tracer without importing this package
+var _ Tracer = oteltracer.Tracer{}
+
+type recordedEvent struct {
+	name  string
+	attrs map[string]any
+}
+
+type recordedSpan struct {
+	mu     sync.Mutex
+	name   string
+	attrs  map[string]any
+	events []recordedEvent
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(attrs map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range attrs {
+		s.attrs[k] = v
+	}
+}
+
+func (s *recordedSpan) AddEvent(name string, attrs map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, recordedEvent{name, attrs})
+}
+
+func (s *recordedSpan) End() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended = true
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &recordedSpan{name: name, attrs: make(map[string]any)}
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+func TestUseContextTracesWait(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tracer := &recordingTracer{}
+	resource, err := NewResourceFromConfig("db", Config{MaxRequests: 1, Window: time.Minute}, WithClock(clock), WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource.initDone = true
+	limiter := resource.limiter.(*RateLimiter)
+	limiter.TryAcquire()
+
+	errs := make(chan error, 1)
+	go func() { errs <- resource.UseContext(context.Background()) }()
+	waitForWaiters(limiter, 1)
+	clock.Advance(time.Minute)
+	if err := <-errs; err != nil {
+		t.Fatalf("Expected UseContext to get through after the reset, got %v", err)
+	}
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("Expected one span, got %d", len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	if span.name != "db" || !span.ended {
+		t.Errorf("Expected an ended span named db, got %q ended=%v", span.name, span.ended)
+	}
+	if span.attrs[attrAcquired] != true || span.attrs[attrWaitSeconds] != 60.0 {
+		t.Errorf("Expected an acquired span that waited 60s, got %v", span.attrs)
+	}
+	if len(span.events) != 1 || span.events[0].name != eventWait || span.events[0].attrs[attrWaitSeconds] != 60.0 {
+		t.Errorf("Expected a limiter.wait event of 60s, got %v", span.events)
+	}
+}
+
+func TestUseContextTracesDenial(t *testing.T) {
+	tracer := &recordingTracer{}
+	resource, err := NewResourceFromConfig("db", Config{MaxRequests: 1, Window: time.Minute}, WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource.initDone = true
+	resource.limiter.TryAcquire()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := resource.UseContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to end the wait, got %v", err)
+	}
+
+	span := tracer.spans[0]
+	if span.attrs[attrAcquired] != false {
+		t.Errorf("Expected the span to record the denial, got %v", span.attrs)
+	}
+	if len(span.events) != 1 || span.events[0].attrs[attrAcquired] != false {
+		t.Errorf("Expected a limiter.wait event that gave up, got %v", span.events)
+	}
+}
+
+func TestUseContextWithoutTracer(t *testing.T) {
+	resource, err := NewResourceFromConfig("db", Config{MaxRequests: 1, Window: time.Minute}, WithMaxConcurrent(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource.initDone = true
+
+	if err := resource.UseContext(context.Background()); err != nil {
+		t.Errorf("Expected the first use to succeed, got %v", err)
+	}
+	if n := resource.sem.Held(); n != 0 {
+		t.Errorf("Expected the concurrency slot to be released, got %d held", n)
+	}
+}
@@ -0,0 +1,201 @@
+// usage.go
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// Latency buckets grow by a quarter power of two, so a percentile read off
+// a bucket bound is within about 19% of the true value. They span 1µs to
+// about 2 minutes; anything slower lands in the last bucket.
+const (
+	latencyBucketsPerDoubling = 4
+	latencyBuckets            = 27 * latencyBucketsPerDoubling
+	latencyMin                = time.Microsecond
+)
+
+// Percentiles cover the uses of the last latencySlots * latencySlotWidth,
+// kept as one histogram per slot so old slots can be dropped whole
+const (
+	latencySlots     = 6
+	latencySlotWidth = 10 * time.Second
+)
+
+// ResourceMetrics is a point-in-time view of how a resource has been used
+type ResourceMetrics struct {
+	Uses        uint64 // uses whose work ran
+	Units       uint64 // limiter units those uses were charged, see UseWeighted
+	Reads       uint64 // those uses made with UseRead; the rest were writes
+	RateLimited uint64 // uses turned away by the limiter or the concurrency cap
+	Errors      uint64 // uses whose work failed, timed out or panicked
+	InFlight    int    // uses running their work right now
+
+	// Latency percentiles of the work of uses finished in the last minute,
+	// zero if there were none
+	P50, P95, P99 time.Duration
+}
+
+// ErrorRate returns the fraction of uses whose work failed
+func (m ResourceMetrics) ErrorRate() float64 {
+	if m.Uses == 0 {
+		return 0
+	}
+	return float64(m.Errors) / float64(m.Uses)
+}
+
+// usageStats collects a resource's ResourceMetrics in bounded memory
+type usageStats struct {
+	mu          sync.Mutex
+	uses        uint64
+	rateLimited uint64
+	errors      uint64
+	units       uint64
+	reads       uint64
+	running     int
+	slots       [latencySlots]latencySlot
+
+	lastErr   error // returned by the latest failed use, see Inspect
+	lastErrAt time.Time
+}
+
+// latencySlot counts the latencies of uses finished in one slot's time
+type latencySlot struct {
+	start  time.Time // zero if the slot has never been used
+	counts [latencyBuckets]uint64
+}
+
+// latencyBucket returns the index of the bucket d falls in
+func latencyBucket(d time.Duration) int {
+	if d <= latencyMin {
+		return 0
+	}
+	i := int(math.Ceil(math.Log2(float64(d)/float64(latencyMin)) * latencyBucketsPerDoubling))
+	if i >= latencyBuckets {
+		return latencyBuckets - 1
+	}
+	return i
+}
+
+// latencyBound returns the upper bound of bucket i
+func latencyBound(i int) time.Duration {
+	return time.Duration(float64(latencyMin) * math.Exp2(float64(i)/latencyBucketsPerDoubling))
+}
+
+// startWork counts a use in mode charged cost units as in flight and
+// returns when its work started
+func (r *Resource) startWork(mode AccessMode, cost int) time.Time {
+	r.usage.mu.Lock()
+	defer r.usage.mu.Unlock()
+
+	r.usage.running++
+	r.usage.units += uint64(cost)
+	if mode == AccessRead {
+		r.usage.reads++
+	}
+	return r.clock.Now()
+}
+
+// recordUse counts a use whose work started at start and has just finished.
+// Work cut short by the caller cancelling isn't failed.
+func (r *Resource) recordUse(start time.Time, failed bool) {
+	now := r.clock.Now()
+	r.usage.recordUse(now, now.Sub(start), failed)
+}
+
+// recordUse counts a use finished at now whose work took d
+func (u *usageStats) recordUse(now time.Time, d time.Duration, failed bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.running--
+	u.uses++
+	if failed {
+		u.errors++
+	}
+	start := now.Truncate(latencySlotWidth)
+	i := start.UnixNano() / int64(latencySlotWidth) % latencySlots
+	if i < 0 {
+		i += latencySlots
+	}
+	slot := &u.slots[i]
+	if !slot.start.Equal(start) {
+		*slot = latencySlot{start: start}
+	}
+	slot.counts[latencyBucket(d)]++
+}
+
+// recordRejection counts a use the limiter or concurrency cap turned away.
+// Cancelled waits and other failures to acquire aren't counted. It reports
+// whether err was counted.
+func (u *usageStats) recordRejection(err error) bool {
+	if !errors.Is(err, ErrRateLimited) && !errors.Is(err, ErrTooManyConcurrent) && !errors.Is(err, ErrQueueFull) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.rateLimited++
+	return true
+}
+
+// recordError notes err as the latest error a use returned
+func (u *usageStats) recordError(err error, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.lastErr = err
+	u.lastErrAt = now
+}
+
+// snapshot returns the metrics as of now
+func (u *usageStats) snapshot(now time.Time) ResourceMetrics {
+	u.mu.Lock()
+	m := ResourceMetrics{Uses: u.uses, Units: u.units, Reads: u.reads, RateLimited: u.rateLimited, Errors: u.errors, InFlight: u.running}
+	var counts [latencyBuckets]uint64
+	var total uint64
+	oldest := now.Truncate(latencySlotWidth).Add(-(latencySlots - 1) * latencySlotWidth)
+	for i := range u.slots {
+		slot := &u.slots[i]
+		if slot.start.IsZero() || slot.start.Before(oldest) {
+			continue
+		}
+		for j, c := range slot.counts {
+			counts[j] += c
+			total += c
+		}
+	}
+	u.mu.Unlock()
+
+	m.P50 = percentile(&counts, total, 0.50)
+	m.P95 = percentile(&counts, total, 0.95)
+	m.P99 = percentile(&counts, total, 0.99)
+	return m
+}
+
+// percentile returns the upper bound of the bucket holding the q-th
+// quantile of total samples
+func percentile(counts *[latencyBuckets]uint64, total uint64, q float64) time.Duration {
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, c := range counts {
+		if seen += c; seen >= rank {
+			return latencyBound(i)
+		}
+	}
+	return latencyBound(latencyBuckets - 1)
+}
+
+// Metrics returns how the resource has been used: counts since it was
+// created and latency percentiles of the last minute. It is safe to call
+// while uses are running.
+func (r *Resource) Metrics() ResourceMetrics {
+	return r.usage.snapshot(r.clock.Now())
+}
@@ -0,0 +1,178 @@
+// usage_test.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// within reports whether got is a bucket bound for want: no lower, and no
+// more than one bucket above
+func within(got, want time.Duration) bool {
+	return got >= want && float64(got) <= float64(want)*1.19
+}
+
+func TestResourceMetricsCounts(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	resource := NewResource("db", 3, 60, WithClock(clock), WithInit(func(context.Context) error { return nil }))
+	errQuery := errors.New("bad query")
+
+	resource.UseFunc(context.Background(), func(context.Context) error { return nil })
+	resource.UseFunc(context.Background(), func(context.Context) error { return errQuery })
+	// A cancelled use runs but doesn't count as an error
+	ctx, cancel := context.WithCancel(context.Background())
+	resource.UseFunc(ctx, func(context.Context) error { cancel(); return context.Canceled })
+
+	resource.limiter.TryAcquire()
+	resource.limiter.TryAcquire()
+	resource.limiter.TryAcquire()
+	resource.Use(1)
+	resource.Use(2)
+
+	m := resource.Metrics()
+	if m.Uses != 3 || m.Errors != 1 || m.RateLimited != 2 {
+		t.Errorf("Expected 3 uses, 1 error and 2 rejections, got %+v", m)
+	}
+	if rate := m.ErrorRate(); rate < 0.33 || rate > 0.34 {
+		t.Errorf("Expected an error rate of a third, got %v", rate)
+	}
+}
+
+func TestResourceMetricsConcurrencyRejections(t *testing.T) {
+	resource := NewResource("db", 10, 60, WithMaxConcurrent(1), WithInit(func(context.Context) error { return nil }))
+	resource.sem.TryAcquire()
+	resource.Use(1)
+
+	if m := resource.Metrics(); m.RateLimited != 1 || m.Uses != 0 {
+		t.Errorf("Expected a use turned away by the cap to count as rejected, got %+v", m)
+	}
+}
+
+func TestResourceMetricsPercentiles(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	resource := NewResource("db", 1000, 3600, WithClock(clock), WithInit(func(context.Context) error { return nil }))
+	useFor := func(d time.Duration, n int) {
+		for i := 0; i < n; i++ {
+			resource.UseFunc(context.Background(), func(context.Context) error {
+				clock.Advance(d)
+				return nil
+			})
+		}
+	}
+
+	if m := resource.Metrics(); m.P50 != 0 || m.P99 != 0 {
+		t.Errorf("Expected zero percentiles before any use, got %+v", m)
+	}
+
+	useFor(time.Millisecond, 50)
+	useFor(10*time.Millisecond, 45)
+	useFor(100*time.Millisecond, 4)
+	useFor(time.Second, 1)
+
+	m := resource.Metrics()
+	if !within(m.P50, time.Millisecond) {
+		t.Errorf("Expected p50 of about 1ms, got %v", m.P50)
+	}
+	if !within(m.P95, 10*time.Millisecond) {
+		t.Errorf("Expected p95 of about 10ms, got %v", m.P95)
+	}
+	if !within(m.P99, 100*time.Millisecond) {
+		t.Errorf("Expected p99 of about 100ms, got %v", m.P99)
+	}
+
+	// Latencies age out of the sliding window but the counts stay
+	clock.Advance(2 * time.Minute)
+	m = resource.Metrics()
+	if m.P50 != 0 || m.P99 != 0 {
+		t.Errorf("Expected old latencies to age out, got %+v", m)
+	}
+	if m.Uses != 100 {
+		t.Errorf("Expected the use count to be kept, got %d", m.Uses)
+	}
+	useFor(5*time.Millisecond, 1)
+	if m := resource.Metrics(); !within(m.P50, 5*time.Millisecond) || !within(m.P99, 5*time.Millisecond) {
+		t.Errorf("Expected percentiles of the new use only, got %+v", m)
+	}
+}
+
+func TestLatencyBuckets(t *testing.T) {
+	for _, d := range []time.Duration{0, time.Microsecond, 3 * time.Microsecond, time.Millisecond, 250 * time.Millisecond, time.Minute} {
+		if got := latencyBound(latencyBucket(d)); d > latencyMin && !within(got, d) {
+			t.Errorf("Expected %v to land in a bucket bounded just above it, bound %v", d, got)
+		}
+	}
+	if latencyBucket(time.Hour) != latencyBuckets-1 {
+		t.Error("Expected latencies past the last bound to land in the last bucket")
+	}
+}
+
+func TestResourceMetricsConcurrent(t *testing.T) {
+	resource := NewResource("db", 1000, 60, WithInit(func(context.Context) error { return nil }))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				resource.UseFunc(context.Background(), func(context.Context) error { return nil })
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				resource.Metrics()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if m := resource.Metrics(); m.Uses != 400 {
+		t.Errorf("Expected 400 uses, got %d", m.Uses)
+	}
+}
+
+func TestMetricsRegistryResourceUsage(t *testing.T) {
+	registry := NewMetricsRegistry()
+	resource := NewResource("db", 1, 60, WithInit(func(context.Context) error { return nil }))
+	registry.RegisterResource(resource)
+
+	resource.UseFunc(context.Background(), func(context.Context) error { return errors.New("boom") })
+	resource.limiter.TryAcquire()
+	resource.Use(1)
+
+	body := scrape(t, registry)
+	expectMetric(t, body, `resource_uses_total{resource="db"} 1`)
+	expectMetric(t, body, `resource_errors_total{resource="db"} 1`)
+	expectMetric(t, body, `resource_rate_limited_total{resource="db"} 1`)
+	expectMetric(t, body, `# TYPE resource_use_latency_seconds summary`)
+	if !strings.Contains(body, `resource_use_latency_seconds{resource="db",quantile="0.99"} `) {
+		t.Errorf("Expected latency quantiles in the scrape:\n%s", body)
+	}
+}
+
+func TestResourcePublishMetricsExpvar(t *testing.T) {
+	resource := NewResource("db", 5, 60, WithInit(func(context.Context) error { return nil }))
+	name := expvarName(t)
+	if err := resource.PublishMetricsExpvar(name); err != nil {
+		t.Fatal(err)
+	}
+	resource.UseFunc(context.Background(), func(context.Context) error { return nil })
+
+	var m ResourceMetrics
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Uses != 1 {
+		t.Errorf("Expected the published metrics to be live, got %+v", m)
+	}
+	if err := resource.PublishMetricsExpvar(name); !errors.Is(err, ErrExpvarExists) {
+		t.Errorf("Expected ErrExpvarExists for a second publish, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+// useall.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// UseAll runs fn while holding a use of every one of resources, e.g. to
+// read from one and write to another. The resources are acquired one at a
+// time in order of name, and of creation between resources sharing a name,
+// whatever order they are passed in, so two UseAlls over the same resources
+// can't each hold one while waiting for the other.
+// Each acquisition waits as UseFunc does. If any is refused, those already
+// held are released without counting it against them and fn doesn't run;
+// an error from fn counts against every resource, as a failed use of each.
+// Passing a resource twice is an ErrInvalidConfig.
+func UseAll(ctx context.Context, fn func(ctx context.Context) error, resources ...*Resource) error {
+	seen := make(map[*Resource]bool, len(resources))
+	for _, r := range resources {
+		if seen[r] {
+			return fmt.Errorf("%w: UseAll given resource %s twice", ErrInvalidConfig, r.name)
+		}
+		seen[r] = true
+	}
+	sorted := append([]*Resource(nil), resources...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].name != sorted[j].name {
+			return sorted[i].name < sorted[j].name
+		}
+		return sorted[i].seq < sorted[j].seq
+	})
+
+	ran := false
+	err := useAll(ctx, sorted, func(ctx context.Context) error {
+		ran = true
+		return fn(ctx)
+	}, &ran)
+	var held *heldError
+	if errors.As(err, &held) {
+		return held.err
+	}
+	return err
+}
+
+// useAll holds a use of rs[0] while acquiring the rest, then runs fn
+func useAll(ctx context.Context, rs []*Resource, fn func(ctx context.Context) error, ran *bool) error {
+	if len(rs) == 0 {
+		return fn(ctx)
+	}
+	return rs[0].use(ctx, true, AccessWrite, 1, func(ctx context.Context) error {
+		err := useAll(ctx, rs[1:], fn, ran)
+		if err != nil && !*ran {
+			var held *heldError
+			if !errors.As(err, &held) {
+				err = &heldError{err: err}
+			}
+		}
+		return err
+	})
+}
+
+// heldError carries the refusal of a resource UseAll acquires later out
+// through the uses of those it already holds, which don't count it as
+// their own failure
+type heldError struct {
+	err error
+}
+
+func (e *heldError) Error() string {
+	return e.err.Error()
+}
+
+func (e *heldError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,123 @@
+// useall_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUseAllBothOrderings(t *testing.T) {
+	useAllBothWays(t, NewResource("a", 1000, 60, WithMaxConcurrent(1)), NewResource("b", 1000, 60, WithMaxConcurrent(1)))
+}
+
+func TestUseAllSameNameBothOrderings(t *testing.T) {
+	// Resources sharing a name still have one order between them
+	useAllBothWays(t, NewResource("db", 1000, 60, WithMaxConcurrent(1)), NewResource("db", 1000, 60, WithMaxConcurrent(1)))
+}
+
+// useAllBothWays runs UseAll over a and b from goroutines naming them in
+// both orders, checking it never deadlocks and holds both for fn
+func useAllBothWays(t *testing.T, a, b *Resource) {
+	t.Helper()
+	var inside atomic.Int32
+	work := func(context.Context) error {
+		if n := inside.Add(1); n != 1 {
+			t.Errorf("Expected one UseAll at a time holding both, %d were", n)
+		}
+		defer inside.Add(-1)
+		if a.Metrics().InFlight != 1 || b.Metrics().InFlight != 1 {
+			t.Error("Expected fn to run with both resources held")
+		}
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+
+	// Half the goroutines name the resources one way round, half the
+	// other; nested uses in those orders would deadlock
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				var err error
+				if i%2 == 0 {
+					err = UseAll(ctx, work, a, b)
+				} else {
+					err = UseAll(ctx, work, b, a)
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if ma, mb := a.Metrics(), b.Metrics(); ma.Uses != 200 || mb.Uses != 200 || ma.InFlight != 0 || mb.InFlight != 0 {
+		t.Errorf("Expected 200 finished uses of each, got %+v and %+v", ma, mb)
+	}
+}
+
+func TestUseAllReleasesOnDenial(t *testing.T) {
+	a := NewResource("a", 10, 60, WithMaxConcurrent(1))
+	b := NewResource("b", 10, 60, WithMaxConcurrent(1), WithBulkheadMode(BulkheadFailFast))
+	done := fillBulkhead(b, 1)
+	defer done()
+
+	ran := false
+	err := UseAll(context.Background(), func(context.Context) error { ran = true; return nil }, b, a)
+	if !errors.Is(err, ErrTooManyConcurrent) {
+		t.Fatalf("Expected b's refusal, got %v", err)
+	}
+	if ran {
+		t.Error("Expected fn not to run without every resource")
+	}
+	if m := a.Metrics(); m.InFlight != 0 || m.Errors != 0 {
+		t.Errorf("Expected a released and not blamed for b's refusal, got %+v", m)
+	}
+	if snap := a.Inspect(); snap.LastError != "" {
+		t.Errorf("Expected no error recorded on a, got %q", snap.LastError)
+	}
+
+	// a's slot is free again
+	if err := a.Use(1); err != nil {
+		t.Errorf("Expected a to be free after the failed UseAll, got %v", err)
+	}
+}
+
+func TestUseAllWorkError(t *testing.T) {
+	a := NewResource("a", 10, 60)
+	b := NewResource("b", 10, 60)
+	errWrite := errors.New("write failed")
+
+	err := UseAll(context.Background(), func(context.Context) error { return errWrite }, a, b)
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("Expected fn's error, got %v", err)
+	}
+	if a.Metrics().Errors != 1 || b.Metrics().Errors != 1 {
+		t.Errorf("Expected fn's error to count against both resources, got %+v and %+v", a.Metrics(), b.Metrics())
+	}
+}
+
+func TestUseAllRejectsDuplicates(t *testing.T) {
+	a := NewResource("a", 10, 60)
+	if err := UseAll(context.Background(), noWork, a, a); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected a resource passed twice to be refused, got %v", err)
+	}
+	// Apart, with another of the same name between them
+	other := NewResource("a", 10, 60)
+	if err := UseAll(context.Background(), noWork, a, other, a); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected a resource passed twice around a namesake to be refused, got %v", err)
+	}
+	if err := UseAll(context.Background(), noWork, a, other); err != nil {
+		t.Errorf("Expected two resources sharing a name to be allowed, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+// value.go
+package main
+
+import (
+	"context"
+	"io"
+)
+
+// ValueResource is a Resource that owns the value it guards, such as a
+// database connection: the value is built by the resource's initialization
+// and handed to the work of every use, so callers don't have to capture it
+// themselves. The embedded Resource's limits, health checks and Close all
+// apply as usual.
+type ValueResource[T any] struct {
+	*Resource
+	value T // set by the initialization, read only once it has succeeded
+}
+
+// NewValueResource creates a resource whose rate limiter is described by
+// cfg and whose initialization is factory, like NewResourceFromConfig with
+// WithInit(factory): the first use builds the value, and a failed build is
+// retried by the next. factory replaces any WithInit in opts. Unless opts
+// include WithTeardown, Close closes the value if it has been built and is
+// an io.Closer.
+func NewValueResource[T any](name string, cfg Config, factory func(ctx context.Context) (T, error), opts ...Option) (*ValueResource[T], error) {
+	vr := &ValueResource[T]{}
+	opts = append(opts, WithInit(func(ctx context.Context) error {
+		v, err := factory(ctx)
+		if err != nil {
+			return err
+		}
+		vr.value = v
+		return nil
+	}))
+
+	r, err := NewResourceFromConfig(name, cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if r.teardown == nil {
+		r.teardown = vr.closeValue
+	}
+	vr.Resource = r
+	return vr, nil
+}
+
+// Use runs fn with the resource's value under its limits, building the
+// value first if no use has yet. It waits and fails exactly as UseFunc
+// does.
+func (vr *ValueResource[T]) Use(ctx context.Context, fn func(ctx context.Context, v T) error) error {
+	return vr.UseFunc(ctx, func(ctx context.Context) error {
+		return fn(ctx, vr.value)
+	})
+}
+
+// closeValue is the default teardown, closing a built value that is an
+// io.Closer
+func (vr *ValueResource[T]) closeValue(context.Context) error {
+	vr.initMu.Lock()
+	built := vr.initDone
+	vr.initMu.Unlock()
+	if !built {
+		return nil
+	}
+	if c, ok := any(vr.value).(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// UseResult runs fn under r's limits like UseFunc and returns its value,
+// or the zero value with the error if the use is refused or fn fails. A
+// panic in fn carries on out of UseResult after being recorded, as it does
+// out of UseFunc.
+func UseResult[T any](ctx context.Context, r *Resource, fn func(ctx context.Context) (T, error)) (T, error) {
+	var v T
+	err := r.UseFunc(ctx, func(ctx context.Context) error {
+		var err error
+		v, err = fn(ctx)
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
@@ -0,0 +1,193 @@
+// value_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeConn stands in for a database connection
+type fakeConn struct {
+	id     int32
+	closed atomic.Bool
+}
+
+func (c *fakeConn) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestValueResourceBuildsOnce(t *testing.T) {
+	var built atomic.Int32
+	vr, err := NewValueResource("db", Config{MaxRequests: 100, Window: time.Minute},
+		func(context.Context) (*fakeConn, error) {
+			time.Sleep(10 * time.Millisecond)
+			return &fakeConn{id: built.Add(1)}, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if built.Load() != 0 {
+		t.Error("Expected the value to be built on first use, not creation")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := vr.Use(context.Background(), func(ctx context.Context, c *fakeConn) error {
+				if c == nil || c.id != 1 {
+					t.Errorf("Expected every use to get the one connection, got %+v", c)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if built.Load() != 1 {
+		t.Errorf("Expected exactly one build, got %d", built.Load())
+	}
+}
+
+func TestValueResourcePropagatesErrors(t *testing.T) {
+	errDial := errors.New("connection refused")
+	attempts := 0
+	vr, _ := NewValueResource("db", Config{MaxRequests: 100, Window: time.Minute},
+		func(context.Context) (string, error) {
+			attempts++
+			if attempts == 1 {
+				return "", errDial
+			}
+			return "conn-2", nil
+		})
+
+	called := false
+	err := vr.Use(context.Background(), func(context.Context, string) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrInitFailed) || !errors.Is(err, errDial) || called {
+		t.Errorf("Expected a failed build to fail the use without running it, got %v", err)
+	}
+
+	errQuery := errors.New("bad query")
+	err = vr.Use(context.Background(), func(ctx context.Context, v string) error {
+		if v != "conn-2" {
+			t.Errorf("Expected the retried build's value, got %q", v)
+		}
+		return errQuery
+	})
+	if !errors.Is(err, errQuery) {
+		t.Errorf("Expected the work's error, got %v", err)
+	}
+}
+
+func TestValueResourceCloseClosesValue(t *testing.T) {
+	conn := &fakeConn{id: 1}
+	vr, _ := NewValueResource("db", Config{MaxRequests: 100, Window: time.Minute},
+		func(context.Context) (*fakeConn, error) { return conn, nil })
+	vr.Use(context.Background(), func(context.Context, *fakeConn) error { return nil })
+
+	if err := vr.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !conn.closed.Load() {
+		t.Error("Expected Close to close the value")
+	}
+
+	// A value never built isn't closed, and WithTeardown takes over
+	tornDown := false
+	unused, _ := NewValueResource("db", Config{MaxRequests: 100, Window: time.Minute},
+		func(context.Context) (*fakeConn, error) {
+			t.Error("Expected an unused value never to be built")
+			return nil, nil
+		}, WithTeardown(func(context.Context) error { tornDown = true; return nil }))
+	unused.Close(context.Background())
+	if !tornDown {
+		t.Error("Expected WithTeardown to replace closing the value")
+	}
+}
+
+func TestValueResourceIdleClosesValue(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	var conns []*fakeConn
+	vr, _ := NewValueResource("db", Config{MaxRequests: 100, Window: time.Minute},
+		func(context.Context) (*fakeConn, error) {
+			conns = append(conns, &fakeConn{id: int32(len(conns) + 1)})
+			return conns[len(conns)-1], nil
+		}, WithClock(clock), WithIdleTimeout(time.Minute))
+
+	for cycle := 1; cycle <= 2; cycle++ {
+		vr.Use(context.Background(), func(context.Context, *fakeConn) error { return nil })
+		clock.Advance(2 * time.Minute)
+		if len(conns) != cycle || !conns[cycle-1].closed.Load() {
+			t.Fatalf("Expected idling out to close value %d of %d", cycle, len(conns))
+		}
+	}
+}
+
+func TestValueResourceInvalidConfig(t *testing.T) {
+	_, err := NewValueResource("db", Config{}, func(context.Context) (int, error) { return 0, nil })
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig, got %v", err)
+	}
+}
+
+func TestUseResult(t *testing.T) {
+	hl := &hookLog{}
+	resource := hookedResource(hl, WithMaxConcurrent(1))
+
+	got, err := UseResult(context.Background(), resource, func(context.Context) (string, error) {
+		hl.add("work")
+		return "42 rows", nil
+	})
+	if err != nil || got != "42 rows" {
+		t.Errorf("Expected the work's value, got %q and %v", got, err)
+	}
+	if want := "init OnInit OnAcquire work OnRelease"; hl.String() != want {
+		t.Errorf("Expected the hooks UseFunc runs, %q, got %q", want, hl.String())
+	}
+
+	errQuery := errors.New("query failed")
+	got, err = UseResult(context.Background(), resource, func(context.Context) (string, error) {
+		return "partial", errQuery
+	})
+	if !errors.Is(err, errQuery) || got != "" {
+		t.Errorf("Expected the zero value and the work's error, got %q and %v", got, err)
+	}
+
+	// Like UseFunc it waits for a slot, and gives up with its context
+	done := fillBulkhead(resource, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ran := false
+	_, err = UseResult(ctx, resource, func(context.Context) (int, error) {
+		ran = true
+		return 1, nil
+	})
+	done()
+	if !errors.Is(err, context.DeadlineExceeded) || ran {
+		t.Errorf("Expected the use to time out waiting without running, got %v", err)
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("Expected the panic to carry on, recovered %v", p)
+			}
+		}()
+		UseResult(context.Background(), resource, func(context.Context) (string, error) { panic("boom") })
+	}()
+	if m := resource.Metrics(); m.InFlight != 0 || m.Errors != 2 {
+		t.Errorf("Expected the panic to count as an error and free its slot, got %+v", m)
+	}
+}
@@ -0,0 +1,104 @@
+// waitchan.go
+package main
+
+import "time"
+
+// WaitChan returns a channel that is closed the next time the limiter has
+// room for another token, whether a release or a window reset freed it. It
+// lets an event loop that can't block in Acquire select on capacity
+// instead. If there is room already, for instance because the window reset
+// after a failed TryAcquire, the channel is closed on return, so no wakeup
+// is lost. Each call returns a fresh channel; closing the limiter closes
+// them all. Room is not reserved: another caller may take it first.
+func (rl *RateLimiter) WaitChan() <-chan struct{} {
+	ch, _ := rl.waitChan()
+	return ch
+}
+
+// waitChan is WaitChan that also reports whether the limiter is still open
+func (rl *RateLimiter) waitChan() (chan struct{}, bool) {
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	ch := make(chan struct{})
+	now := rl.clock.Now()
+	rl.resetIfExpiredLocked(now)
+	if rl.closed || rl.hasRoomLocked() {
+		close(ch)
+		return ch, !rl.closed
+	}
+	rl.notify = append(rl.notify, ch)
+	rl.armResetTimerLocked(now)
+	return ch, true
+}
+
+// TryAcquireWithin takes a token, waiting up to d for one if necessary. It
+// sleeps on WaitChan rather than polling and, unlike WaitTimeout, doesn't
+// join the Acquire queue: each wakeup is just another TryAcquire, so it
+// suits call sites that can afford a short wait but not a place in line.
+// It gives up at once if the limiter is closed.
+func (rl *RateLimiter) TryAcquireWithin(d time.Duration) bool {
+	if rl.TryAcquire() {
+		return true
+	}
+	if d <= 0 {
+		return false
+	}
+
+	deadline := make(chan struct{})
+	timer := rl.clock.AfterFunc(d, func() { close(deadline) })
+	defer timer.Stop()
+
+	for {
+		ch, open := rl.waitChan()
+		if !open {
+			return false
+		}
+		select {
+		case <-ch:
+			if rl.TryAcquire() {
+				return true
+			}
+		case <-deadline:
+			rl.dropNotify(ch)
+			return false
+		}
+	}
+}
+
+// dropNotify forgets a WaitChan channel nobody waits on any more
+func (rl *RateLimiter) dropNotify(ch chan struct{}) {
+	rl.lock()
+	defer rl.unlock()
+
+	for i, c := range rl.notify {
+		if c == ch {
+			rl.notify = append(rl.notify[:i], rl.notify[i+1:]...)
+			return
+		}
+	}
+}
+
+// hasRoomLocked reports whether TryAcquire could take a token right now
+func (rl *RateLimiter) hasRoomLocked() bool {
+	switch rl.mode {
+	case ModePaused:
+		return false
+	case ModeBypass:
+		return true
+	}
+	return rl.waiters.Len() == 0 && rl.currRequests < rl.allowance
+}
+
+// notifyLocked closes the channels handed out by WaitChan once there is
+// room, or unconditionally when the limiter is closed
+func (rl *RateLimiter) notifyLocked() {
+	if len(rl.notify) == 0 || !rl.closed && !rl.hasRoomLocked() {
+		return
+	}
+	for _, ch := range rl.notify {
+		close(ch)
+	}
+	rl.notify = nil
+}
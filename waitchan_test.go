@@ -0,0 +1,217 @@
+// waitchan_test.go
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestWaitChanSignalsOnRelease(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 60, WithLimiterClock(clock))
+	limiter.TryAcquire()
+
+	ch := limiter.WaitChan()
+	other := limiter.WaitChan()
+	if ch == other {
+		t.Error("Expected a fresh channel per call")
+	}
+	if isClosed(ch) {
+		t.Fatal("Expected the channel to stay open while the limiter is full")
+	}
+
+	limiter.Release()
+	if !isClosed(ch) || !isClosed(other) {
+		t.Error("Expected Release to close every pending channel")
+	}
+	if !limiter.TryAcquire() {
+		t.Error("Expected the signalled capacity to be available")
+	}
+}
+
+func TestWaitChanSignalsOnWindowReset(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 60, WithLimiterClock(clock))
+	limiter.TryAcquire()
+
+	ch := limiter.WaitChan()
+	clock.Advance(59 * time.Second)
+	if isClosed(ch) {
+		t.Fatal("Expected the channel to stay open before the window ends")
+	}
+	clock.Advance(time.Second)
+	if !isClosed(ch) {
+		t.Error("Expected the window reset to close the channel")
+	}
+}
+
+func TestWaitChanAfterMissedReset(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 60, WithLimiterClock(clock))
+	limiter.TryAcquire()
+	if limiter.TryAcquire() {
+		t.Fatal("Expected the limiter to be full")
+	}
+
+	// The window ends after the failed TryAcquire but before WaitChan, with
+	// no timer armed to notice
+	clock.Advance(time.Minute)
+	if !isClosed(limiter.WaitChan()) {
+		t.Error("Expected WaitChan to report the capacity the reset freed")
+	}
+}
+
+func TestWaitChanRace(t *testing.T) {
+	// An event loop that only ever waits on WaitChan must never miss a
+	// wakeup, however the window resets interleave with it
+	limiter := NewRateLimiterDuration(1, time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for acquired := 0; acquired < 20; {
+				if limiter.TryAcquire() {
+					acquired++
+					continue
+				}
+				select {
+				case <-limiter.WaitChan():
+				case <-time.After(time.Second):
+					t.Error("Expected WaitChan to wake the loop")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWaitChanClose(t *testing.T) {
+	limiter := NewRateLimiter(1, 60)
+	limiter.TryAcquire()
+
+	ch := limiter.WaitChan()
+	limiter.Close()
+	if !isClosed(ch) {
+		t.Error("Expected Close to close pending channels")
+	}
+	if !isClosed(limiter.WaitChan()) {
+		t.Error("Expected WaitChan on a closed limiter to return a closed channel")
+	}
+	if limiter.resetTimer != nil {
+		t.Error("Expected no reset timer once closed")
+	}
+}
+
+func TestTryAcquireWithinWindowReset(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 60, WithLimiterClock(clock))
+	limiter.TryAcquire()
+
+	got := make(chan bool)
+	go func() { got <- limiter.TryAcquireWithin(2 * time.Minute) }()
+
+	// The deadline and the window reset timers are both pending
+	clock.BlockUntil(2)
+	clock.Advance(time.Minute)
+	if !<-got {
+		t.Error("Expected the window reset during the wait to grant a token")
+	}
+	if n := len(clock.pending); n != 0 {
+		t.Errorf("Expected the deadline timer to be stopped, %d timers pending", n)
+	}
+}
+
+func TestTryAcquireWithinTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 60, WithLimiterClock(clock))
+	limiter.TryAcquire()
+
+	got := make(chan bool)
+	go func() { got <- limiter.TryAcquireWithin(20 * time.Millisecond) }()
+	clock.BlockUntil(2)
+	clock.Advance(20 * time.Millisecond)
+	if <-got {
+		t.Error("Expected no token within 20ms")
+	}
+
+	limiter.mu.Lock()
+	notify := len(limiter.notify)
+	limiter.mu.Unlock()
+	if notify != 0 {
+		t.Errorf("Expected the timed out wait to drop its channel, %d left", notify)
+	}
+}
+
+func TestTryAcquireWithinRelease(t *testing.T) {
+	limiter := NewRateLimiter(1, 60)
+	limiter.TryAcquire()
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		limiter.Release()
+	}()
+	if !limiter.TryAcquireWithin(time.Second) {
+		t.Error("Expected the release to wake the wait")
+	}
+
+	limiter.Close()
+	start := time.Now()
+	if limiter.TryAcquireWithin(time.Second) || time.Since(start) > 100*time.Millisecond {
+		t.Error("Expected a closed limiter to fail straight away")
+	}
+}
+
+// The benchmarks measure how long a waiter takes to notice a released
+// token, reported as wake-ns/op. The sleep loop is what a call site without
+// TryAcquireWithin would do, polling every millisecond.
+func benchmarkWake(b *testing.B, wait func(*RateLimiter) bool) {
+	limiter := NewRateLimiter(1, 3600)
+	limiter.TryAcquire()
+
+	var total time.Duration
+	for i := 0; i < b.N; i++ {
+		acquired := make(chan time.Time)
+		go func() {
+			if !wait(limiter) {
+				b.Error("Expected the waiter to get the released token")
+			}
+			acquired <- time.Now()
+		}()
+		time.Sleep(500 * time.Microsecond)
+		released := time.Now()
+		limiter.Release()
+		total += (<-acquired).Sub(released)
+	}
+	b.ReportMetric(float64(total.Nanoseconds())/float64(b.N), "wake-ns/op")
+}
+
+func BenchmarkTryAcquireWithin(b *testing.B) {
+	benchmarkWake(b, func(rl *RateLimiter) bool {
+		return rl.TryAcquireWithin(20 * time.Millisecond)
+	})
+}
+
+func BenchmarkSleepLoop(b *testing.B) {
+	benchmarkWake(b, func(rl *RateLimiter) bool {
+		for deadline := time.Now().Add(20 * time.Millisecond); time.Now().Before(deadline); {
+			if rl.TryAcquire() {
+				return true
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return false
+	})
+}
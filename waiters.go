@@ -0,0 +1,242 @@
+// waiters.go
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"time"
+)
+
+// Priority orders blocked acquirers when the limiter is saturated
+type Priority int
+
+// Priority levels, lowest first
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	PriorityCritical
+)
+
+// ErrQueueFull is returned by Acquire when WithMaxWaiters' limit on queued
+// callers is reached
+var ErrQueueFull = errors.New("rate limiter: waiter queue full")
+
+// defaultPriorityAging is how long a waiter must wait to be promoted one
+// priority level
+const defaultPriorityAging = 5 * time.Second
+
+// WithPriorityAging sets how long a blocked acquirer waits before being
+// promoted one priority level, so low-priority work is never starved.
+// Zero disables aging.
+func WithPriorityAging(d time.Duration) LimiterOption {
+	return func(rl *RateLimiter) {
+		rl.priorityAging = d
+	}
+}
+
+// WithMaxWaiters caps how many callers can be blocked in Acquire at once.
+// Past the cap Acquire fails straight away with ErrQueueFull, counted as a
+// denial, instead of queueing, so overload can't pile up goroutines
+// without bound. Zero, the default, means no cap.
+func WithMaxWaiters(n int) LimiterOption {
+	return func(rl *RateLimiter) {
+		rl.maxWaiters = n
+	}
+}
+
+// waiter is a goroutine blocked in AcquireCost. Tokens are handed to the
+// highest priority waiter, oldest first among equals: dispatchLocked
+// charges the window on the waiter's behalf and then closes ready.
+type waiter struct {
+	cost     int
+	priority Priority
+	since    time.Time
+	ready    chan struct{}
+	granted  bool
+	epoch    uint64 // window the tokens were charged to, once granted
+	err      error  // set instead of granting when the limiter is closed or paused
+}
+
+// AcquireCost blocks until cost tokens are available or ctx is done. A cost
+// that no window could ever grant fails immediately with
+// ErrCostExceedsLimit rather than waiting forever.
+func (rl *RateLimiter) AcquireCost(ctx context.Context, cost int) error {
+	_, err := rl.acquire(ctx, cost, PriorityNormal)
+	return err
+}
+
+// AcquirePriority blocks like Acquire, but when the limiter is saturated
+// higher priority callers are served before lower ones. Waiters gain a
+// level for every aging interval they spend queued.
+func (rl *RateLimiter) AcquirePriority(ctx context.Context, priority Priority) error {
+	if priority < PriorityLow {
+		priority = PriorityLow
+	}
+	if priority > PriorityCritical {
+		priority = PriorityCritical
+	}
+	_, err := rl.acquire(ctx, 1, priority)
+	return err
+}
+
+// acquire blocks until cost tokens are granted, by the shared window too if
+// there is one, and returns the window they were charged to. Tokens the
+// shared window refuses are given back and asked for again once it resets;
+// a store that can't be reached fails the call unless it fails open.
+func (rl *RateLimiter) acquire(ctx context.Context, cost int, priority Priority) (uint64, error) {
+	for {
+		epoch, err := rl.acquireLocal(ctx, cost, priority)
+		if err != nil {
+			return 0, err
+		}
+		ok, err := rl.commitShared(cost, epoch, true)
+		rl.fireEvents()
+		if ok {
+			return epoch, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		rl.lock()
+		_, wait := rl.sharedLeftLocked(rl.clock.Now())
+		rl.unlock()
+		select {
+		case <-rl.clock.After(wait):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// acquireLocal blocks until cost tokens are granted by the local window
+func (rl *RateLimiter) acquireLocal(ctx context.Context, cost int, priority Priority) (epoch uint64, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// Set once the caller has to queue; the wait is recorded on the
+	// caller's span after the lock is released
+	var queued time.Time
+	defer func() {
+		if !queued.IsZero() {
+			recordWait(ctx, rl.clock.Now().Sub(queued), err)
+		}
+	}()
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	if err := rl.unavailableLocked(); err != nil {
+		return 0, err
+	}
+	if err := rl.checkCostLocked(cost); err != nil {
+		return 0, err
+	}
+	now := rl.clock.Now()
+	if rl.tryAcquireLocked(now, cost) {
+		return rl.epoch, nil
+	}
+	if rl.maxWaiters > 0 && rl.waiters.Len() >= rl.maxWaiters {
+		rl.denied++
+		rl.queueEventLocked(limiterEvent{now: now, current: rl.currRequests, max: rl.allowance})
+		return 0, ErrQueueFull
+	}
+
+	w := &waiter{cost: cost, priority: priority, since: now, ready: make(chan struct{})}
+	elem := rl.waiters.PushBack(w)
+	rl.armResetTimerLocked(now)
+	queued = now
+
+	rl.unlock()
+	select {
+	case <-w.ready:
+		rl.lock()
+		return w.epoch, w.err
+	case <-ctx.Done():
+		rl.lock()
+	}
+
+	if w.err != nil {
+		// Close or Pause already took the waiter off the queue
+		return 0, w.err
+	}
+	if w.granted {
+		// The tokens were handed over as we gave up; give them back to
+		// whichever window they were granted in
+		rl.releaseEpochLocked(w.cost, w.epoch)
+	} else {
+		rl.waiters.Remove(elem)
+	}
+	// Either way the queue may now be able to move
+	rl.dispatchLocked(rl.clock.Now())
+	return 0, ctx.Err()
+}
+
+// dispatchLocked hands tokens to queued waiters, best first, until the next
+// one doesn't fit, then makes sure a reset will wake the rest
+func (rl *RateLimiter) dispatchLocked(now time.Time) {
+	rl.resetIfExpiredLocked(now)
+	if rl.mode == ModePaused {
+		return
+	}
+
+	for next := rl.nextWaiterLocked(now); next != nil; next = rl.nextWaiterLocked(now) {
+		w := next.Value.(*waiter)
+		if rl.mode != ModeBypass && rl.currRequests+w.cost > rl.allowance {
+			break
+		}
+		if left, _ := rl.sharedLeftLocked(now); rl.mode != ModeBypass && w.cost > left {
+			break
+		}
+		rl.currRequests += w.cost
+		rl.held += w.cost
+		rl.acquired++
+		w.granted = true
+		w.epoch = rl.epoch
+		rl.waiters.Remove(next)
+		close(w.ready)
+	}
+	rl.notifyLocked()
+	rl.armResetTimerLocked(now)
+}
+
+// nextWaiterLocked picks the waiter with the highest aged priority. The
+// queue is in arrival order, so the first of equals is the oldest.
+func (rl *RateLimiter) nextWaiterLocked(now time.Time) *list.Element {
+	var best *list.Element
+	var bestPriority Priority
+	for e := rl.waiters.Front(); e != nil; e = e.Next() {
+		w := e.Value.(*waiter)
+		p := w.priority
+		if rl.priorityAging > 0 {
+			p += Priority(now.Sub(w.since) / rl.priorityAging)
+		}
+		if best == nil || p > bestPriority {
+			best, bestPriority = e, p
+		}
+	}
+	return best
+}
+
+// armResetTimerLocked schedules a dispatch for the end of the current window
+// while there are goroutines or WaitChan channels waiting for it
+func (rl *RateLimiter) armResetTimerLocked(now time.Time) {
+	if rl.closed || rl.resetTimer != nil || rl.waiters.Len() == 0 && len(rl.notify) == 0 {
+		return
+	}
+	until := rl.windowStartLocked(now).Add(rl.window).Sub(now)
+	rl.resetTimer = rl.clock.AfterFunc(until, rl.onWindowReset)
+}
+
+// onWindowReset hands the fresh window's tokens to the queue
+func (rl *RateLimiter) onWindowReset() {
+	defer rl.fireEvents()
+	rl.lock()
+	defer rl.unlock()
+
+	rl.resetTimer = nil
+	rl.dispatchLocked(rl.clock.Now())
+}
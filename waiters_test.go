@@ -0,0 +1,223 @@
+// waiters_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAcquireFIFO(t *testing.T) {
+	const n = 50
+	limiter := NewRateLimiter(1, 60)
+	limiter.TryAcquire()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var order []int
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if err := limiter.Acquire(context.Background()); err != nil {
+				t.Errorf("Waiter %d: %v", id, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, id)
+			mu.Unlock()
+			limiter.Release()
+		}(i)
+		waitForWaiters(limiter, i+1)
+	}
+
+	limiter.Release()
+	wg.Wait()
+
+	if len(order) != n {
+		t.Fatalf("Expected %d waiters to complete, got %d", n, len(order))
+	}
+	for i, id := range order {
+		if id != i {
+			t.Fatalf("Expected waiters to complete in submission order, got %v", order)
+		}
+	}
+}
+
+func TestAcquireNoBarging(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 1, WithLimiterClock(clock))
+	limiter.TryAcquire()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- limiter.Acquire(context.Background())
+	}()
+	waitForWaiters(limiter, 1)
+
+	// A newcomer must not take the token the waiter is queued for
+	limiter.Release()
+	if limiter.TryAcquire() {
+		t.Error("TryAcquire should not jump ahead of a queued waiter")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("The queued waiter should get the released token, got %v", err)
+	}
+
+	// Tokens freed by a window reset go to the queue first as well
+	go func() {
+		done <- limiter.Acquire(context.Background())
+	}()
+	waitForWaiters(limiter, 1)
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("The queued waiter should get the reset window's token, got %v", err)
+	}
+	if limiter.TryAcquire() {
+		t.Error("The reset window's only token should have gone to the waiter")
+	}
+}
+
+func TestAcquireCancelledWaiterUnblocksQueue(t *testing.T) {
+	limiter := NewRateLimiter(10, 60)
+	limiter.TryAcquireCost(5)
+
+	// A large request at the front blocks a small one behind it
+	ctx, cancel := context.WithCancel(context.Background())
+	big := make(chan error, 1)
+	go func() {
+		big <- limiter.AcquireCost(ctx, 10)
+	}()
+	waitForWaiters(limiter, 1)
+
+	small := make(chan error, 1)
+	go func() {
+		small <- limiter.AcquireCost(context.Background(), 3)
+	}()
+	waitForWaiters(limiter, 2)
+
+	cancel()
+	<-big
+	if err := <-small; err != nil {
+		t.Errorf("The small request should proceed once the big one gives up, got %v", err)
+	}
+}
+
+func TestAcquirePriority(t *testing.T) {
+	limiter := NewRateLimiter(1, 60)
+	limiter.TryAcquire()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var order []Priority
+
+	queue := func(p Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := limiter.AcquirePriority(context.Background(), p); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, p)
+			mu.Unlock()
+			limiter.Release()
+		}()
+	}
+
+	// Bulk jobs queue first, then health checks and admin traffic arrive
+	queued := 0
+	for _, p := range []Priority{PriorityLow, PriorityLow, PriorityNormal, PriorityCritical, PriorityHigh} {
+		queue(p)
+		queued++
+		waitForWaiters(limiter, queued)
+	}
+
+	limiter.Release()
+	wg.Wait()
+
+	want := []Priority{PriorityCritical, PriorityHigh, PriorityNormal, PriorityLow, PriorityLow}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("Expected completion order %v, got %v", want, order)
+		}
+	}
+}
+
+func TestAcquirePriorityAging(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(1, 3600, WithLimiterClock(clock), WithPriorityAging(time.Second))
+	limiter.TryAcquire()
+
+	low := make(chan error, 1)
+	go func() {
+		low <- limiter.AcquirePriority(context.Background(), PriorityLow)
+	}()
+	waitForWaiters(limiter, 1)
+
+	// After three aging intervals the low waiter has climbed to critical
+	// and, being older, beats a newly arrived critical waiter
+	clock.Advance(3 * time.Second)
+	critical := make(chan error, 1)
+	go func() {
+		critical <- limiter.AcquirePriority(context.Background(), PriorityCritical)
+	}()
+	waitForWaiters(limiter, 2)
+
+	limiter.Release()
+	if err := <-low; err != nil {
+		t.Fatalf("The aged low-priority waiter should run first, got %v", err)
+	}
+	select {
+	case <-critical:
+		t.Fatal("The critical waiter should still be queued")
+	default:
+	}
+
+	limiter.Release()
+	if err := <-critical; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAcquireMaxWaiters(t *testing.T) {
+	const maxWaiters = 3
+	clock := NewFakeClock(time.Now())
+	limiter := NewRateLimiter(maxWaiters, 60, WithLimiterClock(clock), WithMaxWaiters(maxWaiters))
+	limiter.TryAcquireN(maxWaiters)
+
+	errs := make(chan error, maxWaiters)
+	for i := 0; i < maxWaiters; i++ {
+		go func() { errs <- limiter.Acquire(context.Background()) }()
+	}
+	waitForWaiters(limiter, maxWaiters)
+
+	if stats := limiter.Stats(); stats.Waiters != maxWaiters {
+		t.Errorf("Expected Stats to report %d waiters, got %d", maxWaiters, stats.Waiters)
+	}
+
+	// The queue is full, so the next caller returns without blocking
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := limiter.Acquire(ctx); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull past the cap, got %v", err)
+	}
+	if stats := limiter.Stats(); stats.Denied != 1 || stats.Waiters != maxWaiters {
+		t.Errorf("Expected one denial and the queue untouched, got %+v", stats)
+	}
+
+	// The waiters that did queue are all served by the reset
+	clock.Advance(time.Minute)
+	for i := 0; i < maxWaiters; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Expected queued waiter to be granted, got %v", err)
+		}
+	}
+	if stats := limiter.Stats(); stats.Waiters != 0 {
+		t.Errorf("Expected an empty queue, got %d waiters", stats.Waiters)
+	}
+}